@@ -0,0 +1,172 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/rakyll/go-sql-driver-spanner/internal"
+	"google.golang.org/api/option"
+	"google.golang.org/api/transport"
+)
+
+// AuditEntry records a DDL or DML statement that a connection
+// executed, see Driver.OnAudit.
+type AuditEntry struct {
+	// Database is the name of the database.
+	Database string
+
+	// SQL is the statement with its literals replaced by ?, and
+	// Params are the names of its query parameters. The values of
+	// the parameters are not recorded.
+	SQL    string
+	Params []string
+
+	// StatementType is ddl or dml.
+	StatementType string
+
+	// Identity is the service account of the credentials of the
+	// client, if it is known, and DatabaseRole the fine-grained
+	// access control role that the client assumes, if any.
+	Identity     string
+	DatabaseRole string
+
+	// CommitTimestamp is the commit timestamp of the transaction
+	// of a DML statement. It is zero for DDL statements and for
+	// statements that failed.
+	CommitTimestamp time.Time
+
+	// Err is the error of the statement, or ErrNotCommitted if its
+	// transaction was rolled back or failed to commit.
+	Err error
+}
+
+// ErrNotCommitted is the error of the audit entries of DML
+// statements whose transaction did not commit.
+var ErrNotCommitted = errors.New("the transaction of the statement did not commit")
+
+// auditEntries returns the entries of the DDL and DML
+// statements of query, if statements are audited.
+func (c *conn) auditEntries(query string) []AuditEntry {
+	if c.onAudit == nil {
+		return nil
+	}
+	p := parseStatement(query)
+	if p.clientSide != nil {
+		return nil
+	}
+	var entries []AuditEntry
+	for _, q := range p.statements {
+		p := parseStatement(q)
+		if p.typ != internal.StatementTypeDDL && p.typ != internal.StatementTypeDML {
+			continue
+		}
+		var params []string
+		for _, name := range p.params {
+			if !slices.Contains(params, name) {
+				params = append(params, name)
+			}
+		}
+		e := AuditEntry{
+			Database:      c.name,
+			SQL:           internal.RedactLiterals(q),
+			Params:        params,
+			StatementType: strings.ToLower(p.typ.String()),
+		}
+		if c.shared != nil {
+			e.Identity, e.DatabaseRole = c.shared.identity, c.shared.key.driver.Config.DatabaseRole
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// audit records the DDL and DML statements of query, which
+// returned err. DML statements in transactions and statements in
+// batches are recorded once their transaction or batch has ended.
+func (c *conn) audit(query string, err error) {
+	entries := c.auditEntries(query)
+	if len(entries) == 0 {
+		return
+	}
+	if err != nil {
+		c.emitAudit(entries, nil, err)
+		return
+	}
+	switch {
+	case c.ddlBatch != nil:
+		c.ddlBatch.audit = append(c.ddlBatch.audit, entries...)
+	case c.dmlBatch() != nil:
+		b := c.dmlBatch()
+		b.audit = append(b.audit, entries...)
+	case c.rwTx != nil:
+		c.rwTx.audit = append(c.rwTx.audit, entries...)
+	default:
+		c.emitAudit(entries, c.commitResp, nil)
+	}
+}
+
+// auditBatch records the statements of a DML batch that ran with
+// err, once their transaction has ended if the batch ran in one.
+func (c *conn) auditBatch(entries []AuditEntry, err error) {
+	if err == nil && c.rwTx != nil {
+		c.rwTx.audit = append(c.rwTx.audit, entries...)
+		return
+	}
+	c.emitAudit(entries, c.commitResp, err)
+}
+
+// emitAudit passes entries to the OnAudit callback of the driver
+// with the commit timestamp of resp, or with err. DML statements
+// without a commit response did not commit.
+func (c *conn) emitAudit(entries []AuditEntry, resp *spanner.CommitResponse, err error) {
+	for _, e := range entries {
+		switch {
+		case err != nil:
+			e.Err = err
+		case e.StatementType == "dml" && resp == nil:
+			e.Err = ErrNotCommitted
+		case e.StatementType == "dml":
+			e.CommitTimestamp = resp.CommitTs
+		}
+		c.onAudit(e)
+	}
+}
+
+// credentialsIdentity returns the service account of the credentials
+// that the client options select, or "" if they have none or the
+// client connects to the emulator.
+func credentialsIdentity(ctx context.Context, opts []option.ClientOption) string {
+	if _, ok := os.LookupEnv("SPANNER_EMULATOR_HOST"); ok {
+		return ""
+	}
+	opts = append([]option.ClientOption{option.WithScopes(spanner.Scope)}, opts...)
+	creds, err := transport.Creds(ctx, opts...)
+	if err != nil || len(creds.JSON) == 0 {
+		return ""
+	}
+	var f struct {
+		ClientEmail string `json:"client_email"`
+	}
+	json.Unmarshal(creds.JSON, &f)
+	return f.ClientEmail
+}
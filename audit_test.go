@@ -0,0 +1,91 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+func TestAudit(t *testing.T) {
+	var entries []AuditEntry
+	c := &conn{name: "projects/p/instances/i/databases/d", onAudit: func(e AuditEntry) {
+		entries = append(entries, e)
+	}}
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	c.commitResp = &spanner.CommitResponse{CommitTs: ts}
+
+	c.audit("SELECT * FROM Singers", nil)
+	c.audit("UPDATE Singers SET Name = 'Alice' WHERE Id = @id OR Id = @id", nil)
+	c.audit("CREATE TABLE T (Id INT64) PRIMARY KEY (Id)", nil)
+	failed := errors.New("failed")
+	c.audit("DELETE FROM Singers WHERE Id = 1", failed)
+
+	want := []AuditEntry{
+		{
+			Database:        c.name,
+			SQL:             "UPDATE Singers SET Name = ? WHERE Id = @id OR Id = @id",
+			Params:          []string{"id"},
+			StatementType:   "dml",
+			CommitTimestamp: ts,
+		},
+		{Database: c.name, SQL: "CREATE TABLE T (Id INT64) PRIMARY KEY (Id)", StatementType: "ddl"},
+		{Database: c.name, SQL: "DELETE FROM Singers WHERE Id = ?", StatementType: "dml", Err: failed},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("got entries\n%+v\nwant\n%+v", entries, want)
+	}
+}
+
+func TestAuditTransaction(t *testing.T) {
+	var entries []AuditEntry
+	c := &conn{onAudit: func(e AuditEntry) {
+		entries = append(entries, e)
+	}}
+	tx := &rwTx{}
+	c.rwTx = tx
+	c.audit("INSERT INTO Singers (Id) VALUES (1)", nil)
+	tx.savepoint("s")
+	c.audit("INSERT INTO Singers (Id) VALUES (2)", nil)
+	if err := tx.rollbackToSavepoint(context.Background(), "s"); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 || len(tx.audit) != 1 {
+		t.Fatalf("got entries %+v and pending entries %+v, want one pending entry", entries, tx.audit)
+	}
+
+	c.rwTx = nil
+	c.emitAudit(tx.audit, nil, nil)
+	if len(entries) != 1 || entries[0].Err != ErrNotCommitted {
+		t.Errorf("got entries %+v, want an entry that did not commit", entries)
+	}
+}
+
+func TestAuditBatch(t *testing.T) {
+	var entries []AuditEntry
+	c := &conn{onAudit: func(e AuditEntry) {
+		entries = append(entries, e)
+	}}
+	c.ddlBatch = &ddlBatch{}
+	c.audit("CREATE TABLE T (Id INT64) PRIMARY KEY (Id); CREATE INDEX I ON T (Id)", nil)
+	if len(entries) != 0 || len(c.ddlBatch.audit) != 2 {
+		t.Fatalf("got entries %+v and batch entries %+v, want two batch entries", entries, c.ddlBatch.audit)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Backup describes a backup of a database.
+type Backup struct {
+	// Name is the fully qualified name of the backup:
+	// projects/P/instances/I/backups/B.
+	Name string
+	// Database is the fully qualified name of the
+	// database that the backup was created from.
+	Database string
+	// Ready is set once the backup can be restored.
+	Ready bool
+
+	// VersionTime is the time at which the backup
+	// is a consistent copy of the database.
+	VersionTime time.Time
+	CreateTime  time.Time
+	ExpireTime  time.Time
+	SizeBytes   int64
+}
+
+// CreateBackup creates a backup with the given id of the database of
+// db in the same instance, and waits for it to complete. The backup
+// is deleted by Spanner at expireTime.
+func CreateBackup(ctx context.Context, db *sql.DB, backupID string, expireTime time.Time) (Backup, error) {
+	var b Backup
+	err := withConn(ctx, db, func(c *conn) error {
+		var err error
+		b, err = c.createBackup(ctx, backupID, expireTime)
+		return err
+	})
+	return b, err
+}
+
+// Backups lists the backups of the database of db.
+func Backups(ctx context.Context, db *sql.DB) ([]Backup, error) {
+	var backups []Backup
+	err := withConn(ctx, db, func(c *conn) error {
+		var err error
+		backups, err = c.backups(ctx)
+		return err
+	})
+	return backups, err
+}
+
+// RestoreDatabase restores the backup with the given id to a new
+// database with the given id in the instance of db, and waits
+// until the database can be used.
+func RestoreDatabase(ctx context.Context, db *sql.DB, backupID, databaseID string) error {
+	return withConn(ctx, db, func(c *conn) error {
+		return c.restoreDatabase(ctx, backupID, databaseID)
+	})
+}
+
+func (c *conn) createBackup(ctx context.Context, backupID string, expireTime time.Time) (Backup, error) {
+	op, err := c.adminClient.CreateBackup(ctx, &adminpb.CreateBackupRequest{
+		Parent:   c.instanceName(),
+		BackupId: backupID,
+		Backup: &adminpb.Backup{
+			Database:   c.name,
+			ExpireTime: timestamppb.New(expireTime),
+		},
+	})
+	if err != nil {
+		return Backup{}, err
+	}
+	b, err := op.Wait(ctx)
+	if err != nil {
+		return Backup{}, err
+	}
+	return backupFromProto(b), nil
+}
+
+func (c *conn) backups(ctx context.Context) ([]Backup, error) {
+	it := c.adminClient.ListBackups(ctx, &adminpb.ListBackupsRequest{
+		Parent: c.instanceName(),
+		Filter: "database:" + c.name,
+	})
+	var backups []Backup
+	for {
+		b, err := it.Next()
+		if err == iterator.Done {
+			return backups, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The filter matches database names that
+		// start with the name of this database.
+		if b.Database == c.name {
+			backups = append(backups, backupFromProto(b))
+		}
+	}
+}
+
+func (c *conn) restoreDatabase(ctx context.Context, backupID, databaseID string) error {
+	op, err := c.adminClient.RestoreDatabase(ctx, &adminpb.RestoreDatabaseRequest{
+		Parent:     c.instanceName(),
+		DatabaseId: databaseID,
+		Source:     &adminpb.RestoreDatabaseRequest_Backup{Backup: c.backupName(backupID)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = op.Wait(ctx)
+	return err
+}
+
+// backupName returns the fully qualified name of the backup
+// with the given id in the instance of the connection.
+func (c *conn) backupName(backupID string) string {
+	if strings.Contains(backupID, "/backups/") {
+		return backupID
+	}
+	return c.instanceName() + "/backups/" + backupID
+}
+
+func backupFromProto(b *adminpb.Backup) Backup {
+	return Backup{
+		Name:        b.Name,
+		Database:    b.Database,
+		Ready:       b.State == adminpb.Backup_READY,
+		VersionTime: protoTime(b.VersionTime),
+		CreateTime:  protoTime(b.CreateTime),
+		ExpireTime:  protoTime(b.ExpireTime),
+		SizeBytes:   b.SizeBytes,
+	}
+}
+
+// protoTime converts ts to a time.Time, and nil to the zero time.
+func protoTime(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
@@ -0,0 +1,51 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"testing"
+	"time"
+
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestBackupName(t *testing.T) {
+	c := &conn{name: "projects/p/instances/i/databases/d"}
+	if got, want := c.backupName("b1"), "projects/p/instances/i/backups/b1"; got != want {
+		t.Errorf("backupName: got %q, want %q", got, want)
+	}
+	other := "projects/p/instances/other/backups/b2"
+	if got := c.backupName(other); got != other {
+		t.Errorf("backupName: got %q, want %q", got, other)
+	}
+}
+
+func TestBackupFromProto(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	b := backupFromProto(&adminpb.Backup{
+		Name:       "projects/p/instances/i/backups/b1",
+		Database:   "projects/p/instances/i/databases/d",
+		State:      adminpb.Backup_READY,
+		CreateTime: timestamppb.New(created),
+		SizeBytes:  42,
+	})
+	if !b.Ready || !b.CreateTime.Equal(created) || b.SizeBytes != 42 {
+		t.Errorf("unexpected backup %+v", b)
+	}
+	if !b.ExpireTime.IsZero() {
+		t.Errorf("ExpireTime: got %v, want zero time", b.ExpireTime)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/spanner"
+	"github.com/rakyll/go-sql-driver-spanner/internal"
+)
+
+// dmlBatch buffers DML statements that are
+// sent to Spanner in one BatchUpdate call.
+type dmlBatch struct {
+	statements []spanner.Statement
+	// audit are the audit entries of the statements.
+	audit []AuditEntry
+}
+
+var errNoBatch = errors.New("there is no active DML batch")
+
+// dmlBatch returns the active DML batch of the current
+// transaction or of the connection, or nil.
+func (c *conn) dmlBatch() *dmlBatch {
+	if c.rwTx != nil {
+		return c.rwTx.batch
+	}
+	return c.batch
+}
+
+func (c *conn) StartBatchDML() error {
+	if c.roTx != nil {
+		return errors.New("DML batches are not supported in read-only transactions")
+	}
+	if c.dmlBatch() != nil || c.ddlBatch != nil {
+		return errors.New("a batch is already active")
+	}
+	if c.rwTx != nil {
+		c.rwTx.batch = &dmlBatch{}
+	} else {
+		c.batch = &dmlBatch{}
+	}
+	return nil
+}
+
+func (c *conn) RunBatch(ctx context.Context) ([]int64, error) {
+	if b := c.ddlBatch; b != nil {
+		c.ddlBatch = nil
+		if len(b.statements) == 0 {
+			return nil, nil
+		}
+		_, err := c.execDDL(ctx, b.statements, b.protoDescriptors)
+		c.emitAudit(b.audit, nil, err)
+		return nil, err
+	}
+	b := c.dmlBatch()
+	if b == nil {
+		return nil, errNoBatch
+	}
+	c.AbortBatch()
+	if len(b.statements) == 0 {
+		return nil, nil
+	}
+	var counts []int64
+	var err error
+	if c.rwTx != nil {
+		counts, err = c.rwTx.BatchUpdate(ctx, b.statements)
+	} else {
+		counts, err = c.execBatchInNewRWTransaction(ctx, b.statements)
+	}
+	c.auditBatch(b.audit, err)
+	return counts, err
+}
+
+func (c *conn) AbortBatch() error {
+	if c.ddlBatch != nil {
+		c.ddlBatch = nil
+		return nil
+	}
+	if c.dmlBatch() == nil {
+		return errNoBatch
+	}
+	if c.rwTx != nil {
+		c.rwTx.batch = nil
+	} else {
+		c.batch = nil
+	}
+	return nil
+}
+
+// execDMLStatements executes the semicolon-separated DML statements
+// of query in one BatchUpdate call and reports the total number of
+// affected rows. queries are the statements of query. Each statement
+// gets the arguments that it references.
+func (c *conn) execDMLStatements(ctx context.Context, query string, queries []string, args []driver.NamedValue) (driver.Result, error) {
+	if c.roTx != nil {
+		return nil, errors.New("cannot write in read-only transaction")
+	}
+	all, err := c.prepareSpannerStmt(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	statements := make([]spanner.Statement, len(queries))
+	for i, q := range queries {
+		p, err := c.parse(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		if p.clientSide != nil || p.typ != internal.StatementTypeDML {
+			return nil, fmt.Errorf("only DML or only DDL statements can be combined in one statement, got %q", q)
+		}
+		statements[i] = spanner.NewStatement(q)
+		for _, name := range p.params {
+			if v, ok := all.Params[name]; ok {
+				statements[i].Params[name] = v
+			}
+		}
+	}
+
+	if b := c.dmlBatch(); b != nil {
+		b.statements = append(b.statements, statements...)
+		return &result{rowsAffected: 0}, nil
+	}
+	var counts []int64
+	if c.rwTx != nil {
+		counts, err = c.rwTx.BatchUpdate(ctx, statements)
+	} else {
+		counts, err = c.execBatchInNewRWTransaction(ctx, statements)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, n := range counts {
+		total += n
+	}
+	return &result{rowsAffected: total}, nil
+}
+
+func (c *conn) execBatchInNewRWTransaction(ctx context.Context, statements []spanner.Statement) ([]int64, error) {
+	var counts []int64
+	err := c.runInNewRWTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		var err error
+		counts, err = tx.BatchUpdate(ctx, statements)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// BatchUpdate executes the statements in one round trip.
+// The statements that were executed successfully are
+// replayed after a rollback to a savepoint.
+func (tx *rwTx) BatchUpdate(ctx context.Context, statements []spanner.Statement) ([]int64, error) {
+	if tx.err != nil {
+		return nil, tx.err
+	}
+	msg, err := exchange(tx, tx.connector.BatchIn, tx.connector.BatchOut, &internal.RWBatchMessage{
+		Ctx:   ctx,
+		Stmts: statements,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Spanner returns the counts of the statements that
+	// succeeded before the first failed statement.
+	for i, n := range msg.Counts {
+		tx.statements = append(tx.statements, statements[i])
+		tx.counts = append(tx.counts, n)
+	}
+	return msg.Counts, msg.Error
+}
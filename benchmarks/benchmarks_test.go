@@ -0,0 +1,250 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package benchmarks
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+)
+
+const table = "BenchmarkSingers"
+
+// env is the database of the benchmarks, which is
+// opened once for all of them.
+var env struct {
+	db     *sql.DB
+	client *spanner.Client
+	rows   int64
+	err    error
+}
+
+var nextID atomic.Int64
+
+// setup opens the database, creates the table and inserts the rows
+// that are read, unless they exist from an earlier run.
+func setup(b *testing.B) (*sql.DB, *spanner.Client, int64) {
+	name, ok := os.LookupEnv("SPANNER_BENCHMARK_DATABASE")
+	if !ok {
+		b.Skip("SPANNER_BENCHMARK_DATABASE is not set")
+	}
+	if env.db != nil || env.err != nil {
+		if env.err != nil {
+			b.Fatal(env.err)
+		}
+		return env.db, env.client, env.rows
+	}
+	env.err = func() error {
+		env.rows = 1000
+		if v, ok := os.LookupEnv("SPANNER_BENCHMARK_ROWS"); ok {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid SPANNER_BENCHMARK_ROWS %q", v)
+			}
+			env.rows = n
+		}
+		ctx := context.Background()
+		db, err := sql.Open("spanner", name+";createIfNotExists=true")
+		if err != nil {
+			return err
+		}
+		env.db = db
+		if err := spannerdriver.ExecDDL(ctx, db, "CREATE TABLE IF NOT EXISTS "+table+
+			" (SingerId INT64 NOT NULL, Name STRING(MAX), Rating FLOAT64) PRIMARY KEY (SingerId)"); err != nil {
+			return err
+		}
+		if env.client, err = spanner.NewClient(ctx, name); err != nil {
+			return err
+		}
+		if _, err := env.client.Apply(ctx, []*spanner.Mutation{spanner.Delete(table, spanner.AllKeys())}); err != nil {
+			return err
+		}
+		for start := int64(0); start < env.rows; start += 1000 {
+			var ms []*spanner.Mutation
+			for id := start; id < min(start+1000, env.rows); id++ {
+				ms = append(ms, spanner.Insert(table, []string{"SingerId", "Name", "Rating"}, []interface{}{id, fmt.Sprintf("singer-%d", id), rand.Float64()}))
+			}
+			if _, err := env.client.Apply(ctx, ms); err != nil {
+				return err
+			}
+		}
+		// Written rows get IDs after the rows that are read.
+		nextID.Store(env.rows)
+		return nil
+	}()
+	if env.err != nil {
+		b.Fatal(env.err)
+	}
+	return env.db, env.client, env.rows
+}
+
+func BenchmarkPointRead(b *testing.B) {
+	db, client, rows := setup(b)
+	ctx := context.Background()
+	query := "SELECT Name FROM " + table + " WHERE SingerId = @id"
+	b.Run("driver", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var name string
+			if err := db.QueryRowContext(ctx, query, int64(i)%rows).Scan(&name); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("client", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			stmt := spanner.Statement{SQL: query, Params: map[string]interface{}{"id": int64(i) % rows}}
+			it := client.Single().Query(ctx, stmt)
+			row, err := it.Next()
+			if err != nil {
+				b.Fatal(err)
+			}
+			var name string
+			if err := row.Column(0, &name); err != nil {
+				b.Fatal(err)
+			}
+			it.Stop()
+		}
+	})
+}
+
+func BenchmarkScan(b *testing.B) {
+	db, client, rows := setup(b)
+	ctx := context.Background()
+	query := "SELECT SingerId, Name, Rating FROM " + table
+	b.Run("driver", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			r, err := db.QueryContext(ctx, query)
+			if err != nil {
+				b.Fatal(err)
+			}
+			var n int64
+			for r.Next() {
+				var id int64
+				var name string
+				var rating float64
+				if err := r.Scan(&id, &name, &rating); err != nil {
+					b.Fatal(err)
+				}
+				n++
+			}
+			if err := r.Err(); err != nil || n != rows {
+				b.Fatalf("read %d rows, %v", n, err)
+			}
+			r.Close()
+		}
+	})
+	b.Run("client", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var n int64
+			err := client.Single().Query(ctx, spanner.NewStatement(query)).Do(func(row *spanner.Row) error {
+				var id int64
+				var name string
+				var rating float64
+				n++
+				return row.Columns(&id, &name, &rating)
+			})
+			if err != nil || n != rows {
+				b.Fatalf("read %d rows, %v", n, err)
+			}
+		}
+	})
+}
+
+func BenchmarkInsert(b *testing.B) {
+	db, client, _ := setup(b)
+	ctx := context.Background()
+	dml := "INSERT INTO " + table + " (SingerId, Name, Rating) VALUES (@id, @name, @rating)"
+	b.Run("driver", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			id := nextID.Add(1)
+			if _, err := db.ExecContext(ctx, dml, id, "name", 1.0); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("client", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			stmt := spanner.Statement{SQL: dml, Params: map[string]interface{}{"id": nextID.Add(1), "name": "name", "rating": 1.0}}
+			_, err := client.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+				_, err := tx.Update(ctx, stmt)
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkTransaction reads a row and updates it
+// in a read-write transaction.
+func BenchmarkTransaction(b *testing.B) {
+	db, client, rows := setup(b)
+	ctx := context.Background()
+	query := "SELECT Rating FROM " + table + " WHERE SingerId = @id"
+	dml := "UPDATE " + table + " SET Rating = @rating WHERE SingerId = @id"
+	b.Run("driver", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			id := int64(i) % rows
+			tx, err := db.BeginTx(ctx, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			var rating float64
+			if err := tx.QueryRowContext(ctx, query, id).Scan(&rating); err != nil {
+				tx.Rollback()
+				b.Fatal(err)
+			}
+			if _, err := tx.ExecContext(ctx, dml, rating+1, id); err != nil {
+				tx.Rollback()
+				b.Fatal(err)
+			}
+			if err := tx.Commit(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("client", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			id := int64(i) % rows
+			_, err := client.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+				var rating float64
+				stmt := spanner.Statement{SQL: query, Params: map[string]interface{}{"id": id}}
+				it := tx.Query(ctx, stmt)
+				defer it.Stop()
+				row, err := it.Next()
+				if err != nil {
+					return err
+				}
+				if err := row.Column(0, &rating); err != nil {
+					return err
+				}
+				_, err = tx.Update(ctx, spanner.Statement{SQL: dml, Params: map[string]interface{}{"id": id, "rating": rating + 1}})
+				return err
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
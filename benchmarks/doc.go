@@ -0,0 +1,29 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package benchmarks contains benchmarks of the driver against the
+// Cloud Spanner emulator or a real instance. Each benchmark runs the
+// same work through database/sql and through the Spanner client, so
+// that the overhead of the driver can be compared.
+//
+// The benchmarks are skipped unless SPANNER_BENCHMARK_DATABASE names
+// the database to use. It is created if it doesn't exist:
+//
+//	export SPANNER_EMULATOR_HOST=localhost:9010
+//	export SPANNER_BENCHMARK_DATABASE=projects/p/instances/i/databases/bench
+//	go test ./benchmarks -bench . -benchmem
+//
+// SPANNER_BENCHMARK_ROWS is the number of rows of the table that is
+// read, 1000 by default. Use benchstat to compare runs.
+package benchmarks
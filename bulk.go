@@ -0,0 +1,304 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+)
+
+// BulkWriterOptions configures a BulkWriter.
+type BulkWriterOptions struct {
+	// MaxMutations is the maximum number of column values that are
+	// committed at once. Spanner limits a commit to 80,000 mutations,
+	// which includes the changes to secondary indexes, so lower it
+	// for tables with indexes. The default is 80,000.
+	MaxMutations int
+
+	// MaxBytes is the estimated maximum size of a commit. Spanner
+	// limits a commit to 100 MB. The default is 90 MB.
+	MaxBytes int
+
+	// Parallelism is the number of commits that run at the
+	// same time. The default is 4.
+	Parallelism int
+
+	// InsertOrUpdate writes rows with InsertOrUpdate mutations
+	// instead of Insert mutations, so that existing rows are
+	// updated instead of failing the batch.
+	InsertOrUpdate bool
+}
+
+// BatchError is the error of a batch of rows that BulkWriter failed
+// to commit. None of the rows of the batch were written.
+type BatchError struct {
+	// FirstRow is the index of the first row of the batch in
+	// the order in which the rows were written, starting at 0.
+	FirstRow int
+	// Rows is the number of rows in the batch.
+	Rows int
+
+	Err error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("rows %d to %d: %v", e.FirstRow, e.FirstRow+e.Rows-1, e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+// BulkWriter loads rows into a table. It batches the rows into
+// mutations that stay within the limits of a Spanner commit and
+// commits the batches in parallel. Each batch is committed
+// atomically, but batches are independent of each other.
+//
+//	w := spannerdriver.NewBulkWriter(ctx, db, "Singers", spannerdriver.BulkWriterOptions{})
+//	for _, s := range singers {
+//		if err := w.Write(s); err != nil {
+//			...
+//		}
+//	}
+//	err := w.Close()
+type BulkWriter struct {
+	ctx   context.Context
+	table string
+	opts  BulkWriterOptions
+	apply func(context.Context, []*spanner.Mutation) error
+
+	mu        sync.Mutex
+	closed    bool
+	rows      int // number of rows written
+	pending   bulkBatch
+	mutations int // number of column values in pending
+	bytes     int // estimated size of pending
+
+	batches chan bulkBatch
+	wg      sync.WaitGroup
+
+	errMu sync.Mutex
+	errs  []*BatchError
+}
+
+type bulkBatch struct {
+	firstRow  int
+	mutations []*spanner.Mutation
+}
+
+// NewBulkWriter returns a BulkWriter that writes rows to table in db.
+// Commits use ctx. The BulkWriter must be closed to commit the last
+// batch.
+func NewBulkWriter(ctx context.Context, db *sql.DB, table string, opts BulkWriterOptions) *BulkWriter {
+	return newBulkWriter(ctx, table, opts, func(ctx context.Context, ms []*spanner.Mutation) error {
+		_, err := Apply(ctx, db, ms)
+		return err
+	})
+}
+
+func newBulkWriter(ctx context.Context, table string, opts BulkWriterOptions, apply func(context.Context, []*spanner.Mutation) error) *BulkWriter {
+	if opts.MaxMutations <= 0 {
+		opts.MaxMutations = 80000
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = 90 << 20
+	}
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = 4
+	}
+	w := &BulkWriter{
+		ctx:     ctx,
+		table:   table,
+		opts:    opts,
+		apply:   apply,
+		batches: make(chan bulkBatch),
+	}
+	w.wg.Add(opts.Parallelism)
+	for i := 0; i < opts.Parallelism; i++ {
+		go w.commitBatches()
+	}
+	return w
+}
+
+func (w *BulkWriter) commitBatches() {
+	defer w.wg.Done()
+	for b := range w.batches {
+		if err := w.apply(w.ctx, b.mutations); err != nil {
+			w.errMu.Lock()
+			w.errs = append(w.errs, &BatchError{FirstRow: b.firstRow, Rows: len(b.mutations), Err: err})
+			w.errMu.Unlock()
+		}
+	}
+}
+
+// Write adds a row to the current batch. A row is either a struct,
+// or a pointer to a struct, whose fields are mapped to columns like
+// spanner.InsertStruct does, or a map[string]interface{} from column
+// names to values. Write blocks while all commits are busy.
+func (w *BulkWriter) Write(row interface{}) error {
+	m, columns, size, err := w.mutation(row)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return errors.New("BulkWriter is closed")
+	}
+	if len(w.pending.mutations) > 0 && (w.mutations+columns > w.opts.MaxMutations || w.bytes+size > w.opts.MaxBytes) {
+		w.flushLocked()
+	}
+	if len(w.pending.mutations) == 0 {
+		w.pending.firstRow = w.rows
+	}
+	w.pending.mutations = append(w.pending.mutations, m)
+	w.mutations += columns
+	w.bytes += size
+	w.rows++
+	return nil
+}
+
+// Flush commits the current batch without waiting for the commit.
+func (w *BulkWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.closed {
+		w.flushLocked()
+	}
+}
+
+func (w *BulkWriter) flushLocked() {
+	if len(w.pending.mutations) == 0 {
+		return
+	}
+	w.batches <- w.pending
+	w.pending = bulkBatch{}
+	w.mutations, w.bytes = 0, 0
+}
+
+// Close commits the last batch and waits for all commits. It returns
+// the errors of the batches that failed, joined with errors.Join.
+func (w *BulkWriter) Close() error {
+	w.mu.Lock()
+	if !w.closed {
+		w.flushLocked()
+		w.closed = true
+		close(w.batches)
+	}
+	w.mu.Unlock()
+	w.wg.Wait()
+
+	var errs []error
+	for _, e := range w.Errors() {
+		errs = append(errs, e)
+	}
+	return errors.Join(errs...)
+}
+
+// Errors returns the errors of the batches that failed so far.
+func (w *BulkWriter) Errors() []*BatchError {
+	w.errMu.Lock()
+	defer w.errMu.Unlock()
+	return append([]*BatchError(nil), w.errs...)
+}
+
+// mutation returns the mutation for row with its number
+// of columns and its estimated size in bytes.
+func (w *BulkWriter) mutation(row interface{}) (*spanner.Mutation, int, int, error) {
+	if m, ok := row.(map[string]interface{}); ok {
+		size := 0
+		for col, v := range m {
+			size += len(col) + estimateSize(reflect.ValueOf(v))
+		}
+		if w.opts.InsertOrUpdate {
+			return spanner.InsertOrUpdateMap(w.table, m), len(m), size, nil
+		}
+		return spanner.InsertMap(w.table, m), len(m), size, nil
+	}
+
+	v := reflect.ValueOf(row)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, 0, 0, fmt.Errorf("cannot write %T, expected a struct or a map[string]interface{}", row)
+	}
+	columns, size := 0, 0
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if f.PkgPath != "" || strings.Split(f.Tag.Get("spanner"), ",")[0] == "-" {
+			continue // Not a column.
+		}
+		columns++
+		size += len(f.Name) + estimateSize(v.Field(i))
+	}
+	var m *spanner.Mutation
+	var err error
+	if w.opts.InsertOrUpdate {
+		m, err = spanner.InsertOrUpdateStruct(w.table, row)
+	} else {
+		m, err = spanner.InsertStruct(w.table, row)
+	}
+	return m, columns, size, err
+}
+
+// estimateSize estimates the number of bytes that
+// a value takes up in a commit request.
+func estimateSize(v reflect.Value) int {
+	switch v.Kind() {
+	case reflect.Invalid:
+		return 0
+	case reflect.String:
+		return v.Len()
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return estimateSize(v.Elem())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Len()
+		}
+		size := 0
+		for i := 0; i < v.Len(); i++ {
+			size += estimateSize(v.Index(i))
+		}
+		return size
+	case reflect.Struct:
+		// Null types such as spanner.NullString have exported
+		// fields. Types such as time.Time and big.Rat don't.
+		size, exported := 0, false
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" {
+				size += estimateSize(v.Field(i))
+				exported = true
+			}
+		}
+		if !exported {
+			return 16
+		}
+		return size
+	default:
+		return 8
+	}
+}
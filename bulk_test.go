@@ -0,0 +1,89 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+type singer struct {
+	SingerID int64  `spanner:"SingerId"`
+	Name     string `spanner:"Name"`
+	Birth    time.Time
+	ignored  int
+	Comment  string `spanner:"-"`
+}
+
+func TestBulkWriter(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	failed := errors.New("commit failed")
+	apply := func(ctx context.Context, ms []*spanner.Mutation) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sizes = append(sizes, len(ms))
+		if len(sizes) == 1 {
+			return failed
+		}
+		return nil
+	}
+	// Every row has 3 columns, so batches hold 3 rows.
+	w := newBulkWriter(context.Background(), "Singers", BulkWriterOptions{MaxMutations: 10, Parallelism: 1}, apply)
+	for i := 0; i < 7; i++ {
+		if err := w.Write(&singer{SingerID: int64(i), Name: "a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Write(map[string]interface{}{"SingerId": 7, "Name": "b"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(42); err == nil {
+		t.Error("wrote an int")
+	}
+	err := w.Close()
+	if !errors.Is(err, failed) {
+		t.Errorf("want commit error, got %v", err)
+	}
+	if err := w.Write(singer{}); err == nil {
+		t.Error("wrote to a closed BulkWriter")
+	}
+
+	sort.Ints(sizes)
+	if want := []int{2, 3, 3}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("want batches of %v rows, got %v", want, sizes)
+	}
+	errs := w.Errors()
+	if len(errs) != 1 || errs[0].FirstRow != 0 || errs[0].Rows != 3 {
+		t.Errorf("want error for rows 0 to 2, got %v", errs)
+	}
+
+	// A single row that is over the limits is committed on its own.
+	sizes = nil
+	w = newBulkWriter(context.Background(), "Singers", BulkWriterOptions{MaxBytes: 1}, apply)
+	w.Write(singer{Name: "a long name"})
+	w.Write(singer{Name: "another long name"})
+	w.Close()
+	if want := []int{1, 1}; !reflect.DeepEqual(sizes, want) {
+		t.Errorf("want batches of %v rows, got %v", want, sizes)
+	}
+}
@@ -0,0 +1,301 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	adminapi "cloud.google.com/go/spanner/admin/database/apiv1"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/keepalive"
+)
+
+// sharedClient is the Spanner client, and with it the session pool
+// and gRPC channels, that all connections to a database share.
+type sharedClient struct {
+	key         clientKey
+	client      *spanner.Client
+	adminClient *adminapi.DatabaseAdminClient
+	stats       *transportStats
+	refs        int // number of open connections
+
+	// external is set for the client of OpenDBFromClient,
+	// which the application closes.
+	external bool
+
+	// dialect is the SQL dialect of the database. Unless the DSN
+	// sets it, it is detected by the first statement.
+	dialectMu sync.Mutex
+	dialect   adminpb.DatabaseDialect
+
+	// identity is the service account of the
+	// client in audit entries, if it is known.
+	identity string
+
+	// config and channels describe the client, see GetPoolStats.
+	config   PoolConfig
+	channels int
+
+	// broken is set when the client can no longer be used. The
+	// connections that use it are then discarded by database/sql.
+	broken atomic.Bool
+	// expires is when the client is replaced because of
+	// sessionMaxAge, or zero.
+	expires time.Time
+}
+
+// expired reports whether the client is older than sessionMaxAge.
+// New connections then create a new client with new sessions, and
+// database/sql discards the connections that use the old one.
+func (sc *sharedClient) expired(now time.Time) bool {
+	return !sc.expires.IsZero() && now.After(sc.expires)
+}
+
+// retire stops sharing the client with new connections. It
+// is closed when the connections that use it are closed.
+func (sc *sharedClient) retire() {
+	clients.Lock()
+	defer clients.Unlock()
+	if clients.m[sc.key] == sc {
+		delete(clients.m, sc.key)
+	}
+}
+
+// clientKey identifies the clients of a database. Drivers with
+// different configurations don't share clients.
+type clientKey struct {
+	driver      *Driver
+	name        string
+	compression string
+	keepalive   keepalive.ClientParameters
+	maxAge      time.Duration
+
+	endToEndTracing bool
+
+	// client is the client of OpenDBFromClient.
+	client *spanner.Client
+}
+
+// clients are the shared clients. The lock is only held to look up
+// and publish clients: the client of a key is created without it, and
+// the connections that need it meanwhile wait for the pending entry.
+var clients = struct {
+	sync.Mutex
+	m       map[clientKey]*sharedClient
+	pending map[clientKey]chan struct{}
+}{m: make(map[clientKey]*sharedClient), pending: make(map[clientKey]chan struct{})}
+
+// OpenDBFromClient returns a database that executes statements
+// with client, for applications that already configured a client,
+// e.g. with custom credentials. The connections of the database share
+// the client, and closing the database doesn't close it. The client
+// must not be closed before the database.
+//
+// DDL statements and other administrative operations use a database
+// admin client that is created like for databases that are opened
+// with sql.Open. The transport statistics of the connections are
+// empty, because the driver doesn't see the RPCs of the client.
+func OpenDBFromClient(client *spanner.Client) (*sql.DB, error) {
+	return (&Driver{}).OpenDBFromClient(client)
+}
+
+// OpenDBFromClient is like the OpenDBFromClient function, and
+// configures the connections with the fields of d that don't
+// configure the client, such as Hooks and Logger. It returns an
+// error if the fields of d are invalid.
+func (d *Driver) OpenDBFromClient(client *spanner.Client) (*sql.DB, error) {
+	c, err := d.OpenConnector(client.DatabaseName())
+	if err != nil {
+		return nil, err
+	}
+	c.(*connector).client = client
+	return sql.OpenDB(c), nil
+}
+
+// acquireClient returns the shared client of the database of the
+// connector, and creates it for the first connection. Each call
+// must be paired with a call to release.
+func (c *connector) acquireClient(ctx context.Context) (*sharedClient, error) {
+	key := clientKey{driver: c.driver, name: c.config.name, compression: c.compression, keepalive: c.keepalive, maxAge: c.sessionMaxAge, endToEndTracing: c.endToEndTracing, client: c.client}
+	for {
+		clients.Lock()
+		if sc, ok := clients.m[key]; ok && !sc.expired(time.Now()) {
+			sc.refs++
+			clients.Unlock()
+			return sc, nil
+		}
+		done, ok := clients.pending[key]
+		if !ok {
+			break // Unlocked below.
+		}
+		clients.Unlock()
+		// Another connection is creating the client. If it
+		// fails, the next connection to get here tries again.
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	// An expired client is closed by its last connection.
+	delete(clients.m, key)
+	done := make(chan struct{})
+	clients.pending[key] = done
+	clients.Unlock()
+
+	sc, err := c.newSharedClient(ctx, key)
+	clients.Lock()
+	delete(clients.pending, key)
+	if err == nil {
+		clients.m[key] = sc
+	}
+	clients.Unlock()
+	close(done)
+	return sc, err
+}
+
+// newSharedClient creates the client of key, with a reference for
+// the connection that creates it.
+func (c *connector) newSharedClient(ctx context.Context, key clientKey) (*sharedClient, error) {
+	d := c.driver
+	adminClient, err := createAdminClient(ctx)
+	if err != nil {
+		return nil, newConfigError(c.config.name, err)
+	}
+	if c.client != nil {
+		return &sharedClient{key: key, client: c.client, adminClient: adminClient, stats: &transportStats{metrics: c.metrics}, refs: 1, dialect: c.dialect, external: true}, nil
+	}
+	if err := c.ensureDatabase(ctx, adminClient); err != nil {
+		adminClient.Close()
+		return nil, newConfigError(c.config.name, err)
+	}
+	stats := &transportStats{metrics: c.metrics}
+	opts := append([]option.ClientOption{}, d.Options...)
+	opts = append(opts, option.WithUserAgent(userAgent))
+	opts = append(opts, stats.clientOptions()...)
+	if len(d.UnaryInterceptors) > 0 {
+		opts = append(opts, option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(d.UnaryInterceptors...)))
+	}
+	if len(d.StreamInterceptors) > 0 {
+		opts = append(opts, option.WithGRPCDialOption(grpc.WithChainStreamInterceptor(d.StreamInterceptors...)))
+	}
+	if c.keepalive.Time != 0 {
+		opts = append(opts, option.WithGRPCDialOption(grpc.WithKeepaliveParams(c.keepalive)))
+	}
+	config := d.Config
+	if config.OpenTelemetryMeterProvider == nil {
+		config.OpenTelemetryMeterProvider = d.MeterProvider
+	}
+	if c.compression != "" {
+		config.Compression = c.compression
+	}
+	if c.endToEndTracing {
+		config.EnableEndToEndTracing = true
+	}
+	if n := uint64(c.warmupSessions); n > config.SessionPoolConfig.MinOpened {
+		config.SessionPoolConfig.MinOpened = n
+	}
+	client, err := spanner.NewClientWithConfig(ctx, c.config.name, config, opts...)
+	if err != nil {
+		adminClient.Close()
+		return nil, newConfigError(c.config.name, err)
+	}
+	if err := warmup(ctx, &stats.sessions, c.warmupSessions); err != nil {
+		client.Close()
+		adminClient.Close()
+		return nil, newConfigError(c.config.name, err)
+	}
+	sc := &sharedClient{key: key, client: client, adminClient: adminClient, stats: stats, refs: 1, dialect: c.dialect}
+	sc.config, sc.channels = c.newPoolConfig(config)
+	if d.OnAudit != nil {
+		sc.identity = credentialsIdentity(ctx, d.Options)
+	}
+	if c.sessionMaxAge > 0 {
+		sc.expires = time.Now().Add(c.sessionMaxAge)
+	}
+	return sc, nil
+}
+
+// release closes the client when the last
+// connection that uses it is closed.
+func (sc *sharedClient) release() {
+	clients.Lock()
+	sc.refs--
+	last := sc.refs == 0
+	if last && clients.m[sc.key] == sc {
+		delete(clients.m, sc.key)
+	}
+	clients.Unlock()
+	if last {
+		if !sc.external {
+			sc.client.Close()
+		}
+		sc.adminClient.Close()
+	}
+}
+
+// checkBroken marks the client as broken if err shows that its
+// gRPC channels are shut down or its sessions are gone. The client
+// is no longer shared with new connections, which create a new one.
+func (sc *sharedClient) checkBroken(err error) {
+	if err == nil || sc == nil || !isBrokenClient(err) {
+		return
+	}
+	if !sc.broken.Swap(true) {
+		sc.retire()
+	}
+}
+
+// isBrokenClient reports whether err is caused by a client that
+// can't execute any more statements, rather than by the statement.
+// Sessions that are not found are replaced by the session pool, so
+// they don't break the client.
+func isBrokenClient(err error) bool {
+	if errors.Is(err, grpc.ErrClientConnClosing) {
+		return true
+	}
+	return spanner.ErrCode(err) == codes.InvalidArgument && spanner.ErrDesc(err) == "invalid session pool"
+}
+
+// warmup waits until the session pool, whose MinOpened is at least
+// n, has created n sessions. The pool creates them in the background
+// with BatchCreateSessions, which also connects its gRPC channels.
+// Queries and multiplexed sessions don't take sessions from the pool,
+// so they can't warm it up.
+func warmup(ctx context.Context, stats *sessionStats, n int) error {
+	t := time.NewTicker(10 * time.Millisecond)
+	defer t.Stop()
+	for stats.pooled.Load() < int64(n) {
+		if err := stats.creationErr.Load(); err != nil {
+			return fmt.Errorf("warming up sessions: %w", *err)
+		}
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return fmt.Errorf("warming up sessions: %w", ctx.Err())
+		}
+	}
+	return nil
+}
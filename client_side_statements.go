@@ -0,0 +1,267 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/rakyll/go-sql-driver-spanner/internal"
+)
+
+// clientSideStatement is a statement that is handled
+// by the driver instead of being sent to Spanner.
+type clientSideStatement struct {
+	name string
+	re   *regexp.Regexp
+
+	// exec executes the statement with the submatches of re.
+	exec func(ctx context.Context, c *conn, params []string) (driver.Result, error)
+
+	// query executes statements that return rows, such as SHOW.
+	query func(ctx context.Context, c *conn, params []string) (driver.Rows, error)
+}
+
+var clientSideStatements = []*clientSideStatement{
+	{
+		name: "SET READ_ONLY_STALENESS",
+		re:   regexp.MustCompile(`(?is)^\s*SET\s+(?:SESSION\s+)?(?:SPANNER\.)?READ_ONLY_STALENESS(?:\s*=\s*|\s+TO\s+)'([^']*)'\s*;?\s*$`),
+		exec: func(ctx context.Context, c *conn, params []string) (driver.Result, error) {
+			st, err := parseStaleness(params[0])
+			if err != nil {
+				return nil, err
+			}
+			return &result{}, c.setReadOnlyStaleness(st)
+		},
+	},
+	{
+		name: "RESET READ_ONLY_STALENESS",
+		re:   regexp.MustCompile(`(?is)^\s*(?:RESET\s+(?:SPANNER\.)?READ_ONLY_STALENESS|SET\s+(?:SESSION\s+)?(?:SPANNER\.)?READ_ONLY_STALENESS(?:\s*=\s*|\s+TO\s+)DEFAULT)\s*;?\s*$`),
+		exec: func(ctx context.Context, c *conn, params []string) (driver.Result, error) {
+			return &result{}, c.setReadOnlyStaleness(c.defaultReadOnlyStaleness)
+		},
+	},
+	{
+		name: "SHOW READ_ONLY_STALENESS",
+		re:   regexp.MustCompile(`(?is)^\s*SHOW\s+(?:VARIABLE\s+)?((?:SPANNER\.)?READ_ONLY_STALENESS)\s*;?\s*$`),
+		query: func(ctx context.Context, c *conn, params []string) (driver.Rows, error) {
+			col := strings.ToUpper(params[0])
+			if strings.HasPrefix(col, "SPANNER.") {
+				// PostgreSQL style settings are lower case.
+				col = strings.ToLower(col)
+			}
+			return &staticRows{
+				cols:   []string{col},
+				values: [][]driver.Value{{c.readOnlyStaleness.spec}},
+			}, nil
+		},
+	},
+	{
+		name: "BEGIN",
+		re:   regexp.MustCompile(`(?is)^\s*(?:BEGIN(?:\s+TRANSACTION)?|START\s+TRANSACTION)(?:\s+(READ\s+ONLY|READ\s+WRITE))?\s*;?\s*$`),
+		exec: func(ctx context.Context, c *conn, params []string) (driver.Result, error) {
+			readOnly := strings.EqualFold(strings.Join(strings.Fields(params[0]), " "), "READ ONLY")
+			// The transaction outlives the statement, so it must
+			// not be canceled together with the statement context.
+			tx, err := c.BeginTx(context.WithoutCancel(ctx), driver.TxOptions{ReadOnly: readOnly})
+			if err != nil {
+				return nil, err
+			}
+			c.stmtTx = tx
+			return &result{}, nil
+		},
+	},
+	{
+		name: "COMMIT",
+		re:   regexp.MustCompile(`(?is)^\s*COMMIT(?:\s+TRANSACTION)?\s*;?\s*$`),
+		exec: func(ctx context.Context, c *conn, params []string) (driver.Result, error) {
+			tx, err := c.statementTransaction()
+			if err != nil {
+				return nil, err
+			}
+			// The transaction has ended even if Commit failed.
+			c.stmtTx = nil
+			if err := tx.Commit(); err != nil {
+				return nil, err
+			}
+			return &result{}, nil
+		},
+	},
+	{
+		name: "ROLLBACK",
+		re:   regexp.MustCompile(`(?is)^\s*ROLLBACK(?:\s+TRANSACTION)?\s*;?\s*$`),
+		exec: func(ctx context.Context, c *conn, params []string) (driver.Result, error) {
+			tx, err := c.statementTransaction()
+			if err != nil {
+				return nil, err
+			}
+			// The transaction has ended even if Rollback failed.
+			c.stmtTx = nil
+			if err := tx.Rollback(); err != nil {
+				return nil, err
+			}
+			return &result{}, nil
+		},
+	},
+	{
+		name: "SAVEPOINT",
+		re:   regexp.MustCompile(`(?is)^\s*SAVEPOINT\s+(\w+)\s*;?\s*$`),
+		exec: func(ctx context.Context, c *conn, params []string) (driver.Result, error) {
+			if c.roTx != nil {
+				// Read-only transactions have nothing to roll back.
+				return &result{}, nil
+			}
+			if c.rwTx == nil {
+				return nil, errSavepointOutsideTransaction
+			}
+			c.rwTx.savepoint(params[0])
+			return &result{}, nil
+		},
+	},
+	{
+		name: "ROLLBACK TO SAVEPOINT",
+		re:   regexp.MustCompile(`(?is)^\s*ROLLBACK\s+(?:TRANSACTION\s+)?TO\s+(?:SAVEPOINT\s+)?(\w+)\s*;?\s*$`),
+		exec: func(ctx context.Context, c *conn, params []string) (driver.Result, error) {
+			if c.roTx != nil {
+				return &result{}, nil
+			}
+			if c.rwTx == nil {
+				return nil, errSavepointOutsideTransaction
+			}
+			return &result{}, c.rwTx.rollbackToSavepoint(ctx, params[0])
+		},
+	},
+	{
+		name: "RELEASE SAVEPOINT",
+		re:   regexp.MustCompile(`(?is)^\s*RELEASE\s+(?:SAVEPOINT\s+)?(\w+)\s*;?\s*$`),
+		exec: func(ctx context.Context, c *conn, params []string) (driver.Result, error) {
+			if c.roTx != nil {
+				return &result{}, nil
+			}
+			if c.rwTx == nil {
+				return nil, errSavepointOutsideTransaction
+			}
+			return &result{}, c.rwTx.releaseSavepoint(params[0])
+		},
+	},
+	{
+		name: "CREATE DATABASE",
+		re:   regexp.MustCompile("(?is)^\\s*CREATE\\s+DATABASE\\s+[`\"]?([a-z][a-z0-9_-]*)[`\"]?\\s*;?\\s*$"),
+		exec: func(ctx context.Context, c *conn, params []string) (driver.Result, error) {
+			// The database is created in the instance of the connection.
+			return &result{}, c.createDatabase(ctx, params[0])
+		},
+	},
+	{
+		name: "DROP DATABASE",
+		re:   regexp.MustCompile("(?is)^\\s*DROP\\s+DATABASE\\s+[`\"]?([a-z][a-z0-9_-]*)[`\"]?\\s*;?\\s*$"),
+		exec: func(ctx context.Context, c *conn, params []string) (driver.Result, error) {
+			return &result{}, c.dropDatabase(ctx, params[0])
+		},
+	},
+	{
+		name: "START BATCH DML",
+		re:   regexp.MustCompile(`(?is)^\s*START\s+BATCH\s+DML\s*;?\s*$`),
+		exec: func(ctx context.Context, c *conn, params []string) (driver.Result, error) {
+			return &result{}, c.StartBatchDML()
+		},
+	},
+	{
+		name: "START BATCH DDL",
+		re:   regexp.MustCompile(`(?is)^\s*START\s+BATCH\s+DDL\s*;?\s*$`),
+		exec: func(ctx context.Context, c *conn, params []string) (driver.Result, error) {
+			return &result{}, c.StartBatchDDL()
+		},
+	},
+	{
+		name: "RUN BATCH",
+		re:   regexp.MustCompile(`(?is)^\s*RUN\s+BATCH\s*;?\s*$`),
+		exec: func(ctx context.Context, c *conn, params []string) (driver.Result, error) {
+			counts, err := c.RunBatch(ctx)
+			if err != nil {
+				return nil, err
+			}
+			var total int64
+			for _, n := range counts {
+				total += n
+			}
+			return &result{rowsAffected: total}, nil
+		},
+	},
+	{
+		name: "ABORT BATCH",
+		re:   regexp.MustCompile(`(?is)^\s*ABORT\s+BATCH\s*;?\s*$`),
+		exec: func(ctx context.Context, c *conn, params []string) (driver.Result, error) {
+			return &result{}, c.AbortBatch()
+		},
+	},
+}
+
+// execClientSideQuery executes a client-side statement through
+// QueryContext. Statements that don't return rows return no rows.
+func (c *conn) execClientSideQuery(ctx context.Context, cs *clientSideStatement, params []string) (driver.Rows, error) {
+	if cs.query != nil {
+		return cs.query(ctx, c, params)
+	}
+	if _, err := cs.exec(ctx, c, params); err != nil {
+		return nil, err
+	}
+	return &staticRows{}, nil
+}
+
+func (c *conn) setReadOnlyStaleness(st staleness) error {
+	if c.roTx != nil {
+		return errors.New("cannot change the read-only staleness in a read-only transaction")
+	}
+	c.readOnlyStaleness = st
+	return nil
+}
+
+// statementTransaction returns the transaction that was
+// started with a BEGIN statement on the connection.
+func (c *conn) statementTransaction() (driver.Tx, error) {
+	if c.stmtTx != nil {
+		return c.stmtTx, nil
+	}
+	if c.InTransaction() {
+		return nil, errors.New("transactions that were started with BeginTx must be ended with Commit or Rollback")
+	}
+	return nil, errors.New("there is no active transaction")
+}
+
+var errSavepointOutsideTransaction = errors.New("savepoints can only be used in transactions")
+
+// parseClientSideStatement returns the client-side statement that
+// matches query and its parameters, or nil if there is none.
+// Comments in query are ignored.
+func parseClientSideStatement(query string) (*clientSideStatement, []string) {
+	p := parseStatement(query)
+	return p.clientSide, p.clientSideParams
+}
+
+// matchClientSideStatement is parseClientSideStatement
+// without the statement cache.
+func matchClientSideStatement(query string) (*clientSideStatement, []string) {
+	query = internal.StripComments(query)
+	for _, cs := range clientSideStatements {
+		if m := cs.re.FindStringSubmatch(query); m != nil {
+			return cs, m[1:]
+		}
+	}
+	return nil, nil
+}
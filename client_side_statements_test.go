@@ -0,0 +1,391 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestParseClientSideStatement(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		input      string
+		want       string
+		wantParams []string
+	}{
+		{
+			name:       "savepoint",
+			input:      `SAVEPOINT sp1`,
+			want:       "SAVEPOINT",
+			wantParams: []string{"sp1"},
+		},
+		{
+			name:       "rollback to savepoint, lower case",
+			input:      `  rollback to savepoint sp1;`,
+			want:       "ROLLBACK TO SAVEPOINT",
+			wantParams: []string{"sp1"},
+		},
+		{
+			name:       "rollback to",
+			input:      `ROLLBACK TO sp1`,
+			want:       "ROLLBACK TO SAVEPOINT",
+			wantParams: []string{"sp1"},
+		},
+		{
+			name:       "release savepoint",
+			input:      `RELEASE SAVEPOINT sp1`,
+			want:       "RELEASE SAVEPOINT",
+			wantParams: []string{"sp1"},
+		},
+		{
+			name:       "start batch dml",
+			input:      "start batch\n dml",
+			want:       "START BATCH DML",
+			wantParams: []string{},
+		},
+		{
+			name:       "run batch",
+			input:      `RUN BATCH;`,
+			want:       "RUN BATCH",
+			wantParams: []string{},
+		},
+		{
+			name:       "abort batch",
+			input:      `ABORT BATCH`,
+			want:       "ABORT BATCH",
+			wantParams: []string{},
+		},
+		{
+			name:       "begin",
+			input:      `BEGIN`,
+			want:       "BEGIN",
+			wantParams: []string{""},
+		},
+		{
+			name:       "begin transaction read only",
+			input:      "begin transaction read\tonly;",
+			want:       "BEGIN",
+			wantParams: []string{"read\tonly"},
+		},
+		{
+			name:       "start transaction",
+			input:      `START TRANSACTION READ WRITE`,
+			want:       "BEGIN",
+			wantParams: []string{"READ WRITE"},
+		},
+		{
+			name:       "commit",
+			input:      `COMMIT TRANSACTION`,
+			want:       "COMMIT",
+			wantParams: []string{},
+		},
+		{
+			name:       "rollback",
+			input:      `rollback;`,
+			want:       "ROLLBACK",
+			wantParams: []string{},
+		},
+		{
+			name:  "begin with unknown mode",
+			input: `BEGIN DEFERRED`,
+		},
+		{
+			name:  "savepoint without name",
+			input: `SAVEPOINT`,
+		},
+		{
+			name:       "start batch ddl",
+			input:      `start batch ddl;`,
+			want:       "START BATCH DDL",
+			wantParams: []string{},
+		},
+		{
+			name:       "create database",
+			input:      "CREATE DATABASE `my-db`;",
+			want:       "CREATE DATABASE",
+			wantParams: []string{"my-db"},
+		},
+		{
+			name:       "drop database, lower case",
+			input:      `drop database "orders_test"`,
+			want:       "DROP DATABASE",
+			wantParams: []string{"orders_test"},
+		},
+		{
+			name:  "create database with options",
+			input: `CREATE DATABASE db OPTIONS (x=1)`,
+		},
+		{
+			name:  "insert",
+			input: `INSERT INTO Savepoints (Name) VALUES ("SAVEPOINT sp1")`,
+		},
+		{
+			name:       "commented savepoint",
+			input:      "-- keep the state\n/* sp */ SAVEPOINT sp1",
+			want:       "SAVEPOINT",
+			wantParams: []string{"sp1"},
+		},
+	}
+
+	for _, tc := range tests {
+		cs, params := parseClientSideStatement(tc.input)
+		var got string
+		if cs != nil {
+			got = cs.name
+		}
+		if got != tc.want || !reflect.DeepEqual(params, tc.wantParams) {
+			t.Errorf("parseClientSideStatement test failed, %s: wanted %q %v got %q %v.", tc.name, tc.want, tc.wantParams, got, params)
+		}
+	}
+}
+
+func TestDMLBatch(t *testing.T) {
+	ctx := context.Background()
+	c := &conn{}
+
+	if _, err := c.RunBatch(ctx); err != errNoBatch {
+		t.Errorf("run without batch: want %v, got %v", errNoBatch, err)
+	}
+	if _, err := c.exec(ctx, "START BATCH DML", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.StartBatchDML(); err == nil {
+		t.Error("started a second batch")
+	}
+	for i := 0; i < 2; i++ {
+		res, err := c.exec(ctx, "UPDATE T SET V = @v WHERE TRUE", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := res.RowsAffected(); n != 0 {
+			t.Errorf("buffered statement affected %d rows", n)
+		}
+	}
+	if got := len(c.batch.statements); got != 2 {
+		t.Errorf("want 2 buffered statements, got %d", got)
+	}
+	if _, err := c.query(ctx, "SELECT 1", nil); err == nil {
+		t.Error("executed a query during a DML batch")
+	}
+	if _, err := c.exec(ctx, "ABORT BATCH", nil); err != nil {
+		t.Fatal(err)
+	}
+	if c.batch != nil {
+		t.Error("batch is still active after abort")
+	}
+}
+
+func TestDDLBatch(t *testing.T) {
+	ctx := context.Background()
+	c := &conn{}
+
+	if _, err := c.exec(ctx, "START BATCH DDL", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.StartBatchDML(); err == nil {
+		t.Error("started a DML batch during a DDL batch")
+	}
+	if _, err := c.exec(ctx, "CREATE TABLE A (Id INT64) PRIMARY KEY (Id)", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.exec(ctx, "CREATE INDEX AById ON A (Id); DROP TABLE B", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.exec(ctx, "UPDATE A SET Id = 1 WHERE TRUE", nil); err == nil {
+		t.Error("executed DML during a DDL batch")
+	}
+	want := []string{"CREATE TABLE A (Id INT64) PRIMARY KEY (Id)", "CREATE INDEX AById ON A (Id)", "DROP TABLE B"}
+	if !reflect.DeepEqual(c.ddlBatch.statements, want) {
+		t.Errorf("want %q, got %q", want, c.ddlBatch.statements)
+	}
+	if _, err := c.exec(ctx, "ABORT BATCH", nil); err != nil {
+		t.Fatal(err)
+	}
+	if c.ddlBatch != nil {
+		t.Error("batch is still active after abort")
+	}
+
+	c.rwTx = &rwTx{}
+	if err := c.StartBatchDDL(); err == nil {
+		t.Error("started a DDL batch in a transaction")
+	}
+}
+
+func TestMultipleDMLStatements(t *testing.T) {
+	ctx := context.Background()
+	c := &conn{}
+
+	if _, err := c.exec(ctx, "START BATCH DML", nil); err != nil {
+		t.Fatal(err)
+	}
+	args := []driver.NamedValue{{Ordinal: 1, Value: 1}, {Ordinal: 2, Value: "a;b"}}
+	if _, err := c.exec(ctx, "UPDATE T SET V = @v WHERE TRUE; UPDATE T SET S = @s WHERE S != ';';", args); err != nil {
+		t.Fatal(err)
+	}
+	want := []spanner.Statement{
+		{SQL: "UPDATE T SET V = @v WHERE TRUE", Params: map[string]interface{}{"v": 1}},
+		{SQL: "UPDATE T SET S = @s WHERE S != ';'", Params: map[string]interface{}{"s": "a;b"}},
+	}
+	if !reflect.DeepEqual(c.batch.statements, want) {
+		t.Errorf("want %v, got %v", want, c.batch.statements)
+	}
+	if _, err := c.exec(ctx, "UPDATE T SET V = 1 WHERE TRUE; CREATE TABLE U (Id INT64) PRIMARY KEY (Id)", nil); err == nil {
+		t.Error("combined DML and DDL: expected error")
+	}
+}
+
+func TestTransactionStatementsRequireBegin(t *testing.T) {
+	ctx := context.Background()
+
+	c := &conn{}
+	for _, stmt := range []string{"COMMIT", "ROLLBACK"} {
+		if _, err := c.exec(ctx, stmt, nil); err == nil {
+			t.Errorf("%s without transaction: expected error", stmt)
+		}
+	}
+
+	// Transactions started with BeginTx are ended by database/sql.
+	c.rwTx = &rwTx{}
+	for _, stmt := range []string{"COMMIT", "ROLLBACK"} {
+		if _, err := c.exec(ctx, stmt, nil); err == nil {
+			t.Errorf("%s in transaction started with BeginTx: expected error", stmt)
+		}
+	}
+	if _, err := c.exec(ctx, "BEGIN", nil); err == nil {
+		t.Error("BEGIN in transaction: expected error")
+	}
+}
+
+func TestFailedTransactionStatements(t *testing.T) {
+	ctx := context.Background()
+	for _, stmt := range []string{"COMMIT", "ROLLBACK"} {
+		c := &conn{stmtTx: &fakeTx{err: errors.New("session not found")}}
+		if _, err := c.exec(ctx, stmt, nil); err == nil {
+			t.Errorf("%s: expected error", stmt)
+		}
+		if c.stmtTx != nil {
+			t.Errorf("%s failed and left the transaction on the connection", stmt)
+		}
+	}
+}
+
+func TestReadOnlyStalenessStatements(t *testing.T) {
+	ctx := context.Background()
+	c := &conn{readOnlyStaleness: strongStaleness, defaultReadOnlyStaleness: strongStaleness}
+
+	show := func(query string) (string, string) {
+		rows, err := c.query(ctx, query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values := make([]driver.Value, 1)
+		if err := rows.Next(values); err != nil {
+			t.Fatal(err)
+		}
+		return rows.Columns()[0], values[0].(string)
+	}
+
+	if _, err := c.exec(ctx, "SET spanner.read_only_staleness TO 'MAX_STALENESS 10s'", nil); err != nil {
+		t.Fatal(err)
+	}
+	if col, v := show("SHOW spanner.read_only_staleness"); col != "spanner.read_only_staleness" || v != "MAX_STALENESS 10s" {
+		t.Errorf("got %s = %q", col, v)
+	}
+	if _, err := c.query(ctx, "SET READ_ONLY_STALENESS = 'EXACT_STALENESS 5s'", nil); err != nil {
+		t.Fatal(err)
+	}
+	if col, v := show("SHOW VARIABLE READ_ONLY_STALENESS"); col != "READ_ONLY_STALENESS" || v != "EXACT_STALENESS 5s" {
+		t.Errorf("got %s = %q", col, v)
+	}
+	if _, err := c.exec(ctx, "RESET spanner.read_only_staleness", nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, v := show("SHOW READ_ONLY_STALENESS"); v != "STRONG" {
+		t.Errorf("after reset: got %q", v)
+	}
+	if _, err := c.exec(ctx, "SET READ_ONLY_STALENESS = 'EVENTUAL'", nil); err == nil {
+		t.Error("invalid staleness: expected error")
+	}
+	if _, err := c.exec(ctx, "SHOW READ_ONLY_STALENESS", nil); err == nil {
+		t.Error("SHOW with ExecContext: expected error")
+	}
+}
+
+func TestBeginRequiresConn(t *testing.T) {
+	db := openFakeSpanner(t, &fakeSpanner{})
+	db.SetMaxOpenConns(1)
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, "BEGIN"); err != nil {
+		t.Fatal(err)
+	}
+	// The transaction was rolled back when the
+	// connection was returned to the pool.
+	if _, err := db.ExecContext(ctx, "COMMIT"); err == nil {
+		t.Error("COMMIT on a *sql.DB committed the transaction of an earlier BEGIN")
+	}
+}
+
+func TestDatabaseStatements(t *testing.T) {
+	admin := &fakeDatabaseAdmin{}
+	openFakeSpanner(t, &fakeSpanner{admin: admin, query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		// The database doesn't need to exist.
+		return status.Errorf(codes.NotFound, "Database not found: %s", req.GetSql())
+	}})
+	for _, tc := range []struct {
+		params      string
+		wantStmt    string
+		wantDialect adminpb.DatabaseDialect
+	}{
+		{"", "CREATE DATABASE `orders`", adminpb.DatabaseDialect_DATABASE_DIALECT_UNSPECIFIED},
+		{";dialect=postgresql", `CREATE DATABASE "orders"`, adminpb.DatabaseDialect_POSTGRESQL},
+	} {
+		admin.created, admin.dropped = nil, nil
+		d := &Driver{Config: spanner.ClientConfig{SessionPoolConfig: spanner.SessionPoolConfig{MinOpened: 0}}}
+		connector, err := d.OpenConnector("projects/p/instances/i/databases/d" + tc.params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		db := sql.OpenDB(connector)
+		ctx := context.Background()
+		if _, err := db.ExecContext(ctx, "CREATE DATABASE orders"); err != nil {
+			t.Fatalf("%q: %v", tc.params, err)
+		}
+		if _, err := db.ExecContext(ctx, "DROP DATABASE orders"); err != nil {
+			t.Fatalf("%q: %v", tc.params, err)
+		}
+		db.Close()
+		if len(admin.created) != 1 {
+			t.Fatalf("%q: created %d databases, want 1", tc.params, len(admin.created))
+		}
+		if req := admin.created[0]; req.CreateStatement != tc.wantStmt || req.DatabaseDialect != tc.wantDialect || req.Parent != "projects/p/instances/i" {
+			t.Errorf("%q: got %q in %s with dialect %v, want %q with dialect %v", tc.params, req.CreateStatement, req.Parent, req.DatabaseDialect, tc.wantStmt, tc.wantDialect)
+		}
+		if want := []string{"projects/p/instances/i/databases/orders"}; !reflect.DeepEqual(admin.dropped, want) {
+			t.Errorf("%q: dropped %v, want %v", tc.params, admin.dropped, want)
+		}
+	}
+}
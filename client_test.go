@@ -0,0 +1,328 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestSharedClient(t *testing.T) {
+	// Clients connect lazily, so no emulator needs to run.
+	t.Setenv("SPANNER_EMULATOR_HOST", "localhost:9010")
+	d := &Driver{Config: spanner.ClientConfig{SessionPoolConfig: spanner.SessionPoolConfig{MinOpened: 0}}}
+	connector, err := d.OpenConnector("projects/p/instances/i/databases/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	c1, err := connector.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := connector.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c1.(*conn).client != c2.(*conn).client {
+		t.Error("connections to the same database use different clients")
+	}
+
+	other, err := d.OpenConnector("projects/p/instances/i/databases/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c3, err := other.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c3.(*conn).client == c1.(*conn).client {
+		t.Error("connections to different databases share a client")
+	}
+
+	key := clientKey{driver: d, name: "projects/p/instances/i/databases/d"}
+	for i, c := range []interface{ Close() error }{c1, c3, c2} {
+		c.Close()
+		clients.Lock()
+		_, ok := clients.m[key]
+		clients.Unlock()
+		if want := i < 2; ok != want {
+			t.Errorf("after closing %d connections: client registered = %v, want %v", i+1, ok, want)
+		}
+	}
+}
+
+func TestBrokenClient(t *testing.T) {
+	key := clientKey{name: "projects/p/instances/i/databases/broken"}
+	sc := &sharedClient{key: key, stats: &transportStats{}, refs: 1}
+	clients.Lock()
+	clients.m[key] = sc
+	clients.Unlock()
+	c := &conn{shared: sc}
+
+	sc.checkConfig(status.Error(codes.Aborted, "transaction was aborted"))
+	if !c.IsValid() {
+		t.Error("connection is not valid after an aborted transaction")
+	}
+	sc.checkConfig(grpc.ErrClientConnClosing)
+	if c.IsValid() {
+		t.Error("connection is valid after its channel was shut down")
+	}
+	clients.Lock()
+	_, ok := clients.m[key]
+	clients.Unlock()
+	if ok {
+		t.Error("broken client is still shared with new connections")
+	}
+}
+
+func TestIsBrokenClient(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{grpc.ErrClientConnClosing, true},
+		{spanner.ToSpannerError(grpc.ErrClientConnClosing), true},
+		{spanner.ToSpannerError(status.Error(codes.InvalidArgument, "invalid session pool")), true},
+		{status.Error(codes.NotFound, "Session not found: projects/p/instances/i/databases/d/sessions/s"), false},
+		{status.Error(codes.InvalidArgument, "Syntax error: invalid session pool"), false},
+		{context.Canceled, false},
+	} {
+		if got := isBrokenClient(tc.err); got != tc.want {
+			t.Errorf("isBrokenClient(%v) = %t, want %t", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestConcurrentClientCreation(t *testing.T) {
+	warming, release := make(chan struct{}, 1), make(chan struct{})
+	openFakeSpanner(t, &fakeSpanner{createSessions: func(req *sppb.BatchCreateSessionsRequest) error {
+		if strings.HasSuffix(req.Database, "/other") {
+			return nil
+		}
+		warming <- struct{}{}
+		<-release
+		return nil
+	}})
+	d := &Driver{Config: spanner.ClientConfig{SessionPoolConfig: spanner.SessionPoolConfig{MinOpened: 0}}}
+	slow, err := d.OpenConnector("projects/p/instances/i/databases/d;dialect=googlesql;warmupSessions=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fast, err := d.OpenConnector("projects/p/instances/i/databases/other;dialect=googlesql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	conns := make(chan driver.Conn, 2)
+	connect := func() {
+		c, err := slow.Connect(ctx)
+		if err != nil {
+			t.Error(err)
+		}
+		conns <- c
+	}
+	go connect()
+	<-warming
+	go connect()
+
+	// The client of the other database is created while the
+	// first client waits for its sessions.
+	fastCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	c, err := fast.Connect(fastCtx)
+	if err != nil {
+		close(release)
+		t.Fatal(err)
+	}
+	c.Close()
+
+	close(release)
+	c1, c2 := <-conns, <-conns
+	if c1 == nil || c2 == nil {
+		return
+	}
+	defer c1.Close()
+	defer c2.Close()
+	if c1.(*conn).shared != c2.(*conn).shared {
+		t.Error("concurrent connections to the same database created two clients")
+	}
+}
+
+func TestWarmupPool(t *testing.T) {
+	openFakeSpanner(t, &fakeSpanner{createSessions: func(req *sppb.BatchCreateSessionsRequest) error {
+		if strings.HasSuffix(req.Database, "/cold") {
+			return status.Error(codes.PermissionDenied, "permission denied")
+		}
+		return nil
+	}})
+	d := &Driver{Config: spanner.ClientConfig{SessionPoolConfig: spanner.SessionPoolConfig{MinOpened: 0}}}
+	connector, err := d.OpenConnector("projects/p/instances/i/databases/warm;dialect=googlesql;warmupSessions=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := connector.Connect(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if got := c.(*conn).shared.stats.sessions.pooled.Load(); got < 3 {
+		t.Errorf("connected after %d pool sessions were created, want at least 3", got)
+	}
+
+	connector, err = d.OpenConnector("projects/p/instances/i/databases/cold;dialect=googlesql;warmupSessions=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := connector.Connect(context.Background()); err == nil {
+		c.Close()
+		t.Error("connected although the sessions could not be created")
+	} else if Code(err) != codes.PermissionDenied {
+		t.Errorf("got %v, want a PermissionDenied error", err)
+	}
+}
+
+func TestExpiredClient(t *testing.T) {
+	t.Setenv("SPANNER_EMULATOR_HOST", "localhost:9010")
+	d := &Driver{Config: spanner.ClientConfig{SessionPoolConfig: spanner.SessionPoolConfig{MinOpened: 0}}}
+	connector, err := d.OpenConnector("projects/p/instances/i/databases/d;sessionMaxAge=1ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	c1, err := connector.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	time.Sleep(2 * time.Millisecond)
+	if c1.(*conn).IsValid() {
+		t.Error("connection is valid after sessionMaxAge")
+	}
+	c2, err := connector.Connect(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	if c1.(*conn).client == c2.(*conn).client {
+		t.Error("a new connection uses the client that is older than sessionMaxAge")
+	}
+}
+
+func TestCloseRollsBack(t *testing.T) {
+	stmtTx := &fakeTx{}
+	c := &conn{shared: &sharedClient{refs: 2}, stmtTx: stmtTx}
+	c.Close()
+	if !stmtTx.rolledBack {
+		t.Error("transaction started with BEGIN was not rolled back when the connection was closed")
+	}
+}
+
+func TestInterceptors(t *testing.T) {
+	var mu sync.Mutex
+	var unary, streams []string
+	var header string
+	d := &Driver{
+		UnaryInterceptors: []grpc.UnaryClientInterceptor{
+			func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+				mu.Lock()
+				unary = append(unary, method)
+				mu.Unlock()
+				return invoker(ctx, method, req, reply, cc, opts...)
+			},
+		},
+		StreamInterceptors: []grpc.StreamClientInterceptor{
+			func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				mu.Lock()
+				streams = append(streams, method)
+				mu.Unlock()
+				ctx = metadata.AppendToOutgoingContext(ctx, "x-custom", "1")
+				return streamer(ctx, desc, cc, method, opts...)
+			},
+		},
+	}
+	db := openFakeSpannerWithDriver(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		if v := md.Get("x-custom"); len(v) > 0 {
+			header = v[0]
+		}
+		return sendRow(stream)
+	}}, d)
+
+	var id int64
+	if err := db.QueryRowContext(context.Background(), "SELECT Id FROM Singers").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(unary) == 0 {
+		t.Error("the unary interceptor was not called")
+	}
+	if len(streams) != 1 || streams[0] != "/google.spanner.v1.Spanner/ExecuteStreamingSql" || header != "1" {
+		t.Errorf("got streams %v and header %q", streams, header)
+	}
+}
+
+func TestOpenDBFromClient(t *testing.T) {
+	s := &fakeSpanner{dialect: "GOOGLE_STANDARD_SQL", query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		return sendRow(stream)
+	}}
+	openFakeSpanner(t, s)
+	ctx := context.Background()
+	client, err := spanner.NewClientWithConfig(ctx, "projects/p/instances/i/databases/d", spanner.ClientConfig{SessionPoolConfig: spanner.SessionPoolConfig{MinOpened: 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	db, err := OpenDBFromClient(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int64
+	if err := db.QueryRowContext(ctx, "SELECT Id FROM Singers").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Raw(func(driverConn any) error {
+		if driverConn.(SpannerConn).Client() != client {
+			t.Error("the connection doesn't use the client")
+		}
+		return nil
+	})
+	c.Close()
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// Closing the database doesn't close the client.
+	if err := client.Single().Query(ctx, spanner.NewStatement("SELECT Id FROM Singers")).Do(func(*spanner.Row) error { return nil }); err != nil {
+		t.Errorf("client closed with the database: %v", err)
+	}
+}
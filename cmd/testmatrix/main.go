@@ -0,0 +1,345 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command testmatrix runs the integration tests of the driver against
+// several versions of the Cloud Spanner emulator, and optionally a real
+// instance, in parallel and prints a matrix of the results.
+//
+// Each emulator version is started in a Docker container:
+//
+//	go run ./cmd/testmatrix -versions=1.5.0,latest
+//
+// To also run the tests against a real instance, pass its name. A
+// temporary database is created in the instance and dropped afterwards:
+//
+//	go run ./cmd/testmatrix -versions=latest -instance=projects/PROJECT/instances/INSTANCE
+//
+// The go test output of each target is written to -out, named after the
+// target, so that failures can be inspected.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	instance "cloud.google.com/go/spanner/admin/instance/apiv1"
+	instancepb "cloud.google.com/go/spanner/admin/instance/apiv1/instancepb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const emulatorImage = "gcr.io/cloud-spanner-emulator/emulator"
+
+var (
+	versions = flag.String("versions", "latest", "comma separated emulator versions")
+	instName = flag.String("instance", "", "optional real instance, projects/PROJECT/instances/INSTANCE")
+	pkgs     = flag.String("pkgs", "./...", "packages to test")
+	run      = flag.String("run", "", "only run tests matching this regular expression")
+	out      = flag.String("out", "testmatrix-results", "directory for the go test output of each target")
+	timeout  = flag.Duration("timeout", 20*time.Minute, "timeout per target")
+)
+
+// target is an environment that the tests run against.
+type target struct {
+	name string
+	env  []string
+
+	// setup prepares the target and returns a
+	// function that releases its resources.
+	setup func(ctx context.Context, t *target) (func(), error)
+}
+
+// result contains the outcome of each test on a target.
+type result struct {
+	target string
+	tests  map[string]string // test name to pass, fail or skip
+	err    error
+}
+
+func main() {
+	flag.Parse()
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		log.Fatal(err)
+	}
+
+	var targets []*target
+	for _, v := range strings.Split(*versions, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			targets = append(targets, emulatorTarget(v))
+		}
+	}
+	if *instName != "" {
+		targets = append(targets, instanceTarget(*instName))
+	}
+	if len(targets) == 0 {
+		log.Fatal("no targets, set -versions or -instance")
+	}
+
+	results := make([]result, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t *target) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+			defer cancel()
+			results[i] = runTarget(ctx, t)
+		}(i, t)
+	}
+	wg.Wait()
+
+	if failed := printMatrix(results); failed {
+		os.Exit(1)
+	}
+}
+
+func runTarget(ctx context.Context, t *target) result {
+	res := result{target: t.name, tests: make(map[string]string)}
+	cleanup, err := t.setup(ctx, t)
+	if err != nil {
+		res.err = fmt.Errorf("setup: %v", err)
+		return res
+	}
+	defer cleanup()
+
+	args := []string{"test", "-count=1", "-json"}
+	if *run != "" {
+		args = append(args, "-run", *run)
+	}
+	args = append(args, strings.Fields(*pkgs)...)
+	cmd := exec.CommandContext(ctx, "go", args...)
+	cmd.Env = append(os.Environ(), t.env...)
+	output, _ := cmd.Output() // Test failures are read from the output.
+
+	file := filepath.Join(*out, strings.NewReplacer("/", "_", ":", "_").Replace(t.name)+".json")
+	if err := os.WriteFile(file, output, 0644); err != nil {
+		log.Printf("%s: %v", t.name, err)
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(output))
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		var ev struct {
+			Action  string
+			Package string
+			Test    string
+		}
+		if err := json.Unmarshal(s.Bytes(), &ev); err != nil || ev.Test == "" {
+			continue
+		}
+		switch ev.Action {
+		case "pass", "fail", "skip":
+			res.tests[ev.Package+"."+ev.Test] = ev.Action
+		}
+	}
+	if len(res.tests) == 0 {
+		res.err = fmt.Errorf("no test results, see %s", file)
+	}
+	return res
+}
+
+// printMatrix prints one row per test and one column per target
+// and reports whether any test or target failed.
+func printMatrix(results []result) bool {
+	names := make(map[string]bool)
+	for _, r := range results {
+		for name := range r.tests {
+			names[name] = true
+		}
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	failed := false
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprint(w, "TEST")
+	for _, r := range results {
+		fmt.Fprintf(w, "\t%s", r.target)
+	}
+	fmt.Fprintln(w)
+	for _, name := range sorted {
+		fmt.Fprint(w, name)
+		for _, r := range results {
+			outcome, ok := r.tests[name]
+			if !ok {
+				outcome = "-"
+			}
+			if outcome == "fail" {
+				failed = true
+			}
+			fmt.Fprintf(w, "\t%s", outcome)
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+
+	for _, r := range results {
+		if r.err != nil {
+			failed = true
+			fmt.Printf("%s: %v\n", r.target, r.err)
+		}
+	}
+	return failed
+}
+
+func emulatorTarget(version string) *target {
+	return &target{
+		name:  "emulator:" + version,
+		setup: func(ctx context.Context, t *target) (func(), error) { return startEmulator(ctx, t, version) },
+	}
+}
+
+// startEmulator starts the emulator in a container
+// and creates the instance and database of the tests.
+func startEmulator(ctx context.Context, t *target, version string) (func(), error) {
+	id, err := exec.CommandContext(ctx, "docker", "run", "-d", "--rm", "-p", "127.0.0.1::9010", emulatorImage+":"+version).Output()
+	if err != nil {
+		return nil, fmt.Errorf("docker run: %v", err)
+	}
+	container := strings.TrimSpace(string(id))
+	cleanup := func() {
+		exec.Command("docker", "rm", "-f", container).Run()
+	}
+
+	port, err := exec.CommandContext(ctx, "docker", "port", container, "9010").Output()
+	if err != nil {
+		cleanup()
+		return nil, fmt.Errorf("docker port: %v", err)
+	}
+	// The output looks like 127.0.0.1:49153, possibly on multiple lines.
+	host := strings.TrimSpace(strings.Split(string(port), "\n")[0])
+
+	project, inst, db := "test-project", "test-instance", "gotest"
+	opts := []option.ClientOption{
+		option.WithEndpoint(host),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}
+	if err := createDatabase(ctx, "projects/"+project, inst, db, true, opts); err != nil {
+		cleanup()
+		return nil, err
+	}
+	t.env = []string{
+		"SPANNER_EMULATOR_HOST=" + host,
+		"SPANNER_TEST_PROJECT=" + project,
+		"SPANNER_TEST_INSTANCE=" + inst,
+		"SPANNER_TEST_DBID=" + db,
+	}
+	return cleanup, nil
+}
+
+func instanceTarget(name string) *target {
+	return &target{
+		name: "instance:" + name,
+		setup: func(ctx context.Context, t *target) (func(), error) {
+			parts := strings.Split(name, "/")
+			if len(parts) != 4 || parts[0] != "projects" || parts[2] != "instances" {
+				return nil, fmt.Errorf("invalid instance %q", name)
+			}
+			db := fmt.Sprintf("testmatrix-%d", time.Now().Unix())
+			if err := createDatabase(ctx, "projects/"+parts[1], parts[3], db, false, nil); err != nil {
+				return nil, err
+			}
+			t.env = []string{
+				"SPANNER_TEST_PROJECT=" + parts[1],
+				"SPANNER_TEST_INSTANCE=" + parts[3],
+				"SPANNER_TEST_DBID=" + db,
+			}
+			return func() {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+				defer cancel()
+				client, err := database.NewDatabaseAdminClient(ctx)
+				if err != nil {
+					log.Printf("drop database %s: %v", db, err)
+					return
+				}
+				defer client.Close()
+				if err := client.DropDatabase(ctx, &adminpb.DropDatabaseRequest{Database: name + "/databases/" + db}); err != nil {
+					log.Printf("drop database %s: %v", db, err)
+				}
+			}, nil
+		},
+	}
+}
+
+// createDatabase creates an empty database, and
+// the instance first if createInstance is set.
+func createDatabase(ctx context.Context, project, inst, db string, createInstance bool, opts []option.ClientOption) error {
+	if createInstance {
+		ic, err := instance.NewInstanceAdminClient(ctx, opts...)
+		if err != nil {
+			return err
+		}
+		defer ic.Close()
+		// The emulator may take a moment to accept connections.
+		var op *instance.CreateInstanceOperation
+		for i := 0; ; i++ {
+			op, err = ic.CreateInstance(ctx, &instancepb.CreateInstanceRequest{
+				Parent:     project,
+				InstanceId: inst,
+				Instance: &instancepb.Instance{
+					Config:      project + "/instanceConfigs/emulator-config",
+					DisplayName: inst,
+					NodeCount:   1,
+				},
+			})
+			if err == nil || i == 10 {
+				break
+			}
+			time.Sleep(time.Second)
+		}
+		if err != nil {
+			return fmt.Errorf("create instance: %v", err)
+		}
+		if _, err := op.Wait(ctx); err != nil {
+			return fmt.Errorf("create instance: %v", err)
+		}
+	}
+
+	dc, err := database.NewDatabaseAdminClient(ctx, opts...)
+	if err != nil {
+		return err
+	}
+	defer dc.Close()
+	op, err := dc.CreateDatabase(ctx, &adminpb.CreateDatabaseRequest{
+		Parent:          project + "/instances/" + inst,
+		CreateStatement: "CREATE DATABASE `" + db + "`",
+	})
+	if err != nil {
+		return fmt.Errorf("create database: %v", err)
+	}
+	if _, err := op.Wait(ctx); err != nil {
+		return fmt.Errorf("create database: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+)
+
+var (
+	_ driver.RowsColumnTypeDatabaseTypeName = (*rows)(nil)
+	_ driver.RowsColumnTypeScanType         = (*rows)(nil)
+	_ driver.RowsColumnTypeNullable         = (*rows)(nil)
+)
+
+// scanTypes are the types of the values that
+// columns of the Spanner types are decoded into.
+var scanTypes = map[sppb.TypeCode]reflect.Type{
+	sppb.TypeCode_BOOL:      reflect.TypeOf(false),
+	sppb.TypeCode_INT64:     reflect.TypeOf(int64(0)),
+	sppb.TypeCode_ENUM:      reflect.TypeOf(int64(0)),
+	sppb.TypeCode_FLOAT32:   reflect.TypeOf(float64(0)),
+	sppb.TypeCode_FLOAT64:   reflect.TypeOf(float64(0)),
+	sppb.TypeCode_NUMERIC:   reflect.TypeOf(""),
+	sppb.TypeCode_STRING:    reflect.TypeOf(""),
+	sppb.TypeCode_JSON:      reflect.TypeOf(""),
+	sppb.TypeCode_UUID:      reflect.TypeOf(""),
+	sppb.TypeCode_INTERVAL:  reflect.TypeOf(""),
+	sppb.TypeCode_BYTES:     reflect.TypeOf([]byte(nil)),
+	sppb.TypeCode_PROTO:     reflect.TypeOf([]byte(nil)),
+	sppb.TypeCode_DATE:      reflect.TypeOf(time.Time{}),
+	sppb.TypeCode_TIMESTAMP: reflect.TypeOf(time.Time{}),
+}
+
+// arrayScanTypes are the types of the values that
+// arrays of the Spanner types are decoded into.
+var arrayScanTypes = map[sppb.TypeCode]reflect.Type{
+	sppb.TypeCode_BOOL:      reflect.TypeOf([]spanner.NullBool(nil)),
+	sppb.TypeCode_INT64:     reflect.TypeOf([]spanner.NullInt64(nil)),
+	sppb.TypeCode_FLOAT32:   reflect.TypeOf([]spanner.NullFloat32(nil)),
+	sppb.TypeCode_FLOAT64:   reflect.TypeOf([]spanner.NullFloat64(nil)),
+	sppb.TypeCode_NUMERIC:   reflect.TypeOf([]spanner.NullNumeric(nil)),
+	sppb.TypeCode_STRING:    reflect.TypeOf([]spanner.NullString(nil)),
+	sppb.TypeCode_JSON:      reflect.TypeOf([]spanner.NullJSON(nil)),
+	sppb.TypeCode_BYTES:     reflect.TypeOf([][]byte(nil)),
+	sppb.TypeCode_DATE:      reflect.TypeOf([]spanner.NullDate(nil)),
+	sppb.TypeCode_TIMESTAMP: reflect.TypeOf([]spanner.NullTime(nil)),
+}
+
+var (
+	genericScanType    = reflect.TypeOf(spanner.GenericColumnValue{})
+	pgNumericArrayType = reflect.TypeOf([]spanner.PGNumeric(nil))
+)
+
+// ColumnTypeDatabaseTypeName returns the Spanner type of
+// column i without its length, e.g. STRING or ARRAY<INT64>,
+// or its PostgreSQL name in PostgreSQL-dialect databases,
+// e.g. character varying or bigint[].
+func (r *rows) ColumnTypeDatabaseTypeName(i int) string {
+	if r.postgreSQL {
+		return pgTypeName(r.columnType(i))
+	}
+	return typeName(r.columnType(i))
+}
+
+// ColumnTypeScanType returns the type of the values that
+// column i is decoded into. Values of NULL columns are nil.
+func (r *rows) ColumnTypeScanType(i int) reflect.Type {
+	return scanType(r.columnType(i))
+}
+
+// ColumnTypeNullable returns ok false, because
+// Spanner doesn't report the nullability of results.
+func (r *rows) ColumnTypeNullable(i int) (nullable, ok bool) {
+	return false, false
+}
+
+func (r *rows) columnType(i int) *sppb.Type {
+	if i < len(r.types) {
+		return r.types[i]
+	}
+	return nil
+}
+
+// typeName returns the name of the Spanner type t.
+func typeName(t *sppb.Type) string {
+	switch t.GetCode() {
+	case sppb.TypeCode_TYPE_CODE_UNSPECIFIED:
+		return ""
+	case sppb.TypeCode_ARRAY:
+		return "ARRAY<" + typeName(t.GetArrayElementType()) + ">"
+	case sppb.TypeCode_PROTO, sppb.TypeCode_ENUM:
+		if fqn := t.GetProtoTypeFqn(); fqn != "" {
+			return fqn
+		}
+	}
+	return t.GetCode().String()
+}
+
+// pgTypeNames are the PostgreSQL names of the Spanner types.
+var pgTypeNames = map[sppb.TypeCode]string{
+	sppb.TypeCode_BOOL:      "boolean",
+	sppb.TypeCode_INT64:     "bigint",
+	sppb.TypeCode_FLOAT32:   "real",
+	sppb.TypeCode_FLOAT64:   "double precision",
+	sppb.TypeCode_NUMERIC:   "numeric",
+	sppb.TypeCode_STRING:    "character varying",
+	sppb.TypeCode_JSON:      "jsonb",
+	sppb.TypeCode_UUID:      "uuid",
+	sppb.TypeCode_INTERVAL:  "interval",
+	sppb.TypeCode_BYTES:     "bytea",
+	sppb.TypeCode_DATE:      "date",
+	sppb.TypeCode_TIMESTAMP: "timestamp with time zone",
+}
+
+// pgTypeName returns the PostgreSQL name of the Spanner type t.
+func pgTypeName(t *sppb.Type) string {
+	if t.GetCode() == sppb.TypeCode_ARRAY {
+		return pgTypeName(t.GetArrayElementType()) + "[]"
+	}
+	if name, ok := pgTypeNames[t.GetCode()]; ok {
+		return name
+	}
+	return typeName(t)
+}
+
+// scanType returns the type of the values that
+// convertValue decodes values of type t into.
+func scanType(t *sppb.Type) reflect.Type {
+	if t.GetCode() == sppb.TypeCode_ARRAY {
+		if t.GetArrayElementType().GetTypeAnnotation() == sppb.TypeAnnotationCode_PG_NUMERIC {
+			return pgNumericArrayType
+		}
+		if st, ok := arrayScanTypes[t.GetArrayElementType().GetCode()]; ok {
+			return st
+		}
+		return genericScanType
+	}
+	if st, ok := scanTypes[t.GetCode()]; ok {
+		return st
+	}
+	return genericScanType
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestColumnTypes(t *testing.T) {
+	db := openFakeSpanner(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		return stream.Send(&sppb.PartialResultSet{
+			Metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{Fields: []*sppb.StructType_Field{
+				{Name: "Id", Type: &sppb.Type{Code: sppb.TypeCode_INT64}},
+				{Name: "Name", Type: &sppb.Type{Code: sppb.TypeCode_STRING}},
+				{Name: "CreatedAt", Type: &sppb.Type{Code: sppb.TypeCode_TIMESTAMP}},
+				{Name: "Tags", Type: &sppb.Type{Code: sppb.TypeCode_ARRAY, ArrayElementType: &sppb.Type{Code: sppb.TypeCode_STRING}}},
+			}}},
+			Values: []*structpb.Value{
+				stringValue("1"),
+				stringValue("Alice"),
+				stringValue("2020-01-01T00:00:00Z"),
+				structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{stringValue("a")}}),
+			},
+		})
+	}})
+
+	rows, err := db.QueryContext(context.Background(), "SELECT Id, Name, CreatedAt, Tags FROM Singers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name     string
+		scanType reflect.Type
+	}{
+		{"INT64", reflect.TypeOf(int64(0))},
+		{"STRING", reflect.TypeOf("")},
+		{"TIMESTAMP", reflect.TypeOf(time.Time{})},
+		{"ARRAY<STRING>", reflect.TypeOf([]spanner.NullString(nil))},
+	}
+	for i, ct := range types {
+		if ct.DatabaseTypeName() != want[i].name || ct.ScanType() != want[i].scanType {
+			t.Errorf("column %s: got %s, %v, want %s, %v", ct.Name(), ct.DatabaseTypeName(), ct.ScanType(), want[i].name, want[i].scanType)
+		}
+		if _, ok := ct.Nullable(); ok {
+			t.Errorf("column %s: nullability is unknown", ct.Name())
+		}
+	}
+}
+
+func TestQueryDMLInNewTransaction(t *testing.T) {
+	var begin bool
+	db := openFakeSpanner(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		begin = req.GetTransaction().GetBegin().GetReadWrite() != nil
+		return stream.Send(&sppb.PartialResultSet{
+			Metadata: &sppb.ResultSetMetadata{
+				RowType: &sppb.StructType{Fields: []*sppb.StructType_Field{
+					{Name: "Id", Type: &sppb.Type{Code: sppb.TypeCode_INT64}},
+				}},
+				Transaction: &sppb.Transaction{Id: []byte("tx")},
+			},
+			Values: []*structpb.Value{stringValue("42")},
+		})
+	}})
+
+	var id int64
+	if err := db.QueryRowContext(context.Background(), "INSERT INTO Singers (Name) VALUES ('Alice') THEN RETURN Id").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if !begin {
+		t.Error("the DML didn't begin a read-write transaction")
+	}
+	if id != 42 {
+		t.Errorf("got id %d, want 42", id)
+	}
+}
+
+func TestPreparedStatementMetadata(t *testing.T) {
+	db := openFakeSpanner(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		return stream.Send(&sppb.PartialResultSet{
+			Metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{Fields: []*sppb.StructType_Field{
+				{Name: "Id", Type: &sppb.Type{Code: sppb.TypeCode_INT64}},
+				{Name: "Amounts", Type: &sppb.Type{Code: sppb.TypeCode_ARRAY, ArrayElementType: &sppb.Type{Code: sppb.TypeCode_NUMERIC}}},
+			}}},
+		})
+	}})
+
+	ctx := context.Background()
+	s, err := db.PrepareContext(ctx, "SELECT Id, Amounts FROM Invoices WHERE Owner = @owner AND (Payer = @owner OR Note = 'paid @cash')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, err := s.QueryContext(ctx, "alice", "bob"); err == nil {
+		t.Error("expected an error for too many arguments")
+	}
+	rows, err := s.QueryContext(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	// The columns of empty results are described by the metadata.
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(types) != 2 || types[1].DatabaseTypeName() != "ARRAY<NUMERIC>" || types[1].ScanType() != reflect.TypeOf([]spanner.NullNumeric(nil)) {
+		t.Errorf("got column types %v", types)
+	}
+	if rows.Next() {
+		t.Error("got a row, want none")
+	}
+}
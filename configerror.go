@@ -0,0 +1,127 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ConfigError is returned when a connection can't be opened, or the
+// statements on a database fail before the first RPC succeeded, because
+// of the configuration of the application rather than the statement:
+// the project, instance or database doesn't exist, or the credentials
+// are missing or lack permissions.
+//
+//	var cfgErr *spannerdriver.ConfigError
+//	if errors.As(err, &cfgErr) && cfgErr.Code == codes.PermissionDenied {
+//		...
+//	}
+type ConfigError struct {
+	// Database is the name of the database.
+	Database string
+
+	// Code is NotFound, PermissionDenied or Unauthenticated, or
+	// Unknown if the client couldn't be created, e.g. because
+	// no credentials were found.
+	Code codes.Code
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	var problem string
+	switch e.Code {
+	case codes.NotFound:
+		problem = "the database or its instance doesn't exist"
+	case codes.PermissionDenied:
+		problem = "the credentials lack permission to use the database"
+	case codes.Unauthenticated:
+		problem = "the credentials are invalid"
+	default:
+		problem = "the client couldn't be created"
+	}
+	msg := e.Err.Error()
+	if s, ok := status.FromError(e.Err); ok {
+		msg = s.Message()
+	}
+	return fmt.Sprintf("spannerdriver: %s: %s: %s", e.Database, problem, msg)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the Err variable of the code of e.
+func (e *ConfigError) Is(target error) bool {
+	c, ok := target.(codeError)
+	return ok && codes.Code(c) == e.Code
+}
+
+// newConfigError wraps an error that occurred while the client of
+// the database was created. Errors without a status code, such as
+// missing credentials, are reported with the code Unknown.
+func newConfigError(database string, err error) error {
+	var cfgErr *ConfigError
+	if err == nil || errors.As(err, &cfgErr) {
+		return err
+	}
+	if _, ok := status.FromError(err); ok && !isConfigError(err) {
+		return err
+	}
+	return &ConfigError{Database: database, Code: status.Code(err), Err: err}
+}
+
+// isConfigError reports whether err, which a statement returned,
+// is caused by the configuration rather than the statement.
+func isConfigError(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	switch s.Code() {
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return true
+	case codes.NotFound:
+		// Sessions and transactions that expired
+		// are not found either.
+		for _, d := range s.Details() {
+			if info, ok := d.(*errdetails.ResourceInfo); ok {
+				return strings.HasSuffix(info.ResourceType, ".Database") || strings.HasSuffix(info.ResourceType, ".Instance")
+			}
+		}
+		msg := s.Message()
+		return strings.Contains(msg, "Database not found") || strings.Contains(msg, "Instance not found")
+	}
+	return false
+}
+
+// checkConfig returns err as a ConfigError if it is caused by the
+// configuration and no RPC of the client has succeeded yet, and
+// as an Error otherwise. The client is also marked as broken if
+// err shows that it can't be used anymore.
+func (sc *sharedClient) checkConfig(err error) error {
+	sc.checkBroken(err)
+	if err == nil || sc == nil || sc.stats.succeeded.Load() || !isConfigError(err) {
+		return newError(err)
+	}
+	return &ConfigError{Database: sc.key.name, Code: status.Code(err), Err: err}
+}
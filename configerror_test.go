@@ -0,0 +1,78 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsConfigError(t *testing.T) {
+	withResource := func(code codes.Code, msg, resourceType string) error {
+		s, err := status.New(code, msg).WithDetails(&errdetails.ResourceInfo{ResourceType: resourceType})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.Err()
+	}
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{status.Error(codes.PermissionDenied, "caller lacks spanner.sessions.create"), true},
+		{status.Error(codes.Unauthenticated, "invalid credentials"), true},
+		{status.Error(codes.NotFound, "Database not found: projects/p/instances/i/databases/d"), true},
+		{withResource(codes.NotFound, "not found", "type.googleapis.com/google.spanner.admin.instance.v1.Instance"), true},
+		{withResource(codes.NotFound, "Session not found", "type.googleapis.com/google.spanner.v1.Session"), false},
+		{status.Error(codes.InvalidArgument, "Table not found: Singers"), false},
+		{errors.New("no credentials"), false},
+	} {
+		if got := isConfigError(tt.err); got != tt.want {
+			t.Errorf("isConfigError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestConfigError(t *testing.T) {
+	const db = "projects/p/instances/i/databases/d"
+	cause := errors.New("could not find default credentials")
+	err := newConfigError(db, cause)
+	var cfgErr *ConfigError
+	if !errors.As(err, &cfgErr) || cfgErr.Code != codes.Unknown || !errors.Is(err, cause) {
+		t.Fatalf("newConfigError(%v) = %#v, want ConfigError with code Unknown", cause, err)
+	}
+	if got := err.Error(); !strings.Contains(got, db) || !strings.Contains(got, "could not find default credentials") {
+		t.Errorf("unexpected message %q", got)
+	}
+	if err := newConfigError(db, status.Error(codes.Unavailable, "unavailable")); errors.As(err, &cfgErr) {
+		t.Errorf("Unavailable was reported as a configuration error: %v", err)
+	}
+
+	sc := &sharedClient{key: clientKey{name: db}, stats: &transportStats{}}
+	denied := status.Error(codes.PermissionDenied, "caller lacks permission")
+	if err := sc.checkConfig(denied); !errors.As(err, &cfgErr) || cfgErr.Code != codes.PermissionDenied {
+		t.Errorf("want ConfigError before the first successful RPC, got %v", err)
+	}
+	sc.stats.succeeded.Store(true)
+	var spannerErr *Error
+	if err := sc.checkConfig(denied); !errors.As(err, &spannerErr) || spannerErr.Err != denied {
+		t.Errorf("want an Error that wraps the error after a successful RPC, got %#v", err)
+	}
+}
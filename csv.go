@@ -0,0 +1,177 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+)
+
+// ImportCSV streams the records of a CSV file into table with a
+// BulkWriter configured by opts, and returns the number of records
+// that were read. The first record names the columns. Values are
+// converted to the types of the columns in INFORMATION_SCHEMA:
+// BYTES values are base64 encoded, DATE values are YYYY-MM-DD and
+// TIMESTAMP values are RFC 3339. Empty values are NULL. ARRAY and
+// STRUCT columns are not supported.
+func ImportCSV(ctx context.Context, db *sql.DB, table string, r io.Reader, opts BulkWriterOptions) (int, error) {
+	types, err := columnTypes(ctx, db, table)
+	if err != nil {
+		return 0, err
+	}
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return 0, fmt.Errorf("cannot read CSV header: %v", err)
+	}
+	converters, err := csvConverters(types, header)
+	if err != nil {
+		return 0, err
+	}
+
+	w := NewBulkWriter(ctx, db, table, opts)
+	n := 0
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			w.Close()
+			return n, err
+		}
+		row := make(map[string]interface{}, len(header))
+		for i, s := range record {
+			v, err := converters[i](s)
+			if err != nil {
+				w.Close()
+				return n, fmt.Errorf("record %d, column %s: %v", n+1, header[i], err)
+			}
+			row[header[i]] = v
+		}
+		if err := w.Write(row); err != nil {
+			w.Close()
+			return n, err
+		}
+		n++
+	}
+	return n, w.Close()
+}
+
+// columnTypes returns the Spanner types of the columns of
+// table, keyed by upper-case column name.
+func columnTypes(ctx context.Context, db *sql.DB, table string) (map[string]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT COLUMN_NAME, SPANNER_TYPE FROM INFORMATION_SCHEMA.COLUMNS
+WHERE TABLE_SCHEMA = '' AND TABLE_NAME = @table`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	types := make(map[string]string)
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return nil, err
+		}
+		types[strings.ToUpper(name)] = typ
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("table %s not found", table)
+	}
+	return types, nil
+}
+
+// csvConverters returns the functions that convert
+// the CSV values of the columns in header.
+func csvConverters(types map[string]string, header []string) ([]func(string) (interface{}, error), error) {
+	converters := make([]func(string) (interface{}, error), len(header))
+	for i, col := range header {
+		typ, ok := types[strings.ToUpper(col)]
+		if !ok {
+			return nil, fmt.Errorf("column %s not found", col)
+		}
+		convert, err := csvConverter(typ)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %v", col, err)
+		}
+		converters[i] = func(s string) (interface{}, error) {
+			if s == "" {
+				return nil, nil
+			}
+			return convert(s)
+		}
+	}
+	return converters, nil
+}
+
+func csvConverter(typ string) (func(string) (interface{}, error), error) {
+	// Strip the length of STRING(MAX), BYTES(10) and the like.
+	if i := strings.IndexByte(typ, '('); i >= 0 {
+		typ = typ[:i]
+	}
+	switch strings.ToUpper(typ) {
+	case "STRING":
+		return func(s string) (interface{}, error) { return s, nil }, nil
+	case "BYTES":
+		return func(s string) (interface{}, error) { return base64.StdEncoding.DecodeString(s) }, nil
+	case "INT64":
+		return func(s string) (interface{}, error) { return strconv.ParseInt(s, 10, 64) }, nil
+	case "FLOAT64":
+		return func(s string) (interface{}, error) { return strconv.ParseFloat(s, 64) }, nil
+	case "FLOAT32":
+		return func(s string) (interface{}, error) {
+			f, err := strconv.ParseFloat(s, 32)
+			return float32(f), err
+		}, nil
+	case "BOOL":
+		return func(s string) (interface{}, error) { return strconv.ParseBool(s) }, nil
+	case "NUMERIC":
+		return func(s string) (interface{}, error) {
+			r, ok := new(big.Rat).SetString(s)
+			if !ok {
+				return nil, fmt.Errorf("invalid NUMERIC %q", s)
+			}
+			return r, nil
+		}, nil
+	case "DATE":
+		return func(s string) (interface{}, error) { return civil.ParseDate(s) }, nil
+	case "TIMESTAMP":
+		return func(s string) (interface{}, error) { return time.Parse(time.RFC3339Nano, s) }, nil
+	case "JSON":
+		return func(s string) (interface{}, error) {
+			if !json.Valid([]byte(s)) {
+				return nil, fmt.Errorf("invalid JSON %q", s)
+			}
+			return spanner.NullJSON{Value: json.RawMessage(s), Valid: true}, nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("type %s is not supported", typ)
+	}
+}
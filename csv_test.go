@@ -0,0 +1,68 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+)
+
+func TestCSVConverters(t *testing.T) {
+	types := map[string]string{
+		"ID":       "INT64",
+		"NAME":     "STRING(MAX)",
+		"PHOTO":    "BYTES(1024)",
+		"SCORE":    "FLOAT64",
+		"ACTIVE":   "BOOL",
+		"PRICE":    "NUMERIC",
+		"BIRTH":    "DATE",
+		"UPDATED":  "TIMESTAMP",
+		"TAGS":     "ARRAY<STRING(MAX)>",
+		"NICKNAME": "STRING(100)",
+	}
+	header := []string{"Id", "Name", "Photo", "Score", "Active", "Price", "Birth", "Updated", "Nickname"}
+	converters, err := csvConverters(types, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := []string{"1", "Alice", "AQI=", "1.5", "true", "3.14", "2020-01-02", "2020-01-02T03:04:05Z", ""}
+	want := []interface{}{
+		int64(1), "Alice", []byte{1, 2}, 1.5, true, big.NewRat(314, 100),
+		civil.Date{Year: 2020, Month: 1, Day: 2}, time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC), nil,
+	}
+	for i, s := range record {
+		got, err := converters[i](s)
+		if err != nil {
+			t.Fatalf("%s: %v", header[i], err)
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("%s: want %#v, got %#v", header[i], want[i], got)
+		}
+	}
+	if _, err := converters[0]("one"); err == nil {
+		t.Error("converted invalid INT64")
+	}
+
+	if _, err := csvConverters(types, []string{"Tags"}); err == nil {
+		t.Error("converted ARRAY column")
+	}
+	if _, err := csvConverters(types, []string{"Unknown"}); err == nil {
+		t.Error("converted unknown column")
+	}
+}
@@ -0,0 +1,294 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	adminapi "cloud.google.com/go/spanner/admin/database/apiv1"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ddlBatch buffers DDL statements that are sent to
+// Spanner in one UpdateDatabaseDdl operation.
+type ddlBatch struct {
+	statements       []string
+	protoDescriptors ProtoDescriptors
+	// audit are the audit entries of the statements.
+	audit []AuditEntry
+}
+
+// ExecDDL executes the DDL statements in one schema change operation
+// on a connection of db and, unless the asyncDdl connection parameter
+// is set, waits for it to complete. Spanner applies
+// a batch of statements much faster than the same statements one at
+// a time.
+func ExecDDL(ctx context.Context, db *sql.DB, statements ...string) error {
+	return withConn(ctx, db, func(c *conn) error {
+		_, err := c.execDDL(ctx, statements, nil)
+		return err
+	})
+}
+
+// withConn calls f with a Spanner connection of db. All helpers
+// that take a *sql.DB use it, so that they work with the
+// connections of every connector of the driver.
+func withConn(ctx context.Context, db *sql.DB, f func(c *conn) error) error {
+	c, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	return c.Raw(func(driverConn interface{}) error {
+		sc, ok := driverConn.(interface{ spannerConn() *conn })
+		if !ok {
+			return errors.New("not a Spanner connection")
+		}
+		return f(sc.spannerConn())
+	})
+}
+
+// spannerConn returns c. It is promoted to the connections
+// that wrap a connection, such as those of WeightedConnector.
+func (c *conn) spannerConn() *conn {
+	return c
+}
+
+func (c *conn) StartBatchDDL() error {
+	if c.InTransaction() {
+		return errors.New("DDL batches cannot be started in a transaction")
+	}
+	if c.dmlBatch() != nil || c.ddlBatch != nil {
+		return errors.New("a batch is already active")
+	}
+	c.ddlBatch = &ddlBatch{}
+	return nil
+}
+
+// execDDL executes the DDL statements in one operation,
+// or adds them to the active DDL batch. protoDescriptors
+// are the descriptors of proto bundle statements, if any.
+func (c *conn) execDDL(ctx context.Context, statements []string, protoDescriptors ProtoDescriptors) (driver.Result, error) {
+	if c.ddlBatch != nil {
+		c.ddlBatch.statements = append(c.ddlBatch.statements, statements...)
+		if protoDescriptors != nil {
+			c.ddlBatch.protoDescriptors = protoDescriptors
+		}
+		return &result{rowsAffected: 0}, nil
+	}
+	if c.dmlBatch() != nil {
+		return nil, errors.New("DDL statements are not allowed while a DML batch is active")
+	}
+	if err := c.endTransactionForDDL(); err != nil {
+		return nil, err
+	}
+	op, err := c.adminClient.UpdateDatabaseDdl(ctx, &adminpb.UpdateDatabaseDdlRequest{
+		Database:         c.name,
+		Statements:       statements,
+		ProtoDescriptors: protoDescriptors,
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.ddlOperation = op.Name()
+	if c.asyncDDL {
+		return &result{rowsAffected: 0}, nil
+	}
+	if err := op.Wait(ctx); err != nil {
+		return nil, err
+	}
+	return &result{rowsAffected: 0}, nil
+}
+
+func (c *conn) DDLOperationName() (string, error) {
+	if c.ddlOperation == "" {
+		return "", errors.New("this connection has not executed a DDL statement")
+	}
+	return c.ddlOperation, nil
+}
+
+// DDLOperation describes a schema change operation.
+type DDLOperation struct {
+	Name       string
+	Statements []string
+
+	// Progress is the progress of each statement in percent.
+	Progress []int32
+	// CommitTimestamps are the times at which the
+	// statements that have completed were applied.
+	CommitTimestamps []time.Time
+	// Throttled is set if Spanner slowed down the
+	// operation, e.g. because of too many concurrent
+	// schema changes.
+	Throttled bool
+
+	Done bool
+	// Err is the error of an operation that failed.
+	Err error
+}
+
+func (c *conn) DDLOperation(ctx context.Context, name string) (DDLOperation, error) {
+	op := c.adminClient.UpdateDatabaseDdlOperation(name)
+	pollErr := op.Poll(ctx)
+	md, err := op.Metadata()
+	if err != nil {
+		return DDLOperation{}, err
+	}
+	info := newDDLOperation(name, md)
+	info.Done = op.Done()
+	if info.Done {
+		info.Err = pollErr
+	} else if pollErr != nil {
+		return DDLOperation{}, pollErr
+	}
+	return info, nil
+}
+
+func (c *conn) DDLOperations(ctx context.Context, inFlight bool) ([]DDLOperation, error) {
+	filter := "(metadata.@type:type.googleapis.com/google.spanner.admin.database.v1.UpdateDatabaseDdlMetadata)"
+	if inFlight {
+		filter += " AND (done:false)"
+	}
+	it := c.adminClient.ListDatabaseOperations(ctx, &adminpb.ListDatabaseOperationsRequest{
+		Parent: c.instanceName(),
+		Filter: filter,
+	})
+	var ops []DDLOperation
+	for {
+		op, err := it.Next()
+		if err == iterator.Done {
+			return ops, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		// The operations of a database are named after it.
+		if !strings.HasPrefix(op.GetName(), c.name+"/operations/") {
+			continue
+		}
+		info, err := ddlOperationFromProto(op)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, info)
+	}
+}
+
+func ddlOperationFromProto(op *longrunningpb.Operation) (DDLOperation, error) {
+	md := &adminpb.UpdateDatabaseDdlMetadata{}
+	if err := op.GetMetadata().UnmarshalTo(md); err != nil {
+		return DDLOperation{}, err
+	}
+	info := newDDLOperation(op.GetName(), md)
+	info.Done = op.GetDone()
+	if s := op.GetError(); s != nil {
+		info.Err = status.ErrorProto(s)
+	}
+	return info, nil
+}
+
+func newDDLOperation(name string, md *adminpb.UpdateDatabaseDdlMetadata) DDLOperation {
+	info := DDLOperation{
+		Name:       name,
+		Statements: md.GetStatements(),
+		Throttled:  md.GetThrottled(),
+	}
+	for _, p := range md.GetProgress() {
+		info.Progress = append(info.Progress, p.GetProgressPercent())
+	}
+	for _, ts := range md.GetCommitTimestamps() {
+		info.CommitTimestamps = append(info.CommitTimestamps, ts.AsTime())
+	}
+	return info
+}
+
+// instanceName returns the name of the instance of the database.
+func (c *conn) instanceName() string {
+	return c.name[:strings.Index(c.name, "/databases/")]
+}
+
+func (c *conn) createDatabase(ctx context.Context, name string) error {
+	op, err := c.adminClient.CreateDatabase(ctx, &adminpb.CreateDatabaseRequest{
+		Parent:          c.instanceName(),
+		CreateStatement: createDatabaseStatement(name, c.dialect),
+		DatabaseDialect: c.dialect,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = op.Wait(ctx)
+	return err
+}
+
+func (c *conn) dropDatabase(ctx context.Context, name string) error {
+	return c.adminClient.DropDatabase(ctx, &adminpb.DropDatabaseRequest{
+		Database: c.instanceName() + "/databases/" + name,
+	})
+}
+
+// createDatabaseStatement returns the CREATE DATABASE statement of
+// the database name, which is quoted in the given dialect.
+func createDatabaseStatement(name string, dialect adminpb.DatabaseDialect) string {
+	if dialect == adminpb.DatabaseDialect_POSTGRESQL {
+		return `CREATE DATABASE "` + name + `"`
+	}
+	return "CREATE DATABASE `" + name + "`"
+}
+
+// createDatabaseIfNotExists creates the database with the given fully
+// qualified name and dialect and executes the extra statements in it,
+// unless the database already exists.
+func createDatabaseIfNotExists(ctx context.Context, adminClient *adminapi.DatabaseAdminClient, name string, dialect adminpb.DatabaseDialect, extra []string) error {
+	_, err := adminClient.GetDatabase(ctx, &adminpb.GetDatabaseRequest{Name: name})
+	if status.Code(err) != codes.NotFound {
+		return err
+	}
+	i := strings.Index(name, "/databases/")
+	op, err := adminClient.CreateDatabase(ctx, &adminpb.CreateDatabaseRequest{
+		Parent:          name[:i],
+		CreateStatement: createDatabaseStatement(name[i+len("/databases/"):], dialect),
+		ExtraStatements: extra,
+		DatabaseDialect: dialect,
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		// Created concurrently by another process.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = op.Wait(ctx)
+	return err
+}
+
+// allDDL reports whether all queries are DDL statements.
+func allDDL(queries []string) bool {
+	for _, q := range queries {
+		if !isDdl(q) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestDDLOperationFromProto(t *testing.T) {
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	md, err := anypb.New(&adminpb.UpdateDatabaseDdlMetadata{
+		Statements:       []string{"CREATE INDEX A ON T (A)", "CREATE INDEX B ON T (B)"},
+		CommitTimestamps: []*timestamppb.Timestamp{timestamppb.New(ts)},
+		Progress: []*adminpb.OperationProgress{
+			{ProgressPercent: 100},
+			{ProgressPercent: 42},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := &longrunningpb.Operation{
+		Name:     "projects/p/instances/i/databases/d/operations/o",
+		Metadata: md,
+		Done:     true,
+		Result:   &longrunningpb.Operation_Error{Error: &status.Status{Code: int32(codes.FailedPrecondition), Message: "duplicate"}},
+	}
+	got, err := ddlOperationFromProto(op)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != op.Name || !got.Done || got.Err == nil {
+		t.Errorf("want failed operation %s, got %+v", op.Name, got)
+	}
+	if want := []int32{100, 42}; !reflect.DeepEqual(got.Progress, want) {
+		t.Errorf("want progress %v, got %v", want, got.Progress)
+	}
+	if want := []time.Time{ts}; !reflect.DeepEqual(got.CommitTimestamps, want) {
+		t.Errorf("want commit timestamps %v, got %v", want, got.CommitTimestamps)
+	}
+}
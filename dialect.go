@@ -0,0 +1,79 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/spanner"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+)
+
+// dialectQuery queries the SQL dialect of a database. It is valid
+// in both GoogleSQL and PostgreSQL.
+const dialectQuery = "SELECT option_value FROM information_schema.database_options WHERE option_name = 'database_dialect'"
+
+// detectDialect returns the SQL dialect of the database of client.
+func detectDialect(ctx context.Context, client *spanner.Client) (adminpb.DatabaseDialect, error) {
+	var v string
+	err := client.Single().Query(ctx, spanner.NewStatement(dialectQuery)).Do(func(r *spanner.Row) error {
+		return r.Column(0, &v)
+	})
+	if err != nil {
+		return adminpb.DatabaseDialect_DATABASE_DIALECT_UNSPECIFIED, fmt.Errorf("detect database dialect: %v", err)
+	}
+	d, ok := adminpb.DatabaseDialect_value[v]
+	if !ok {
+		return adminpb.DatabaseDialect_DATABASE_DIALECT_UNSPECIFIED, fmt.Errorf("unknown database dialect %q", v)
+	}
+	return adminpb.DatabaseDialect(d), nil
+}
+
+// databaseDialect returns the SQL dialect of the database, and
+// detects it first if the DSN doesn't set it. Failed detections
+// are retried by the next statement.
+func (sc *sharedClient) databaseDialect(ctx context.Context) (adminpb.DatabaseDialect, error) {
+	sc.dialectMu.Lock()
+	defer sc.dialectMu.Unlock()
+	if sc.dialect == adminpb.DatabaseDialect_DATABASE_DIALECT_UNSPECIFIED {
+		d, err := detectDialect(ctx, sc.client)
+		if err != nil {
+			return d, err
+		}
+		sc.dialect = d
+	}
+	return sc.dialect, nil
+}
+
+// parse parses query in the dialect of the database of c.
+func (c *conn) parse(ctx context.Context, query string) (*parsedStatement, error) {
+	if c.shared == nil {
+		return parseStatement(query), nil
+	}
+	// Client-side statements are the same in both dialects and
+	// don't need the database, e.g. to create it.
+	if cs, _ := parseClientSideStatement(query); cs != nil {
+		return parseStatement(query), nil
+	}
+	d, err := c.shared.databaseDialect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if d == adminpb.DatabaseDialect_POSTGRESQL {
+		return parsePGStatement(query), nil
+	}
+	return parseStatement(query), nil
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestPostgreSQLDialect(t *testing.T) {
+	var params map[string]*structpb.Value
+	db := openFakeSpanner(t, &fakeSpanner{dialect: "POSTGRESQL", query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		params = req.GetParams().GetFields()
+		pgNumeric := &sppb.Type{Code: sppb.TypeCode_NUMERIC, TypeAnnotation: sppb.TypeAnnotationCode_PG_NUMERIC}
+		return stream.Send(&sppb.PartialResultSet{
+			Metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{Fields: []*sppb.StructType_Field{
+				{Name: "id", Type: &sppb.Type{Code: sppb.TypeCode_INT64}},
+				{Name: "amount", Type: pgNumeric},
+				{Name: "tags", Type: arrayType(sppb.TypeCode_STRING)},
+			}}},
+			Values: []*structpb.Value{
+				stringValue("1"),
+				stringValue("NaN"),
+				structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{stringValue("a")}}),
+			},
+		})
+	}})
+
+	rows, err := db.QueryContext(context.Background(), "SELECT id, amount, tags FROM invoices WHERE owner = $2 AND id > $1", int64(0), "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	want := map[string]string{"p1": "0", "p2": "alice"}
+	for name, v := range want {
+		if got := params[name].GetStringValue(); got != v {
+			t.Errorf("parameter %s: got %q, want %q", name, got, v)
+		}
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, ct := range types {
+		names = append(names, ct.DatabaseTypeName())
+	}
+	if want := []string{"bigint", "numeric", "character varying[]"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got types %q, want %q", names, want)
+	}
+	if !rows.Next() {
+		t.Fatal(rows.Err())
+	}
+	var (
+		id     int64
+		amount string
+		tags   []spanner.NullString
+	)
+	if err := rows.Scan(&id, &amount, &tags); err != nil {
+		t.Fatal(err)
+	}
+	if amount != "NaN" {
+		t.Errorf("got amount %q, want NaN", amount)
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/rakyll/go-sql-driver-spanner/internal"
+)
+
+// StatementDigest returns a hash of the shape of query: query with its
+// literals removed, lists of literals collapsed and whitespace
+// collapsed. All executions of a statement have the same digest,
+// whatever values they contain. The digest is recorded with the
+// statement duration metric, in the logs of statements and as the
+// spanner.statement label of CPU profiles.
+func StatementDigest(query string) string {
+	h := fnv.New64a()
+	h.Write([]byte(internal.NormalizeStatement(query)))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
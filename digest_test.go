@@ -0,0 +1,28 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import "testing"
+
+func TestStatementDigest(t *testing.T) {
+	if StatementDigest("SELECT * FROM Singers WHERE Name = 'a'") == StatementDigest("SELECT * FROM Albums WHERE Name = 'a'") {
+		t.Error("statements of different tables have the same digest")
+	}
+	a := StatementDigest("SELECT * FROM Singers\n WHERE Id IN (1, 2) AND Name = 'a'")
+	b := StatementDigest("SELECT * FROM Singers WHERE Id IN (3, 4, 5) AND Name = 'b' -- retry")
+	if a != b {
+		t.Errorf("executions of a statement have the digests %s and %s", a, b)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+)
+
+var (
+	insertRe = regexp.MustCompile(`(?is)^\s*INSERT\s+(?:INTO\s+)?(\w+)\s*\(([^)]*)\)\s*VALUES\s*\(([^)]*)\)\s*;?\s*$`)
+	updateRe = regexp.MustCompile(`(?is)^\s*UPDATE\s+(\w+)\s+SET\s+(.+?)\s+WHERE\s+(.+?)\s*;?\s*$`)
+	deleteRe = regexp.MustCompile(`(?is)^\s*DELETE\s+(?:FROM\s+)?(\w+)\s+WHERE\s+(.+?)\s*;?\s*$`)
+
+	columnRe     = regexp.MustCompile(`^\s*(\w+)\s*$`)
+	paramRe      = regexp.MustCompile(`^\s*@(\w+)\s*$`)
+	assignmentRe = regexp.MustCompile(`^\s*(\w+)\s*=\s*@(\w+)\s*$`)
+	andRe        = regexp.MustCompile(`(?i)\s+AND\s+`)
+)
+
+// dmlMutation is a DML statement that writes one row
+// and can be applied as a mutation instead.
+type dmlMutation struct {
+	op    string // INSERT, UPDATE or DELETE
+	table string
+
+	// columns and values are the inserted or updated values.
+	columns []string
+	values  []interface{}
+
+	// keyColumns and keyValues are the columns and values
+	// of the WHERE clause of an UPDATE or DELETE.
+	keyColumns []string
+	keyValues  []interface{}
+}
+
+// parseDMLMutation parses statements of the forms
+//
+//	INSERT [INTO] t (c1, c2) VALUES (@p1, @p2)
+//	UPDATE t SET c1 = @p1 WHERE k1 = @k1 [AND k2 = @k2]
+//	DELETE [FROM] t WHERE k1 = @k1 [AND k2 = @k2]
+//
+// It returns nil for all other statements.
+func parseDMLMutation(ss spanner.Statement) *dmlMutation {
+	if m := insertRe.FindStringSubmatch(ss.SQL); m != nil {
+		cols := strings.Split(m[2], ",")
+		params := strings.Split(m[3], ",")
+		if len(cols) != len(params) {
+			return nil
+		}
+		d := &dmlMutation{op: "INSERT", table: m[1]}
+		for i := range cols {
+			c := columnRe.FindStringSubmatch(cols[i])
+			p := paramRe.FindStringSubmatch(params[i])
+			if c == nil || p == nil {
+				return nil
+			}
+			v, ok := ss.Params[p[1]]
+			if !ok {
+				return nil
+			}
+			d.columns = append(d.columns, c[1])
+			d.values = append(d.values, v)
+		}
+		return d
+	}
+	if m := updateRe.FindStringSubmatch(ss.SQL); m != nil {
+		d := &dmlMutation{op: "UPDATE", table: m[1]}
+		var ok bool
+		if d.columns, d.values, ok = parseAssignments(strings.Split(m[2], ","), ss.Params); !ok {
+			return nil
+		}
+		if d.keyColumns, d.keyValues, ok = parseAssignments(andRe.Split(m[3], -1), ss.Params); !ok {
+			return nil
+		}
+		return d
+	}
+	if m := deleteRe.FindStringSubmatch(ss.SQL); m != nil {
+		d := &dmlMutation{op: "DELETE", table: m[1]}
+		var ok bool
+		if d.keyColumns, d.keyValues, ok = parseAssignments(andRe.Split(m[2], -1), ss.Params); !ok {
+			return nil
+		}
+		return d
+	}
+	return nil
+}
+
+// parseAssignments parses a list of "column = @param" expressions.
+func parseAssignments(exprs []string, params map[string]interface{}) ([]string, []interface{}, bool) {
+	var cols []string
+	var vals []interface{}
+	for _, e := range exprs {
+		m := assignmentRe.FindStringSubmatch(e)
+		if m == nil {
+			return nil, nil, false
+		}
+		v, ok := params[m[2]]
+		if !ok {
+			return nil, nil, false
+		}
+		cols = append(cols, m[1])
+		vals = append(vals, v)
+	}
+	return cols, vals, true
+}
+
+// mutation returns the mutation that has the same effect as the
+// statement, given the primary key columns of its table. It returns
+// false if the WHERE clause of an UPDATE or DELETE does not specify
+// exactly one row.
+func (d *dmlMutation) mutation(primaryKey []string) (*spanner.Mutation, bool) {
+	if d.op == "INSERT" {
+		return spanner.Insert(d.table, d.columns, d.values), true
+	}
+	if len(d.keyColumns) != len(primaryKey) {
+		return nil, false
+	}
+	key := make(spanner.Key, len(primaryKey))
+	for i, pk := range primaryKey {
+		j := indexFold(d.keyColumns, pk)
+		if j < 0 {
+			return nil, false
+		}
+		key[i] = d.keyValues[j]
+	}
+	if d.op == "DELETE" {
+		return spanner.Delete(d.table, key), true
+	}
+	for _, c := range d.columns {
+		if indexFold(primaryKey, c) >= 0 {
+			return nil, false // Key updates are not allowed.
+		}
+	}
+	cols := append(append([]string{}, d.columns...), primaryKey...)
+	vals := append(append([]interface{}{}, d.values...), key...)
+	return spanner.Update(d.table, cols, vals), true
+}
+
+func indexFold(names []string, name string) int {
+	for i, n := range names {
+		if strings.EqualFold(n, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// applyAsMutation applies a DML statement outside of a transaction as
+// a mutation if the statement writes exactly one row. Updates are
+// idempotent, so they are committed at least once with a single Commit
+// RPC. Inserts are committed exactly once, so that a replayed commit
+// doesn't fail with AlreadyExists. It returns false if the statement
+// cannot be converted. Deletes are not converted: a mutation doesn't
+// report whether the row existed.
+func (c *conn) applyAsMutation(ctx context.Context, ss spanner.Statement) (bool, error) {
+	d := parseDMLMutation(ss)
+	if d == nil || d.op == "DELETE" {
+		return false, nil
+	}
+	var pk []string
+	if d.op != "INSERT" {
+		var err error
+		if pk, err = c.primaryKey(ctx, d.table); err != nil {
+			return false, err
+		}
+	}
+	m, ok := d.mutation(pk)
+	if !ok {
+		return false, nil
+	}
+	var opts []spanner.ApplyOption
+	if d.op == "UPDATE" {
+		opts = append(opts, spanner.ApplyAtLeastOnce())
+	}
+	_, err := c.Apply(ctx, []*spanner.Mutation{m}, opts...)
+	return true, err
+}
+
+// primaryKey returns the primary key columns of the table in
+// key order. They are cached for the life of the connection.
+func (c *conn) primaryKey(ctx context.Context, table string) ([]string, error) {
+	if pk, ok := c.primaryKeys[strings.ToUpper(table)]; ok {
+		return pk, nil
+	}
+	stmt := spanner.NewStatement(`SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.INDEX_COLUMNS
+WHERE TABLE_SCHEMA = '' AND UPPER(TABLE_NAME) = UPPER(@table) AND INDEX_TYPE = 'PRIMARY_KEY'
+ORDER BY ORDINAL_POSITION`)
+	stmt.Params["table"] = table
+	it := c.client.Single().Query(ctx, stmt)
+	defer it.Stop()
+	var pk []string
+	for {
+		row, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		var col string
+		if err := row.Columns(&col); err != nil {
+			return nil, err
+		}
+		pk = append(pk, col)
+	}
+	if c.primaryKeys == nil {
+		c.primaryKeys = make(map[string][]string)
+	}
+	c.primaryKeys[strings.ToUpper(table)] = pk
+	return pk, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestDMLMutation(t *testing.T) {
+	params := map[string]interface{}{"id": 1, "sub": 2, "name": "a"}
+	pk := []string{"Id", "SubId"}
+
+	tests := []struct {
+		sql  string
+		want *spanner.Mutation
+	}{
+		{
+			sql:  "INSERT INTO Singers (Id, Name) VALUES (@id, @name)",
+			want: spanner.Insert("Singers", []string{"Id", "Name"}, []interface{}{1, "a"}),
+		},
+		{
+			sql:  "insert Singers(Id) values(@id);",
+			want: spanner.Insert("Singers", []string{"Id"}, []interface{}{1}),
+		},
+		{
+			sql:  "UPDATE Singers SET Name = @name WHERE SubId = @sub AND Id = @id",
+			want: spanner.Update("Singers", []string{"Name", "Id", "SubId"}, []interface{}{"a", 1, 2}),
+		},
+		{
+			sql:  "DELETE FROM Singers WHERE subid = @sub and id = @id",
+			want: spanner.Delete("Singers", spanner.Key{1, 2}),
+		},
+		// Statements that don't write exactly one row by key.
+		{sql: "DELETE FROM Singers WHERE Id = @id"},
+		{sql: "DELETE FROM Singers WHERE Id = @id AND Name = @name"},
+		{sql: "UPDATE Singers SET Id = @id WHERE Id = @id AND SubId = @sub"},
+		{sql: "UPDATE Singers SET Name = 'b' WHERE Id = @id AND SubId = @sub"},
+		{sql: "DELETE FROM Singers WHERE Id > @id AND SubId = @sub"},
+		{sql: "INSERT INTO Singers (Id, Name) VALUES (@id, UPPER(@name))"},
+		{sql: "INSERT INTO Singers (Id, Name) VALUES (@id, @unknown)"},
+		{sql: "INSERT INTO Singers (Id, Name) SELECT Id, Name FROM Others"},
+	}
+	for _, tc := range tests {
+		ss := spanner.Statement{SQL: tc.sql, Params: params}
+		var got *spanner.Mutation
+		if d := parseDMLMutation(ss); d != nil {
+			got, _ = d.mutation(pk)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: want %v, got %v", tc.sql, tc.want, got)
+		}
+	}
+}
+
+func TestApplyAsMutation(t *testing.T) {
+	var mu sync.Mutex
+	var commits []*sppb.CommitRequest
+	var dml []string
+	openFakeSpanner(t, &fakeSpanner{
+		query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+			// The primary key of the table.
+			return stream.Send(&sppb.PartialResultSet{
+				Metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{Fields: []*sppb.StructType_Field{
+					{Name: "COLUMN_NAME", Type: &sppb.Type{Code: sppb.TypeCode_STRING}},
+				}}},
+				Values: []*structpb.Value{structpb.NewStringValue("SingerId")},
+			})
+		},
+		update: func(req *sppb.ExecuteSqlRequest) (*sppb.ResultSet, error) {
+			mu.Lock()
+			dml = append(dml, req.GetSql())
+			mu.Unlock()
+			var tx *sppb.Transaction
+			if req.GetTransaction().GetBegin() != nil {
+				tx = &sppb.Transaction{Id: []byte("tx")}
+			}
+			// The row to delete doesn't exist.
+			return &sppb.ResultSet{
+				Metadata: &sppb.ResultSetMetadata{Transaction: tx},
+				Stats:    &sppb.ResultSetStats{RowCount: &sppb.ResultSetStats_RowCountExact{RowCountExact: 0}},
+			}, nil
+		},
+		commit: func(req *sppb.CommitRequest) (*sppb.CommitResponse, error) {
+			mu.Lock()
+			commits = append(commits, req)
+			mu.Unlock()
+			return &sppb.CommitResponse{CommitTimestamp: timestamppb.Now()}, nil
+		},
+	})
+	d := &Driver{Config: spanner.ClientConfig{SessionPoolConfig: spanner.SessionPoolConfig{MinOpened: 0}}}
+	connector, err := d.OpenConnector("projects/p/instances/i/databases/d;dialect=googlesql;convertDmlToMutations=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	defer db.Close()
+	ctx := context.Background()
+
+	// Inserts are applied exactly once, in a transaction.
+	if _, err := db.ExecContext(ctx, "INSERT INTO Singers (SingerId, Name) VALUES (@id, @name)", sql.Named("id", 1), sql.Named("name", "a")); err != nil {
+		t.Fatal(err)
+	}
+	// Updates are applied at least once, with a single-use transaction.
+	if _, err := db.ExecContext(ctx, "UPDATE Singers SET Name = @name WHERE SingerId = @id", sql.Named("id", 1), sql.Named("name", "b")); err != nil {
+		t.Fatal(err)
+	}
+	if len(commits) != 2 || len(dml) != 0 {
+		t.Fatalf("got %d commits and DML %q, want 2 commits of mutations", len(commits), dml)
+	}
+	if commits[0].GetSingleUseTransaction() != nil {
+		t.Error("insert was applied at least once")
+	}
+	if commits[1].GetSingleUseTransaction() == nil {
+		t.Error("update was not applied at least once")
+	}
+
+	// Deletes run as DML, which reports the rows that were deleted.
+	res, err := db.ExecContext(ctx, "DELETE FROM Singers WHERE SingerId = @id", sql.Named("id", 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := res.RowsAffected(); err != nil || n != 0 {
+		t.Errorf("delete of a missing row: got %d rows affected, %v, want 0", n, err)
+	}
+	if len(dml) != 1 {
+		t.Errorf("delete was not executed as DML: %q", dml)
+	}
+}
@@ -19,17 +19,22 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"errors"
+	"fmt"
+	"log/slog"
 	"os"
-	"regexp"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/spanner"
 	"github.com/rakyll/go-sql-driver-spanner/internal"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/api/option"
 
 	adminapi "cloud.google.com/go/spanner/admin/database/apiv1"
-	adminpb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
 )
 
 const userAgent = "go-sql-driver-spanner/0.1"
@@ -49,47 +54,359 @@ type Driver struct {
 	// Options represent the optional Google Cloud client options
 	// to be passed to the underlying client.
 	Options []option.ClientOption
+
+	// Middlewares are applied to all queries and executed
+	// statements of the connections opened by this driver.
+	Middlewares []Middleware
+
+	// UnaryInterceptors and StreamInterceptors are installed on the
+	// gRPC channels of the Spanner client, in order, the first one
+	// being the outermost one. They run after the interceptors of
+	// the driver, and see the RPCs of all connections to a database.
+	UnaryInterceptors  []grpc.UnaryClientInterceptor
+	StreamInterceptors []grpc.StreamClientInterceptor
+
+	// MemoryLimiter, if set, bounds the memory held by decoded
+	// rows across all connections opened by this driver.
+	MemoryLimiter *MemoryLimiter
+
+	// OnTransactionRetry, if set, is called after a read-write
+	// transaction that Spanner aborted has finished, with the
+	// number of attempts and the outcome. Counting the calls
+	// shows where transactions contend for the same rows.
+	OnTransactionRetry func(TransactionRetry)
+
+	// LongRunningTransactions, if set, reports and optionally rolls
+	// back transactions that stay open for too long.
+	LongRunningTransactions *LongRunningTransactions
+
+	// LeakDetector, if set, tracks the rows and transactions of
+	// all connections to find those that are never closed.
+	LeakDetector *LeakDetector
+
+	// TracerProvider creates the spans of queries, executed
+	// statements and transactions. The global tracer provider
+	// is used if it is nil.
+	TracerProvider trace.TracerProvider
+
+	// Logger, if set, receives structured events: opened and
+	// closed connections and the classification of statements at
+	// debug level, retried transactions at info level, and
+	// long-running transactions at warning level, unless
+	// LongRunningTransactions has its own logger.
+	Logger *slog.Logger
+
+	// RequestTag, if set, returns the request tag of statements
+	// whose context has none, see WithRequestTag, e.g. to tag them
+	// with the route of the HTTP request that executes them.
+	RequestTag func(ctx context.Context, query string) string
+
+	// Hooks, if set, observe the statements and transactions
+	// of the connections opened by this driver.
+	Hooks Hooks
+
+	// OnAudit, if set, is called for each DDL and DML statement,
+	// once its transaction has ended, for audit logs of the changes
+	// of the schema and of the data.
+	OnAudit func(AuditEntry)
+
+	// OnSlowQuery, if set, is called for statements that take
+	// longer than the slowQueryThreshold connection parameter.
+	// Otherwise they are logged as warnings to Logger or, if it
+	// isn't set either, with the log package. Queries end when
+	// their rows are closed.
+	OnSlowQuery func(SlowQuery)
+
+	// MeterProvider, if set, records the metrics of the driver,
+	// such as the latency of statements and the outcome of
+	// transactions. It is also passed to the Spanner client,
+	// unless Config sets another meter provider.
+	MeterProvider metric.MeterProvider
 }
 
 // Open opens a connection to a Google Cloud Spanner database.
 // Use fully qualified string:
 //
 // Example: projects/$PROJECT/instances/$INSTANCE/databases/$DATABASE
+//
+// The name can be followed by semicolon separated connection parameters:
+//
+// Example: projects/$PROJECT/instances/$INSTANCE/databases/$DATABASE;readTimestamp=2020-01-01T00:00:00Z
+//
+// Supported parameters:
+//
+//   - readTimestamp: RFC 3339 timestamp at which all queries outside of
+//     read-write transactions read, including read-only transactions.
+//   - maxCommitDelay: duration, e.g. 100ms, that read-write transactions
+//     are willing to wait for Spanner to batch their commits.
+//   - excludeTxnFromChangeStreams: true to exclude the changes of read-write
+//     transactions from change streams that allow transaction exclusion.
+//   - readLockMode: optimistic or pessimistic locking for the reads
+//     of read-write transactions.
+//   - returnCommitStats: true to request the commit statistics of
+//     read-write transactions, which are recorded as metrics.
+//   - transactionTimeout: duration after which read-write transactions
+//     that have not committed are rolled back.
+//   - ddlInTransactionMode: fail (the default) to reject DDL statements
+//     in transactions, or autocommit to commit the transaction first.
+//   - asyncDdl: true to return from DDL statements once the schema change
+//     operation has been submitted instead of waiting for it to complete.
+//   - convertDmlToMutations: true to apply INSERT and UPDATE
+//     statements that write a single row by key as mutations when they
+//     are executed outside of a transaction.
+//   - createIfNotExists: true to create the database when it doesn't
+//     exist the first time a connection is opened.
+//   - bootstrapDdl: path of a file with semicolon separated DDL
+//     statements that are executed when the database is created.
+//   - warmupSessions: number of sessions that the session pool
+//     creates before the first connection to the database is
+//     returned. It raises SessionPoolConfig.MinOpened if needed.
+//   - borrowBytes: true to decode BYTES values into buffers that are
+//     only valid until the next row is read, see sql.RawBytes.
+//   - enableCompression: gzip to compress requests and responses,
+//     or none, the default.
+//   - keepaliveTime: duration, e.g. 1m, after which idle gRPC channels
+//     are pinged to keep them open behind NATs and firewalls.
+//   - keepaliveTimeout: duration after which a channel whose ping
+//     hasn't been answered is closed, 20s by default.
+//   - maxPrefetchRows: number of rows that queries read ahead of the
+//     application at most, 0 by default, which disables prefetching.
+//   - minPrefetchRows: number of rows that queries read ahead at
+//     least when prefetching is enabled, 1 by default.
+//   - sessionMaxAge: duration, e.g. 24h, after which the client and
+//     its sessions are replaced by a new client.
+//   - logStatements: true to log the wall time, the rows and the
+//     Spanner request IDs of each statement to Driver.Logger at
+//     debug level.
+//   - slowQueryThreshold: duration, e.g. 500ms, after which statements
+//     are reported to Driver.OnSlowQuery or logged.
+//   - pprofLabels: true to execute statements with pprof labels of
+//     their digest and transaction type, which CPU profiles show.
+//   - endToEndTracing: true to ask Spanner to trace the RPCs of the
+//     client on the server side, as part of the traces of the
+//     application.
+//   - sqlCommenter: true to append sqlcommenter comments with the
+//     trace context and the tags of WithSQLCommentTags to queries
+//     and DML statements.
+//   - dialect: googlesql or postgresql, the SQL dialect of the database.
+//     By default it is detected by the first statement.
 func (d *Driver) Open(name string) (driver.Conn, error) {
-	return openDriverConn(context.Background(), d, name)
+	c, err := d.OpenConnector(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.Connect(context.Background())
 }
 
 func (d *Driver) OpenConnector(name string) (driver.Connector, error) {
+	config, err := parseConnectorConfig(name)
+	if err != nil {
+		return nil, err
+	}
+	staleness, err := config.readOnlyStaleness()
+	if err != nil {
+		return nil, err
+	}
+	txOpts, err := config.transactionOptions()
+	if err != nil {
+		return nil, err
+	}
+	txTimeout, err := config.transactionTimeout()
+	if err != nil {
+		return nil, err
+	}
+	convertDML, err := config.convertDMLToMutations()
+	if err != nil {
+		return nil, err
+	}
+	autocommitDDL, err := config.autocommitDDL()
+	if err != nil {
+		return nil, err
+	}
+	asyncDDL, err := config.asyncDDL()
+	if err != nil {
+		return nil, err
+	}
+	create, bootstrap, err := config.createIfNotExists()
+	if err != nil {
+		return nil, err
+	}
+	warmup, err := config.warmupSessions()
+	if err != nil {
+		return nil, err
+	}
+	borrowBytes, err := config.borrowBytes()
+	if err != nil {
+		return nil, err
+	}
+	compression, err := config.compression()
+	if err != nil {
+		return nil, err
+	}
+	keepaliveParams, err := config.keepalive()
+	if err != nil {
+		return nil, err
+	}
+	prefetch, err := config.prefetch()
+	if err != nil {
+		return nil, err
+	}
+	sessionMaxAge, err := config.sessionMaxAge()
+	if err != nil {
+		return nil, err
+	}
+	logStatements, err := config.logStatements()
+	if err != nil {
+		return nil, err
+	}
+	slowQuery, err := config.slowQueryThreshold()
+	if err != nil {
+		return nil, err
+	}
+	endToEndTracing, err := config.endToEndTracing()
+	if err != nil {
+		return nil, err
+	}
+	pprofLabels, err := config.pprofLabels()
+	if err != nil {
+		return nil, err
+	}
+	sqlCommenter, err := config.sqlCommenter()
+	if err != nil {
+		return nil, err
+	}
+	dialect, err := config.dialect()
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := newDriverMetrics(d.MeterProvider)
+	if err != nil {
+		return nil, err
+	}
 	return &connector{
-		driver: d,
-		name:   name,
+		driver:            d,
+		config:            config,
+		readOnlyStaleness: staleness,
+		rwTxOptions:       txOpts,
+		rwTxTimeout:       txTimeout,
+		convertDML:        convertDML,
+		autocommitDDL:     autocommitDDL,
+		asyncDDL:          asyncDDL,
+		createIfNotExists: create,
+		bootstrapDDL:      bootstrap,
+		warmupSessions:    warmup,
+		borrowBytes:       borrowBytes,
+		compression:       compression,
+		keepalive:         keepaliveParams,
+		prefetch:          prefetch,
+		sessionMaxAge:     sessionMaxAge,
+		logStatements:     logStatements,
+		slowQuery:         slowQuery,
+		endToEndTracing:   endToEndTracing,
+		pprofLabels:       pprofLabels,
+		sqlCommenter:      sqlCommenter,
+		dialect:           dialect,
+		metrics:           metrics,
 	}, nil
 }
 
 type connector struct {
 	driver *Driver
-	name   string
-}
+	config connectorConfig
 
-func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
-	return openDriverConn(ctx, c.driver, c.name)
+	readOnlyStaleness staleness
+	rwTxOptions       spanner.TransactionOptions
+	rwTxTimeout       time.Duration
+	convertDML        bool
+	autocommitDDL     bool
+	asyncDDL          bool
+	createIfNotExists bool
+	bootstrapDDL      []string
+	warmupSessions    int
+	borrowBytes       bool
+	compression       string
+	keepalive         keepalive.ClientParameters
+	prefetch          prefetchBounds
+	sessionMaxAge     time.Duration
+	logStatements     bool
+	slowQuery         time.Duration
+	endToEndTracing   bool
+	pprofLabels       bool
+	sqlCommenter      bool
+	dialect           adminpb.DatabaseDialect
+	client            *spanner.Client // set by OpenDBFromClient
+	metrics           *driverMetrics
+
+	mu      sync.Mutex
+	created bool // whether createIfNotExists has been checked
 }
 
-func openDriverConn(ctx context.Context, d *Driver, name string) (driver.Conn, error) {
-	if d.Config.NumChannels == 0 {
-		d.Config.NumChannels = 1 // TODO(jbd): Explain database/sql has a high-level management.
+// ensureDatabase creates the database of the connector if
+// createIfNotExists is set and it doesn't exist yet.
+func (c *connector) ensureDatabase(ctx context.Context, adminClient *adminapi.DatabaseAdminClient) error {
+	if !c.createIfNotExists {
+		return nil
 	}
-	opts := append(d.Options, option.WithUserAgent(userAgent))
-	client, err := spanner.NewClientWithConfig(ctx, name, d.Config, opts...)
-	if err != nil {
-		return nil, err
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.created {
+		return nil
+	}
+	if err := createDatabaseIfNotExists(ctx, adminClient, c.config.name, c.dialect, c.bootstrapDDL); err != nil {
+		return err
 	}
+	c.created = true
+	return nil
+}
 
-	adminClient, err := createAdminClient(ctx)
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return openDriverConn(ctx, c)
+}
+
+func openDriverConn(ctx context.Context, c *connector) (driver.Conn, error) {
+	d := c.driver
+	shared, err := c.acquireClient(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return &conn{client: client, adminClient: adminClient, name: name}, nil
+	sc := &conn{
+		shared:                   shared,
+		client:                   shared.client,
+		adminClient:              shared.adminClient,
+		name:                     c.config.name,
+		dialect:                  c.dialect,
+		readOnlyStaleness:        c.readOnlyStaleness,
+		defaultReadOnlyStaleness: c.readOnlyStaleness,
+		rwTxOptions:              c.rwTxOptions,
+		rwTxTimeout:              c.rwTxTimeout,
+		convertDML:               c.convertDML,
+		autocommitDDL:            c.autocommitDDL,
+		asyncDDL:                 c.asyncDDL,
+		transportStats:           shared.stats,
+		memoryLimiter:            d.MemoryLimiter,
+		onRetry:                  d.OnTransactionRetry,
+		longRunning:              d.LongRunningTransactions,
+		leaks:                    d.LeakDetector,
+		borrowBytes:              c.borrowBytes,
+		prefetch:                 c.prefetch,
+		tracer:                   newTracer(d.TracerProvider),
+		metrics:                  c.metrics,
+		logStatements:            c.logStatements,
+		slowQueryThreshold:       c.slowQuery,
+		onSlowQuery:              d.OnSlowQuery,
+		hooks:                    d.Hooks,
+		requestTag:               d.RequestTag,
+		pprofLabels:              c.pprofLabels,
+		sqlCommenter:             c.sqlCommenter,
+		onAudit:                  d.OnAudit,
+	}
+	if d.Logger != nil {
+		sc.logger = d.Logger.With(slog.String("database", c.config.name))
+	}
+	sc.metrics.connectionsChanged(1)
+	sc.logEvent(ctx, slog.LevelDebug, "spanner connection opened")
+	sc.handler = chainMiddlewares(d.Middlewares, sc.executeStatement)
+	return sc, nil
 }
 
 func createAdminClient(ctx context.Context) (adminClient *adminapi.DatabaseAdminClient, err error) {
@@ -118,12 +435,322 @@ func (c *connector) Driver() driver.Driver {
 	return &Driver{}
 }
 
+// SpannerConn is the public interface for the raw Spanner connection
+// for the database/sql driver. It can be obtained from a *sql.Conn
+// through conn.Raw:
+//
+//	var ts time.Time
+//	err := conn.Raw(func(driverConn interface{}) (err error) {
+//		ts, err = driverConn.(spannerdriver.SpannerConn).CommitTimestamp()
+//		return err
+//	})
+type SpannerConn interface {
+	// CommitTimestamp returns the commit timestamp of the last
+	// read/write transaction that was committed on this connection,
+	// including implicit transactions of DML statements that were
+	// executed outside of a transaction. It returns an error if no
+	// read/write transaction has been committed since the last call
+	// to BeginTx.
+	CommitTimestamp() (time.Time, error)
+
+	// CommitResponse returns the commit response of the last
+	// read/write transaction that was committed on this connection.
+	// It returns an error under the same conditions as CommitTimestamp.
+	CommitResponse() (*spanner.CommitResponse, error)
+
+	// InTransaction reports whether the connection is in a
+	// transaction and InReadOnlyTransaction whether that
+	// transaction is read-only.
+	InTransaction() bool
+	InReadOnlyTransaction() bool
+
+	// ReadTimestamp returns the timestamp at which the current
+	// read-only transaction reads. It returns an error outside of
+	// a read-only transaction, or before the transaction has read.
+	ReadTimestamp() (time.Time, error)
+
+	// TransactionRetried reports whether the client library retried
+	// the last read/write transaction on this connection because
+	// Spanner aborted it, including implicit transactions of DML
+	// statements. Transactions started with BeginTx are not retried;
+	// their commit fails with an error if Spanner aborts them.
+	TransactionRetried() bool
+
+	// BeginReadWriteStmtBasedTransaction starts a read/write transaction
+	// that is controlled by the caller instead of database/sql, for
+	// capabilities that database/sql cannot express. The transaction
+	// uses the read/write transaction options of the connection, and
+	// those in ctx. It is independent of the transactions of the
+	// connection and must be committed or rolled back by the caller:
+	//
+	//	tx, err := driverConn.(spannerdriver.SpannerConn).BeginReadWriteStmtBasedTransaction(ctx)
+	//	...
+	//	resp, err := tx.CommitWithReturnResp(ctx)
+	BeginReadWriteStmtBasedTransaction(ctx context.Context) (*spanner.ReadWriteStmtBasedTransaction, error)
+
+	// Client returns the Spanner client that the connection shares
+	// with the other connections to the database, for features that
+	// the driver doesn't wrap. It must not be closed.
+	Client() *spanner.Client
+
+	// ReadOnlyTransaction and ReadWriteTransaction return the current
+	// transaction of the connection, or nil outside of a transaction
+	// of that kind. They are only valid until the transaction ends.
+	// Statements and mutations that are executed on them directly are
+	// part of the transaction, but the driver doesn't know about them:
+	// they are not replayed after a rollback to a savepoint, nor
+	// reported to hooks and audit logs.
+	//
+	//	err := conn.Raw(func(driverConn any) error {
+	//		tx := driverConn.(spannerdriver.SpannerConn).ReadWriteTransaction()
+	//		return tx.BufferWrite([]*spanner.Mutation{m})
+	//	})
+	ReadOnlyTransaction() *spanner.ReadOnlyTransaction
+	ReadWriteTransaction() *spanner.ReadWriteTransaction
+
+	// TransportStats returns the transport-level counters of the
+	// gRPC channels that this connection shares with the other
+	// connections to the database.
+	TransportStats() TransportStats
+
+	// SessionPoolStats returns the statistics of the sessions that
+	// this connection shares with the other connections to the
+	// database, see also PublishSessionPoolStats.
+	SessionPoolStats() SessionPoolStats
+
+	// StartBatchDML starts a DML batch on the connection. DML statements
+	// that are executed while the batch is active are buffered and
+	// affect zero rows until the batch is run. RunBatch sends them to
+	// Spanner in one round trip and returns the update count of each
+	// statement. AbortBatch discards the buffered statements.
+	//
+	// A batch that is started in a read-write transaction belongs to the
+	// transaction. It must be run or aborted before the transaction is
+	// committed. A batch that is started outside of a transaction is run
+	// in a new read-write transaction.
+	//
+	// The same can be achieved with the START BATCH DML, RUN BATCH and
+	// ABORT BATCH statements.
+	StartBatchDML() error
+
+	// StartBatchDDL starts a DDL batch on the connection. DDL statements
+	// that are executed while the batch is active are buffered until
+	// RunBatch sends them to Spanner in one schema change operation,
+	// which then returns no update counts. DDL batches cannot be started
+	// in transactions. The same can be achieved with the START BATCH DDL
+	// statement.
+	StartBatchDDL() error
+
+	RunBatch(ctx context.Context) ([]int64, error)
+
+	// DDLOperationName returns the name of the long-running operation
+	// of the last DDL statement or DDL batch on this connection. With
+	// the asyncDdl connection parameter, DDL statements return once
+	// the operation has been submitted, and the name can be used to
+	// poll the operation.
+	DDLOperationName() (string, error)
+
+	// DDLOperation polls the schema change operation with the given
+	// name. DDLOperations lists the schema change operations of the
+	// database, or only those that are in flight, e.g. to show the
+	// progress of index backfills.
+	DDLOperation(ctx context.Context, name string) (DDLOperation, error)
+	DDLOperations(ctx context.Context, inFlight bool) ([]DDLOperation, error)
+	AbortBatch() error
+
+	// BufferWrite buffers mutations in the current read-write
+	// transaction. They are applied atomically with the DML of
+	// the transaction when it commits. Use the BufferWrite
+	// function to buffer mutations in a *sql.Tx.
+	BufferWrite(ms []*spanner.Mutation) error
+
+	// BatchWrite applies the mutation groups with the BatchWrite RPC.
+	// Each group is applied atomically, but groups are applied
+	// independently and in no particular order. It cannot be used
+	// in a transaction. Use the BatchWrite function to call it on
+	// a *sql.DB.
+	BatchWrite(ctx context.Context, mgs []*spanner.MutationGroup) (*spanner.BatchWriteResponseIterator, error)
+
+	// Apply applies the mutations outside of a transaction and
+	// returns the commit timestamp. Pass spanner.ApplyAtLeastOnce()
+	// to commit idempotent writes in one round trip. Use the Apply
+	// function to call it on a *sql.DB.
+	Apply(ctx context.Context, ms []*spanner.Mutation, opts ...spanner.ApplyOption) (time.Time, error)
+}
+
+var _ SpannerConn = &conn{}
+
 type conn struct {
+	// shared is the client that the connection shares with
+	// the other connections to the database.
+	shared      *sharedClient
 	client      *spanner.Client
 	adminClient *adminapi.DatabaseAdminClient
 	roTx        *spanner.ReadOnlyTransaction
 	rwTx        *rwTx
 	name        string
+
+	// dialect is the dialect of the DSN, or
+	// DATABASE_DIALECT_UNSPECIFIED. It is the dialect of
+	// the databases that CREATE DATABASE creates.
+	dialect adminpb.DatabaseDialect
+
+	// readOnlyStaleness is used for all queries outside of read-write
+	// transactions. It can be changed with SET READ_ONLY_STALENESS
+	// and is reset to defaultReadOnlyStaleness.
+	readOnlyStaleness        staleness
+	defaultReadOnlyStaleness staleness
+
+	// rwTxOptions are the default options for read-write transactions.
+	rwTxOptions spanner.TransactionOptions
+	// rwTxTimeout is the default timeout of read-write transactions.
+	rwTxTimeout time.Duration
+
+	// convertDML applies single-row DML outside of transactions
+	// as mutations. primaryKeys caches the primary key columns
+	// of the tables, keyed by upper-case table name.
+	convertDML  bool
+	primaryKeys map[string][]string
+
+	// generatedKeys caches the identity columns and columns with
+	// sequence defaults of the tables, keyed by upper-case table name.
+	generatedKeys map[string][]string
+
+	// autocommitDDL commits the current transaction before
+	// a DDL statement instead of rejecting the statement.
+	autocommitDDL bool
+
+	// commitResp is the commit response of the last
+	// read/write transaction on this connection.
+	commitResp *spanner.CommitResponse
+	// retried is set if the last read/write transaction was retried.
+	retried bool
+	onRetry func(TransactionRetry)
+
+	longRunning *LongRunningTransactions
+	leaks       *LeakDetector
+
+	// borrowBytes decodes BYTES values of rows into buffers
+	// that are reused for the next row.
+	borrowBytes bool
+	// prefetch bounds the rows that queries read ahead.
+	prefetch prefetchBounds
+
+	transportStats *transportStats
+
+	// tracer creates the spans of the connection, and
+	// metrics records its measurements, if it is not nil.
+	tracer  trace.Tracer
+	metrics *driverMetrics
+	// logger receives the events of the connection, if it is not nil.
+	// logStatements logs each statement with its wall time, rows
+	// and request IDs at debug level.
+	logger        *slog.Logger
+	logStatements bool
+
+	// slowQueryThreshold is the duration after which statements
+	// are reported to onSlowQuery or logged.
+	slowQueryThreshold time.Duration
+	onSlowQuery        func(SlowQuery)
+
+	// hooks observe statements and transactions, if not nil.
+	hooks Hooks
+	// requestTag returns the default request tag of statements.
+	requestTag func(ctx context.Context, query string) string
+	// pprofLabels executes statements with pprof labels.
+	pprofLabels bool
+	// sqlCommenter appends sqlcommenter comments to statements.
+	sqlCommenter bool
+	// onAudit records DDL and DML statements, if not nil.
+	onAudit func(AuditEntry)
+
+	// handler executes statements through the middleware chain.
+	handler StatementHandler
+
+	// batch is the active DML batch outside of a transaction.
+	batch *dmlBatch
+	// ddlBatch is the active DDL batch.
+	ddlBatch *ddlBatch
+	// asyncDDL returns from DDL statements without waiting for
+	// them. ddlOperation is the name of the last DDL operation.
+	asyncDDL     bool
+	ddlOperation string
+
+	memoryLimiter *MemoryLimiter
+
+	// stmtTx is the transaction that was started with a
+	// BEGIN statement instead of BeginTx, if any.
+	stmtTx driver.Tx
+}
+
+func (c *conn) CommitTimestamp() (time.Time, error) {
+	resp, err := c.CommitResponse()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return resp.CommitTs, nil
+}
+
+func (c *conn) CommitResponse() (*spanner.CommitResponse, error) {
+	if c.commitResp == nil {
+		return nil, errors.New("this connection has not executed a read/write transaction that committed successfully")
+	}
+	return c.commitResp, nil
+}
+
+func (c *conn) InTransaction() bool {
+	return c.roTx != nil || c.rwTx != nil
+}
+
+func (c *conn) InReadOnlyTransaction() bool {
+	return c.roTx != nil
+}
+
+func (c *conn) ReadTimestamp() (time.Time, error) {
+	if c.roTx == nil {
+		return time.Time{}, errors.New("not in a read-only transaction")
+	}
+	return c.roTx.Timestamp()
+}
+
+func (c *conn) TransactionRetried() bool {
+	return c.retried
+}
+
+func (c *conn) BeginReadWriteStmtBasedTransaction(ctx context.Context) (*spanner.ReadWriteStmtBasedTransaction, error) {
+	return spanner.NewReadWriteStmtBasedTransactionWithOptions(ctx, c.client, mergeTransactionOptions(ctx, c.rwTxOptions))
+}
+
+func (c *conn) Client() *spanner.Client {
+	return c.client
+}
+
+func (c *conn) ReadOnlyTransaction() *spanner.ReadOnlyTransaction {
+	return c.roTx
+}
+
+func (c *conn) ReadWriteTransaction() *spanner.ReadWriteTransaction {
+	if c.rwTx == nil || c.rwTx.connector == nil {
+		return nil
+	}
+	return c.rwTx.connector.Tx
+}
+
+func (c *conn) TransportStats() TransportStats {
+	return c.transportStats.snapshot()
+}
+
+func (c *conn) SessionPoolStats() SessionPoolStats {
+	return c.sessionStats().snapshot()
+}
+
+// sessionStats returns the session statistics of the client
+// of the connection, or nil if the connection has no client.
+func (c *conn) sessionStats() *sessionStats {
+	if c.transportStats == nil {
+		return nil
+	}
+	return &c.transportStats.sessions
 }
 
 func (c *conn) Prepare(query string) (driver.Stmt, error) {
@@ -132,43 +759,219 @@ func (c *conn) Prepare(query string) (driver.Stmt, error) {
 
 func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
 	// TODO(jbd): Mention emails need to be escaped.
-	args, err := internal.NamedValueParamNames(query, -1)
+	p, err := c.parse(ctx, query)
 	if err != nil {
 		return nil, err
 	}
-	return &stmt{conn: c, query: query, numArgs: len(args)}, nil
+	return &stmt{conn: c, query: query, parsed: p}, nil
 }
 
 func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	ctx = c.withDefaultRequestTag(ctx, query)
+	ctx, hookEnd := c.startQueryHook(ctx, StatementKindExec, query, args)
+	ctx, span := c.startStatementSpan(ctx, StatementKindExec, query)
+	c.logStatement(ctx, StatementKindExec, query)
+	ctx, log := c.startStatementLog(ctx, StatementKindExec, query)
+	var res driver.Result
+	var err error
+	c.withProfilerLabels(ctx, query, func(ctx context.Context) {
+		res, err = c.execContext(ctx, query, args)
+	})
+	c.audit(query, err)
+	endSpan(span, err)
+	log.execDone(ctx, res, err)
+	c.metrics.statementExecuted(ctx, StatementKindExec, query, start, err)
+	hookEnd(rowsAffected(res), err)
+	return res, err
+}
 
-	// Use admin API if DDL statement is provided.
-	isDdl, err := isDdl(query)
+func (c *conn) execContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if ms, ok := mutationsFromArgs(query, args); ok {
+		if err := c.BufferWrite(ms); err != nil {
+			return nil, err
+		}
+		return &result{rowsAffected: 0}, nil
+	}
+	res, err := c.handler(ctx, Statement{Kind: StatementKindExec, SQL: query, Args: args})
 	if err != nil {
 		return nil, err
 	}
+	return res.Result, nil
+}
 
-	if isDdl {
-		op, err := c.adminClient.UpdateDatabaseDdl(ctx, &adminpb.UpdateDatabaseDdlRequest{
-			Database:   c.name,
-			Statements: []string{query},
-		})
-		if err != nil {
-			return nil, err
+// QueryContext executes queries without preparing them first, so that
+// arguments such as PartitionedQuery that aren't query parameters
+// pass through database/sql.
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.queryContext(ctx, query, args)
+}
+
+func (c *conn) queryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	ctx = c.withDefaultRequestTag(ctx, query)
+	ctx, hookEnd := c.startQueryHook(ctx, StatementKindQuery, query, args)
+	ctx, span := c.startStatementSpan(ctx, StatementKindQuery, query)
+	c.logStatement(ctx, StatementKindQuery, query)
+	ctx, log := c.startStatementLog(ctx, StatementKindQuery, query)
+	var res StatementResult
+	var err error
+	c.withProfilerLabels(ctx, query, func(ctx context.Context) {
+		res, err = c.handler(ctx, Statement{Kind: StatementKindQuery, SQL: query, Args: args})
+	})
+	c.audit(query, err)
+	c.metrics.statementExecuted(ctx, StatementKindQuery, query, start, err)
+	if err != nil {
+		endSpan(span, err)
+		log.done(ctx, 0, err)
+		hookEnd(0, err)
+		return nil, err
+	}
+	if r, ok := res.Rows.(*rows); ok {
+		// The span ends when the rows are closed,
+		// which records and logs the rows that were read.
+		r.span = span
+		r.metrics = c.metrics
+		r.log = log
+		r.hookEnd = hookEnd
+	} else {
+		span.End()
+		log.done(ctx, -1, nil)
+		hookEnd(-1, nil)
+	}
+	return res.Rows, nil
+}
+
+// executeStatement is the innermost StatementHandler of a connection.
+// Configuration errors are returned as ConfigError until
+// the first RPC of the client succeeds.
+func (c *conn) executeStatement(ctx context.Context, stmt Statement) (StatementResult, error) {
+	if stmt.Kind == StatementKindQuery {
+		rows, err := c.query(ctx, stmt.SQL, stmt.Args)
+		return StatementResult{Rows: rows}, c.shared.checkConfig(err)
+	}
+	res, err := c.exec(ctx, stmt.SQL, stmt.Args)
+	return StatementResult{Result: res}, c.shared.checkConfig(err)
+}
+
+func (c *conn) query(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	encodeStart := time.Now()
+	p, err := c.parse(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if p.clientSide != nil {
+		return c.execClientSideQuery(ctx, p.clientSide, p.clientSideParams)
+	}
+	if c.dmlBatch() != nil {
+		return nil, errors.New("queries are not allowed while a DML batch is active")
+	}
+	if p.typ == internal.StatementTypeDDL {
+		return nil, errors.New("DDL statements must be executed with ExecContext")
+	}
+	pq, args, partitioned := partitionedQueryFromArgs(args)
+	ss, err := p.spannerStatement(c.withSQLComment(ctx, p.sql), args)
+	if err != nil {
+		return nil, err
+	}
+	latency := statementLatencyFrom(ctx)
+	latency.encoded(encodeStart)
+	release := func() {}
+	if c.roTx == nil && c.rwTx == nil {
+		// The query holds a session until its rows are closed.
+		ctx = c.sessionStats().withSessionWait(ctx)
+		release = c.sessionStats().hold()
+	}
+
+	it, err := c.prefetched(ctx, func(ctx context.Context) (rowIterator, error) {
+		switch {
+		case partitioned:
+			return c.queryPartitioned(ctx, ss, pq)
+		case c.roTx != nil:
+			return taggedQuery(ctx, c.roTx, ss), nil
+		case c.rwTx != nil:
+			return c.rwTx.Query(ctx, ss)
+		case p.typ == internal.StatementTypeDML:
+			return c.queryInNewRWTransaction(ctx, ss)
 		}
-		if err := op.Wait(ctx); err != nil {
-			return nil, err
+		return taggedQuery(ctx, c.client.Single().WithTimestampBound(c.readOnlyStaleness.bound), ss), nil
+	})
+	if err != nil {
+		release()
+		return nil, err
+	}
+	untrack := c.leaks.track("rows")
+	done := func() {
+		untrack()
+		release()
+	}
+	r := &rows{it: it, ctx: ctx, limiter: c.memoryLimiter, done: done, shared: c.shared, borrowBytes: c.borrowBytes, latency: latency, postgreSQL: p.postgreSQL}
+	if err := r.readFirst(); err != nil {
+		r.Close()
+		return nil, err
+	}
+	latency.readFirstRow()
+	return r, nil
+}
+
+func (c *conn) exec(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	encodeStart := time.Now()
+	p, err := c.parse(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if cs := p.clientSide; cs != nil {
+		if cs.exec == nil {
+			return nil, fmt.Errorf("%s must be executed with QueryContext", cs.name)
 		}
-		return &result{rowsAffected: 0}, nil
+		return cs.exec(ctx, c, p.clientSideParams)
+	}
+	if queries := p.statements; len(queries) > 1 {
+		if allDDL(queries) {
+			return c.execDDL(ctx, queries, protoDescriptorsFromArgs(args))
+		}
+		return c.execDMLStatements(ctx, p.sql, queries, args)
+	}
+
+	// Use admin API if DDL statement is provided.
+	switch p.typ {
+	case internal.StatementTypeDDL:
+		return c.execDDL(ctx, []string{query}, protoDescriptorsFromArgs(args))
+	case internal.StatementTypeQuery:
+		return nil, errors.New("queries must be executed with QueryContext")
+	}
+	if c.ddlBatch != nil {
+		return nil, errors.New("only DDL statements can be executed while a DDL batch is active")
 	}
 
 	if c.roTx != nil {
 		return nil, errors.New("cannot write in read-only transaction")
 	}
-	ss, err := prepareSpannerStmt(query, args)
+	ss, err := p.spannerStatement(p.sql, args)
 	if err != nil {
 		return nil, err
 	}
+	statementLatencyFrom(ctx).encoded(encodeStart)
+
+	if b := c.dmlBatch(); b != nil {
+		ss.SQL = c.withSQLComment(ctx, ss.SQL)
+		b.statements = append(b.statements, ss)
+		return &result{rowsAffected: 0}, nil
+	}
 
+	if c.rwTx == nil && c.convertDML {
+		applied, err := c.applyAsMutation(ctx, ss)
+		if err != nil {
+			return nil, err
+		}
+		if applied {
+			return &result{rowsAffected: 1}, nil
+		}
+	}
+
+	// The comment is appended after the DML has been converted,
+	// which parses the statement.
+	ss.SQL = c.withSQLComment(ctx, ss.SQL)
 	var rowsAffected int64
 	if c.rwTx == nil {
 		rowsAffected, err = c.execContextInNewRWTransaction(ctx, ss)
@@ -181,18 +984,79 @@ func (c *conn) ExecContext(ctx context.Context, query string, args []driver.Name
 	return &result{rowsAffected: rowsAffected}, nil
 }
 
-func isDdl(query string) (bool, error) {
+// isDdl reports whether query is a DDL statement. Comments and
+// statement hints before the first keyword are ignored.
+func isDdl(query string) bool {
+	return parseStatement(query).typ == internal.StatementTypeDDL
+}
 
-	matchddl, err := regexp.MatchString(`(?is)^\n*\s*(CREATE|DROP|ALTER)\s+.+$`, query)
-	if err != nil {
-		return false, err
+var _ driver.Pinger = &conn{}
+
+// Ping verifies the connectivity and the credentials with a
+// SELECT 1 round trip. Configuration problems are returned as
+// ConfigError.
+func (c *conn) Ping(ctx context.Context) error {
+	if c.client == nil {
+		return driver.ErrBadConn
+	}
+	it := c.client.Single().Query(ctx, spanner.NewStatement("SELECT 1"))
+	defer it.Stop()
+	_, err := it.Next()
+	return c.shared.checkConfig(err)
+}
+
+var _ driver.SessionResetter = &conn{}
+
+// ResetSession is called before the connection is reused. It rolls
+// back a transaction that was started with BEGIN and not ended,
+// discards active batches and resets the variables that were
+// changed with SET statements.
+func (c *conn) ResetSession(ctx context.Context) error {
+	if err := c.rollbackStatementTransaction(); err != nil {
+		// The state of the connection is unknown.
+		return driver.ErrBadConn
+	}
+	if tx := c.rwTx; tx != nil {
+		// database/sql returned the connection without ending
+		// its transaction, e.g. because Commit failed early.
+		if err := tx.Rollback(); err != nil || c.rwTx != nil {
+			return driver.ErrBadConn
+		}
 	}
+	c.batch = nil
+	c.ddlBatch = nil
+	c.readOnlyStaleness = c.defaultReadOnlyStaleness
+	return nil
+}
 
-	return matchddl, nil
+// rollbackStatementTransaction rolls back the transaction that
+// was started with BEGIN, if any, so that its session is
+// returned to the session pool.
+func (c *conn) rollbackStatementTransaction() error {
+	if c.stmtTx == nil {
+		return nil
+	}
+	tx := c.stmtTx
+	c.stmtTx = nil
+	return tx.Rollback()
+}
+
+var _ driver.Validator = &conn{}
+
+// IsValid reports whether the client of the connection can still
+// be used, and isn't older than sessionMaxAge. database/sql
+// discards connections that aren't valid.
+func (c *conn) IsValid() bool {
+	return c.shared == nil || !c.shared.broken.Load() && !c.shared.expired(time.Now())
 }
 
 func (c *conn) Close() error {
-	c.client.Close()
+	// database/sql closes connections that exceeded SetConnMaxLifetime
+	// without resetting them first.
+	c.rollbackStatementTransaction()
+	c.shared.release()
+	c.metrics.connectionsChanged(-1)
+	c.logEvent(context.Background(), slog.LevelDebug, "spanner connection closed")
 	return nil
 }
 
@@ -201,52 +1065,160 @@ func (c *conn) Begin() (driver.Tx, error) {
 }
 
 func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
-	if c.inTransaction() {
+	txType := txTypeReadWrite
+	if opts.ReadOnly {
+		txType = txTypeReadOnly
+	}
+	_, span := c.startSpan(ctx, "spanner.Begin", attrTransactionType.String(txType))
+	// The RPCs of the transaction are not traced as children of
+	// the span, which ends before the transaction does.
+	telemetry := &txTelemetry{ctx: ctx, conn: c, txType: txType, begin: time.Now()}
+	tx, err := c.beginTx(ctx, opts, telemetry)
+	endSpan(span, err)
+	c.metrics.failed(ctx, "Begin", err)
+	if err != nil {
+		c.hookError(ctx, err)
+	} else if c.hooks != nil {
+		telemetry.ctx = c.hooks.OnTxBegin(ctx, TxEvent{ReadOnly: opts.ReadOnly})
+	}
+	return tx, err
+}
+
+// beginTx starts a transaction whose Commit
+// and Rollback are traced with telemetry.
+func (c *conn) beginTx(ctx context.Context, opts driver.TxOptions, telemetry *txTelemetry) (driver.Tx, error) {
+	if c.InTransaction() {
 		return nil, errors.New("already in a transaction")
 	}
+	if c.batch != nil || c.ddlBatch != nil {
+		return nil, errors.New("cannot begin a transaction while a batch is active")
+	}
+	c.commitResp = nil
+	c.retried = false
 
 	if opts.ReadOnly {
-		c.roTx = c.client.ReadOnlyTransaction().WithTimestampBound(spanner.StrongRead())
-		return &roTx{close: func() {
-			c.roTx.Close()
-			c.roTx = nil
+		ro := c.client.ReadOnlyTransaction().WithTimestampBound(c.readOnlyStaleness.bound)
+		c.roTx = ro
+		stop := c.longRunning.watch("read-only", nil, c.logger)
+		done := c.leaks.track("read-only transaction")
+		release := c.sessionStats().hold()
+		return &roTx{telemetry: telemetry, close: func() {
+			stop()
+			done()
+			release()
+			ro.Close()
+			// The transaction may already have
+			// ended before a DDL statement.
+			if c.roTx == ro {
+				c.roTx = nil
+			}
 		}}, nil
 	}
 
-	connector := internal.NewRWConnector(ctx, c.client)
-	c.rwTx = &rwTx{
-		connector: connector,
-		close: func() {
-			c.rwTx = nil
-		},
+	txOpts := mergeTransactionOptions(ctx, c.rwTxOptions)
+	// The timeout covers the transactions that are started
+	// again after a rollback to a savepoint.
+	txCtx, cancelTimeout := c.withTransactionTimeout(ctx)
+	txCtx, rollback := context.WithCancelCause(c.sessionStats().withSessionWait(txCtx))
+	cancel := func() {
+		rollback(nil)
+		cancelTimeout()
 	}
-
-	// TODO(jbd): Make sure we are not leaking
-	// a goroutine in connector if timeout happens.
-	select {
-	case <-connector.Ready:
-		return c.rwTx, nil
-	case err := <-connector.Errors: // If received before Ready, transaction failed to start.
+	begin := func() (*internal.RWConnector, error) {
+		return startRWConnector(txCtx, c.client, txOpts)
+	}
+	connector, err := begin()
+	if err != nil {
+		cancel()
 		return nil, err
-	case <-time.Tick(10 * time.Second):
-		return nil, errors.New("cannot begin transaction, timeout after 10 seconds")
 	}
+	stop := c.longRunning.watch("read-write", rollback, c.logger)
+	done := c.leaks.track("read-write transaction")
+	release := c.sessionStats().hold()
+	tx := &rwTx{connector: connector, begin: begin, telemetry: telemetry}
+	tx.close = func(commitResp *spanner.CommitResponse, err error) {
+		if c.rwTx != tx {
+			return // Already closed.
+		}
+		stop()
+		done()
+		release()
+		cancel()
+		c.transactionFinished(tx.connector.Attempts(), err)
+		c.rwTx = nil
+		c.commitResp = commitResp
+		c.emitAudit(tx.audit, commitResp, nil)
+	}
+	c.rwTx = tx
+	return tx, nil
 }
 
-func (c *conn) inTransaction() bool {
-	return c.roTx != nil || c.rwTx != nil
+// withTransactionTimeout returns a context that expires when a
+// read-write transaction that is started with ctx times out.
+func (c *conn) withTransactionTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := transactionTimeout(ctx, c.rwTxTimeout)
+	if timeout == 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// runInNewRWTransaction runs fn in a new read-write transaction that
+// the client library retries if Spanner aborts it. The transaction
+// is recorded by the metrics, session statistics, traces and retry
+// hooks of the connection like transactions started with BeginTx.
+func (c *conn) runInNewRWTransaction(ctx context.Context, fn func(context.Context, *spanner.ReadWriteTransaction) error) error {
+	c.commitResp = nil
+	ctx, cancel := c.withTransactionTimeout(ctx)
+	defer cancel()
+	ctx = c.sessionStats().withSessionWait(ctx)
+	defer c.sessionStats().hold()()
+	attempts := 0
+	resp, err := c.client.ReadWriteTransactionWithOptions(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		attempts++
+		c.hookRetry(ctx, attempts)
+		return fn(ctx, tx)
+	}, mergeTransactionOptions(ctx, c.rwTxOptions))
+	c.transactionFinished(attempts, err)
+	c.metrics.transactionEnded(ctx, txTypeReadWrite, transactionOutcome(false, err))
+	trace.SpanFromContext(ctx).SetAttributes(retryCount(attempts))
+	if err != nil {
+		return err
+	}
+	c.commitResp = &resp
+	return nil
 }
 
 func (c *conn) execContextInNewRWTransaction(ctx context.Context, statement spanner.Statement) (int64, error) {
 	var rowsAffected int64
-	fn := func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
-		count, err := tx.Update(ctx, statement)
+	err := c.runInNewRWTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		count, err := taggedUpdate(ctx, tx, statement)
 		rowsAffected = count
 		return err
-	}
-	_, err := c.client.ReadWriteTransaction(ctx, fn)
+	})
 	if err != nil {
 		return 0, err
 	}
 	return rowsAffected, nil
 }
+
+// queryInNewRWTransaction executes a DML statement with a THEN RETURN
+// clause in a new read-write transaction. Its rows are read before the
+// transaction commits, so they are buffered.
+func (c *conn) queryInNewRWTransaction(ctx context.Context, statement spanner.Statement) (rowIterator, error) {
+	var buffered *bufferedIterator
+	err := c.runInNewRWTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		it := taggedQuery(ctx, tx, statement)
+		buffered = &bufferedIterator{}
+		err := it.Do(func(row *spanner.Row) error {
+			buffered.rows = append(buffered.rows, row)
+			return nil
+		})
+		buffered.metadata = it.Metadata
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return buffered, nil
+}
@@ -17,6 +17,7 @@ package spannerdriver
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"os"
 	"reflect"
 	"testing"
@@ -188,7 +189,7 @@ func TestQueryContext(t *testing.T) {
 }
 
 // note: isDdl function does not check validity of statement
-// just that the statement begins with a DDL instruction.
+// just that the statement begins with a DDL keyword.
 // Other checking performed by database.
 func TestIsDdl(t *testing.T) {
 
@@ -297,13 +298,50 @@ func TestIsDdl(t *testing.T) {
 			input: `0CREATE TABLE Valid`,
 			want:  false,
 		},
+		{
+			name:  "leading comments",
+			input: "-- create the table\n/* v2 */ CREATE TABLE Valid",
+			want:  true,
+		},
+		{
+			name:  "commented insert (not ddl)",
+			input: "/* CREATE TABLE */ INSERT INTO Valid",
+			want:  false,
+		},
+		{
+			name:  "hinted select (not ddl)",
+			input: "@{STATEMENT_TAG='create'} SELECT 1",
+			want:  false,
+		},
+		{
+			name:  "grant",
+			input: "GRANT SELECT ON TABLE Valid TO ROLE Reader",
+			want:  true,
+		},
+		{
+			name:  "revoke",
+			input: "revoke SELECT ON TABLE Valid FROM ROLE Reader",
+			want:  true,
+		},
+		{
+			name:  "analyze",
+			input: "ANALYZE",
+			want:  true,
+		},
+		{
+			name:  "rename",
+			input: "RENAME TABLE Valid TO Renamed",
+			want:  true,
+		},
+		{
+			name:  "keyword prefix (not ddl)",
+			input: "CREATED TABLE Valid",
+			want:  false,
+		},
 	}
 
 	for _, tc := range tests {
-		got, err := isDdl(tc.input)
-		if err != nil {
-			t.Error(err)
-		}
+		got := isDdl(tc.input)
 		if got != tc.want {
 			t.Errorf("isDdl test failed, %s: wanted %t got %t.", tc.name, tc.want, got)
 		}
@@ -661,3 +699,10 @@ func TestExecContextDml(t *testing.T) {
 	}
 
 }
+
+func TestPingClosedConn(t *testing.T) {
+	c := &conn{}
+	if err := c.Ping(context.Background()); err != driver.ErrBadConn {
+		t.Errorf("Ping() = %v, want driver.ErrBadConn", err)
+	}
+}
@@ -0,0 +1,406 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/rakyll/go-sql-driver-spanner/internal"
+	"google.golang.org/grpc/keepalive"
+)
+
+var dsnRegex = regexp.MustCompile(`^projects/[^/;]+/instances/[^/;]+/databases/[^/;]+$`)
+
+// connectorConfig is the parsed form of a data source name.
+//
+// A data source name is a fully qualified database name that
+// is optionally followed by semicolon separated key=value pairs:
+//
+// Example: projects/$PROJECT/instances/$INSTANCE/databases/$DATABASE;readTimestamp=2020-01-01T00:00:00Z
+type connectorConfig struct {
+	name   string
+	params map[string]string // keys are lower case
+}
+
+// knownParams are the connection parameters. Other parameters are
+// rejected, so that a misspelled parameter isn't silently ignored.
+var knownParams = []string{
+	"readTimestamp", "maxCommitDelay", "excludeTxnFromChangeStreams", "readLockMode",
+	"returnCommitStats", "transactionTimeout", "convertDmlToMutations", "ddlInTransactionMode",
+	"asyncDdl", "createIfNotExists", "bootstrapDdl", "warmupSessions",
+	"borrowBytes", "enableCompression", "keepaliveTime", "keepaliveTimeout", "minPrefetchRows",
+	"maxPrefetchRows", "sessionMaxAge", "logStatements", "slowQueryThreshold", "pprofLabels",
+	"endToEndTracing", "sqlCommenter", "dialect",
+}
+
+func parseConnectorConfig(dsn string) (connectorConfig, error) {
+	parts := strings.Split(dsn, ";")
+	name := strings.TrimSpace(parts[0])
+	if !dsnRegex.MatchString(name) {
+		return connectorConfig{}, fmt.Errorf("invalid database name %q, expected projects/PROJECT/instances/INSTANCE/databases/DATABASE", name)
+	}
+	params := make(map[string]string)
+	for _, p := range parts[1:] {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 {
+			return connectorConfig{}, fmt.Errorf("invalid connection parameter %q, expected key=value", p)
+		}
+		key := strings.TrimSpace(kv[0])
+		if !slices.ContainsFunc(knownParams, func(p string) bool { return strings.EqualFold(p, key) }) {
+			return connectorConfig{}, fmt.Errorf("unknown connection parameter %q", key)
+		}
+		params[strings.ToLower(key)] = strings.TrimSpace(kv[1])
+	}
+	return connectorConfig{name: name, params: params}, nil
+}
+
+// readOnlyStaleness returns the staleness that is used for
+// queries outside of read-write transactions.
+func (c connectorConfig) readOnlyStaleness() (staleness, error) {
+	v, ok := c.params["readtimestamp"]
+	if !ok {
+		return strongStaleness, nil
+	}
+	if _, err := time.Parse(time.RFC3339Nano, v); err != nil {
+		return staleness{}, fmt.Errorf("invalid readTimestamp %q: %v", v, err)
+	}
+	return parseStaleness("READ_TIMESTAMP " + v)
+}
+
+// transactionOptions returns the default options
+// for read-write transactions.
+func (c connectorConfig) transactionOptions() (spanner.TransactionOptions, error) {
+	var opts spanner.TransactionOptions
+	if v, ok := c.params["maxcommitdelay"]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return spanner.TransactionOptions{}, fmt.Errorf("invalid maxCommitDelay %q: %v", v, err)
+		}
+		opts.CommitOptions.MaxCommitDelay = &d
+	}
+	if v, ok := c.params["excludetxnfromchangestreams"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return spanner.TransactionOptions{}, fmt.Errorf("invalid excludeTxnFromChangeStreams %q: %v", v, err)
+		}
+		opts.ExcludeTxnFromChangeStreams = b
+	}
+	if v, ok := c.params["readlockmode"]; ok {
+		m, ok := sppb.TransactionOptions_ReadWrite_ReadLockMode_value[strings.ToUpper(v)]
+		if !ok || m == 0 {
+			return spanner.TransactionOptions{}, fmt.Errorf("invalid readLockMode %q, expected optimistic or pessimistic", v)
+		}
+		opts.ReadLockMode = sppb.TransactionOptions_ReadWrite_ReadLockMode(m)
+	}
+	if v, ok := c.params["returncommitstats"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return spanner.TransactionOptions{}, fmt.Errorf("invalid returnCommitStats %q: %v", v, err)
+		}
+		opts.CommitOptions.ReturnCommitStats = b
+	}
+	return opts, nil
+}
+
+// convertDMLToMutations reports whether simple DML statements outside
+// of transactions are applied as mutations.
+func (c connectorConfig) convertDMLToMutations() (bool, error) {
+	v, ok := c.params["convertdmltomutations"]
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid convertDmlToMutations %q: %v", v, err)
+	}
+	return b, nil
+}
+
+// autocommitDDL reports whether DDL statements in a transaction
+// commit the transaction first instead of failing.
+func (c connectorConfig) autocommitDDL() (bool, error) {
+	switch v := strings.ToLower(c.params["ddlintransactionmode"]); v {
+	case "", "fail":
+		return false, nil
+	case "autocommit":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid ddlInTransactionMode %q, expected fail or autocommit", v)
+	}
+}
+
+// asyncDDL reports whether DDL statements return once the
+// schema change operation has been submitted.
+func (c connectorConfig) asyncDDL() (bool, error) {
+	v, ok := c.params["asyncddl"]
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid asyncDdl %q: %v", v, err)
+	}
+	return b, nil
+}
+
+// createIfNotExists reports whether the database is created when
+// it doesn't exist, and returns the statements of the bootstrapDdl
+// file that are executed when it is created.
+func (c connectorConfig) createIfNotExists() (bool, []string, error) {
+	v, ok := c.params["createifnotexists"]
+	if !ok {
+		if _, ok := c.params["bootstrapddl"]; ok {
+			return false, nil, fmt.Errorf("bootstrapDdl requires createIfNotExists=true")
+		}
+		return false, nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, nil, fmt.Errorf("invalid createIfNotExists %q: %v", v, err)
+	}
+	path, ok := c.params["bootstrapddl"]
+	if !ok || !b {
+		return b, nil, nil
+	}
+	ddl, err := os.ReadFile(path)
+	if err != nil {
+		return false, nil, fmt.Errorf("invalid bootstrapDdl: %v", err)
+	}
+	return b, internal.SplitStatements(string(ddl)), nil
+}
+
+// transactionTimeout returns the default time between beginning
+// and committing a read-write transaction, or 0 for no timeout.
+func (c connectorConfig) transactionTimeout() (time.Duration, error) {
+	v, ok := c.params["transactiontimeout"]
+	if !ok {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid transactionTimeout %q", v)
+	}
+	return d, nil
+}
+
+// warmupSessions returns the number of sessions that are created
+// before the first connection to the database is returned.
+func (c connectorConfig) warmupSessions() (int, error) {
+	v, ok := c.params["warmupsessions"]
+	if !ok {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid warmupSessions %q", v)
+	}
+	return n, nil
+}
+
+// borrowBytes reports whether BYTES values are decoded into buffers
+// that are reused for the next row instead of new byte slices.
+func (c connectorConfig) borrowBytes() (bool, error) {
+	v, ok := c.params["borrowbytes"]
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid borrowBytes %q: %v", v, err)
+	}
+	return b, nil
+}
+
+// logStatements reports whether statements are logged
+// with their wall time, rows and request IDs.
+func (c connectorConfig) logStatements() (bool, error) {
+	v, ok := c.params["logstatements"]
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid logStatements %q: %v", v, err)
+	}
+	return b, nil
+}
+
+// sqlCommenter reports whether sqlcommenter
+// comments are appended to statements.
+func (c connectorConfig) sqlCommenter() (bool, error) {
+	v, ok := c.params["sqlcommenter"]
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid sqlCommenter %q: %v", v, err)
+	}
+	return b, nil
+}
+
+// pprofLabels reports whether statements are executed
+// with pprof labels of the statement.
+func (c connectorConfig) pprofLabels() (bool, error) {
+	v, ok := c.params["pproflabels"]
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid pprofLabels %q: %v", v, err)
+	}
+	return b, nil
+}
+
+// endToEndTracing reports whether Spanner traces
+// the RPCs of the client on the server side.
+func (c connectorConfig) endToEndTracing() (bool, error) {
+	v, ok := c.params["endtoendtracing"]
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid endToEndTracing %q: %v", v, err)
+	}
+	return b, nil
+}
+
+// compression returns the compression of the gRPC messages
+// of the client: "gzip", or "" for no compression.
+func (c connectorConfig) compression() (string, error) {
+	switch v := strings.ToLower(c.params["enablecompression"]); v {
+	case "", "none":
+		return "", nil
+	case "gzip":
+		return v, nil
+	default:
+		return "", fmt.Errorf("invalid enableCompression %q, expected gzip or none", v)
+	}
+}
+
+// dialect returns the SQL dialect of the database, or
+// DATABASE_DIALECT_UNSPECIFIED if the dialect is detected
+// when the client of the database is created.
+func (c connectorConfig) dialect() (adminpb.DatabaseDialect, error) {
+	switch v := strings.ToLower(c.params["dialect"]); v {
+	case "":
+		return adminpb.DatabaseDialect_DATABASE_DIALECT_UNSPECIFIED, nil
+	case "googlesql":
+		return adminpb.DatabaseDialect_GOOGLE_STANDARD_SQL, nil
+	case "postgresql":
+		return adminpb.DatabaseDialect_POSTGRESQL, nil
+	default:
+		return 0, fmt.Errorf("invalid dialect %q, expected googlesql or postgresql", v)
+	}
+}
+
+// sessionMaxAge returns the age after which the client of the
+// database is replaced, or 0 if clients are used until they are
+// closed.
+func (c connectorConfig) sessionMaxAge() (time.Duration, error) {
+	v, ok := c.params["sessionmaxage"]
+	if !ok {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid sessionMaxAge %q", v)
+	}
+	return d, nil
+}
+
+// slowQueryThreshold returns the duration after which statements
+// are slow, or 0 if slow statements aren't reported.
+func (c connectorConfig) slowQueryThreshold() (time.Duration, error) {
+	v, ok := c.params["slowquerythreshold"]
+	if !ok {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid slowQueryThreshold %q", v)
+	}
+	return d, nil
+}
+
+// prefetch returns the bounds of the number of rows that queries
+// read ahead of the application.
+func (c connectorConfig) prefetch() (prefetchBounds, error) {
+	b := prefetchBounds{min: 1}
+	for _, param := range []struct {
+		name string
+		n    *int
+	}{
+		{"minPrefetchRows", &b.min},
+		{"maxPrefetchRows", &b.max},
+	} {
+		v, ok := c.params[strings.ToLower(param.name)]
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return b, fmt.Errorf("invalid %s %q", param.name, v)
+		}
+		*param.n = n
+	}
+	if b.max > 0 && (b.min < 1 || b.min > b.max) {
+		return b, fmt.Errorf("minPrefetchRows must be between 1 and maxPrefetchRows %d, got %d", b.max, b.min)
+	}
+	return b, nil
+}
+
+// keepalive returns the keepalive parameters of the gRPC channels.
+// Keepalive pings are disabled unless keepaliveTime is set.
+func (c connectorConfig) keepalive() (keepalive.ClientParameters, error) {
+	var p keepalive.ClientParameters
+	for _, param := range []struct {
+		name string
+		d    *time.Duration
+	}{
+		{"keepaliveTime", &p.Time},
+		{"keepaliveTimeout", &p.Timeout},
+	} {
+		v, ok := c.params[strings.ToLower(param.name)]
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return p, fmt.Errorf("invalid %s %q", param.name, v)
+		}
+		*param.d = d
+	}
+	if p.Time == 0 && p.Timeout != 0 {
+		return p, fmt.Errorf("keepaliveTimeout requires keepaliveTime")
+	}
+	// Idle connections are the ones that silently die.
+	p.PermitWithoutStream = p.Time != 0
+	return p, nil
+}
@@ -0,0 +1,486 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/grpc/keepalive"
+)
+
+func TestParseConnectorConfig(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		input     string
+		want      connectorConfig
+		wantError bool
+	}{
+		{
+			name:  "database name only",
+			input: "projects/p/instances/i/databases/d",
+			want:  connectorConfig{name: "projects/p/instances/i/databases/d", params: map[string]string{}},
+		},
+		{
+			name:  "with parameters",
+			input: "projects/p/instances/i/databases/d;readTimestamp=2020-01-01T00:00:00Z; MaxCommitDelay = 10ms;",
+			want: connectorConfig{
+				name:   "projects/p/instances/i/databases/d",
+				params: map[string]string{"readtimestamp": "2020-01-01T00:00:00Z", "maxcommitdelay": "10ms"},
+			},
+		},
+		{
+			name:      "unknown parameter",
+			input:     "projects/p/instances/i/databases/d;readTimestmp=2020-01-01T00:00:00Z",
+			wantError: true,
+		},
+		{
+			name:      "missing database",
+			input:     "projects/p/instances/i",
+			wantError: true,
+		},
+		{
+			name:      "parameter without value",
+			input:     "projects/p/instances/i/databases/d;readTimestamp",
+			wantError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		got, err := parseConnectorConfig(tc.input)
+		if (err != nil) != tc.wantError {
+			t.Errorf("%s: wanted error %t, got %v", tc.name, tc.wantError, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: want: %v, got: %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestReadOnlyStaleness(t *testing.T) {
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		input     string
+		want      spanner.TimestampBound
+		wantError bool
+	}{
+		{
+			name:  "default",
+			input: "projects/p/instances/i/databases/d",
+			want:  spanner.StrongRead(),
+		},
+		{
+			name:  "read timestamp",
+			input: "projects/p/instances/i/databases/d;readTimestamp=2020-01-01T00:00:00Z",
+			want:  spanner.ReadTimestamp(ts),
+		},
+		{
+			name:      "invalid read timestamp",
+			input:     "projects/p/instances/i/databases/d;readTimestamp=yesterday",
+			wantError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		config, err := parseConnectorConfig(tc.input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got, err := config.readOnlyStaleness()
+		if (err != nil) != tc.wantError {
+			t.Errorf("%s: wanted error %t, got %v", tc.name, tc.wantError, err)
+			continue
+		}
+		if err == nil && got.bound.String() != tc.want.String() {
+			t.Errorf("%s: want: %v, got: %v", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestTransactionOptions(t *testing.T) {
+	delay := 100 * time.Millisecond
+
+	tests := []struct {
+		name        string
+		input       string
+		want        *time.Duration
+		wantExclude bool
+		wantLock    sppb.TransactionOptions_ReadWrite_ReadLockMode
+		wantStats   bool
+		wantError   bool
+	}{
+		{
+			name:  "default",
+			input: "projects/p/instances/i/databases/d",
+		},
+		{
+			name:  "max commit delay",
+			input: "projects/p/instances/i/databases/d;maxCommitDelay=100ms",
+			want:  &delay,
+		},
+		{
+			name:      "invalid max commit delay",
+			input:     "projects/p/instances/i/databases/d;maxCommitDelay=100",
+			wantError: true,
+		},
+		{
+			name:        "exclude from change streams",
+			input:       "projects/p/instances/i/databases/d;excludeTxnFromChangeStreams=true",
+			wantExclude: true,
+		},
+		{
+			name:     "read lock mode",
+			input:    "projects/p/instances/i/databases/d;readLockMode=Optimistic",
+			wantLock: sppb.TransactionOptions_ReadWrite_OPTIMISTIC,
+		},
+		{
+			name:      "invalid read lock mode",
+			input:     "projects/p/instances/i/databases/d;readLockMode=read_lock_mode_unspecified",
+			wantError: true,
+		},
+		{
+			name:      "return commit stats",
+			input:     "projects/p/instances/i/databases/d;returnCommitStats=true",
+			wantStats: true,
+		},
+		{
+			name:      "invalid return commit stats",
+			input:     "projects/p/instances/i/databases/d;returnCommitStats=yes please",
+			wantError: true,
+		},
+		{
+			name:      "invalid exclude from change streams",
+			input:     "projects/p/instances/i/databases/d;excludeTxnFromChangeStreams=maybe",
+			wantError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		config, err := parseConnectorConfig(tc.input)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		got, err := config.transactionOptions()
+		if (err != nil) != tc.wantError {
+			t.Errorf("%s: wanted error %t, got %v", tc.name, tc.wantError, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got.CommitOptions.MaxCommitDelay, tc.want) {
+			t.Errorf("%s: want: %v, got: %v", tc.name, tc.want, got.CommitOptions.MaxCommitDelay)
+		}
+		if err == nil && got.ReadLockMode != tc.wantLock {
+			t.Errorf("%s: want read lock mode %v, got %v", tc.name, tc.wantLock, got.ReadLockMode)
+		}
+		if err == nil && got.ExcludeTxnFromChangeStreams != tc.wantExclude {
+			t.Errorf("%s: want exclude %t, got %t", tc.name, tc.wantExclude, got.ExcludeTxnFromChangeStreams)
+		}
+		if err == nil && got.CommitOptions.ReturnCommitStats != tc.wantStats {
+			t.Errorf("%s: want commit stats %t, got %t", tc.name, tc.wantStats, got.CommitOptions.ReturnCommitStats)
+		}
+	}
+}
+
+func TestTransactionTimeoutParam(t *testing.T) {
+	config, err := parseConnectorConfig("projects/p/instances/i/databases/d;transactionTimeout=30s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := config.transactionTimeout(); err != nil || got != 30*time.Second {
+		t.Errorf("want 30s, got %v, %v", got, err)
+	}
+
+	config, err = parseConnectorConfig("projects/p/instances/i/databases/d;transactionTimeout=-1s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.transactionTimeout(); err == nil {
+		t.Error("negative timeout: expected error")
+	}
+}
+
+func TestDDLInTransactionMode(t *testing.T) {
+	for input, want := range map[string]bool{
+		"projects/p/instances/i/databases/d":                                 false,
+		"projects/p/instances/i/databases/d;ddlInTransactionMode=fail":       false,
+		"projects/p/instances/i/databases/d;ddlInTransactionMode=AutoCommit": true,
+	} {
+		config, err := parseConnectorConfig(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := config.autocommitDDL(); err != nil || got != want {
+			t.Errorf("%s: want %t, got %t, %v", input, want, got, err)
+		}
+	}
+	config, err := parseConnectorConfig("projects/p/instances/i/databases/d;ddlInTransactionMode=ignore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.autocommitDDL(); err == nil {
+		t.Error("invalid mode: expected error")
+	}
+}
+
+func TestAsyncDDL(t *testing.T) {
+	config, err := parseConnectorConfig("projects/p/instances/i/databases/d;asyncDdl=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := config.asyncDDL(); err != nil || !got {
+		t.Errorf("want async DDL, got %t, %v", got, err)
+	}
+	if _, err := (&conn{}).DDLOperationName(); err == nil {
+		t.Error("DDLOperationName without DDL: expected error")
+	}
+}
+
+func TestCreateIfNotExists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.sql")
+	ddl := "CREATE TABLE a (id INT64) PRIMARY KEY (id);\n-- comment\nCREATE INDEX a_by_id ON a (id);\n"
+	if err := os.WriteFile(path, []byte(ddl), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		dsn      string
+		want     bool
+		wantStmt int
+		wantErr  bool
+	}{
+		{dsn: "projects/p/instances/i/databases/d"},
+		{dsn: "projects/p/instances/i/databases/d;createIfNotExists=true", want: true},
+		{dsn: "projects/p/instances/i/databases/d;createIfNotExists=true;bootstrapDdl=" + path, want: true, wantStmt: 2},
+		{dsn: "projects/p/instances/i/databases/d;createIfNotExists=false;bootstrapDdl=" + path},
+		{dsn: "projects/p/instances/i/databases/d;bootstrapDdl=" + path, wantErr: true},
+		{dsn: "projects/p/instances/i/databases/d;createIfNotExists=yes", wantErr: true},
+		{dsn: "projects/p/instances/i/databases/d;createIfNotExists=true;bootstrapDdl=/does/not/exist.sql", wantErr: true},
+	}
+	for _, tc := range tests {
+		config, err := parseConnectorConfig(tc.dsn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, stmts, err := config.createIfNotExists()
+		if (err != nil) != tc.wantErr {
+			t.Errorf("%s: got error %v, want error %t", tc.dsn, err, tc.wantErr)
+			continue
+		}
+		if got != tc.want || len(stmts) != tc.wantStmt {
+			t.Errorf("%s: got %t with %d statements, want %t with %d", tc.dsn, got, len(stmts), tc.want, tc.wantStmt)
+		}
+	}
+}
+
+func TestWarmupSessions(t *testing.T) {
+	config, err := parseConnectorConfig("projects/p/instances/i/databases/d;warmupSessions=25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := config.warmupSessions(); err != nil || got != 25 {
+		t.Errorf("want 25, got %d, %v", got, err)
+	}
+	config, err = parseConnectorConfig("projects/p/instances/i/databases/d;warmupSessions=-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.warmupSessions(); err == nil {
+		t.Error("negative warmupSessions: expected error")
+	}
+}
+
+func TestBorrowBytes(t *testing.T) {
+	config, err := parseConnectorConfig("projects/p/instances/i/databases/d;borrowBytes=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := config.borrowBytes(); err != nil || !got {
+		t.Errorf("want borrowed bytes, got %t, %v", got, err)
+	}
+}
+
+func TestLogStatements(t *testing.T) {
+	config, err := parseConnectorConfig("projects/p/instances/i/databases/d;logStatements=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := config.logStatements(); err != nil || !got {
+		t.Errorf("want logged statements, got %t, %v", got, err)
+	}
+}
+
+func TestPprofLabels(t *testing.T) {
+	config, err := parseConnectorConfig("projects/p/instances/i/databases/d;pprofLabels=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := config.pprofLabels(); err != nil || !got {
+		t.Errorf("want pprof labels, got %t, %v", got, err)
+	}
+}
+
+func TestSQLCommenter(t *testing.T) {
+	config, err := parseConnectorConfig("projects/p/instances/i/databases/d;sqlCommenter=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := config.sqlCommenter(); err != nil || !got {
+		t.Errorf("want sqlcommenter, got %t, %v", got, err)
+	}
+}
+
+func TestEndToEndTracing(t *testing.T) {
+	config, err := parseConnectorConfig("projects/p/instances/i/databases/d;endToEndTracing=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := config.endToEndTracing(); err != nil || !got {
+		t.Errorf("want end-to-end tracing, got %t, %v", got, err)
+	}
+}
+
+func TestSlowQueryThreshold(t *testing.T) {
+	config, err := parseConnectorConfig("projects/p/instances/i/databases/d;slowQueryThreshold=500ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := config.slowQueryThreshold(); err != nil || got != 500*time.Millisecond {
+		t.Errorf("got %v, %v, want 500ms", got, err)
+	}
+	config, err = parseConnectorConfig("projects/p/instances/i/databases/d;slowQueryThreshold=0s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.slowQueryThreshold(); err == nil {
+		t.Error("zero slowQueryThreshold: expected error")
+	}
+}
+
+func TestCompression(t *testing.T) {
+	for input, want := range map[string]string{
+		"projects/p/instances/i/databases/d":                        "",
+		"projects/p/instances/i/databases/d;enableCompression=GZIP": "gzip",
+		"projects/p/instances/i/databases/d;enableCompression=none": "",
+	} {
+		config, err := parseConnectorConfig(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := config.compression(); err != nil || got != want {
+			t.Errorf("%s: want %q, got %q, %v", input, want, got, err)
+		}
+	}
+	config, err := parseConnectorConfig("projects/p/instances/i/databases/d;enableCompression=zstd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.compression(); err == nil {
+		t.Error("unsupported compression: expected error")
+	}
+}
+
+func TestDialect(t *testing.T) {
+	for input, want := range map[string]adminpb.DatabaseDialect{
+		"projects/p/instances/i/databases/d":                    adminpb.DatabaseDialect_DATABASE_DIALECT_UNSPECIFIED,
+		"projects/p/instances/i/databases/d;dialect=GoogleSQL":  adminpb.DatabaseDialect_GOOGLE_STANDARD_SQL,
+		"projects/p/instances/i/databases/d;dialect=postgresql": adminpb.DatabaseDialect_POSTGRESQL,
+	} {
+		config, err := parseConnectorConfig(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := config.dialect(); err != nil || got != want {
+			t.Errorf("%s: want %v, got %v, %v", input, want, got, err)
+		}
+	}
+	config, err := parseConnectorConfig("projects/p/instances/i/databases/d;dialect=mysql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.dialect(); err == nil {
+		t.Error("unsupported dialect: expected error")
+	}
+}
+
+func TestKeepalive(t *testing.T) {
+	config, err := parseConnectorConfig("projects/p/instances/i/databases/d;keepaliveTime=1m;keepaliveTimeout=10s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := keepalive.ClientParameters{Time: time.Minute, Timeout: 10 * time.Second, PermitWithoutStream: true}
+	if got, err := config.keepalive(); err != nil || got != want {
+		t.Errorf("want %+v, got %+v, %v", want, got, err)
+	}
+	for _, input := range []string{
+		"projects/p/instances/i/databases/d;keepaliveTime=soon",
+		"projects/p/instances/i/databases/d;keepaliveTimeout=10s",
+	} {
+		config, err := parseConnectorConfig(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := config.keepalive(); err == nil {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+}
+
+func TestPrefetch(t *testing.T) {
+	config, err := parseConnectorConfig("projects/p/instances/i/databases/d;maxPrefetchRows=64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := config.prefetch(); err != nil || got != (prefetchBounds{min: 1, max: 64}) {
+		t.Errorf("got %+v, %v", got, err)
+	}
+	for _, input := range []string{
+		"projects/p/instances/i/databases/d;maxPrefetchRows=many",
+		"projects/p/instances/i/databases/d;minPrefetchRows=8;maxPrefetchRows=4",
+		"projects/p/instances/i/databases/d;minPrefetchRows=0;maxPrefetchRows=4",
+	} {
+		config, err := parseConnectorConfig(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := config.prefetch(); err == nil {
+			t.Errorf("%s: expected error", input)
+		}
+	}
+}
+
+func TestSessionMaxAge(t *testing.T) {
+	config, err := parseConnectorConfig("projects/p/instances/i/databases/d;sessionMaxAge=24h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := config.sessionMaxAge(); err != nil || got != 24*time.Hour {
+		t.Errorf("got %v, %v, want 24h", got, err)
+	}
+	config, err = parseConnectorConfig("projects/p/instances/i/databases/d;sessionMaxAge=-1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.sessionMaxAge(); err == nil {
+		t.Error("negative sessionMaxAge: expected error")
+	}
+}
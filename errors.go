@@ -0,0 +1,135 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"errors"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Errors that the errors of statements, commits and rollbacks match
+// with errors.Is if they failed with the corresponding gRPC code:
+//
+//	_, err := db.ExecContext(ctx, "INSERT INTO Singers (SingerId) VALUES (1)")
+//	if errors.Is(err, spannerdriver.ErrAlreadyExists) {
+//		...
+//	}
+var (
+	ErrCanceled           error = codeError(codes.Canceled)
+	ErrInvalidArgument    error = codeError(codes.InvalidArgument)
+	ErrDeadlineExceeded   error = codeError(codes.DeadlineExceeded)
+	ErrNotFound           error = codeError(codes.NotFound)
+	ErrAlreadyExists      error = codeError(codes.AlreadyExists)
+	ErrPermissionDenied   error = codeError(codes.PermissionDenied)
+	ErrResourceExhausted  error = codeError(codes.ResourceExhausted)
+	ErrFailedPrecondition error = codeError(codes.FailedPrecondition)
+	ErrAborted            error = codeError(codes.Aborted)
+	ErrOutOfRange         error = codeError(codes.OutOfRange)
+	ErrUnimplemented      error = codeError(codes.Unimplemented)
+	ErrInternal           error = codeError(codes.Internal)
+	ErrUnavailable        error = codeError(codes.Unavailable)
+	ErrUnauthenticated    error = codeError(codes.Unauthenticated)
+)
+
+type codeError codes.Code
+
+func (c codeError) Error() string {
+	return "spannerdriver: " + codes.Code(c).String()
+}
+
+// Error is the error of a statement, a commit or a rollback that
+// failed with a gRPC status code. Its message is the message of
+// the underlying error, which is usually a *spanner.Error.
+//
+// Errors match the Err variables of their code with errors.Is,
+// and are found with errors.As:
+//
+//	var spannerErr *spannerdriver.Error
+//	if errors.As(err, &spannerErr) && spannerErr.Code == codes.Aborted {
+//		...
+//	}
+type Error struct {
+	// Code is the gRPC status code of the error.
+	Code codes.Code
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the Err variable of the code of e.
+func (e *Error) Is(target error) bool {
+	c, ok := target.(codeError)
+	return ok && codes.Code(c) == e.Code
+}
+
+// GRPCStatus returns the status of the underlying error,
+// so that status.Code and status.FromError work with e.
+func (e *Error) GRPCStatus() *status.Status {
+	if s, ok := status.FromError(e.Err); ok {
+		return s
+	}
+	return status.New(e.Code, e.Err.Error())
+}
+
+// Code returns the gRPC status code of err, or of the error that
+// err wraps. It returns OK if err is nil and Unknown if err has no
+// code, e.g. because the driver rejected a statement before it was
+// sent to Spanner.
+func Code(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	var cfgErr *ConfigError
+	if errors.As(err, &cfgErr) {
+		return cfgErr.Code
+	}
+	if s, ok := status.FromError(err); ok {
+		return s.Code()
+	}
+	return codes.Unknown
+}
+
+// newError wraps an error with a gRPC status code in an Error.
+// Errors without a code and errors that the driver has already
+// wrapped are returned as they are.
+func newError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	var cfgErr *ConfigError
+	if errors.As(err, &e) || errors.As(err, &cfgErr) {
+		return err
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	return &Error{Code: s.Code(), Err: err}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCode(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want codes.Code
+	}{
+		{nil, codes.OK},
+		{errors.New("not sent"), codes.Unknown},
+		{status.Error(codes.NotFound, "not found"), codes.NotFound},
+		{fmt.Errorf("wrapped: %w", status.Error(codes.Aborted, "aborted")), codes.Aborted},
+		{&Error{Code: codes.AlreadyExists, Err: errors.New("exists")}, codes.AlreadyExists},
+		{&ConfigError{Code: codes.PermissionDenied, Err: errors.New("denied")}, codes.PermissionDenied},
+	} {
+		if got := Code(tc.err); got != tc.want {
+			t.Errorf("Code(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestNewError(t *testing.T) {
+	cause := status.Error(codes.AlreadyExists, "Row [1] in table Singers already exists")
+	err := newError(cause)
+	if !errors.Is(err, ErrAlreadyExists) || errors.Is(err, ErrNotFound) {
+		t.Errorf("%v matches the wrong codes", err)
+	}
+	if err.Error() != cause.Error() {
+		t.Errorf("got message %q, want %q", err.Error(), cause.Error())
+	}
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("status.Code(%v) = %v", err, status.Code(err))
+	}
+	if again := newError(err); again != err {
+		t.Errorf("wrapped %v twice", err)
+	}
+	notSent := errors.New("not sent")
+	if got := newError(notSent); got != notSent {
+		t.Errorf("wrapped %v without a code", notSent)
+	}
+}
+
+func TestStatementError(t *testing.T) {
+	db := openFakeSpanner(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		return status.Error(codes.InvalidArgument, "Table not found: Singers")
+	}})
+	_, err := db.QueryContext(context.Background(), "SELECT Id FROM Singers")
+	if !errors.Is(err, ErrInvalidArgument) || Code(err) != codes.InvalidArgument {
+		t.Errorf("want ErrInvalidArgument, got %v", err)
+	}
+	var spannerErr *spanner.Error
+	if !errors.As(err, &spannerErr) {
+		t.Errorf("%#v doesn't wrap a *spanner.Error", err)
+	}
+}
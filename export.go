@@ -0,0 +1,244 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ExportOptions configure how a database is exported.
+type ExportOptions struct {
+	// Tables are the tables to export. All tables
+	// are exported if it is empty.
+	Tables []string
+	// Parallelism is the number of partitions of a table
+	// that are read at the same time. It defaults to 4.
+	Parallelism int
+}
+
+// Export exports the database of db to the directory dir: its DDL
+// statements to schema.sql, and the rows of each table to TABLE.csv
+// in the format of ExportCSV. All tables are read at the same
+// timestamp, so that they are consistent with each other.
+func Export(ctx context.Context, db *sql.DB, dir string, opts ExportOptions) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return withConn(ctx, db, func(c *conn) error {
+		if err := writeFile(filepath.Join(dir, "schema.sql"), func(w io.Writer) error {
+			return c.exportSchema(ctx, w)
+		}); err != nil {
+			return err
+		}
+		tables := opts.Tables
+		if len(tables) == 0 {
+			var err error
+			if tables, err = ListTables(ctx, db); err != nil {
+				return err
+			}
+		}
+		tx, err := c.client.BatchReadOnlyTransaction(ctx, spanner.StrongRead())
+		if err != nil {
+			return err
+		}
+		defer tx.Close()
+		for _, table := range tables {
+			err := writeFile(filepath.Join(dir, table+".csv"), func(w io.Writer) error {
+				_, err := c.exportCSV(ctx, tx, table, w, opts)
+				return err
+			})
+			if err != nil {
+				return fmt.Errorf("exporting %s: %v", table, err)
+			}
+		}
+		return nil
+	})
+}
+
+// ExportSchema writes the DDL statements of the database of db to w,
+// separated by semicolons, so that they can be executed with ExecDDL
+// or one ExecContext call to recreate the schema.
+func ExportSchema(ctx context.Context, db *sql.DB, w io.Writer) error {
+	return withConn(ctx, db, func(c *conn) error {
+		return c.exportSchema(ctx, w)
+	})
+}
+
+// ExportCSV writes the rows of table to w with partitioned reads,
+// and returns the number of rows. The first record names the columns.
+// Values are in the format that ImportCSV reads; ARRAY values are
+// JSON arrays. Generated columns are not exported.
+func ExportCSV(ctx context.Context, db *sql.DB, table string, w io.Writer, opts ExportOptions) (int64, error) {
+	var n int64
+	err := withConn(ctx, db, func(c *conn) error {
+		tx, err := c.client.BatchReadOnlyTransaction(ctx, spanner.StrongRead())
+		if err != nil {
+			return err
+		}
+		defer tx.Close()
+		n, err = c.exportCSV(ctx, tx, table, w, opts)
+		return err
+	})
+	return n, err
+}
+
+func (c *conn) exportSchema(ctx context.Context, w io.Writer) error {
+	resp, err := c.adminClient.GetDatabaseDdl(ctx, &adminpb.GetDatabaseDdlRequest{Database: c.name})
+	if err != nil {
+		return err
+	}
+	for _, stmt := range resp.Statements {
+		if _, err := fmt.Fprintf(w, "%s;\n\n", stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *conn) exportCSV(ctx context.Context, tx *spanner.BatchReadOnlyTransaction, table string, w io.Writer, opts ExportOptions) (int64, error) {
+	t, err := c.describeTable(ctx, table)
+	if err != nil {
+		return 0, err
+	}
+	var columns []string
+	for _, col := range t.Columns {
+		if col.Generated == "" {
+			columns = append(columns, col.Name)
+		}
+	}
+	partitions, err := tx.PartitionRead(ctx, table, spanner.AllKeys(), columns, spanner.PartitionOptions{})
+	if err != nil {
+		return 0, err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return 0, err
+	}
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = 4
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex // guards cw, n and firstErr
+	var n int64
+	var firstErr error
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, parallelism)
+	for _, p := range partitions {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(p *spanner.Partition) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			err := tx.Execute(ctx, p).Do(func(row *spanner.Row) error {
+				record, err := csvRecord(row)
+				if err != nil {
+					return err
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				n++
+				return cw.Write(record)
+			})
+			if err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}(p)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return n, firstErr
+	}
+	cw.Flush()
+	return n, cw.Error()
+}
+
+// csvRecord formats the values of row for ExportCSV.
+func csvRecord(row *spanner.Row) ([]string, error) {
+	record := make([]string, row.Size())
+	for i := range record {
+		var v spanner.GenericColumnValue
+		if err := row.Column(i, &v); err != nil {
+			return nil, err
+		}
+		s, err := csvValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %v", row.ColumnName(i), err)
+		}
+		record[i] = s
+	}
+	return record, nil
+}
+
+// csvValue formats a value of a row. Spanner already encodes most
+// values as the strings that ImportCSV reads: INT64 and NUMERIC values
+// as decimal strings, BYTES as base64, DATE and TIMESTAMP values in
+// RFC 3339 format.
+func csvValue(v spanner.GenericColumnValue) (string, error) {
+	switch k := v.Value.GetKind().(type) {
+	case nil, *structpb.Value_NullValue:
+		return "", nil
+	case *structpb.Value_StringValue:
+		return k.StringValue, nil
+	case *structpb.Value_BoolValue:
+		return strconv.FormatBool(k.BoolValue), nil
+	case *structpb.Value_NumberValue:
+		bits := 64
+		if v.Type.GetCode() == sppb.TypeCode_FLOAT32 {
+			bits = 32
+		}
+		return strconv.FormatFloat(k.NumberValue, 'g', -1, bits), nil
+	case *structpb.Value_ListValue:
+		b, err := json.Marshal(k.ListValue.AsSlice())
+		return string(b), err
+	default:
+		return "", fmt.Errorf("unsupported value %v", v.Value)
+	}
+}
+
+// writeFile creates the file with the given name and calls write.
+func writeFile(name string, write func(w io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
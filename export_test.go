@@ -0,0 +1,70 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestCSVValue(t *testing.T) {
+	tests := []struct {
+		typ   sppb.TypeCode
+		value *structpb.Value
+		want  string
+	}{
+		{typ: sppb.TypeCode_STRING, value: structpb.NewNullValue(), want: ""},
+		{typ: sppb.TypeCode_STRING, value: structpb.NewStringValue("a,b"), want: "a,b"},
+		{typ: sppb.TypeCode_INT64, value: structpb.NewStringValue("9007199254740993"), want: "9007199254740993"},
+		{typ: sppb.TypeCode_BOOL, value: structpb.NewBoolValue(true), want: "true"},
+		{typ: sppb.TypeCode_FLOAT64, value: structpb.NewNumberValue(0.1), want: "0.1"},
+		{typ: sppb.TypeCode_FLOAT32, value: structpb.NewNumberValue(float64(float32(0.1))), want: "0.1"},
+		{typ: sppb.TypeCode_FLOAT64, value: structpb.NewStringValue("NaN"), want: "NaN"},
+		{typ: sppb.TypeCode_BYTES, value: structpb.NewStringValue("AQI="), want: "AQI="},
+		{typ: sppb.TypeCode_TIMESTAMP, value: structpb.NewStringValue("2020-01-02T03:04:05.123456Z"), want: "2020-01-02T03:04:05.123456Z"},
+		{
+			typ: sppb.TypeCode_ARRAY,
+			value: structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{
+				structpb.NewStringValue("a"), structpb.NewNullValue(),
+			}}),
+			want: `["a",null]`,
+		},
+	}
+	for _, tc := range tests {
+		v := spanner.GenericColumnValue{Type: &sppb.Type{Code: tc.typ}, Value: tc.value}
+		got, err := csvValue(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("%v %v: got %q, want %q", tc.typ, tc.value, got, tc.want)
+			continue
+		}
+		if tc.typ == sppb.TypeCode_ARRAY || got == "" {
+			continue
+		}
+		// The value can be imported again.
+		convert, err := csvConverter(tc.typ.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := convert(got); err != nil {
+			t.Errorf("%v: cannot import %q: %v", tc.typ, got, err)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+)
+
+// Hooks observe the statements and transactions of the connections
+// opened by a driver, e.g. to instrument them for an APM product
+// without wrapping database/sql. Hooks are called synchronously on
+// the goroutine of the application and must not block. Embed
+// NopHooks to implement only some of the methods:
+//
+//	type apmHooks struct{ spannerdriver.NopHooks }
+//
+//	func (apmHooks) OnQueryStart(ctx context.Context, e spannerdriver.QueryEvent) context.Context {
+//		ctx, _ = apm.StartSpan(ctx, e.SQL)
+//		return ctx
+//	}
+//
+//	func (apmHooks) OnQueryEnd(ctx context.Context, e spannerdriver.QueryEvent) {
+//		apm.SpanFromContext(ctx).End()
+//	}
+//
+//	d := &spannerdriver.Driver{Hooks: apmHooks{}}
+type Hooks interface {
+	// OnQueryStart is called before a query or an executed statement
+	// runs. The returned context is used to execute the statement and
+	// is passed to OnQueryEnd.
+	OnQueryStart(ctx context.Context, e QueryEvent) context.Context
+
+	// OnQueryEnd is called when a statement has finished, which
+	// for queries is when their rows are closed.
+	OnQueryEnd(ctx context.Context, e QueryEvent)
+
+	// OnTxBegin is called when a transaction has begun. The returned
+	// context is passed to OnTxCommit or OnTxRollback.
+	OnTxBegin(ctx context.Context, e TxEvent) context.Context
+
+	// OnTxCommit and OnTxRollback are called when a
+	// transaction has been committed or rolled back.
+	OnTxCommit(ctx context.Context, e TxEvent)
+	OnTxRollback(ctx context.Context, e TxEvent)
+
+	// OnRetry is called before the implicit read-write transaction
+	// of statements executed outside of a transaction runs again
+	// because Spanner aborted it. Attempt is 2 for the first retry.
+	OnRetry(ctx context.Context, attempt int)
+
+	// OnError is called with each error that a statement,
+	// Begin, Commit or Rollback returns.
+	OnError(ctx context.Context, err error)
+}
+
+// QueryEvent describes a query or an executed statement.
+type QueryEvent struct {
+	Kind StatementKind
+	SQL  string
+	Args []driver.NamedValue
+
+	// TransactionType is single_use, read_only or read_write.
+	TransactionType string
+
+	// Duration, Rows and Err are set in OnQueryEnd. Rows is the
+	// number of rows that a query returned or that a statement
+	// affected, or -1 if it is unknown.
+	Duration time.Duration
+	Rows     int64
+	Err      error
+
+	// EndReason is set in OnQueryEnd to why the statement ended:
+	// ok, canceled or deadline_exceeded if the application canceled
+	// the context or its deadline passed, timeout if the driver or the
+	// Spanner client timed out, or error for all other errors.
+	EndReason string
+
+	// Latency is set in OnQueryEnd to the phases of Duration.
+	Latency LatencyBreakdown
+}
+
+// TxEvent describes a transaction.
+type TxEvent struct {
+	ReadOnly bool
+
+	// Duration, Attempts and Err are set in OnTxCommit and
+	// OnTxRollback. Attempts is the number of times that a
+	// read-write transaction ran, or 0 if it is unknown.
+	Duration time.Duration
+	Attempts int
+	Err      error
+}
+
+// NopHooks implements Hooks with methods that do nothing.
+type NopHooks struct{}
+
+func (NopHooks) OnQueryStart(ctx context.Context, e QueryEvent) context.Context { return ctx }
+func (NopHooks) OnQueryEnd(ctx context.Context, e QueryEvent)                   {}
+func (NopHooks) OnTxBegin(ctx context.Context, e TxEvent) context.Context       { return ctx }
+func (NopHooks) OnTxCommit(ctx context.Context, e TxEvent)                      {}
+func (NopHooks) OnTxRollback(ctx context.Context, e TxEvent)                    {}
+func (NopHooks) OnRetry(ctx context.Context, attempt int)                       {}
+func (NopHooks) OnError(ctx context.Context, err error)                         {}
+
+// startQueryHook calls OnQueryStart and returns the context of the
+// statement and a function that calls OnQueryEnd, and OnError if the
+// statement failed, with the rows that it returned or affected.
+func (c *conn) startQueryHook(ctx context.Context, kind StatementKind, query string, args []driver.NamedValue) (context.Context, func(rows int64, err error)) {
+	if c.hooks == nil {
+		return ctx, func(int64, error) {}
+	}
+	e := QueryEvent{Kind: kind, SQL: query, Args: args, TransactionType: c.transactionType()}
+	latency := &statementLatency{start: time.Now()}
+	ctx = withStatementLatency(c.hooks.OnQueryStart(ctx, e), latency)
+	return ctx, func(rows int64, err error) {
+		e.Duration, e.Rows, e.Err = time.Since(latency.start), rows, err
+		e.EndReason = endReason(ctx, err)
+		e.Latency = latency.breakdown(e.Duration)
+		c.hooks.OnQueryEnd(ctx, e)
+		c.hookError(ctx, err)
+	}
+}
+
+// hookError calls OnError if err is not nil.
+func (c *conn) hookError(ctx context.Context, err error) {
+	if c.hooks != nil && err != nil {
+		c.hooks.OnError(ctx, err)
+	}
+}
+
+// hookRetry calls OnRetry if attempt is a retry.
+func (c *conn) hookRetry(ctx context.Context, attempt int) {
+	if c.hooks != nil && attempt > 1 {
+		c.hooks.OnRetry(ctx, attempt)
+	}
+}
+
+// rowsAffected returns the rows affected by res, or -1.
+func rowsAffected(res driver.Result) int64 {
+	if res == nil {
+		return -1
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1
+	}
+	return n
+}
@@ -0,0 +1,181 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type hookKey struct{}
+
+// recordingHooks records the events that it observes.
+type recordingHooks struct {
+	NopHooks
+	events []string
+}
+
+func (h *recordingHooks) OnQueryStart(ctx context.Context, e QueryEvent) context.Context {
+	h.events = append(h.events, fmt.Sprintf("start %v %s %s", e.Kind, e.SQL, e.TransactionType))
+	return context.WithValue(ctx, hookKey{}, e.SQL)
+}
+
+func (h *recordingHooks) OnQueryEnd(ctx context.Context, e QueryEvent) {
+	h.events = append(h.events, fmt.Sprintf("end %v rows=%d err=%v", ctx.Value(hookKey{}), e.Rows, e.Err != nil))
+}
+
+func (h *recordingHooks) OnTxBegin(ctx context.Context, e TxEvent) context.Context {
+	h.events = append(h.events, fmt.Sprintf("begin readOnly=%v", e.ReadOnly))
+	return context.WithValue(ctx, hookKey{}, "tx")
+}
+
+func (h *recordingHooks) OnTxCommit(ctx context.Context, e TxEvent) {
+	h.events = append(h.events, fmt.Sprintf("commit %v", ctx.Value(hookKey{})))
+}
+
+func (h *recordingHooks) OnRetry(ctx context.Context, attempt int) {
+	h.events = append(h.events, fmt.Sprintf("retry %d", attempt))
+}
+
+func (h *recordingHooks) OnError(ctx context.Context, err error) {
+	h.events = append(h.events, "error")
+}
+
+func TestHooks(t *testing.T) {
+	hooks := &recordingHooks{}
+	db := openFakeSpannerWithDriver(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		if req.Sql == "SELECT Id FROM Albums" {
+			return status.Error(codes.NotFound, "Table not found: Albums")
+		}
+		return sendRow(stream)
+	}}, &Driver{Hooks: hooks})
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int64
+	if err := tx.QueryRowContext(ctx, "SELECT Id FROM Singers").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.QueryContext(ctx, "SELECT Id FROM Albums"); err == nil {
+		t.Fatal("want an error")
+	}
+
+	want := []string{
+		"begin readOnly=true",
+		"start Query SELECT Id FROM Singers read_only",
+		"end SELECT Id FROM Singers rows=1 err=false",
+		"commit tx",
+		"start Query SELECT Id FROM Albums single_use",
+		"end SELECT Id FROM Albums rows=0 err=true",
+		"error",
+	}
+	if !reflect.DeepEqual(hooks.events, want) {
+		t.Errorf("got events\n%q\nwant\n%q", hooks.events, want)
+	}
+}
+
+func TestHookRetry(t *testing.T) {
+	hooks := &recordingHooks{}
+	c := &conn{hooks: hooks}
+	for attempt := 1; attempt <= 3; attempt++ {
+		c.hookRetry(context.Background(), attempt)
+	}
+	if want := []string{"retry 2", "retry 3"}; !reflect.DeepEqual(hooks.events, want) {
+		t.Errorf("got events %q, want %q", hooks.events, want)
+	}
+}
+
+// endReasonHooks records the end reasons of statements.
+type endReasonHooks struct {
+	NopHooks
+	reasons []string
+}
+
+func (h *endReasonHooks) OnQueryEnd(ctx context.Context, e QueryEvent) {
+	h.reasons = append(h.reasons, e.EndReason)
+}
+
+func TestHookEndReason(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hooks := &endReasonHooks{}
+	db := openFakeSpannerWithDriver(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		switch req.Sql {
+		case "SELECT Id FROM Canceled":
+			cancel()
+			return status.Error(codes.Canceled, "context canceled")
+		case "SELECT Id FROM Slow":
+			return status.Error(codes.DeadlineExceeded, "deadline exceeded")
+		}
+		return sendRow(stream)
+	}}, &Driver{Hooks: hooks})
+
+	var id int64
+	for _, query := range []string{"SELECT Id FROM Singers", "SELECT Id FROM Slow", "SELECT Id FROM Canceled"} {
+		db.QueryRowContext(ctx, query).Scan(&id)
+	}
+	if want := []string{endOK, endTimeout, endCanceled}; !reflect.DeepEqual(hooks.reasons, want) {
+		t.Errorf("got end reasons %v, want %v", hooks.reasons, want)
+	}
+}
+
+// latencyHooks records the latency breakdowns of statements.
+type latencyHooks struct {
+	NopHooks
+	latencies []LatencyBreakdown
+}
+
+func (h *latencyHooks) OnQueryEnd(ctx context.Context, e QueryEvent) {
+	h.latencies = append(h.latencies, e.Latency)
+}
+
+func TestHookLatency(t *testing.T) {
+	hooks := &latencyHooks{}
+	db := openFakeSpannerWithDriver(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		stream.SetHeader(metadata.Pairs(serverTimingHeader, "gfet4t7; dur=2"))
+		time.Sleep(5 * time.Millisecond)
+		return sendRow(stream)
+	}}, &Driver{Hooks: hooks})
+
+	var id int64
+	if err := db.QueryRowContext(context.Background(), "SELECT Id FROM Singers WHERE Id = @id", 1).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks.latencies) != 1 {
+		t.Fatalf("got %d latencies, want 1", len(hooks.latencies))
+	}
+	l := hooks.latencies[0]
+	if l.Encode <= 0 || l.Decode <= 0 || l.Server != 2*time.Millisecond {
+		t.Errorf("got %+v", l)
+	}
+	if l.RPC < 5*time.Millisecond || l.FirstRow < l.RPC || l.Total < l.FirstRow {
+		t.Errorf("got %+v, want RPC <= FirstRow <= Total", l)
+	}
+}
@@ -0,0 +1,223 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+)
+
+// insertRow is a row that is written by InsertOrUpdateStruct
+// or InsertOrUpdateMap.
+type insertRow struct {
+	columns []string
+	values  []interface{}
+	// zero reports for each column whether its value is the zero
+	// value, which lets Spanner generate the value of key columns.
+	zero []bool
+	// set stores a value that Spanner generated, if possible.
+	set func(column string, v spanner.GenericColumnValue) error
+}
+
+// structRow returns the row of the struct in. The fields of in are
+// mapped to columns like the spanner client maps them. Generated
+// values can only be stored if in is a pointer.
+func structRow(in interface{}) (insertRow, error) {
+	v := reflect.ValueOf(in)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return insertRow{}, fmt.Errorf("%T is not a struct or a pointer to a struct", in)
+	}
+	row := insertRow{}
+	fields := make(map[string]reflect.Value)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("spanner"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				name = tag
+			}
+		}
+		fv := v.Field(i)
+		row.columns = append(row.columns, name)
+		row.values = append(row.values, fv.Interface())
+		row.zero = append(row.zero, fv.IsZero())
+		fields[strings.ToUpper(name)] = fv
+	}
+	row.set = func(column string, gv spanner.GenericColumnValue) error {
+		fv, ok := fields[strings.ToUpper(column)]
+		if !ok || !fv.CanAddr() {
+			return nil
+		}
+		return gv.Decode(fv.Addr().Interface())
+	}
+	return row, nil
+}
+
+// mapRow returns the row with the column values in. Generated
+// values are stored in the map.
+func mapRow(in map[string]interface{}) insertRow {
+	row := insertRow{}
+	for name, v := range in {
+		row.columns = append(row.columns, name)
+		row.values = append(row.values, v)
+		row.zero = append(row.zero, v == nil)
+	}
+	row.set = func(column string, gv spanner.GenericColumnValue) error {
+		v, err := decodeGenerated(gv)
+		if err != nil {
+			return err
+		}
+		in[column] = v
+		return nil
+	}
+	return row
+}
+
+// decodeGenerated decodes a generated key value. Identity columns and
+// sequences generate INT64 values, other values are returned as is.
+func decodeGenerated(gv spanner.GenericColumnValue) (interface{}, error) {
+	if gv.Type.GetCode() != sppb.TypeCode_INT64 {
+		return gv, nil
+	}
+	var n spanner.NullInt64
+	if err := gv.Decode(&n); err != nil {
+		return nil, err
+	}
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Int64, nil
+}
+
+// insertOrUpdate writes row to table. Key columns that Spanner
+// generates are omitted if their values are zero, and the values
+// that Spanner generated are returned with THEN RETURN and stored in
+// the row. Rows without generated values are written as a mutation.
+func (c *conn) insertOrUpdate(ctx context.Context, table string, row insertRow) error {
+	generated, err := c.generatedKeyColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+	isGenerated := make(map[string]bool)
+	for _, col := range generated {
+		isGenerated[strings.ToUpper(col)] = true
+	}
+	var columns []string
+	var values []interface{}
+	provided := make(map[string]bool)
+	for i, col := range row.columns {
+		if row.zero[i] && isGenerated[strings.ToUpper(col)] {
+			continue
+		}
+		columns = append(columns, col)
+		values = append(values, row.values[i])
+		provided[strings.ToUpper(col)] = true
+	}
+	var returning []string
+	for _, col := range generated {
+		if !provided[strings.ToUpper(col)] {
+			returning = append(returning, col)
+		}
+	}
+	if len(returning) == 0 {
+		_, err := c.Apply(ctx, []*spanner.Mutation{spanner.InsertOrUpdate(table, columns, values)})
+		return err
+	}
+
+	stmt := insertReturningStatement(table, columns, values, returning)
+	return c.runInNewRWTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		return tx.Query(ctx, stmt).Do(func(r *spanner.Row) error {
+			for i, col := range returning {
+				var gv spanner.GenericColumnValue
+				if err := r.Column(i, &gv); err != nil {
+					return err
+				}
+				if err := row.set(col, gv); err != nil {
+					return fmt.Errorf("column %s: %v", col, err)
+				}
+			}
+			return nil
+		})
+	})
+}
+
+// insertReturningStatement returns the INSERT OR UPDATE statement
+// that writes the columns and returns the generated columns.
+func insertReturningStatement(table string, columns []string, values []interface{}, returning []string) spanner.Statement {
+	stmt := spanner.Statement{Params: make(map[string]interface{}, len(values))}
+	quoted := make([]string, len(columns))
+	params := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteIdentifier(col)
+		params[i] = fmt.Sprintf("@p%d", i+1)
+		stmt.Params[fmt.Sprintf("p%d", i+1)] = values[i]
+	}
+	ret := make([]string, len(returning))
+	for i, col := range returning {
+		ret[i] = quoteIdentifier(col)
+	}
+	stmt.SQL = fmt.Sprintf("INSERT OR UPDATE INTO %s (%s) VALUES (%s) THEN RETURN %s",
+		quoteIdentifier(table), strings.Join(quoted, ", "), strings.Join(params, ", "), strings.Join(ret, ", "))
+	return stmt
+}
+
+// generatedKeyColumns returns the identity columns and the columns
+// that default to the next value of a sequence of table.
+func (c *conn) generatedKeyColumns(ctx context.Context, table string) ([]string, error) {
+	if cols, ok := c.generatedKeys[strings.ToUpper(table)]; ok {
+		return cols, nil
+	}
+	schema, name := splitQualifiedName(table)
+	stmt := spanner.Statement{SQL: `SELECT COLUMN_NAME, COLUMN_DEFAULT, IS_IDENTITY FROM INFORMATION_SCHEMA.COLUMNS
+WHERE TABLE_SCHEMA = @schema AND TABLE_NAME = @table
+ORDER BY ORDINAL_POSITION`, Params: map[string]interface{}{"schema": schema, "table": name}}
+	var cols []string
+	err := c.querySchema(ctx, stmt, func(row *spanner.Row) error {
+		var col Column
+		var def, identity spanner.NullString
+		if err := row.Columns(&col.Name, &def, &identity); err != nil {
+			return err
+		}
+		col.Default = def.StringVal
+		col.Identity = identity.StringVal == "YES"
+		if col.KeyGenerated() {
+			cols = append(cols, col.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c.generatedKeys == nil {
+		c.generatedKeys = make(map[string][]string)
+	}
+	c.generatedKeys[strings.ToUpper(table)] = cols
+	return cols, nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestColumnKeyGenerated(t *testing.T) {
+	for _, tt := range []struct {
+		col  Column
+		want bool
+	}{
+		{Column{Name: "Id", Identity: true}, true},
+		{Column{Name: "Id", Default: "GET_NEXT_SEQUENCE_VALUE(SEQUENCE SingerIds)"}, true},
+		{Column{Name: "Id", Default: "get_next_sequence_value (sequence s)"}, true},
+		{Column{Name: "CreatedAt", Default: "CURRENT_TIMESTAMP()"}, false},
+		{Column{Name: "Name"}, false},
+	} {
+		if got := tt.col.KeyGenerated(); got != tt.want {
+			t.Errorf("%+v.KeyGenerated() = %v, want %v", tt.col, got, tt.want)
+		}
+	}
+}
+
+func TestStructRow(t *testing.T) {
+	type singer struct {
+		ID      int64 `spanner:"SingerId"`
+		Name    string
+		Skipped string `spanner:"-"`
+		hidden  string
+	}
+	s := &singer{Name: "Alice"}
+	row, err := structRow(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"SingerId", "Name"}; !reflect.DeepEqual(row.columns, want) {
+		t.Errorf("columns = %v, want %v", row.columns, want)
+	}
+	if want := []bool{true, false}; !reflect.DeepEqual(row.zero, want) {
+		t.Errorf("zero = %v, want %v", row.zero, want)
+	}
+	gv := spanner.GenericColumnValue{
+		Type:  &sppb.Type{Code: sppb.TypeCode_INT64},
+		Value: structpb.NewStringValue("42"),
+	}
+	if err := row.set("SINGERID", gv); err != nil {
+		t.Fatal(err)
+	}
+	if s.ID != 42 {
+		t.Errorf("ID = %d, want 42", s.ID)
+	}
+	if _, err := structRow(42); err == nil {
+		t.Error("structRow(42) succeeded, want error")
+	}
+}
+
+func TestMapRow(t *testing.T) {
+	in := map[string]interface{}{"Name": "Alice", "SingerId": nil}
+	row := mapRow(in)
+	for i, col := range row.columns {
+		if want := col == "SingerId"; row.zero[i] != want {
+			t.Errorf("zero[%s] = %v, want %v", col, row.zero[i], want)
+		}
+	}
+	gv := spanner.GenericColumnValue{
+		Type:  &sppb.Type{Code: sppb.TypeCode_INT64},
+		Value: structpb.NewStringValue("7"),
+	}
+	if err := row.set("SingerId", gv); err != nil {
+		t.Fatal(err)
+	}
+	if got := in["SingerId"]; got != int64(7) {
+		t.Errorf("SingerId = %v, want 7", got)
+	}
+}
+
+func TestInsertReturningStatement(t *testing.T) {
+	stmt := insertReturningStatement("Singers", []string{"Name"}, []interface{}{"Alice"}, []string{"SingerId"})
+	want := spanner.Statement{
+		SQL:    "INSERT OR UPDATE INTO `Singers` (`Name`) VALUES (@p1) THEN RETURN `SingerId`",
+		Params: map[string]interface{}{"p1": "Alice"},
+	}
+	if !reflect.DeepEqual(stmt, want) {
+		t.Errorf("got %+v, want %+v", stmt, want)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// indexPollInterval is the interval at which WaitForIndex
+// checks the state of an index.
+var indexPollInterval = time.Second
+
+// CreateIndexStatement returns the CREATE INDEX statement
+// of the index idx on the given table.
+func CreateIndexStatement(table string, idx Index) string {
+	var b strings.Builder
+	b.WriteString("CREATE ")
+	if idx.Unique {
+		b.WriteString("UNIQUE ")
+	}
+	if idx.NullFiltered {
+		b.WriteString("NULL_FILTERED ")
+	}
+	keys := make([]string, len(idx.Columns))
+	for i, col := range idx.Columns {
+		keys[i] = quoteIdentifier(col.Name)
+		if col.Descending {
+			keys[i] += " DESC"
+		}
+	}
+	fmt.Fprintf(&b, "INDEX %s ON %s (%s)", quoteIdentifier(idx.Name), quoteIdentifier(table), strings.Join(keys, ", "))
+	if len(idx.Storing) > 0 {
+		stored := make([]string, len(idx.Storing))
+		for i, col := range idx.Storing {
+			stored[i] = quoteIdentifier(col)
+		}
+		fmt.Fprintf(&b, " STORING (%s)", strings.Join(stored, ", "))
+	}
+	if idx.Interleave != "" {
+		fmt.Fprintf(&b, ", INTERLEAVE IN %s", quoteIdentifier(idx.Interleave))
+	}
+	return b.String()
+}
+
+// CreateIndex creates the index idx on the given table. Unless the
+// asyncDdl connection parameter is set, it returns once the index has
+// been backfilled, otherwise WaitForIndex waits for the backfill.
+func CreateIndex(ctx context.Context, db *sql.DB, table string, idx Index) error {
+	if len(idx.Columns) == 0 {
+		return fmt.Errorf("index %s has no columns", idx.Name)
+	}
+	return ExecDDL(ctx, db, CreateIndexStatement(table, idx))
+}
+
+// DropIndex drops the index with the given name.
+func DropIndex(ctx context.Context, db *sql.DB, name string) error {
+	return ExecDDL(ctx, db, "DROP INDEX "+quoteIdentifier(name))
+}
+
+// ListIndexes returns the secondary indexes of the table.
+func ListIndexes(ctx context.Context, db *sql.DB, table string) ([]Index, error) {
+	var t Table
+	err := withConn(ctx, db, func(c *conn) error {
+		schema, name := splitQualifiedName(table)
+		return c.describeIndexes(ctx, schema, name, &t)
+	})
+	return t.Indexes, err
+}
+
+// WaitForIndex waits until the index on the given table
+// has been backfilled and can be used by queries.
+func WaitForIndex(ctx context.Context, db *sql.DB, table, name string) error {
+	for {
+		indexes, err := ListIndexes(ctx, db, table)
+		if err != nil {
+			return err
+		}
+		i := indexOfIndex(indexes, name)
+		if i < 0 {
+			return fmt.Errorf("index %s on %s not found", name, table)
+		}
+		if indexes[i].State == "READ_WRITE" {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(indexPollInterval):
+		}
+	}
+}
+
+func indexOfIndex(indexes []Index, name string) int {
+	for i, idx := range indexes {
+		if equalFoldIdentifiers(idx.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
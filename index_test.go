@@ -0,0 +1,57 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"testing"
+)
+
+func TestCreateIndexStatement(t *testing.T) {
+	tests := []struct {
+		idx  Index
+		want string
+	}{
+		{
+			idx:  Index{Name: "SingersByName", Columns: []IndexColumn{{Name: "LastName"}, {Name: "FirstName", Descending: true}}},
+			want: "CREATE INDEX `SingersByName` ON `Singers` (`LastName`, `FirstName` DESC)",
+		},
+		{
+			idx: Index{
+				Name:         "AlbumsByTitle",
+				Unique:       true,
+				NullFiltered: true,
+				Columns:      []IndexColumn{{Name: "SingerId"}, {Name: "Title"}},
+				Storing:      []string{"Budget", "ReleaseDate"},
+				Interleave:   "Singers",
+			},
+			want: "CREATE UNIQUE NULL_FILTERED INDEX `AlbumsByTitle` ON `Singers` (`SingerId`, `Title`) STORING (`Budget`, `ReleaseDate`), INTERLEAVE IN `Singers`",
+		},
+	}
+	for _, tc := range tests {
+		if got := CreateIndexStatement("Singers", tc.idx); got != tc.want {
+			t.Errorf("got  %q\nwant %q", got, tc.want)
+		}
+	}
+}
+
+func TestIndexOfIndex(t *testing.T) {
+	indexes := []Index{{Name: "A"}, {Name: "SingersByName"}}
+	if got := indexOfIndex(indexes, "singersbyname"); got != 1 {
+		t.Errorf("got %d, want 1", got)
+	}
+	if got := indexOfIndex(indexes, "B"); got != -1 {
+		t.Errorf("got %d, want -1", got)
+	}
+}
@@ -14,21 +14,25 @@
 
 package internal
 
-import (
-	"fmt"
-	"regexp"
-)
+import "testing"
 
-var namedValueParamNameRegex = regexp.MustCompile("@(\\w+)")
-
-func NamedValueParamNames(q string, n int) ([]string, error) {
-	var names []string
-	matches := namedValueParamNameRegex.FindAllStringSubmatch(q, n)
-	if m := len(matches); n != -1 && m < n {
-		return nil, fmt.Errorf("query has %d placeholders but %d arguments are provided", m, n)
+func TestLRU(t *testing.T) {
+	c := NewLRU[string, int](2)
+	c.Add("a", 1)
+	c.Add("b", 2)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf(`Get("a") = %d, %v, want 1, true`, v, ok)
+	}
+	// b is the least recently used entry now.
+	c.Add("c", 3)
+	if _, ok := c.Get("b"); ok {
+		t.Error(`"b" was not evicted`)
+	}
+	c.Add("a", 4)
+	if v, _ := c.Get("a"); v != 4 {
+		t.Errorf(`Get("a") = %d after update, want 4`, v)
 	}
-	for _, m := range matches {
-		names = append(names, m[1])
+	if n := c.Len(); n != 2 {
+		t.Errorf("Len() = %d, want 2", n)
 	}
-	return names, nil
 }
@@ -17,8 +17,11 @@ package internal
 import (
 	"context"
 	"errors"
+	"sync/atomic"
 
 	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // RWConnector starts a Cloud Spanner read-write
@@ -31,19 +34,47 @@ type RWConnector struct {
 	ExecIn  chan *RWExecMessage
 	ExecOut chan *RWExecMessage
 
+	BatchIn  chan *RWBatchMessage
+	BatchOut chan *RWBatchMessage
+
+	BufferIn  chan *RWBufferMessage
+	BufferOut chan *RWBufferMessage
+
 	RollbackIn chan struct{}
 	CommitIn   chan struct{}
 	Errors     chan error // only for starting, commit and rollback
 
 	Ready chan struct{}
+
+	// CommitResponse is set before the final error is sent
+	// on Errors and is only valid if that error is nil.
+	CommitResponse spanner.CommitResponse
+
+	// Tx is the transaction. It is set before Ready is sent.
+	Tx *spanner.ReadWriteTransaction
+
+	// attempts is the number of times the transaction
+	// function ran the statements of the caller.
+	attempts int32
 }
 
-func NewRWConnector(ctx context.Context, c *spanner.Client) *RWConnector {
+// Attempts returns the number of times the transaction ran, which
+// is 1 once it has started. The retries of the client library after
+// Spanner aborted the transaction are refused, so they don't count.
+func (c *RWConnector) Attempts() int {
+	return int(atomic.LoadInt32(&c.attempts))
+}
+
+func NewRWConnector(ctx context.Context, c *spanner.Client, opts spanner.TransactionOptions) *RWConnector {
 	connector := &RWConnector{
 		QueryIn:    make(chan *RWQueryMessage),
 		QueryOut:   make(chan *RWQueryMessage),
 		ExecIn:     make(chan *RWExecMessage),
 		ExecOut:    make(chan *RWExecMessage),
+		BatchIn:    make(chan *RWBatchMessage),
+		BatchOut:   make(chan *RWBatchMessage),
+		BufferIn:   make(chan *RWBufferMessage),
+		BufferOut:  make(chan *RWBufferMessage),
 		RollbackIn: make(chan struct{}),
 		CommitIn:   make(chan struct{}),
 		Errors:     make(chan error),
@@ -51,17 +82,37 @@ func NewRWConnector(ctx context.Context, c *spanner.Client) *RWConnector {
 	}
 
 	fn := func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+		if !atomic.CompareAndSwapInt32(&connector.attempts, 0, 1) {
+			// The statements of the first attempt cannot be
+			// replayed, so the transaction fails instead.
+			return errRetryRefused
+		}
+		connector.Tx = tx
 		connector.Ready <- struct{}{}
 		for {
 			select {
 			case <-ctx.Done():
-				return ctx.Err()
+				return context.Cause(ctx)
 			case msg := <-connector.QueryIn:
-				msg.It = tx.Query(msg.Ctx, msg.Stmt)
+				if msg.Tag != "" {
+					msg.It = tx.QueryWithOptions(msg.Ctx, msg.Stmt, spanner.QueryOptions{RequestTag: msg.Tag})
+				} else {
+					msg.It = tx.Query(msg.Ctx, msg.Stmt)
+				}
 				connector.QueryOut <- msg
 			case msg := <-connector.ExecIn:
-				msg.Rows, msg.Error = tx.Update(msg.Ctx, msg.Stmt)
+				if msg.Tag != "" {
+					msg.Rows, msg.Error = tx.UpdateWithOptions(msg.Ctx, msg.Stmt, spanner.QueryOptions{RequestTag: msg.Tag})
+				} else {
+					msg.Rows, msg.Error = tx.Update(msg.Ctx, msg.Stmt)
+				}
 				connector.ExecOut <- msg
+			case msg := <-connector.BatchIn:
+				msg.Counts, msg.Error = tx.BatchUpdate(msg.Ctx, msg.Stmts)
+				connector.BatchOut <- msg
+			case msg := <-connector.BufferIn:
+				msg.Error = tx.BufferWrite(msg.Mutations)
+				connector.BufferOut <- msg
 			case <-connector.RollbackIn:
 				return ErrAborted
 			case <-connector.CommitIn:
@@ -70,7 +121,11 @@ func NewRWConnector(ctx context.Context, c *spanner.Client) *RWConnector {
 		}
 	}
 	go func() {
-		_, err := c.ReadWriteTransaction(ctx, fn)
+		resp, err := c.ReadWriteTransactionWithOptions(ctx, fn, opts)
+		if errors.Is(err, errRetryRefused) {
+			err = ErrRetryAborted
+		}
+		connector.CommitResponse = resp
 		connector.Errors <- err
 	}()
 	return connector
@@ -79,6 +134,7 @@ func NewRWConnector(ctx context.Context, c *spanner.Client) *RWConnector {
 type RWQueryMessage struct {
 	Ctx  context.Context   // in
 	Stmt spanner.Statement // in
+	Tag  string            // in, the request tag
 
 	It *spanner.RowIterator // out
 }
@@ -86,9 +142,34 @@ type RWQueryMessage struct {
 type RWExecMessage struct {
 	Ctx  context.Context   // in
 	Stmt spanner.Statement // in
+	Tag  string            // in, the request tag
 
 	Rows  int64 // out
 	Error error // out
 }
 
+type RWBatchMessage struct {
+	Ctx   context.Context     // in
+	Stmts []spanner.Statement // in
+
+	Counts []int64 // out
+	Error  error   // out
+}
+
+type RWBufferMessage struct {
+	Mutations []*spanner.Mutation // in
+
+	Error error // out
+}
+
 var ErrAborted = errors.New("aborted")
+
+// ErrRetryAborted is returned when Spanner aborted the
+// transaction and the caller has to run it again. It has
+// the gRPC code Aborted, like the error of the abort.
+var ErrRetryAborted = status.Error(codes.Aborted, "transaction was aborted by Spanner, run it again")
+
+// errRetryRefused ends the attempts of the client library to retry
+// the transaction. It must not have the code Aborted, which the
+// client library would retry again.
+var errRetryRefused = errors.New("retry of the transaction refused")
@@ -0,0 +1,486 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// SplitStatements splits q at the semicolons that separate statements.
+// Semicolons in string literals, quoted identifiers and comments do
+// not separate statements. Statements that only consist of whitespace
+// and comments are dropped.
+func SplitStatements(q string) []string {
+	var stmts []string
+	start := 0
+	add := func(end int) {
+		if s := strings.TrimSpace(q[start:end]); !isBlank(s) {
+			stmts = append(stmts, s)
+		}
+	}
+	for i := 0; i < len(q); {
+		switch c := q[i]; {
+		case c == ';':
+			add(i)
+			i++
+			start = i
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(q, i)
+		case c == '#' || (c == '-' && strings.HasPrefix(q[i:], "--")):
+			i = skipLineComment(q, i)
+		case c == '/' && strings.HasPrefix(q[i:], "/*"):
+			i = skipBlockComment(q, i)
+		default:
+			i++
+		}
+	}
+	add(len(q))
+	return stmts
+}
+
+// skipQuoted returns the index after the quoted string, identifier
+// or triple-quoted string that starts at q[i].
+func skipQuoted(q string, i int) int {
+	quote := q[i : i+1]
+	if strings.HasPrefix(q[i:], strings.Repeat(quote, 3)) {
+		quote = strings.Repeat(quote, 3)
+	}
+	for j := i + len(quote); j < len(q); j++ {
+		if q[j] == '\\' {
+			j++ // Skip the escaped character.
+			continue
+		}
+		if strings.HasPrefix(q[j:], quote) {
+			return j + len(quote)
+		}
+	}
+	return len(q)
+}
+
+func skipLineComment(q string, i int) int {
+	if j := strings.IndexByte(q[i:], '\n'); j >= 0 {
+		return i + j + 1
+	}
+	return len(q)
+}
+
+func skipBlockComment(q string, i int) int {
+	if j := strings.Index(q[i+2:], "*/"); j >= 0 {
+		return i + 2 + j + 2
+	}
+	return len(q)
+}
+
+// isBlank reports whether s only consists of whitespace and comments.
+func isBlank(s string) bool {
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#' || (c == '-' && strings.HasPrefix(s[i:], "--")):
+			i = skipLineComment(s, i)
+		case c == '/' && strings.HasPrefix(s[i:], "/*"):
+			i = skipBlockComment(s, i)
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// StripComments removes the comments from q. Comment
+// markers in string literals and quoted identifiers are
+// left as they are.
+func StripComments(q string) string {
+	var b strings.Builder
+	for i := 0; i < len(q); {
+		switch c := q[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			j := skipQuoted(q, i)
+			b.WriteString(q[i:j])
+			i = j
+		case c == '#' || (c == '-' && strings.HasPrefix(q[i:], "--")):
+			i = skipLineComment(q, i)
+			b.WriteByte('\n')
+		case c == '/' && strings.HasPrefix(q[i:], "/*"):
+			i = skipBlockComment(q, i)
+			b.WriteByte(' ')
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// RedactLiterals replaces the string, bytes and numeric literals
+// of q with ? and removes its comments, so that q can be logged
+// without the values that it contains. Quoted identifiers, query
+// parameters and statement hints are left as they are.
+func RedactLiterals(q string) string {
+	var b strings.Builder
+	for i := 0; i < len(q); {
+		switch c := q[i]; {
+		case c == '`':
+			j := skipQuoted(q, i)
+			b.WriteString(q[i:j])
+			i = j
+		case c == '\'' || c == '"':
+			i = skipQuoted(q, i)
+			b.WriteByte('?')
+		case c == '#' || (c == '-' && strings.HasPrefix(q[i:], "--")):
+			i = skipLineComment(q, i)
+			b.WriteByte('\n')
+		case c == '/' && strings.HasPrefix(q[i:], "/*"):
+			i = skipBlockComment(q, i)
+			b.WriteByte(' ')
+		case c == '@' && strings.HasPrefix(q[i:], "@{"):
+			j := skipHint(q, i)
+			b.WriteString(q[i:j])
+			i = j
+		case isKeywordChar(c, true) || c == '@':
+			// Identifiers and parameters may contain digits.
+			j := i + 1
+			for j < len(q) && isKeywordChar(q[j], false) {
+				j++
+			}
+			b.WriteString(q[i:j])
+			i = j
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(q) && q[i+1] >= '0' && q[i+1] <= '9':
+			// Numbers, including hexadecimal numbers
+			// and exponents such as 1.5e-3.
+			hex := strings.HasPrefix(q[i:], "0x") || strings.HasPrefix(q[i:], "0X")
+			j := i + 1
+			for ; j < len(q); j++ {
+				d := q[j]
+				exponent := !hex && (d == '+' || d == '-') && (q[j-1] == 'e' || q[j-1] == 'E')
+				if !isKeywordChar(d, false) && d != '.' && !exponent {
+					break
+				}
+			}
+			b.WriteByte('?')
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// repeatedPlaceholders matches lists of two or more
+// placeholders, such as the values of an IN list.
+var repeatedPlaceholders = regexp.MustCompile(`\?(?:\s*,\s*\?)+`)
+
+// NormalizeStatement returns the shape of q: q with its literals
+// redacted like RedactLiterals does, lists of literals collapsed into
+// a single ?, and runs of whitespace collapsed into single spaces.
+// Executions of a statement with different values have the same shape.
+func NormalizeStatement(q string) string {
+	q = strings.Join(strings.Fields(RedactLiterals(q)), " ")
+	return repeatedPlaceholders.ReplaceAllString(q, "?")
+}
+
+// ConvertPositionalParams replaces the ? placeholders of q with the
+// query parameters @p1, @p2 and so on, in order, and the keywords of
+// q that are keys of keywords with their values. String literals,
+// quoted identifiers, comments and statement hints are left as they are.
+func ConvertPositionalParams(q string, keywords map[string]string) string {
+	var b strings.Builder
+	n := 0
+	for i := 0; i < len(q); {
+		switch c := q[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			j := skipQuoted(q, i)
+			b.WriteString(q[i:j])
+			i = j
+		case c == '#' || (c == '-' && strings.HasPrefix(q[i:], "--")):
+			j := skipLineComment(q, i)
+			b.WriteString(q[i:j])
+			i = j
+		case c == '/' && strings.HasPrefix(q[i:], "/*"):
+			j := skipBlockComment(q, i)
+			b.WriteString(q[i:j])
+			i = j
+		case c == '@' && strings.HasPrefix(q[i:], "@{"):
+			j := skipHint(q, i)
+			b.WriteString(q[i:j])
+			i = j
+		case c == '?':
+			n++
+			b.WriteString("@p" + strconv.Itoa(n))
+			i++
+		case isKeywordChar(c, true) || c == '@':
+			j := i + 1
+			for j < len(q) && isKeywordChar(q[j], false) {
+				j++
+			}
+			if kw, ok := keywords[strings.ToUpper(q[i:j])]; ok && c != '@' {
+				b.WriteString(kw)
+			} else {
+				b.WriteString(q[i:j])
+			}
+			i = j
+		default:
+			b.WriteByte(c)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// ParamNames returns the names of the query parameters of q, such as
+// id for @id, in the order of their first occurrence. Each name is
+// returned once. String literals, quoted identifiers, comments and
+// statement hints are skipped.
+func ParamNames(q string) []string {
+	var names []string
+	for i := 0; i < len(q); {
+		switch c := q[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(q, i)
+		case c == '#' || (c == '-' && strings.HasPrefix(q[i:], "--")):
+			i = skipLineComment(q, i)
+		case c == '/' && strings.HasPrefix(q[i:], "/*"):
+			i = skipBlockComment(q, i)
+		case c == '@' && strings.HasPrefix(q[i:], "@{"):
+			i = skipHint(q, i)
+		case c == '@':
+			j := i + 1
+			for j < len(q) && isKeywordChar(q[j], false) {
+				j++
+			}
+			if name := q[i+1 : j]; name != "" && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+			i = max(j, i+1)
+		default:
+			i++
+		}
+	}
+	return names
+}
+
+// PGParamNames returns the names of the query parameters of q in the
+// PostgreSQL dialect, whose parameters $1, $2 and so on are named p1,
+// p2 and so on. The names of all parameters up to the highest number
+// in q are returned in order. String literals, quoted identifiers,
+// dollar-quoted strings and comments are skipped.
+func PGParamNames(q string) []string {
+	n := 0
+	for i := 0; i < len(q); {
+		switch c := q[i]; {
+		case c == '\'' || c == '"':
+			i = skipQuoted(q, i)
+		case c == '-' && strings.HasPrefix(q[i:], "--"):
+			i = skipLineComment(q, i)
+		case c == '/' && strings.HasPrefix(q[i:], "/*"):
+			i = skipBlockComment(q, i)
+		case c == '$':
+			j := i + 1
+			for j < len(q) && q[j] >= '0' && q[j] <= '9' {
+				j++
+			}
+			if j > i+1 {
+				p, _ := strconv.Atoi(q[i+1 : j])
+				n = max(n, p)
+				i = j
+				continue
+			}
+			i = skipDollarQuoted(q, i)
+		default:
+			i++
+		}
+	}
+	names := make([]string, n)
+	for i := range names {
+		names[i] = "p" + strconv.Itoa(i+1)
+	}
+	return names
+}
+
+// skipDollarQuoted returns the index after the dollar-quoted string,
+// such as $$a$$ or $tag$a$tag$, that starts at q[i], or i+1 if there
+// is none.
+func skipDollarQuoted(q string, i int) int {
+	j := i + 1
+	for j < len(q) && isKeywordChar(q[j], j == i+1) {
+		j++
+	}
+	if j == len(q) || q[j] != '$' {
+		return i + 1
+	}
+	tag := q[i : j+1]
+	if k := strings.Index(q[j+1:], tag); k >= 0 {
+		return j + 1 + k + len(tag)
+	}
+	return len(q)
+}
+
+// SplitList splits q at the commas that are not quoted or nested
+// in parentheses. Angle brackets nest outside of parentheses, where
+// they can only be part of types such as ARRAY<STRUCT<a INT64, b BOOL>>.
+func SplitList(q string) []string {
+	var parts []string
+	parens, angles, start := 0, 0, 0
+	for i := 0; i < len(q); {
+		switch c := q[i]; c {
+		case '\'', '"', '`':
+			i = skipQuoted(q, i)
+			continue
+		case '(':
+			parens++
+		case ')':
+			parens--
+		case '<':
+			if parens == 0 {
+				angles++
+			}
+		case '>':
+			if parens == 0 {
+				angles--
+			}
+		case ',':
+			if parens == 0 && angles == 0 {
+				parts = append(parts, strings.TrimSpace(q[start:i]))
+				start = i + 1
+			}
+		}
+		i++
+	}
+	if s := strings.TrimSpace(q[start:]); s != "" || len(parts) > 0 {
+		parts = append(parts, s)
+	}
+	return parts
+}
+
+// ClosingParen returns the index of the parenthesis that closes
+// the one at q[i], or -1 if it isn't closed.
+func ClosingParen(q string, i int) int {
+	depth := 0
+	for i < len(q) {
+		switch c := q[i]; c {
+		case '\'', '"', '`':
+			i = skipQuoted(q, i)
+			continue
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+		i++
+	}
+	return -1
+}
+
+// StatementType is the type of a SQL statement.
+type StatementType int
+
+const (
+	// StatementTypeUnknown is the type of statements
+	// that don't start with a known keyword.
+	StatementTypeUnknown StatementType = iota
+	StatementTypeQuery
+	StatementTypeDML
+	StatementTypeDDL
+)
+
+func (t StatementType) String() string {
+	switch t {
+	case StatementTypeQuery:
+		return "query"
+	case StatementTypeDML:
+		return "DML"
+	case StatementTypeDDL:
+		return "DDL"
+	}
+	return "unknown"
+}
+
+var statementTypes = map[string]StatementType{
+	"SELECT":  StatementTypeQuery,
+	"WITH":    StatementTypeQuery,
+	"FROM":    StatementTypeQuery,
+	"GRAPH":   StatementTypeQuery,
+	"INSERT":  StatementTypeDML,
+	"UPDATE":  StatementTypeDML,
+	"DELETE":  StatementTypeDML,
+	"CREATE":  StatementTypeDDL,
+	"DROP":    StatementTypeDDL,
+	"ALTER":   StatementTypeDDL,
+	"ANALYZE": StatementTypeDDL,
+	"GRANT":   StatementTypeDDL,
+	"REVOKE":  StatementTypeDDL,
+	"RENAME":  StatementTypeDDL,
+}
+
+// ParseStatementType returns the type of the statement q
+// from its first keyword, see FirstKeyword.
+func ParseStatementType(q string) StatementType {
+	return statementTypes[FirstKeyword(q)]
+}
+
+// FirstKeyword returns the upper-cased first keyword of the
+// statement q. Comments, statement hints such as @{STATEMENT_TAG=x}
+// and the opening parentheses of queries such as (SELECT 1) are
+// skipped. It returns "" if q doesn't start with a keyword.
+func FirstKeyword(q string) string {
+	i := 0
+	for i < len(q) {
+		switch c := q[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '(':
+			i++
+		case c == '#' || (c == '-' && strings.HasPrefix(q[i:], "--")):
+			i = skipLineComment(q, i)
+		case c == '/' && strings.HasPrefix(q[i:], "/*"):
+			i = skipBlockComment(q, i)
+		case c == '@' && strings.HasPrefix(q[i:], "@{"):
+			i = skipHint(q, i)
+		default:
+			j := i
+			for j < len(q) && isKeywordChar(q[j], j == i) {
+				j++
+			}
+			return strings.ToUpper(q[i:j])
+		}
+	}
+	return ""
+}
+
+// skipHint returns the index after the statement hint that starts
+// at q[i]. Hint values may be quoted strings.
+func skipHint(q string, i int) int {
+	for j := i + 2; j < len(q); {
+		switch q[j] {
+		case '\'', '"', '`':
+			j = skipQuoted(q, j)
+		case '}':
+			return j + 1
+		default:
+			j++
+		}
+	}
+	return len(q)
+}
+
+func isKeywordChar(c byte, first bool) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || !first && c >= '0' && c <= '9'
+}
@@ -0,0 +1,219 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{input: "SELECT 1", want: []string{"SELECT 1"}},
+		{input: "SELECT 1;", want: []string{"SELECT 1"}},
+		{input: " ; ;", want: nil},
+		{
+			input: "UPDATE T SET V = 1 WHERE TRUE;\nDELETE FROM T WHERE TRUE",
+			want:  []string{"UPDATE T SET V = 1 WHERE TRUE", "DELETE FROM T WHERE TRUE"},
+		},
+		{
+			input: `INSERT INTO T (S) VALUES ('a;b'); INSERT INTO T (S) VALUES ("c\";d")`,
+			want:  []string{`INSERT INTO T (S) VALUES ('a;b')`, `INSERT INTO T (S) VALUES ("c\";d")`},
+		},
+		{
+			input: "INSERT INTO `T;` (S) VALUES ('''e;'f''');",
+			want:  []string{"INSERT INTO `T;` (S) VALUES ('''e;'f''')"},
+		},
+		{
+			input: "-- first; statement\nSELECT 1; /* second; */ SELECT 2; # done;",
+			want:  []string{"-- first; statement\nSELECT 1", "/* second; */ SELECT 2"},
+		},
+	}
+	for _, tc := range tests {
+		if got := SplitStatements(tc.input); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%q: want %q, got %q", tc.input, tc.want, got)
+		}
+	}
+}
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "-- header\nCREATE TABLE T", want: "CREATE TABLE T"},
+		{input: "SELECT /* a */ 1 # b", want: "SELECT   1"},
+		{input: "SELECT '--not a comment', `#x`", want: "SELECT '--not a comment', `#x`"},
+	}
+	for _, tc := range tests {
+		if got := StripComments(tc.input); got != tc.want {
+			t.Errorf("StripComments(%q): got %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestRedactLiterals(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "SELECT * FROM Singers WHERE Name = 'Alice' AND Id = 42", want: "SELECT * FROM Singers WHERE Name = ? AND Id = ?"},
+		{input: `SELECT a1 FROM T2 WHERE b = @p1 AND c IN (1.5e-3, .5, 0x1F, b"x", r'''y''')`, want: "SELECT a1 FROM T2 WHERE b = @p1 AND c IN (?, ?, ?, b?, r?)"},
+		{input: "@{STATEMENT_TAG='t'} SELECT `col-1` FROM T -- 'secret'\n", want: "@{STATEMENT_TAG='t'} SELECT `col-1` FROM T"},
+		{input: "UPDATE T SET x = x - 1 WHERE true /* 'y' */", want: "UPDATE T SET x = x - ? WHERE true"},
+	}
+	for _, tc := range tests {
+		if got := RedactLiterals(tc.input); got != tc.want {
+			t.Errorf("RedactLiterals(%q): got %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeStatement(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "SELECT *\n  FROM Singers\tWHERE Id = 1 -- first\n", want: "SELECT * FROM Singers WHERE Id = ?"},
+		{input: "SELECT * FROM Singers WHERE Id IN (1, 2,3) AND Name = @name", want: "SELECT * FROM Singers WHERE Id IN (?) AND Name = @name"},
+		{input: "INSERT INTO T (a, b) VALUES ('x', 2), ('y', 3)", want: "INSERT INTO T (a, b) VALUES (?), (?)"},
+	}
+	for _, tc := range tests {
+		if got := NormalizeStatement(tc.input); got != tc.want {
+			t.Errorf("NormalizeStatement(%q): got %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestConvertPositionalParams(t *testing.T) {
+	keywords := map[string]string{"RETURNING": "THEN RETURN"}
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "SELECT * FROM Singers WHERE Id = ? AND Name = ?", want: "SELECT * FROM Singers WHERE Id = @p1 AND Name = @p2"},
+		{input: "INSERT INTO `t?` (a) VALUES (?) returning `id`", want: "INSERT INTO `t?` (a) VALUES (@p1) THEN RETURN `id`"},
+		{input: "SELECT 'a?', returning_x -- ?\nFROM T WHERE b = ? /* ? */", want: "SELECT 'a?', returning_x -- ?\nFROM T WHERE b = @p1 /* ? */"},
+	}
+	for _, tc := range tests {
+		if got := ConvertPositionalParams(tc.input, keywords); got != tc.want {
+			t.Errorf("ConvertPositionalParams(%q): got %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestParamNames(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{input: "SELECT 1", want: nil},
+		{input: "UPDATE T SET A = @a WHERE Id = @id AND @a IS NOT NULL", want: []string{"a", "id"}},
+		{input: "@{FORCE_INDEX=x} SELECT 'a@b.c', `@d` -- @e\nFROM T WHERE F = @p1 /* @g */", want: []string{"p1"}},
+	}
+	for _, tc := range tests {
+		if got := ParamNames(tc.input); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ParamNames(%q): got %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestPGParamNames(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{input: "SELECT 1", want: []string{}},
+		{input: "UPDATE t SET a = $2 WHERE id = $1 AND $2 IS NOT NULL", want: []string{"p1", "p2"}},
+		{input: "SELECT '$4', \"$5\", $$ $6 $$, $x$ $7 $x$ -- $8\nFROM t WHERE f = $3 /* $9 */", want: []string{"p1", "p2", "p3"}},
+	}
+	for _, tc := range tests {
+		if got := PGParamNames(tc.input); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("PGParamNames(%q): got %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{input: "", want: nil},
+		{input: "a, b DESC", want: []string{"a", "b DESC"}},
+		{
+			input: "Id INT64, S STRUCT<a INT64, b STRING(MAX)>, G INT64 AS (IF(Id > 0, 1, 2)) STORED",
+			want:  []string{"Id INT64", "S STRUCT<a INT64, b STRING(MAX)>", "G INT64 AS (IF(Id > 0, 1, 2)) STORED"},
+		},
+		{input: "D STRING(MAX) DEFAULT ('a,b'), E BOOL", want: []string{"D STRING(MAX) DEFAULT ('a,b')", "E BOOL"}},
+	}
+	for _, tc := range tests {
+		if got := SplitList(tc.input); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("SplitList(%q): got %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestClosingParen(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{input: "(a)", want: 2},
+		{input: "(a, (b)) c", want: 7},
+		{input: "(')', `)`)", want: 9},
+		{input: "(a", want: -1},
+	}
+	for _, tc := range tests {
+		if got := ClosingParen(tc.input, 0); got != tc.want {
+			t.Errorf("ClosingParen(%q): got %d, want %d", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestParseStatementType(t *testing.T) {
+	tests := []struct {
+		input string
+		want  StatementType
+	}{
+		{input: "SELECT 1", want: StatementTypeQuery},
+		{input: "  (SELECT 1) UNION ALL (SELECT 2)", want: StatementTypeQuery},
+		{input: "with t as (select 1) select * from t", want: StatementTypeQuery},
+		{input: "FROM Singers |> WHERE SingerId = 1", want: StatementTypeQuery},
+		{input: "GRAPH FinGraph MATCH (n) RETURN n", want: StatementTypeQuery},
+		{input: "@{STATEMENT_TAG='a}b'} @{OPTIMIZER_VERSION=6} SELECT 1", want: StatementTypeQuery},
+		{input: "-- INSERT\nSELECT 1", want: StatementTypeQuery},
+		{input: "/* SELECT */ INSERT INTO T (A) VALUES (1)", want: StatementTypeDML},
+		{input: "@{LOCK_SCANNED_RANGES=exclusive}UPDATE T SET A = 1 WHERE TRUE", want: StatementTypeDML},
+		{input: "# header\ndelete from T where true", want: StatementTypeDML},
+		{input: "CREATE TABLE T (A INT64) PRIMARY KEY (A)", want: StatementTypeDDL},
+		{input: "ANALYZE", want: StatementTypeDDL},
+		{input: "GRANT SELECT ON TABLE T TO ROLE R", want: StatementTypeDDL},
+		{input: "REVOKE SELECT ON TABLE T FROM ROLE R", want: StatementTypeDDL},
+		{input: "RENAME TABLE T TO U", want: StatementTypeDDL},
+		{input: "SHOW VARIABLE READ_ONLY_STALENESS", want: StatementTypeUnknown},
+		{input: "SELECTED 1", want: StatementTypeUnknown},
+		{input: "1 SELECT", want: StatementTypeUnknown},
+		{input: "-- only a comment", want: StatementTypeUnknown},
+	}
+	for _, tc := range tests {
+		if got := ParseStatementType(tc.input); got != tc.want {
+			t.Errorf("ParseStatementType(%q): got %v, want %v", tc.input, got, tc.want)
+		}
+	}
+}
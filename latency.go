@@ -0,0 +1,111 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBreakdown splits the latency of a statement into the phases
+// of its execution, to tell whether a slow statement waited for the
+// network, for Spanner or for the driver. See QueryEvent.Latency.
+type LatencyBreakdown struct {
+	// Encode is the time that the driver spent parsing the
+	// statement and binding its arguments to query parameters.
+	Encode time.Duration
+
+	// RPC is the time that the RPCs of the statement took, until
+	// the first response of streaming RPCs, and Server is the part
+	// of it that Spanner reported as its GFE latency. RPC time
+	// beyond Server is spent on the network.
+	RPC    time.Duration
+	Server time.Duration
+
+	// FirstRow is the time until the first row of a query
+	// was read. It is 0 for statements executed with Exec.
+	FirstRow time.Duration
+
+	// Decode is the time that the driver spent
+	// converting the values of the rows of a query.
+	Decode time.Duration
+
+	// Total is the time of the whole statement, until
+	// the rows of a query were closed.
+	Total time.Duration
+}
+
+type statementLatencyKey struct{}
+
+// statementLatency measures the LatencyBreakdown of a statement.
+// A nil *statementLatency measures nothing.
+type statementLatency struct {
+	start    time.Time
+	rpcs     RPCRecorder
+	encode   atomic.Int64 // nanoseconds
+	firstRow atomic.Int64
+	decode   atomic.Int64
+}
+
+// withStatementLatency returns a context that
+// measures the latency of a statement in l.
+func withStatementLatency(ctx context.Context, l *statementLatency) context.Context {
+	ctx = WithRPCRecorder(ctx, &l.rpcs)
+	return context.WithValue(ctx, statementLatencyKey{}, l)
+}
+
+// statementLatencyFrom returns the statementLatency of ctx, or nil.
+func statementLatencyFrom(ctx context.Context) *statementLatency {
+	l, _ := ctx.Value(statementLatencyKey{}).(*statementLatency)
+	return l
+}
+
+// encoded records that the statement was encoded from start until now.
+func (l *statementLatency) encoded(start time.Time) {
+	if l != nil {
+		l.encode.Add(int64(time.Since(start)))
+	}
+}
+
+// readFirstRow records that the first row of a query has been read.
+func (l *statementLatency) readFirstRow() {
+	if l != nil {
+		l.firstRow.Store(int64(time.Since(l.start)))
+	}
+}
+
+// decoded records that a row was decoded from start until now.
+func (l *statementLatency) decoded(start time.Time) {
+	if l != nil {
+		l.decode.Add(int64(time.Since(start)))
+	}
+}
+
+// breakdown returns the latency of the statement,
+// which took total.
+func (l *statementLatency) breakdown(total time.Duration) LatencyBreakdown {
+	b := LatencyBreakdown{
+		Encode:   time.Duration(l.encode.Load()),
+		FirstRow: time.Duration(l.firstRow.Load()),
+		Decode:   time.Duration(l.decode.Load()),
+		Total:    total,
+	}
+	for _, rpc := range l.rpcs.RPCs() {
+		b.RPC += rpc.Duration
+		b.Server += rpc.GFELatency
+	}
+	return b
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"log"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LeakDetector tracks the rows and transactions of the connections
+// opened by a driver, to find those that the application forgets to
+// close. Rows that aren't closed hold a session, and transactions
+// that aren't committed or rolled back hold a session and locks.
+//
+// Use the same LeakDetector with one driver at a time.
+type LeakDetector struct {
+	// Threshold is the age after which open rows and transactions
+	// are reported as leaked.
+	Threshold time.Duration
+
+	// CaptureStacks records the stack that opened the rows or
+	// began the transaction, which is included in the reports.
+	// Capturing stacks is relatively expensive.
+	CaptureStacks bool
+
+	// Logger, if set, receives a warning for each leak when it
+	// exceeds the threshold. Otherwise leaks are only returned
+	// by Leaks.
+	Logger *log.Logger
+
+	mu   sync.Mutex
+	open map[*Leak]struct{}
+}
+
+// Leak describes rows or a transaction that has been open
+// for longer than the threshold of a LeakDetector.
+type Leak struct {
+	// Kind is "rows", "read-only transaction" or
+	// "read-write transaction".
+	Kind string
+
+	// Opened is the time at which the rows were
+	// opened or the transaction began.
+	Opened time.Time
+
+	// Stack is the stack that opened the rows or began the
+	// transaction if LeakDetector.CaptureStacks is set.
+	Stack []byte
+}
+
+// Leaks returns the rows and transactions that are open for
+// longer than the threshold, the oldest first.
+func (d *LeakDetector) Leaks() []Leak {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var leaks []Leak
+	for l := range d.open {
+		if time.Since(l.Opened) >= d.Threshold {
+			leaks = append(leaks, *l)
+		}
+	}
+	sort.Slice(leaks, func(i, j int) bool { return leaks[i].Opened.Before(leaks[j].Opened) })
+	return leaks
+}
+
+// track starts tracking rows or a transaction that are opened
+// now, and returns a function that stops tracking them when
+// they are closed. The function may be called more than once.
+func (d *LeakDetector) track(kind string) (done func()) {
+	if d == nil {
+		return func() {}
+	}
+	l := &Leak{Kind: kind, Opened: time.Now()}
+	if d.CaptureStacks {
+		l.Stack = debug.Stack()
+	}
+	d.mu.Lock()
+	if d.open == nil {
+		d.open = make(map[*Leak]struct{})
+	}
+	d.open[l] = struct{}{}
+	d.mu.Unlock()
+
+	var t *time.Timer
+	if d.Logger != nil && d.Threshold > 0 {
+		t = time.AfterFunc(d.Threshold, func() {
+			d.Logger.Printf("spannerdriver: %s has been open for %v and may have leaked, it was opened at:\n%s",
+				kind, time.Since(l.Opened).Round(time.Millisecond), stackOrHint(l.Stack))
+		})
+	}
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if t != nil {
+				t.Stop()
+			}
+			d.mu.Lock()
+			delete(d.open, l)
+			d.mu.Unlock()
+		})
+	}
+}
+
+func stackOrHint(stack []byte) string {
+	if stack == nil {
+		return "(set LeakDetector.CaptureStacks to record the stack)"
+	}
+	return string(stack)
+}
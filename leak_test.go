@@ -0,0 +1,55 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLeakDetector(t *testing.T) {
+	var out syncBuffer
+	d := &LeakDetector{
+		Threshold:     10 * time.Millisecond,
+		CaptureStacks: true,
+		Logger:        log.New(&out, "", 0),
+	}
+	leaked := d.track("rows")
+	closed := d.track("read-write transaction")
+	closed()
+	closed() // Closing twice is allowed.
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), "TestLeakDetector") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := out.String(); !strings.Contains(got, "rows has been open") || strings.Contains(got, "transaction") {
+		t.Errorf("want warning about the rows only, got %q", got)
+	}
+	leaks := d.Leaks()
+	if len(leaks) != 1 || leaks[0].Kind != "rows" || !bytes.Contains(leaks[0].Stack, []byte("TestLeakDetector")) {
+		t.Errorf("want leaked rows with the stack of the test, got %+v", leaks)
+	}
+
+	leaked()
+	if leaks := d.Leaks(); len(leaks) != 0 {
+		t.Errorf("want no leaks after closing the rows, got %+v", leaks)
+	}
+	var disabled *LeakDetector
+	disabled.track("rows")()
+}
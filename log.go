@@ -0,0 +1,124 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"log/slog"
+	"time"
+)
+
+// logEvent logs an event of the connection with the logger of the
+// driver, if any. The attributes are only built if the level is
+// enabled, see logEnabled.
+func (c *conn) logEvent(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	if !c.logEnabled(ctx, level) {
+		return
+	}
+	c.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// logEnabled reports whether events of the given level are logged.
+func (c *conn) logEnabled(ctx context.Context, level slog.Level) bool {
+	return c.logger != nil && c.logger.Enabled(ctx, level)
+}
+
+// logStatement logs the classification of a query or an executed statement.
+func (c *conn) logStatement(ctx context.Context, kind StatementKind, query string) {
+	if !c.logEnabled(ctx, slog.LevelDebug) {
+		return
+	}
+	c.logger.LogAttrs(ctx, slog.LevelDebug, "spanner statement",
+		slog.String("kind", kind.String()),
+		slog.String("statement_type", statementType(query)),
+		slog.String("digest", StatementDigest(query)),
+		slog.String("transaction_type", c.transactionType()),
+	)
+}
+
+// statementLog logs the wall time, the rows and the Spanner request
+// IDs of a statement at debug level, if the logStatements connection
+// parameter is set, and reports the statement if it took longer than
+// slowQueryThreshold.
+type statementLog struct {
+	conn   *conn
+	kind   StatementKind
+	query  string
+	txType string
+	tag    string
+	start  time.Time
+	rpcs   RPCRecorder
+}
+
+// startStatementLog returns the log of a statement and a context that
+// collects the request IDs of its RPCs, or nil and ctx if statements
+// are neither logged nor checked for slowness.
+func (c *conn) startStatementLog(ctx context.Context, kind StatementKind, query string) (context.Context, *statementLog) {
+	if !c.logsStatements(ctx) && c.slowQueryThreshold <= 0 {
+		return ctx, nil
+	}
+	l := &statementLog{
+		conn:   c,
+		kind:   kind,
+		query:  query,
+		txType: c.transactionType(),
+		tag:    requestTag(ctx),
+		start:  time.Now(),
+	}
+	return WithRPCRecorder(ctx, &l.rpcs), l
+}
+
+// logsStatements reports whether each statement is logged.
+func (c *conn) logsStatements(ctx context.Context) bool {
+	return c.logStatements && c.logEnabled(ctx, slog.LevelDebug)
+}
+
+// done logs the statement, which returned or affected the
+// given number of rows. A negative number isn't logged.
+func (l *statementLog) done(ctx context.Context, rows int64, err error) {
+	if l == nil {
+		return
+	}
+	d := time.Since(l.start)
+	if t := l.conn.slowQueryThreshold; t > 0 && d >= t {
+		l.conn.reportSlowQuery(ctx, l.slowQuery(d, err))
+	}
+	if !l.conn.logsStatements(ctx) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("kind", l.kind.String()),
+		slog.String("statement_type", statementType(l.query)),
+		slog.String("digest", StatementDigest(l.query)),
+		slog.Duration("duration", d),
+	}
+	if rows >= 0 {
+		attrs = append(attrs, slog.Int64("rows", rows))
+	}
+	attrs = append(attrs, slog.Any("request_ids", l.rpcs.requestIDs()))
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	l.conn.logger.LogAttrs(ctx, slog.LevelDebug, "spanner statement executed", attrs...)
+}
+
+// execDone logs an executed statement with the rows that it affected.
+func (l *statementLog) execDone(ctx context.Context, res driver.Result, err error) {
+	if l == nil {
+		return
+	}
+	l.done(ctx, rowsAffected(res), err)
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestLogger(t *testing.T) {
+	var out syncBuffer
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	db := openFakeSpannerWithDriver(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		return sendRow(stream)
+	}}, &Driver{Logger: logger})
+
+	var id int64
+	if err := db.QueryRowContext(context.Background(), "SELECT Id FROM Singers").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	got := out.String()
+	for _, want := range []string{
+		`msg="spanner connection opened" database=projects/p/instances/i/databases/d`,
+		`msg="spanner statement" database=projects/p/instances/i/databases/d kind=Query statement_type=query digest=` + StatementDigest("SELECT Id FROM Singers") + ` transaction_type=single_use`,
+		`msg="spanner connection closed"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log does not contain %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestLogRetries(t *testing.T) {
+	var out syncBuffer
+	c := &conn{logger: slog.New(slog.NewTextHandler(&out, nil))}
+	c.transactionFinished(1, nil)
+	c.transactionFinished(3, nil)
+	if got, want := out.String(), `msg="spanner transaction retried" attempts=3`; !strings.Contains(got, want) || strings.Count(got, "\n") != 1 {
+		t.Errorf("got %q, want one line with %q", got, want)
+	}
+}
+
+func TestLogLongRunningTransactions(t *testing.T) {
+	var out syncBuffer
+	l := &LongRunningTransactions{Threshold: time.Millisecond}
+	defer l.watch("read-only", nil, slog.New(slog.NewTextHandler(&out, nil)))()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for out.String() == "" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := out.String(); !strings.Contains(got, `level=WARN msg="spanner transaction is long-running" transaction=read-only`) {
+		t.Errorf("got %q, want a warning", got)
+	}
+}
+
+func TestLogStatementLatency(t *testing.T) {
+	var out syncBuffer
+	var requestID string
+	logger := slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	db := openFakeSpannerWithDriver(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		if ids := md.Get(requestIDHeader); len(ids) > 0 {
+			requestID = ids[0]
+		}
+		return sendRow(stream)
+	}}, &Driver{Logger: logger})
+
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Raw(func(driverConn any) error {
+		driverConn.(*conn).logStatements = true
+		return nil
+	})
+	var id int64
+	if err := c.QueryRowContext(ctx, "SELECT Id FROM Singers").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+
+	got := out.String()
+	if requestID == "" {
+		t.Fatal("the query had no request ID")
+	}
+	for _, want := range []string{
+		`msg="spanner statement executed"`,
+		"kind=Query statement_type=query digest=" + StatementDigest("SELECT Id FROM Singers") + " duration=",
+		"rows=1 request_ids=[" + requestID + "]",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("log does not contain %q:\n%s", want, got)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"errors"
+	"log"
+	"log/slog"
+	"runtime/debug"
+	"time"
+)
+
+// ErrLongRunningTransaction is returned by the statements and the
+// commit of a read-write transaction that was rolled back because
+// it stayed open for longer than LongRunningTransactions.Threshold.
+var ErrLongRunningTransaction = errors.New("transaction was rolled back because it exceeded the long-running transaction threshold")
+
+// LongRunningTransactions detects transactions that stay open for
+// longer than a threshold, which usually means that the application
+// leaked them. Open read-write transactions hold locks that block
+// other transactions, and all transactions hold a session.
+type LongRunningTransactions struct {
+	// Threshold is the age after which a transaction is long-running.
+	Threshold time.Duration
+
+	// Logger, if set, receives a warning with the stack that began
+	// each long-running transaction. Otherwise the Logger of the
+	// driver or, if it isn't set either, the log package is used.
+	Logger *log.Logger
+
+	// RollBack rolls back long-running read-write transactions.
+	// Their statements and commit then fail with
+	// ErrLongRunningTransaction. Read-only transactions are only
+	// reported.
+	RollBack bool
+}
+
+// watch starts watching a transaction that begins now and returns
+// a function that stops watching when the transaction ends. If
+// rollback is not nil, it is called to roll back the transaction.
+// Long-running transactions are logged to logger if l has no Logger.
+func (l *LongRunningTransactions) watch(kind string, rollback context.CancelCauseFunc, logger *slog.Logger) (stop func()) {
+	if l == nil || l.Threshold <= 0 {
+		return func() {}
+	}
+	stack := debug.Stack()
+	begin := time.Now()
+	t := time.AfterFunc(l.Threshold, func() {
+		rolledBack := l.RollBack && rollback != nil
+		if rolledBack {
+			rollback(ErrLongRunningTransaction)
+		}
+		age := time.Since(begin).Round(time.Millisecond)
+		if l.Logger == nil && logger != nil {
+			logger.Warn("spanner transaction is long-running",
+				slog.String("transaction", kind),
+				slog.Duration("age", age),
+				slog.Bool("rolled_back", rolledBack),
+				slog.String("stack", string(stack)))
+			return
+		}
+		logf := log.Printf
+		if l.Logger != nil {
+			logf = l.Logger.Printf
+		}
+		msg := ""
+		if rolledBack {
+			msg = ", rolling it back"
+		}
+		logf("spannerdriver: %s transaction has been open for %v%s, it began at:\n%s", kind, age, msg, stack)
+	})
+	return func() { t.Stop() }
+}
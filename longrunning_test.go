@@ -0,0 +1,78 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLongRunningTransactions(t *testing.T) {
+	var out syncBuffer
+	l := &LongRunningTransactions{
+		Threshold: 10 * time.Millisecond,
+		Logger:    log.New(&out, "", 0),
+		RollBack:  true,
+	}
+
+	ctx, rollback := context.WithCancelCause(context.Background())
+	defer rollback(nil)
+	stop := l.watch("read-write", rollback, nil)
+	defer stop()
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("long-running transaction was not rolled back")
+	}
+	if err := context.Cause(ctx); err != ErrLongRunningTransaction {
+		t.Errorf("want ErrLongRunningTransaction, got %v", err)
+	}
+	// The transaction is logged after it was rolled back.
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(out.String(), "TestLongRunningTransactions") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := out.String(); !strings.Contains(got, "read-write transaction has been open") || !strings.Contains(got, "TestLongRunningTransactions") {
+		t.Errorf("want warning with stack of the test, got %q", got)
+	}
+
+	// Transactions that end in time are not reported.
+	l.Threshold = time.Hour
+	l.watch("read-only", nil, nil)()
+	var disabled *LongRunningTransactions
+	disabled.watch("read-only", nil, nil)()
+}
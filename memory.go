@@ -0,0 +1,102 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrMemoryLimitExceeded is returned by Rows.Next if decoding
+// the next row would exceed the budget of a MemoryLimiter.
+var ErrMemoryLimitExceeded = errors.New("spannerdriver: memory limit for decoded rows exceeded")
+
+// MemoryLimiter bounds the memory that is held by decoded rows across
+// all connections that share it, to protect services from running out
+// of memory during accidental full table scans.
+//
+// The size of a row is estimated from its encoded size and is held
+// from the moment the row is decoded until the next row is requested
+// or the rows are closed. Rows that are buffered by the Spanner client
+// and were not decoded yet are not accounted for.
+type MemoryLimiter struct {
+	limit int64
+	block bool
+
+	mu       sync.Mutex
+	used     int64
+	released chan struct{} // closed when memory is released
+}
+
+// NewMemoryLimiter returns a limiter with a budget of limit bytes.
+// If block is true, rows wait for memory to be released by other rows
+// when the budget is exhausted. Otherwise they fail immediately with
+// ErrMemoryLimitExceeded. A row that is larger than the whole budget
+// always fails.
+func NewMemoryLimiter(limit int64, block bool) *MemoryLimiter {
+	return &MemoryLimiter{
+		limit:    limit,
+		block:    block,
+		released: make(chan struct{}),
+	}
+}
+
+// InUse returns the number of bytes that are currently held by decoded rows.
+func (l *MemoryLimiter) InUse() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.used
+}
+
+func (l *MemoryLimiter) acquire(ctx context.Context, n int64) error {
+	if l == nil || n == 0 {
+		return nil
+	}
+	if n > l.limit {
+		return ErrMemoryLimitExceeded
+	}
+	for {
+		l.mu.Lock()
+		if l.used+n <= l.limit {
+			l.used += n
+			l.mu.Unlock()
+			return nil
+		}
+		if !l.block {
+			l.mu.Unlock()
+			return ErrMemoryLimitExceeded
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *MemoryLimiter) release(n int64) {
+	if l == nil || n == 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.used -= n
+	close(l.released)
+	l.released = make(chan struct{})
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLimiter(100, false)
+
+	if err := l.acquire(ctx, 101); err != ErrMemoryLimitExceeded {
+		t.Errorf("row larger than limit: want %v, got %v", ErrMemoryLimitExceeded, err)
+	}
+	if err := l.acquire(ctx, 60); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.acquire(ctx, 60); err != ErrMemoryLimitExceeded {
+		t.Errorf("exhausted limit: want %v, got %v", ErrMemoryLimitExceeded, err)
+	}
+	l.release(60)
+	if got := l.InUse(); got != 0 {
+		t.Errorf("want 0 bytes in use, got %d", got)
+	}
+
+	var nilLimiter *MemoryLimiter
+	if err := nilLimiter.acquire(ctx, 1<<40); err != nil {
+		t.Errorf("nil limiter: %v", err)
+	}
+	nilLimiter.release(1 << 40)
+}
+
+func TestMemoryLimiterBlocks(t *testing.T) {
+	ctx := context.Background()
+	l := NewMemoryLimiter(100, true)
+	if err := l.acquire(ctx, 80); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- l.acquire(ctx, 50)
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("acquire did not block, err: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	l.release(80)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := l.acquire(ctx, 60); err != context.DeadlineExceeded {
+		t.Errorf("want %v, got %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Values of the spanner.end_reason attribute, see endReason.
+const (
+	endOK               = "ok"
+	endCanceled         = "canceled"
+	endDeadlineExceeded = "deadline_exceeded"
+	endTimeout          = "timeout"
+	endError            = "error"
+)
+
+// Values of the spanner.transaction_outcome attribute.
+const (
+	txCommitted  = "committed"
+	txRolledBack = "rolled_back"
+	txAborted    = "aborted"
+	txFailed     = "failed"
+)
+
+const (
+	attrTransactionOutcome = attribute.Key("spanner.transaction_outcome")
+	attrTransactionTag     = attribute.Key("spanner.transaction_tag")
+	attrStatementDigest    = attribute.Key("spanner.statement_digest")
+	attrEndReason          = attribute.Key("spanner.end_reason")
+)
+
+// commitMethod is the gRPC method that commits transactions.
+const commitMethod = "/google.spanner.v1.Spanner/Commit"
+
+// driverMetrics are the OpenTelemetry instruments of a driver.
+// A nil *driverMetrics records nothing.
+type driverMetrics struct {
+	statementDuration metric.Float64Histogram
+	rows              metric.Int64Counter
+	transactions      metric.Int64Counter
+	retries           metric.Int64Counter
+	connections       metric.Int64UpDownCounter
+	commitDuration    metric.Float64Histogram
+	commitMutations   metric.Int64Histogram
+	errors            metric.Int64Counter
+}
+
+// newDriverMetrics creates the instruments of a driver with the
+// meter of mp. It returns nil if mp is nil.
+func newDriverMetrics(mp metric.MeterProvider) (*driverMetrics, error) {
+	if mp == nil {
+		return nil, nil
+	}
+	meter := mp.Meter(tracerName)
+	m := &driverMetrics{}
+	var err error
+	if m.statementDuration, err = meter.Float64Histogram("spanner.driver.statement.duration",
+		metric.WithDescription("Duration of queries until the first row is returned, and of executed statements."),
+		metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if m.rows, err = meter.Int64Counter("spanner.driver.rows",
+		metric.WithDescription("Number of rows returned by queries."),
+		metric.WithUnit("{row}")); err != nil {
+		return nil, err
+	}
+	if m.transactions, err = meter.Int64Counter("spanner.driver.transactions",
+		metric.WithDescription("Number of transactions that ended, by outcome."),
+		metric.WithUnit("{transaction}")); err != nil {
+		return nil, err
+	}
+	if m.retries, err = meter.Int64Counter("spanner.driver.transaction.retries",
+		metric.WithDescription("Number of times read-write transactions were retried after Spanner aborted them."),
+		metric.WithUnit("{retry}")); err != nil {
+		return nil, err
+	}
+	if m.connections, err = meter.Int64UpDownCounter("spanner.driver.connections",
+		metric.WithDescription("Number of open connections."),
+		metric.WithUnit("{connection}")); err != nil {
+		return nil, err
+	}
+	if m.commitDuration, err = meter.Float64Histogram("spanner.driver.commit.duration",
+		metric.WithDescription("Duration of the commits of transactions that requested commit statistics."),
+		metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if m.commitMutations, err = meter.Int64Histogram("spanner.driver.commit.mutations",
+		metric.WithDescription("Number of mutations of the commits of transactions that requested commit statistics."),
+		metric.WithUnit("{mutation}")); err != nil {
+		return nil, err
+	}
+	if m.errors, err = meter.Int64Counter("spanner.driver.errors",
+		metric.WithDescription("Number of failed statements, reads of rows, and begins, commits and rollbacks of transactions, by error code."),
+		metric.WithUnit("{error}")); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// statementExecuted records the duration of a query or an executed statement.
+func (m *driverMetrics) statementExecuted(ctx context.Context, kind StatementKind, query string, start time.Time, err error) {
+	if m == nil {
+		return
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("db.operation.name", kind.String()),
+		attrStatementType.String(statementType(query)),
+		attrStatementDigest.String(StatementDigest(query)),
+		attrEndReason.String(endReason(ctx, err)),
+	}
+	if err != nil {
+		attrs = append(attrs, attribute.String("error.type", errorCode(err)))
+	}
+	m.statementDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+	m.failed(ctx, kind.String(), err)
+}
+
+// failed counts err, if it is not nil, by its error code and
+// the operation that failed: Query, Exec, Begin, Commit or Rollback.
+func (m *driverMetrics) failed(ctx context.Context, operation string, err error) {
+	if m == nil || err == nil {
+		return
+	}
+	m.errors.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("db.operation.name", operation),
+		attribute.String("error.type", errorCode(err)),
+		attrEndReason.String(endReason(ctx, err)),
+	))
+}
+
+// errorCode returns the gRPC code of err, such as ABORTED or
+// DEADLINE_EXCEEDED. Errors of expired and canceled contexts
+// have the codes of the corresponding gRPC errors.
+func errorCode(err error) string {
+	c := spanner.ErrCode(err)
+	if c == codes.Unknown {
+		c = status.FromContextError(err).Code()
+	}
+	return code.Code(c).String()
+}
+
+// endReason returns why an operation that was started with ctx ended:
+//   - ok if err is nil.
+//   - canceled or deadline_exceeded if the application canceled ctx
+//     or its deadline passed.
+//   - timeout if the driver or the Spanner client gave up while ctx
+//     was still alive, e.g. at the timeout of a transaction, at the
+//     timeout of an RPC, or at the long-running transaction threshold.
+//   - error for the errors of Spanner and of the driver.
+func endReason(ctx context.Context, err error) string {
+	switch {
+	case err == nil:
+		return endOK
+	case errors.Is(ctx.Err(), context.Canceled):
+		return endCanceled
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return endDeadlineExceeded
+	}
+	switch spanner.ErrCode(err) {
+	case codes.DeadlineExceeded, codes.Canceled:
+		return endTimeout
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) || errors.Is(err, ErrLongRunningTransaction) {
+		return endTimeout
+	}
+	return endError
+}
+
+// rowsReturned records the rows that a query returned.
+func (m *driverMetrics) rowsReturned(ctx context.Context, n int64) {
+	if m == nil || n == 0 {
+		return
+	}
+	m.rows.Add(ctx, n)
+}
+
+// transactionEnded records the outcome of a transaction.
+func (m *driverMetrics) transactionEnded(ctx context.Context, txType, outcome string) {
+	if m == nil {
+		return
+	}
+	m.transactions.Add(ctx, 1, metric.WithAttributes(attrTransactionType.String(txType), attrTransactionOutcome.String(outcome)))
+}
+
+// transactionRetried records the retries of a read-write
+// transaction that ran attempts times.
+func (m *driverMetrics) transactionRetried(attempts int) {
+	if m == nil || attempts <= 1 {
+		return
+	}
+	m.retries.Add(context.Background(), int64(attempts-1))
+}
+
+// committed records the duration and the mutation count of a Commit
+// RPC that returned commit statistics, by transaction tag.
+func (m *driverMetrics) committed(ctx context.Context, req, reply any, d time.Duration) {
+	resp, ok := reply.(*sppb.CommitResponse)
+	if m == nil || !ok || resp.GetCommitStats() == nil {
+		return
+	}
+	var attrs []attribute.KeyValue
+	if r, ok := req.(*sppb.CommitRequest); ok && r.GetRequestOptions().GetTransactionTag() != "" {
+		attrs = append(attrs, attrTransactionTag.String(r.GetRequestOptions().GetTransactionTag()))
+	}
+	m.commitDuration.Record(ctx, d.Seconds(), metric.WithAttributes(attrs...))
+	m.commitMutations.Record(ctx, resp.GetCommitStats().GetMutationCount(), metric.WithAttributes(attrs...))
+}
+
+// connectionsChanged records that delta connections were opened or closed.
+func (m *driverMetrics) connectionsChanged(delta int64) {
+	if m == nil {
+		return
+	}
+	m.connections.Add(context.Background(), delta)
+}
+
+// transactionOutcome returns the outcome of a
+// transaction that was committed or rolled back.
+func transactionOutcome(rollback bool, err error) string {
+	switch {
+	case err == nil && rollback:
+		return txRolledBack
+	case err == nil:
+		return txCommitted
+	case spanner.ErrCode(err) == codes.Aborted:
+		return txAborted
+	}
+	return txFailed
+}
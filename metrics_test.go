@@ -0,0 +1,229 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// collectMetrics returns the sums, the counts of float histograms
+// and the sums of int histograms that reader collected, keyed by
+// instrument name.
+func collectMetrics(t *testing.T, reader sdkmetric.Reader) map[string]int64 {
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]int64)
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch data := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range data.DataPoints {
+					values[m.Name] += dp.Value
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range data.DataPoints {
+					values[m.Name] += int64(dp.Count)
+				}
+			case metricdata.Histogram[int64]:
+				for _, dp := range data.DataPoints {
+					values[m.Name] += dp.Sum
+				}
+			}
+		}
+	}
+	return values
+}
+
+func TestMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	db := openFakeSpannerWithDriver(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		return sendRow(stream)
+	}}, &Driver{MeterProvider: mp})
+	db.SetMaxIdleConns(0)
+
+	ctx := context.Background()
+	var id int64
+	if err := db.QueryRowContext(ctx, "SELECT Id FROM Singers").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.QueryRowContext(ctx, "SELECT Id FROM Singers").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := collectMetrics(t, reader)
+	for name, want := range map[string]int64{
+		"spanner.driver.statement.duration": 2,
+		"spanner.driver.rows":               2,
+		"spanner.driver.transactions":       1,
+		"spanner.driver.connections":        0,
+	} {
+		if got[name] != want {
+			t.Errorf("%s = %d, want %d", name, got[name], want)
+		}
+	}
+}
+
+func TestTransactionOutcome(t *testing.T) {
+	for _, tc := range []struct {
+		rollback bool
+		err      error
+		want     string
+	}{
+		{false, nil, txCommitted},
+		{true, nil, txRolledBack},
+		{false, status.Error(codes.Aborted, "aborted"), txAborted},
+		{false, errors.New("failed"), txFailed},
+	} {
+		if got := transactionOutcome(tc.rollback, tc.err); got != tc.want {
+			t.Errorf("transactionOutcome(%v, %v) = %q, want %q", tc.rollback, tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestCommitMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	m, err := newDriverMetrics(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	req := &sppb.CommitRequest{RequestOptions: &sppb.RequestOptions{TransactionTag: "app=shop"}}
+	m.committed(ctx, req, &sppb.CommitResponse{CommitStats: &sppb.CommitResponse_CommitStats{MutationCount: 12}}, 20*time.Millisecond)
+	m.committed(ctx, req, &sppb.CommitResponse{CommitStats: &sppb.CommitResponse_CommitStats{MutationCount: 3}}, 10*time.Millisecond)
+	// Commits without statistics are not recorded.
+	m.committed(ctx, req, &sppb.CommitResponse{}, 10*time.Millisecond)
+
+	got := collectMetrics(t, reader)
+	if got["spanner.driver.commit.duration"] != 2 || got["spanner.driver.commit.mutations"] != 15 {
+		t.Errorf("got %v, want 2 commits with 15 mutations", got)
+	}
+}
+
+func TestErrorMetrics(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	db := openFakeSpannerWithDriver(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		return status.Error(codes.NotFound, "Table not found: Albums")
+	}}, &Driver{MeterProvider: mp})
+
+	if _, err := db.QueryContext(context.Background(), "SELECT Id FROM Albums"); err == nil {
+		t.Fatal("want an error")
+	}
+	if got := collectMetrics(t, reader)["spanner.driver.errors"]; got != 1 {
+		t.Errorf("got %d errors, want 1", got)
+	}
+}
+
+func TestStatementDigestMetric(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	db := openFakeSpannerWithDriver(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		return sendRow(stream)
+	}}, &Driver{MeterProvider: mp})
+
+	for _, query := range []string{"SELECT Id FROM Singers WHERE Id = 1", "SELECT Id FROM Singers\n WHERE Id = 2"} {
+		var id int64
+		if err := db.QueryRowContext(context.Background(), query).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if m.Name != "spanner.driver.statement.duration" {
+				continue
+			}
+			dps := m.Data.(metricdata.Histogram[float64]).DataPoints
+			if len(dps) != 1 || dps[0].Count != 2 {
+				t.Fatalf("got %+v, want one data point of both queries", dps)
+			}
+			digest, _ := dps[0].Attributes.Value(attrStatementDigest)
+			if want := StatementDigest("SELECT Id FROM Singers WHERE Id = 3"); digest.AsString() != want {
+				t.Errorf("got digest %q, want %q", digest.AsString(), want)
+			}
+			return
+		}
+	}
+	t.Error("no statement duration metric")
+}
+
+func TestEndReason(t *testing.T) {
+	expired, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-expired.Done()
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	alive := context.Background()
+	for _, tc := range []struct {
+		ctx  context.Context
+		err  error
+		want string
+	}{
+		{alive, nil, endOK},
+		{canceled, status.Error(codes.Canceled, "context canceled"), endCanceled},
+		{expired, status.Error(codes.DeadlineExceeded, "deadline exceeded"), endDeadlineExceeded},
+		{alive, status.Error(codes.DeadlineExceeded, "deadline exceeded"), endTimeout},
+		{alive, ErrLongRunningTransaction, endTimeout},
+		{alive, status.Error(codes.NotFound, "Table not found: Albums"), endError},
+	} {
+		if got := endReason(tc.ctx, tc.err); got != tc.want {
+			t.Errorf("endReason(%v, %v) = %s, want %s", tc.ctx.Err(), tc.err, got, tc.want)
+		}
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 0)
+	defer cancel()
+	<-ctx.Done()
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{status.Error(codes.Aborted, "aborted"), "ABORTED"},
+		{status.Error(codes.ResourceExhausted, "too many requests"), "RESOURCE_EXHAUSTED"},
+		{ctx.Err(), "DEADLINE_EXCEEDED"},
+		{context.Canceled, "CANCELLED"},
+		{errors.New("invalid statement"), "UNKNOWN"},
+	} {
+		if got := errorCode(tc.err); got != tc.want {
+			t.Errorf("errorCode(%v) = %s, want %s", tc.err, got, tc.want)
+		}
+	}
+}
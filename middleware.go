@@ -0,0 +1,80 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql/driver"
+)
+
+// StatementKind tells queries and executed statements apart.
+type StatementKind int
+
+const (
+	// StatementKindQuery is a statement executed with QueryContext.
+	StatementKindQuery StatementKind = iota
+	// StatementKindExec is a statement executed with ExecContext.
+	StatementKindExec
+)
+
+func (k StatementKind) String() string {
+	switch k {
+	case StatementKindQuery:
+		return "Query"
+	case StatementKindExec:
+		return "Exec"
+	}
+	return "Unknown"
+}
+
+// Statement is a SQL statement that is passed
+// through the middleware chain of a connection.
+type Statement struct {
+	Kind StatementKind
+	SQL  string
+	Args []driver.NamedValue
+}
+
+// StatementResult is the result of a Statement. Rows is set
+// for queries and Result is set for executed statements.
+type StatementResult struct {
+	Rows   driver.Rows
+	Result driver.Result
+}
+
+// StatementHandler executes a statement.
+type StatementHandler func(ctx context.Context, stmt Statement) (StatementResult, error)
+
+// Middleware wraps a StatementHandler to add behavior before or after
+// the statement is executed, or to replace its execution altogether.
+// A middleware may modify the statement before passing it to next.
+//
+//	logging := func(next spannerdriver.StatementHandler) spannerdriver.StatementHandler {
+//		return func(ctx context.Context, stmt spannerdriver.Statement) (spannerdriver.StatementResult, error) {
+//			log.Printf("%v: %s", stmt.Kind, stmt.SQL)
+//			return next(ctx, stmt)
+//		}
+//	}
+//	d := &spannerdriver.Driver{Middlewares: []spannerdriver.Middleware{logging}}
+type Middleware func(next StatementHandler) StatementHandler
+
+// chainMiddlewares returns a handler that calls the middlewares in
+// order, the first middleware being the outermost one, before h.
+func chainMiddlewares(middlewares []Middleware, h StatementHandler) StatementHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
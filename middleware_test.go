@@ -0,0 +1,62 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestChainMiddlewares(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next StatementHandler) StatementHandler {
+			return func(ctx context.Context, stmt Statement) (StatementResult, error) {
+				calls = append(calls, name+":"+stmt.SQL)
+				return next(ctx, stmt)
+			}
+		}
+	}
+	rewrite := func(next StatementHandler) StatementHandler {
+		return func(ctx context.Context, stmt Statement) (StatementResult, error) {
+			stmt.SQL = strings.ToUpper(stmt.SQL)
+			return next(ctx, stmt)
+		}
+	}
+	base := func(ctx context.Context, stmt Statement) (StatementResult, error) {
+		calls = append(calls, "base:"+stmt.Kind.String()+":"+stmt.SQL)
+		return StatementResult{Result: &result{rowsAffected: 1}}, nil
+	}
+
+	c := &conn{handler: chainMiddlewares([]Middleware{record("outer"), rewrite, record("inner")}, base)}
+	res, err := c.ExecContext(context.Background(), "delete from t where true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Errorf("want 1 row affected, got %d", n)
+	}
+
+	want := []string{
+		"outer:delete from t where true",
+		"inner:DELETE FROM T WHERE TRUE",
+		"base:Exec:DELETE FROM T WHERE TRUE",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("want calls %v, got %v", want, calls)
+	}
+}
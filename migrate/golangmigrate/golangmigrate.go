@@ -0,0 +1,347 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package golangmigrate is a golang-migrate database driver for Spanner
+// databases, built on the database/sql driver. Importing it registers
+// the driver for URLs of the form
+//
+//	spannerdriver://projects/PROJECT/instances/INSTANCE/databases/DATABASE
+//
+// where the database is followed by the connection parameters of the
+// driver, e.g. ;retryAbortsInternally=false, and optionally by
+// ?x-migrations-table=NAME&x-lock-table=NAME. A *sql.DB is used with
+// WithInstance:
+//
+//	driver, err := golangmigrate.WithInstance(db, &golangmigrate.Config{})
+//	...
+//	m, err := migrate.NewWithDatabaseInstance("file://migrations", "spannerdriver", driver)
+//
+// The statements of a migration file are applied as one DDL batch, or,
+// if they are all DML, in one read-write transaction. The version is
+// stored in a schema_migrations table, and the lock is a row of a
+// schema_migrations_lock table that is inserted with a mutation, so
+// only one migrate process can hold it at a time.
+package golangmigrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+	"github.com/golang-migrate/migrate/v4/database"
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+	"github.com/rakyll/go-sql-driver-spanner/internal"
+	"github.com/rakyll/go-sql-driver-spanner/migrate"
+	"google.golang.org/grpc/codes"
+)
+
+// Scheme is the URL scheme of the driver.
+const Scheme = "spannerdriver"
+
+// DefaultMigrationsTable is the default name of the version table.
+const DefaultMigrationsTable = "schema_migrations"
+
+func init() {
+	database.Register(Scheme, &Driver{})
+}
+
+// Config configures a Driver.
+type Config struct {
+	// MigrationsTable is the name of the version table.
+	// It defaults to DefaultMigrationsTable.
+	MigrationsTable string
+	// LockTable is the name of the lock table. It defaults
+	// to the name of the version table followed by _lock.
+	LockTable string
+}
+
+// Driver is a golang-migrate database driver for Spanner.
+type Driver struct {
+	db     *sql.DB
+	config Config
+	// closeDB is set if the driver opened db.
+	closeDB bool
+
+	mu     sync.Mutex
+	locked bool
+}
+
+var _ database.Driver = (*Driver)(nil)
+
+// WithInstance returns a driver that migrates the database of db, and
+// creates the version and lock tables if they don't exist yet.
+func WithInstance(db *sql.DB, config *Config) (database.Driver, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	c := *config
+	if c.MigrationsTable == "" {
+		c.MigrationsTable = DefaultMigrationsTable
+	}
+	if c.LockTable == "" {
+		c.LockTable = c.MigrationsTable + "_lock"
+	}
+	d := &Driver{db: db, config: c}
+	if err := spannerdriver.ExecDDL(context.Background(),
+		db, createMigrationsTable(c.MigrationsTable), createLockTable(c.LockTable)); err != nil {
+		return nil, fmt.Errorf("creating %s and %s: %v", c.MigrationsTable, c.LockTable, err)
+	}
+	return d, nil
+}
+
+// Open opens the database of a spannerdriver:// URL.
+func (d *Driver) Open(rawURL string) (database.Driver, error) {
+	dsn, config, err := parseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("spanner", dsn)
+	if err != nil {
+		return nil, err
+	}
+	driver, err := WithInstance(db, &config)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	driver.(*Driver).closeDB = true
+	return driver, nil
+}
+
+// parseURL returns the DSN and the configuration of a spannerdriver:// URL.
+func parseURL(rawURL string) (string, Config, error) {
+	var config Config
+	dsn, ok := strings.CutPrefix(rawURL, Scheme+"://")
+	if !ok {
+		return "", config, fmt.Errorf("invalid URL %q, expected %s://projects/...", rawURL, Scheme)
+	}
+	dsn, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return "", config, fmt.Errorf("invalid URL %q: %v", rawURL, err)
+	}
+	config.MigrationsTable = params.Get("x-migrations-table")
+	config.LockTable = params.Get("x-lock-table")
+	return dsn, config, nil
+}
+
+// Close closes the database if the driver opened it.
+func (d *Driver) Close() error {
+	if d.closeDB {
+		return d.db.Close()
+	}
+	return nil
+}
+
+// Lock inserts the row of the lock table, and returns
+// database.ErrLocked if another process holds the lock.
+func (d *Driver) Lock() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.locked {
+		return database.ErrLocked
+	}
+	_, err := spannerdriver.Apply(context.Background(), d.db, []*spanner.Mutation{
+		spanner.Insert(d.config.LockTable, []string{"Id", "LockedAt"}, []interface{}{int64(1), spanner.CommitTimestamp}),
+	})
+	if spanner.ErrCode(err) == codes.AlreadyExists {
+		return database.ErrLocked
+	}
+	if err != nil {
+		return err
+	}
+	d.locked = true
+	return nil
+}
+
+// Unlock deletes the row of the lock table.
+func (d *Driver) Unlock() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.locked {
+		return database.ErrNotLocked
+	}
+	if _, err := spannerdriver.Apply(context.Background(), d.db, []*spanner.Mutation{
+		spanner.Delete(d.config.LockTable, spanner.Key{int64(1)}),
+	}); err != nil {
+		return err
+	}
+	d.locked = false
+	return nil
+}
+
+// Run applies the statements of a migration file.
+func (d *Driver) Run(migration io.Reader) error {
+	b, err := io.ReadAll(migration)
+	if err != nil {
+		return err
+	}
+	statements := migrate.Split(string(b))
+	if len(statements) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	switch typ, err := statementsType(statements); {
+	case err != nil:
+		return err
+	case typ == internal.StatementTypeDDL:
+		return spannerdriver.ExecDDL(ctx, d.db, statements...)
+	}
+
+	tx, err := d.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return database.Error{OrigErr: err, Query: []byte(stmt)}
+		}
+	}
+	return tx.Commit()
+}
+
+// statementsType returns the type of statements, which
+// must either all be DDL or all be DML statements.
+func statementsType(statements []string) (internal.StatementType, error) {
+	typ := internal.ParseStatementType(statements[0])
+	for _, stmt := range statements {
+		t := internal.ParseStatementType(stmt)
+		if t != internal.StatementTypeDDL && t != internal.StatementTypeDML {
+			return t, fmt.Errorf("unsupported %s statement in migration: %s", t, stmt)
+		}
+		if t != typ {
+			return t, errors.New("migrations can't mix DDL and DML statements")
+		}
+	}
+	return typ, nil
+}
+
+// SetVersion replaces the version of the version table.
+func (d *Driver) SetVersion(version int, dirty bool) error {
+	ms := []*spanner.Mutation{spanner.Delete(d.config.MigrationsTable, spanner.AllKeys())}
+	if version >= 0 || (version == database.NilVersion && dirty) {
+		ms = append(ms, spanner.Insert(d.config.MigrationsTable,
+			[]string{"Version", "Dirty"}, []interface{}{int64(version), dirty}))
+	}
+	_, err := spannerdriver.Apply(context.Background(), d.db, ms)
+	return err
+}
+
+// Version returns the version of the version table, or
+// database.NilVersion if no migration has been applied.
+func (d *Driver) Version() (int, bool, error) {
+	var version int64
+	var dirty bool
+	err := d.db.QueryRowContext(context.Background(),
+		fmt.Sprintf("SELECT Version, Dirty FROM `%s` LIMIT 1", d.config.MigrationsTable)).Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return database.NilVersion, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return int(version), dirty, nil
+}
+
+// Drop drops all tables of the database, including the version
+// table, in one DDL batch. The lock table is kept, because the
+// lock is held while the database is dropped.
+func (d *Driver) Drop() error {
+	ctx := context.Background()
+	names, err := spannerdriver.ListTables(ctx, d.db)
+	if err != nil {
+		return err
+	}
+	var tables []spannerdriver.Table
+	for _, name := range names {
+		if strings.EqualFold(name, d.config.LockTable) {
+			continue
+		}
+		t, err := spannerdriver.DescribeTable(ctx, d.db, name)
+		if err != nil {
+			return err
+		}
+		tables = append(tables, t)
+	}
+	statements := dropStatements(tables)
+	if len(statements) == 0 {
+		return nil
+	}
+	return spannerdriver.ExecDDL(ctx, d.db, statements...)
+}
+
+// dropStatements returns the statements that drop tables: their
+// foreign keys first, then each table after its indexes, with
+// interleaved tables before their parents.
+func dropStatements(tables []spannerdriver.Table) []string {
+	parents := make(map[string]string)
+	for _, t := range tables {
+		parents[strings.ToUpper(t.Name)] = strings.ToUpper(t.ParentTable)
+	}
+	depth := func(name string) int {
+		n := 0
+		for p := parents[strings.ToUpper(name)]; p != ""; p = parents[p] {
+			n++
+		}
+		return n
+	}
+	sorted := append([]spannerdriver.Table(nil), tables...)
+	sort.SliceStable(sorted, func(i, j int) bool { return depth(sorted[i].Name) > depth(sorted[j].Name) })
+
+	var statements []string
+	for _, t := range sorted {
+		for _, fk := range t.ForeignKeys {
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", quote(t.Name), quote(fk.Name)))
+		}
+	}
+	for _, t := range sorted {
+		for _, idx := range t.Indexes {
+			statements = append(statements, "DROP INDEX "+quote(idx.Name))
+		}
+		statements = append(statements, "DROP TABLE "+quote(t.Name))
+	}
+	return statements
+}
+
+func createMigrationsTable(table string) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n"+
+		"  Version INT64 NOT NULL,\n"+
+		"  Dirty BOOL NOT NULL,\n"+
+		") PRIMARY KEY (Version)", quote(table))
+}
+
+func createLockTable(table string) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n"+
+		"  Id INT64 NOT NULL,\n"+
+		"  LockedAt TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),\n"+
+		") PRIMARY KEY (Id)", quote(table))
+}
+
+// quote quotes an identifier, and each part
+// of a name that is qualified with a schema.
+func quote(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = "`" + p + "`"
+	}
+	return strings.Join(parts, ".")
+}
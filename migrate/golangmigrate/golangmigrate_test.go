@@ -0,0 +1,76 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package golangmigrate
+
+import (
+	"reflect"
+	"testing"
+
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+	"github.com/rakyll/go-sql-driver-spanner/internal"
+)
+
+func TestParseURL(t *testing.T) {
+	dsn, config, err := parseURL("spannerdriver://projects/p/instances/i/databases/d;warmupSessions=10?x-migrations-table=versions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "projects/p/instances/i/databases/d;warmupSessions=10"; dsn != want {
+		t.Errorf("got DSN %q, want %q", dsn, want)
+	}
+	if want := (Config{MigrationsTable: "versions"}); config != want {
+		t.Errorf("got %+v, want %+v", config, want)
+	}
+	if _, _, err := parseURL("spanner://projects/p/instances/i/databases/d"); err == nil {
+		t.Error("other scheme: expected error")
+	}
+}
+
+func TestStatementsType(t *testing.T) {
+	typ, err := statementsType([]string{"CREATE TABLE Singers (Id INT64) PRIMARY KEY (Id)", "CREATE INDEX SingersById ON Singers (Id)"})
+	if err != nil || typ != internal.StatementTypeDDL {
+		t.Errorf("DDL: got %v, %v", typ, err)
+	}
+	typ, err = statementsType([]string{"INSERT INTO Singers (Id) VALUES (1)", "UPDATE Singers SET Id = 2 WHERE Id = 1"})
+	if err != nil || typ != internal.StatementTypeDML {
+		t.Errorf("DML: got %v, %v", typ, err)
+	}
+	if _, err := statementsType([]string{"CREATE TABLE Singers (Id INT64) PRIMARY KEY (Id)", "INSERT INTO Singers (Id) VALUES (1)"}); err == nil {
+		t.Error("DDL and DML: expected error")
+	}
+	if _, err := statementsType([]string{"SELECT 1"}); err == nil {
+		t.Error("query: expected error")
+	}
+}
+
+func TestDropStatements(t *testing.T) {
+	tables := []spannerdriver.Table{
+		{Name: "Albums", ParentTable: "Singers", Indexes: []spannerdriver.Index{{Name: "AlbumsByTitle"}}},
+		{Name: "Concerts", ForeignKeys: []spannerdriver.ForeignKey{{Name: "FK_Concerts_Singers"}}},
+		{Name: "Singers"},
+		{Name: "Songs", ParentTable: "Albums"},
+	}
+	want := []string{
+		"ALTER TABLE `Concerts` DROP CONSTRAINT `FK_Concerts_Singers`",
+		"DROP TABLE `Songs`",
+		"DROP INDEX `AlbumsByTitle`",
+		"DROP TABLE `Albums`",
+		"DROP TABLE `Concerts`",
+		"DROP TABLE `Singers`",
+	}
+	if got := dropStatements(tables); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
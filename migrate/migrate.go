@@ -0,0 +1,226 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package migrate is a minimal migration runner for Spanner databases
+// that are used with the database/sql driver.
+//
+// Migrations are versioned files of semicolon separated DDL statements,
+// named VERSION_NAME.sql, e.g. 0001_create_singers.sql. They are usually
+// embedded in the binary:
+//
+//	//go:embed migrations/*.sql
+//	var migrations embed.FS
+//
+//	ms, err := migrate.Load(migrations, "migrations")
+//	...
+//	applied, err := migrate.Up(ctx, db, ms, migrate.Options{})
+//
+// Each migration is applied as one DDL batch, and its version is recorded
+// in a schema version table. Spanner doesn't apply DDL transactionally, so
+// a migration that fails halfway leaves its version marked as dirty, and
+// Up refuses to continue until the database has been repaired and the
+// row of the version has been deleted or marked as clean.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+	"github.com/rakyll/go-sql-driver-spanner/internal"
+)
+
+// DefaultTable is the default name of the schema version table.
+const DefaultTable = "SchemaMigrations"
+
+var fileNameRe = regexp.MustCompile(`^(\d+)_(.+)\.sql$`)
+
+// Migration is a versioned list of DDL statements.
+type Migration struct {
+	Version    int64
+	Name       string
+	Statements []string
+}
+
+// Options configure how migrations are applied.
+type Options struct {
+	// Table is the name of the schema version
+	// table. It defaults to DefaultTable.
+	Table string
+}
+
+func (o Options) table() string {
+	if o.Table == "" {
+		return DefaultTable
+	}
+	return o.Table
+}
+
+// Load loads the migrations from the .sql files in the directory dir of
+// fsys, ordered by version. Files with other extensions are ignored.
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	var ms []Migration
+	versions := make(map[int64]string)
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".sql" {
+			continue
+		}
+		m, err := ParseFileName(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := versions[m.Version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, e.Name())
+		}
+		versions[m.Version] = e.Name()
+		ddl, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		m.Statements = Split(string(ddl))
+		ms = append(ms, m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return ms, nil
+}
+
+// LoadFile loads the migration in the file with the given path.
+func LoadFile(name string) (Migration, error) {
+	m, err := ParseFileName(filepath.Base(name))
+	if err != nil {
+		return Migration{}, err
+	}
+	ddl, err := os.ReadFile(name)
+	if err != nil {
+		return Migration{}, err
+	}
+	m.Statements = Split(string(ddl))
+	return m, nil
+}
+
+// ParseFileName returns the migration without statements
+// that a file named VERSION_NAME.sql contains.
+func ParseFileName(name string) (Migration, error) {
+	m := fileNameRe.FindStringSubmatch(name)
+	if m == nil {
+		return Migration{}, fmt.Errorf("invalid migration file name %q, expected VERSION_NAME.sql", name)
+	}
+	v, err := strconv.ParseInt(m[1], 10, 64)
+	if err != nil {
+		return Migration{}, fmt.Errorf("invalid migration file name %q: %v", name, err)
+	}
+	return Migration{Version: v, Name: m[2]}, nil
+}
+
+// Split splits a file into its DDL statements. Semicolons and comment
+// markers in string literals and quoted identifiers are left alone,
+// and comments are removed.
+func Split(ddl string) []string {
+	var statements []string
+	for _, stmt := range internal.SplitStatements(ddl) {
+		if stmt = internal.StripComments(stmt); stmt != "" {
+			statements = append(statements, stmt)
+		}
+	}
+	return statements
+}
+
+// Up applies the migrations that haven't been applied to the
+// database of db yet in order, and returns them.
+func Up(ctx context.Context, db *sql.DB, migrations []Migration, opts Options) ([]Migration, error) {
+	table := opts.table()
+	if err := spannerdriver.ExecDDL(ctx, db, CreateTableStatement(table)); err != nil {
+		return nil, fmt.Errorf("creating %s: %v", table, err)
+	}
+	applied, err := Versions(ctx, db, opts)
+	if err != nil {
+		return nil, err
+	}
+	for v, dirty := range applied {
+		if dirty {
+			return nil, fmt.Errorf("migration %d failed and must be repaired manually", v)
+		}
+	}
+
+	var done []Migration
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := record(ctx, db, table, m, true); err != nil {
+			return done, err
+		}
+		if len(m.Statements) > 0 {
+			if err := spannerdriver.ExecDDL(ctx, db, m.Statements...); err != nil {
+				return done, fmt.Errorf("migration %d (%s): %v", m.Version, m.Name, err)
+			}
+		}
+		if err := record(ctx, db, table, m, false); err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Versions returns the versions that have been applied, and whether
+// each of them is dirty because it failed.
+func Versions(ctx context.Context, db *sql.DB, opts Options) (map[int64]bool, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT Version, Dirty FROM `%s`", opts.table()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := make(map[int64]bool)
+	for rows.Next() {
+		var v int64
+		var dirty bool
+		if err := rows.Scan(&v, &dirty); err != nil {
+			return nil, err
+		}
+		versions[v] = dirty
+	}
+	return versions, rows.Err()
+}
+
+// CreateTableStatement returns the statement that creates
+// the schema version table if it doesn't exist.
+func CreateTableStatement(table string) string {
+	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` (\n"+
+		"  Version INT64 NOT NULL,\n"+
+		"  Name STRING(MAX) NOT NULL,\n"+
+		"  Dirty BOOL NOT NULL,\n"+
+		"  AppliedAt TIMESTAMP NOT NULL OPTIONS (allow_commit_timestamp = true),\n"+
+		") PRIMARY KEY (Version)", table)
+}
+
+// record records the version of m as dirty while
+// it is applied, and as clean once it succeeded.
+func record(ctx context.Context, db *sql.DB, table string, m Migration, dirty bool) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf("INSERT OR UPDATE INTO `%s` (Version, Name, Dirty, AppliedAt)"+
+		" VALUES (@version, @name, @dirty, PENDING_COMMIT_TIMESTAMP())", table), m.Version, m.Name, dirty)
+	return err
+}
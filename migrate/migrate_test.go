@@ -0,0 +1,88 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/0002_add_albums.sql": {Data: []byte(`
+-- Albums of singers; one per row.
+CREATE TABLE Albums (
+  SingerId INT64 NOT NULL,
+  AlbumId INT64 NOT NULL,
+  Title STRING(MAX) DEFAULT ('untitled; for now'),
+) PRIMARY KEY (SingerId, AlbumId);
+CREATE INDEX AlbumsByTitle ON Albums (Title); -- trailing comment
+`)},
+		"migrations/0001_create_singers.sql": {Data: []byte("CREATE TABLE Singers (Id INT64) PRIMARY KEY (Id)")},
+		"migrations/README.md":               {Data: []byte("not a migration")},
+	}
+	ms, err := Load(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Migration{
+		{Version: 1, Name: "create_singers", Statements: []string{"CREATE TABLE Singers (Id INT64) PRIMARY KEY (Id)"}},
+		{Version: 2, Name: "add_albums", Statements: []string{
+			"CREATE TABLE Albums (\n  SingerId INT64 NOT NULL,\n  AlbumId INT64 NOT NULL,\n  Title STRING(MAX) DEFAULT ('untitled; for now'),\n) PRIMARY KEY (SingerId, AlbumId)",
+			"CREATE INDEX AlbumsByTitle ON Albums (Title)",
+		}},
+	}
+	if !reflect.DeepEqual(ms, want) {
+		t.Errorf("got  %q\nwant %q", ms, want)
+	}
+
+	fsys["migrations/01_duplicate.sql"] = &fstest.MapFile{Data: []byte("DROP TABLE Singers")}
+	if _, err := Load(fsys, "migrations"); err == nil {
+		t.Error("duplicate versions: expected error")
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "7_drop_singers.sql")
+	if err := os.WriteFile(name, []byte("DROP INDEX SingersByName;\nDROP TABLE Singers;\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Migration{Version: 7, Name: "drop_singers", Statements: []string{"DROP INDEX SingersByName", "DROP TABLE Singers"}}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("got %q, want %q", m, want)
+	}
+}
+
+func TestParseFileName(t *testing.T) {
+	m, err := ParseFileName("20200101120000_add_index.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Version != 20200101120000 || m.Name != "add_index" {
+		t.Errorf("got %+v", m)
+	}
+	for _, name := range []string{"add_index.sql", "1.sql", "1_add_index.txt"} {
+		if _, err := ParseFileName(name); err == nil {
+			t.Errorf("ParseFileName(%q): expected error", name)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/grpc/status"
+)
+
+// mutationsArg carries mutations from BufferWrite to the
+// driver connection. *sql.Tx has no other way to reach the
+// connection it runs on.
+type mutationsArg []*spanner.Mutation
+
+// BufferWrite buffers mutations in tx. They are applied when
+// tx commits, atomically with the DML statements executed in tx.
+// Mutations are more efficient than DML for bulk writes, but
+// the rows they write are not visible to queries in tx.
+func BufferWrite(ctx context.Context, tx *sql.Tx, ms ...*spanner.Mutation) error {
+	_, err := tx.ExecContext(ctx, "", mutationsArg(ms))
+	return err
+}
+
+// CheckNamedValue lets mutationsArg, ProtoDescriptors and PartitionedQuery
+// values pass through database/sql and leaves all other values to the
+// default conversion.
+func (c *conn) CheckNamedValue(v *driver.NamedValue) error {
+	switch v.Value.(type) {
+	case mutationsArg, ProtoDescriptors, PartitionedQuery:
+		return nil
+	}
+	return driver.ErrSkip
+}
+
+// mutationsFromArgs reports whether the statement was sent
+// by BufferWrite and returns its mutations.
+func mutationsFromArgs(query string, args []driver.NamedValue) ([]*spanner.Mutation, bool) {
+	if query != "" || len(args) != 1 {
+		return nil, false
+	}
+	ms, ok := args[0].Value.(mutationsArg)
+	return ms, ok
+}
+
+func (c *conn) BufferWrite(ms []*spanner.Mutation) error {
+	if c.rwTx == nil {
+		return errors.New("mutations can only be buffered in a read-write transaction")
+	}
+	if c.rwTx.err != nil {
+		return c.rwTx.err
+	}
+	c.rwTx.mutations = append(c.rwTx.mutations, ms...)
+	return nil
+}
+
+// BatchWrite applies the mutation groups with the BatchWrite RPC on
+// a connection of db. Groups are applied independently, which makes
+// BatchWrite suitable for ingest jobs that do not need atomicity
+// across groups. It returns one error per group, which is nil if the
+// group was applied. Groups that were not reported before the RPC
+// failed get the error of the RPC, which is also returned.
+func BatchWrite(ctx context.Context, db *sql.DB, mgs []*spanner.MutationGroup) ([]error, error) {
+	var errs []error
+	err := withConn(ctx, db, func(c *conn) error {
+		it, err := c.BatchWrite(ctx, mgs)
+		if err != nil {
+			return err
+		}
+		errs, err = batchWriteErrors(len(mgs), it.Do)
+		return err
+	})
+	return errs, err
+}
+
+// Apply applies the mutations outside of a transaction on a connection
+// of db and returns the commit timestamp. With spanner.ApplyAtLeastOnce()
+// the mutations are committed without first beginning a transaction,
+// which saves a round trip but may apply them more than once. Only use
+// it for idempotent writes such as inserts or updates of blind values.
+func Apply(ctx context.Context, db *sql.DB, ms []*spanner.Mutation, opts ...spanner.ApplyOption) (time.Time, error) {
+	var ts time.Time
+	err := withConn(ctx, db, func(c *conn) error {
+		var err error
+		ts, err = c.Apply(ctx, ms, opts...)
+		return err
+	})
+	return ts, err
+}
+
+// InsertOrUpdateStruct inserts in into table, or updates the row
+// with the same primary key if it exists. The fields of in are
+// mapped to columns like spanner.InsertOrUpdateStruct maps them,
+// so no column lists have to be written by hand:
+//
+//	err := spannerdriver.InsertOrUpdateStruct(ctx, db, "Singers", &Singer{SingerID: 1, Name: "Alice"})
+//
+// Identity columns and columns that default to the next value of a
+// sequence are omitted if their fields are zero, and the values that
+// Spanner generated for them are stored in the fields if in is a
+// pointer.
+//
+// In a transaction, buffer the mutation with BufferWrite instead.
+func InsertOrUpdateStruct(ctx context.Context, db *sql.DB, table string, in interface{}) error {
+	row, err := structRow(in)
+	if err != nil {
+		return err
+	}
+	return withConn(ctx, db, func(c *conn) error {
+		return c.insertOrUpdate(ctx, table, row)
+	})
+}
+
+// InsertOrUpdateMap inserts the row with the column values in into
+// table, or updates the row with the same primary key if it exists.
+// Values of identity columns and columns that default to the next
+// value of a sequence that are missing or nil are generated by
+// Spanner and stored in the map.
+func InsertOrUpdateMap(ctx context.Context, db *sql.DB, table string, in map[string]interface{}) error {
+	return withConn(ctx, db, func(c *conn) error {
+		return c.insertOrUpdate(ctx, table, mapRow(in))
+	})
+}
+
+// DeleteKeys deletes the rows of table with the keys in keys, which
+// can be a spanner.Key, a spanner.KeyRange or a combination built with
+// spanner.KeySets. Deleting by key is much cheaper than DELETE ... WHERE,
+// as Spanner does not have to read the rows first. Rows of interleaved
+// tables with ON DELETE CASCADE are deleted as well.
+func DeleteKeys(ctx context.Context, db *sql.DB, table string, keys spanner.KeySet) error {
+	_, err := Apply(ctx, db, []*spanner.Mutation{spanner.Delete(table, keys)})
+	return err
+}
+
+// DeleteKeyRange deletes the rows of table with keys from start,
+// inclusive, to end, exclusive. Keys can be prefixes of the primary
+// key, so that a range can cover all rows of a parent row:
+//
+//	err := spannerdriver.DeleteKeyRange(ctx, db, "Albums", spanner.Key{1}, spanner.Key{2})
+func DeleteKeyRange(ctx context.Context, db *sql.DB, table string, start, end spanner.Key) error {
+	return DeleteKeys(ctx, db, table, spanner.KeyRange{Start: start, End: end, Kind: spanner.ClosedOpen})
+}
+
+// batchWriteErrors maps the responses of a BatchWrite
+// RPC to the errors of the n groups in the request.
+func batchWriteErrors(n int, do func(func(*sppb.BatchWriteResponse) error) error) ([]error, error) {
+	errs := make([]error, n)
+	reported := make([]bool, n)
+	err := do(func(r *sppb.BatchWriteResponse) error {
+		groupErr := status.ErrorProto(r.Status)
+		for _, i := range r.Indexes {
+			errs[i] = groupErr
+			reported[i] = true
+		}
+		return nil
+	})
+	if err != nil {
+		for i := range errs {
+			if !reported[i] {
+				errs[i] = err
+			}
+		}
+	}
+	return errs, err
+}
+
+func (c *conn) BatchWrite(ctx context.Context, mgs []*spanner.MutationGroup) (*spanner.BatchWriteResponseIterator, error) {
+	if c.roTx != nil || c.rwTx != nil {
+		return nil, errors.New("BatchWrite cannot be used in a transaction")
+	}
+	return c.client.BatchWrite(ctx, mgs), nil
+}
+
+func (c *conn) Apply(ctx context.Context, ms []*spanner.Mutation, opts ...spanner.ApplyOption) (time.Time, error) {
+	if c.roTx != nil || c.rwTx != nil {
+		return time.Time{}, errors.New("Apply cannot be used in a transaction, use BufferWrite instead")
+	}
+	c.commitResp = nil
+	c.retried = false
+	ts, err := c.client.Apply(ctx, ms, opts...)
+	if err != nil {
+		return time.Time{}, err
+	}
+	c.commitResp = &spanner.CommitResponse{CommitTs: ts}
+	return ts, nil
+}
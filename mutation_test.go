@@ -0,0 +1,101 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+)
+
+func TestBufferWrite(t *testing.T) {
+	ctx := context.Background()
+	c := &conn{}
+	m := spanner.Insert("Singers", []string{"SingerId"}, []interface{}{1})
+
+	if err := c.BufferWrite([]*spanner.Mutation{m}); err == nil {
+		t.Error("buffered mutations outside of a transaction")
+	}
+
+	c.rwTx = &rwTx{}
+	args := []driver.NamedValue{{Ordinal: 1, Value: mutationsArg{m}}}
+	if err := c.CheckNamedValue(&args[0]); err != nil {
+		t.Fatalf("CheckNamedValue: %v", err)
+	}
+	if err := c.CheckNamedValue(&driver.NamedValue{Value: 1}); err != driver.ErrSkip {
+		t.Errorf("CheckNamedValue of int: want ErrSkip, got %v", err)
+	}
+	if _, err := c.ExecContext(ctx, "", args); err != nil {
+		t.Fatal(err)
+	}
+	c.rwTx.savepoint("a")
+	if _, err := c.ExecContext(ctx, "", args); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(c.rwTx.mutations); got != 2 {
+		t.Fatalf("want 2 buffered mutations, got %d", got)
+	}
+	if err := c.rwTx.rollbackToSavepoint(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if got := len(c.rwTx.mutations); got != 1 {
+		t.Errorf("after rollback to savepoint: want 1 buffered mutation, got %d", got)
+	}
+}
+
+func TestBatchWriteErrors(t *testing.T) {
+	rpcErr := errors.New("stream broken")
+	do := func(f func(*sppb.BatchWriteResponse) error) error {
+		f(&sppb.BatchWriteResponse{Indexes: []int32{0, 2}, Status: &status.Status{}})
+		f(&sppb.BatchWriteResponse{Indexes: []int32{1}, Status: &status.Status{Code: int32(codes.AlreadyExists)}})
+		return rpcErr
+	}
+	errs, err := batchWriteErrors(4, do)
+	if err != rpcErr {
+		t.Errorf("want RPC error, got %v", err)
+	}
+	if errs[0] != nil || errs[2] != nil {
+		t.Errorf("want applied groups 0 and 2, got %v", errs)
+	}
+	if errs[1] == nil || errs[1] == rpcErr {
+		t.Errorf("want group error for 1, got %v", errs[1])
+	}
+	if errs[3] != rpcErr {
+		t.Errorf("want RPC error for unreported group 3, got %v", errs[3])
+	}
+
+	if _, err := (&conn{rwTx: &rwTx{}}).BatchWrite(context.Background(), nil); err == nil {
+		t.Error("BatchWrite in a transaction: expected error")
+	}
+}
+
+func TestApplyInTransaction(t *testing.T) {
+	c := &conn{rwTx: &rwTx{}}
+	if _, err := c.Apply(context.Background(), nil, spanner.ApplyAtLeastOnce()); err == nil {
+		t.Error("Apply in a transaction: expected error")
+	}
+}
+
+func TestInsertOrUpdateStructInvalid(t *testing.T) {
+	if err := InsertOrUpdateStruct(context.Background(), nil, "Singers", 42); err == nil {
+		t.Error("upserted an int")
+	}
+}
@@ -0,0 +1,191 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package opencensus records the statements and transactions of the
+// database/sql driver as OpenCensus spans and stats, for services that
+// haven't migrated to OpenTelemetry yet. It implements the hooks of
+// the driver, so it can be used alongside the OpenTelemetry spans and
+// metrics of the driver:
+//
+//	if err := view.Register(opencensus.DefaultViews...); err != nil {
+//		log.Fatal(err)
+//	}
+//	d := &spannerdriver.Driver{Hooks: opencensus.Hooks{}}
+//	c, err := d.OpenConnector("projects/PROJECT/instances/INSTANCE/databases/DATABASE")
+//
+// Each statement gets a span, which ends when the rows of a query are
+// closed, and each transaction gets a span from its begin until its
+// commit or rollback.
+package opencensus
+
+import (
+	"context"
+
+	"cloud.google.com/go/spanner"
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Measures of the driver.
+var (
+	StatementLatency = stats.Float64("spanner.driver/statement_latency", "Latency of statements, until the rows of queries are closed", stats.UnitMilliseconds)
+	Transactions     = stats.Int64("spanner.driver/transactions", "Transactions that were committed or rolled back", stats.UnitDimensionless)
+	Retries          = stats.Int64("spanner.driver/retries", "Retries of implicit transactions that Spanner aborted", stats.UnitDimensionless)
+	Errors           = stats.Int64("spanner.driver/errors", "Errors of statements and transactions", stats.UnitDimensionless)
+)
+
+// Tags of the measures.
+var (
+	KeyOperation       = tag.MustNewKey("operation")
+	KeyTransactionType = tag.MustNewKey("transaction_type")
+	KeyOutcome         = tag.MustNewKey("outcome")
+	KeyErrorCode       = tag.MustNewKey("error_code")
+)
+
+// Views of the measures.
+var (
+	StatementLatencyView = &view.View{
+		Name:        "spanner.driver/statement_latency",
+		Description: StatementLatency.Description(),
+		Measure:     StatementLatency,
+		TagKeys:     []tag.Key{KeyOperation, KeyTransactionType},
+		Aggregation: view.Distribution(1, 2, 5, 10, 20, 50, 100, 200, 500, 1000, 2000, 5000, 10000),
+	}
+	TransactionsView = &view.View{
+		Name:        "spanner.driver/transactions",
+		Description: Transactions.Description(),
+		Measure:     Transactions,
+		TagKeys:     []tag.Key{KeyTransactionType, KeyOutcome},
+		Aggregation: view.Count(),
+	}
+	RetriesView = &view.View{
+		Name:        "spanner.driver/retries",
+		Description: Retries.Description(),
+		Measure:     Retries,
+		Aggregation: view.Count(),
+	}
+	ErrorsView = &view.View{
+		Name:        "spanner.driver/errors",
+		Description: Errors.Description(),
+		Measure:     Errors,
+		TagKeys:     []tag.Key{KeyErrorCode},
+		Aggregation: view.Count(),
+	}
+
+	// DefaultViews are the views of all measures of the driver.
+	DefaultViews = []*view.View{StatementLatencyView, TransactionsView, RetriesView, ErrorsView}
+)
+
+// Hooks implements spannerdriver.Hooks with OpenCensus
+// spans and stats. The views have to be registered.
+type Hooks struct{}
+
+var _ spannerdriver.Hooks = Hooks{}
+
+func (Hooks) OnQueryStart(ctx context.Context, e spannerdriver.QueryEvent) context.Context {
+	ctx, span := trace.StartSpan(ctx, "spanner."+e.Kind.String(), trace.WithSpanKind(trace.SpanKindClient))
+	span.AddAttributes(
+		trace.StringAttribute("db.statement", e.SQL),
+		trace.StringAttribute("spanner.transaction_type", e.TransactionType),
+	)
+	return ctx
+}
+
+func (Hooks) OnQueryEnd(ctx context.Context, e spannerdriver.QueryEvent) {
+	span := trace.FromContext(ctx)
+	if e.Rows >= 0 {
+		span.AddAttributes(trace.Int64Attribute("spanner.rows", e.Rows))
+	}
+	endSpan(span, e.Err)
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(KeyOperation, e.Kind.String()),
+		tag.Upsert(KeyTransactionType, e.TransactionType),
+	}, StatementLatency.M(float64(e.Duration)/1e6))
+}
+
+func (Hooks) OnTxBegin(ctx context.Context, e spannerdriver.TxEvent) context.Context {
+	ctx, span := trace.StartSpan(ctx, "spanner.Transaction", trace.WithSpanKind(trace.SpanKindClient))
+	span.AddAttributes(trace.StringAttribute("spanner.transaction_type", transactionType(e)))
+	return ctx
+}
+
+func (Hooks) OnTxCommit(ctx context.Context, e spannerdriver.TxEvent) {
+	endTransaction(ctx, e, "committed")
+}
+
+func (Hooks) OnTxRollback(ctx context.Context, e spannerdriver.TxEvent) {
+	endTransaction(ctx, e, "rolled_back")
+}
+
+func (Hooks) OnRetry(ctx context.Context, attempt int) {
+	trace.FromContext(ctx).Annotate([]trace.Attribute{trace.Int64Attribute("attempt", int64(attempt))}, "transaction retried")
+	stats.Record(ctx, Retries.M(1))
+}
+
+func (Hooks) OnError(ctx context.Context, err error) {
+	stats.RecordWithTags(ctx, []tag.Mutator{tag.Upsert(KeyErrorCode, errorCode(err))}, Errors.M(1))
+}
+
+// endTransaction ends the span of a transaction
+// and records the transaction with its outcome.
+func endTransaction(ctx context.Context, e spannerdriver.TxEvent, outcome string) {
+	span := trace.FromContext(ctx)
+	if e.Attempts > 0 {
+		span.AddAttributes(trace.Int64Attribute("spanner.attempts", int64(e.Attempts)))
+	}
+	endSpan(span, e.Err)
+	if e.Err != nil {
+		outcome = "failed"
+	}
+	stats.RecordWithTags(ctx, []tag.Mutator{
+		tag.Upsert(KeyTransactionType, transactionType(e)),
+		tag.Upsert(KeyOutcome, outcome),
+	}, Transactions.M(1))
+}
+
+// endSpan ends span with the status of err. The span is nil
+// if the driver was used without the hooks before.
+func endSpan(span *trace.Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		c := spanner.ErrCode(err)
+		span.SetStatus(trace.Status{Code: int32(c), Message: err.Error()})
+	}
+	span.End()
+}
+
+func transactionType(e spannerdriver.TxEvent) string {
+	if e.ReadOnly {
+		return "read_only"
+	}
+	return "read_write"
+}
+
+// errorCode returns the gRPC code of err, such as ABORTED,
+// like the error.type attribute of the driver's metrics.
+func errorCode(err error) string {
+	c := spanner.ErrCode(err)
+	if c == codes.Unknown {
+		c = status.FromContextError(err).Code()
+	}
+	return code.Code(c).String()
+}
@@ -0,0 +1,127 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package opencensus
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*trace.SpanData
+}
+
+func (r *spanRecorder) ExportSpan(s *trace.SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func TestHooks(t *testing.T) {
+	if err := view.Register(DefaultViews...); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(DefaultViews...)
+	r := &spanRecorder{}
+	trace.RegisterExporter(r)
+	defer trace.UnregisterExporter(r)
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+
+	var h Hooks
+	ctx := context.Background()
+	txCtx := h.OnTxBegin(ctx, spannerdriver.TxEvent{})
+	e := spannerdriver.QueryEvent{Kind: spannerdriver.StatementKindExec, SQL: "UPDATE Singers SET Name = @name WHERE Id = 1", TransactionType: "read_write"}
+	qCtx := h.OnQueryStart(txCtx, e)
+	e.Duration, e.Rows = 3*time.Millisecond, 1
+	h.OnQueryEnd(qCtx, e)
+	h.OnRetry(txCtx, 2)
+	aborted := status.Error(codes.Aborted, "transaction aborted")
+	h.OnError(txCtx, aborted)
+	h.OnTxCommit(txCtx, spannerdriver.TxEvent{Duration: 10 * time.Millisecond, Attempts: 2})
+
+	if len(r.spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(r.spans))
+	}
+	stmt, tx := r.spans[0], r.spans[1]
+	if stmt.Name != "spanner.Exec" || stmt.Attributes["db.statement"] != e.SQL || stmt.Attributes["spanner.rows"] != int64(1) {
+		t.Errorf("got statement span %s %v", stmt.Name, stmt.Attributes)
+	}
+	if tx.Name != "spanner.Transaction" || tx.Attributes["spanner.attempts"] != int64(2) || len(tx.Annotations) != 1 {
+		t.Errorf("got transaction span %s %v %v", tx.Name, tx.Attributes, tx.Annotations)
+	}
+
+	rows, err := view.RetrieveData(StatementLatencyView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Data.(*view.DistributionData).Count != 1 {
+		t.Errorf("got statement latency %v", rows)
+	}
+	for name, want := range map[string]string{TransactionsView.Name: "committed", ErrorsView.Name: "ABORTED", RetriesView.Name: ""} {
+		rows, err := view.RetrieveData(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 1 || rows[0].Data.(*view.CountData).Value != 1 {
+			t.Errorf("%s: got %v", name, rows)
+			continue
+		}
+		if want == "" {
+			continue
+		}
+		found := false
+		for _, tag := range rows[0].Tags {
+			found = found || tag.Value == want
+		}
+		if !found {
+			t.Errorf("%s: got tags %v, want %s", name, rows[0].Tags, want)
+		}
+	}
+}
+
+func TestFailedTransaction(t *testing.T) {
+	if err := view.Register(TransactionsView); err != nil {
+		t.Fatal(err)
+	}
+	defer view.Unregister(TransactionsView)
+
+	var h Hooks
+	ctx := h.OnTxBegin(context.Background(), spannerdriver.TxEvent{ReadOnly: true})
+	h.OnTxRollback(ctx, spannerdriver.TxEvent{ReadOnly: true, Err: errors.New("boom")})
+	rows, err := view.RetrieveData(TransactionsView.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("got %v", rows)
+	}
+	tags := map[string]string{}
+	for _, tag := range rows[0].Tags {
+		tags[tag.Key.Name()] = tag.Value
+	}
+	if tags["outcome"] != "failed" || tags["transaction_type"] != "read_only" {
+		t.Errorf("got tags %v", tags)
+	}
+}
@@ -0,0 +1,197 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/api/iterator"
+)
+
+// PartitionedQuery executes a query as partitions that are read
+// concurrently, and merges their rows into one result. It is passed
+// as an argument of QueryContext:
+//
+//	rows, err := db.QueryContext(ctx, "SELECT * FROM Singers", spannerdriver.PartitionedQuery{MaxParallelism: 8})
+//
+// The query must be root-partitionable, e.g. a full table scan.
+// Rows are returned in no particular order. Partitioned queries
+// can't be executed in transactions; they read at the read-only
+// staleness of the connection.
+type PartitionedQuery struct {
+	// MaxParallelism is the number of partitions that
+	// are read at the same time. It defaults to 4.
+	MaxParallelism int
+
+	// MaxPartitions is the desired maximum number of
+	// partitions. Spanner chooses the number if it is 0.
+	MaxPartitions int64
+}
+
+// partitionedQueryFromArgs returns the PartitionedQuery of args, if
+// any, and the other arguments, which are the query parameters.
+func partitionedQueryFromArgs(args []driver.NamedValue) (PartitionedQuery, []driver.NamedValue, bool) {
+	for i, arg := range args {
+		if pq, ok := arg.Value.(PartitionedQuery); ok {
+			params := append(append([]driver.NamedValue{}, args[:i]...), args[i+1:]...)
+			return pq, params, true
+		}
+	}
+	return PartitionedQuery{}, args, false
+}
+
+// queryPartitioned partitions the statement ss in a batch read-only
+// transaction and returns an iterator over the rows of all partitions.
+func (c *conn) queryPartitioned(ctx context.Context, ss spanner.Statement, pq PartitionedQuery) (*mergedIterator, error) {
+	if c.InTransaction() {
+		return nil, errors.New("partitioned queries cannot be executed in a transaction")
+	}
+	tx, err := c.client.BatchReadOnlyTransaction(ctx, c.readOnlyStaleness.bound)
+	if err != nil {
+		return nil, err
+	}
+	partitions, err := tx.PartitionQuery(ctx, ss, spanner.PartitionOptions{MaxPartitions: pq.MaxPartitions})
+	if err != nil {
+		tx.Cleanup(context.WithoutCancel(ctx))
+		return nil, err
+	}
+	parallelism := pq.MaxParallelism
+	if parallelism <= 0 {
+		parallelism = 4
+	}
+	return newMergedIterator(ctx, tx, partitions, parallelism), nil
+}
+
+// mergedIterator iterates over the rows of partitions, which are
+// executed by at most parallelism workers at the same time.
+type mergedIterator struct {
+	tx     *spanner.BatchReadOnlyTransaction
+	cancel context.CancelFunc
+	rows   chan *spanner.Row
+	done   chan struct{} // closed when all workers returned
+
+	mu       sync.Mutex // guards err and metadata
+	err      error
+	metadata *sppb.ResultSetMetadata
+
+	stopOnce sync.Once
+}
+
+func newMergedIterator(ctx context.Context, tx *spanner.BatchReadOnlyTransaction, partitions []*spanner.Partition, parallelism int) *mergedIterator {
+	ctx, cancel := context.WithCancel(ctx)
+	m := &mergedIterator{
+		tx:     tx,
+		cancel: cancel,
+		rows:   make(chan *spanner.Row, parallelism),
+		done:   make(chan struct{}),
+	}
+	work := make(chan *spanner.Partition)
+	go func() {
+		defer close(work)
+		for _, p := range partitions {
+			select {
+			case work <- p:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < min(parallelism, len(partitions)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.work(ctx, work)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(m.rows)
+		close(m.done)
+	}()
+	return m
+}
+
+// work executes partitions until there are no more,
+// or one of them fails.
+func (m *mergedIterator) work(ctx context.Context, work <-chan *spanner.Partition) {
+	for p := range work {
+		it := m.tx.Execute(ctx, p)
+		err := it.Do(func(row *spanner.Row) error {
+			select {
+			case m.rows <- row:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		m.mu.Lock()
+		if m.metadata == nil {
+			m.metadata = it.Metadata
+		}
+		if err != nil && m.err == nil {
+			m.err = err
+			m.cancel()
+		}
+		m.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Next returns the next row of any partition, or
+// the error of the first partition that failed.
+func (m *mergedIterator) Next() (*spanner.Row, error) {
+	if err := m.error(); err != nil {
+		return nil, err
+	}
+	row, ok := <-m.rows
+	if ok {
+		return row, nil
+	}
+	if err := m.error(); err != nil {
+		return nil, err
+	}
+	return nil, iterator.Done
+}
+
+func (m *mergedIterator) error() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+// resultMetadata returns the metadata of the
+// first partition that returned any.
+func (m *mergedIterator) resultMetadata() *sppb.ResultSetMetadata {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.metadata
+}
+
+// Stop stops the workers and cleans up the transaction.
+func (m *mergedIterator) Stop() {
+	m.stopOnce.Do(func() {
+		m.cancel()
+		<-m.done
+		m.tx.Cleanup(context.Background())
+	})
+}
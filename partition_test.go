@@ -0,0 +1,103 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// partitionRows streams the rows 100*p to 100*p+99 of the partition p.
+func partitionRows(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+	p, err := strconv.Atoi(string(req.PartitionToken))
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "not a partition")
+	}
+	prs := &sppb.PartialResultSet{Metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{Fields: []*sppb.StructType_Field{
+		{Name: "Id", Type: &sppb.Type{Code: sppb.TypeCode_INT64}},
+	}}}}
+	for i := 0; i < 100; i++ {
+		prs.Values = append(prs.Values, structpb.NewStringValue(strconv.Itoa(100*p+i)))
+	}
+	return stream.Send(prs)
+}
+
+func TestPartitionedQuery(t *testing.T) {
+	var running, maxRunning atomic.Int32
+	db := openFakeSpanner(t, &fakeSpanner{partitions: 5, query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			m := maxRunning.Load()
+			if n <= m || maxRunning.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		return partitionRows(req, stream)
+	}})
+
+	rows, err := db.QueryContext(context.Background(), "SELECT Id FROM Singers", PartitionedQuery{MaxParallelism: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if cols, _ := rows.Columns(); len(cols) != 1 || cols[0] != "Id" {
+		t.Errorf("columns = %v, want [Id]", cols)
+	}
+	seen := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		seen[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 500 {
+		t.Errorf("got %d distinct rows, want 500", len(seen))
+	}
+	if n := maxRunning.Load(); n > 2 {
+		t.Errorf("%d partitions were read at the same time, want at most 2", n)
+	}
+}
+
+func TestPartitionedQueryError(t *testing.T) {
+	db := openFakeSpanner(t, &fakeSpanner{partitions: 5, query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		if string(req.PartitionToken) == "3" {
+			return status.Error(codes.Internal, "partition failed")
+		}
+		return partitionRows(req, stream)
+	}})
+
+	rows, err := db.QueryContext(context.Background(), "SELECT Id FROM Singers", PartitionedQuery{})
+	if err == nil {
+		for rows.Next() {
+		}
+		err = rows.Err()
+		rows.Close()
+	}
+	if status.Code(err) != codes.Internal {
+		t.Errorf("want the error of the failed partition, got %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+// defaultNumChannels is the number of gRPC channels
+// of the Spanner client if NumChannels isn't set.
+const defaultNumChannels = 4
+
+// PoolStats describes the client that the connections to a database
+// share, for the admin and debug endpoints of applications.
+type PoolStats struct {
+	// Database is the name of the database of the client.
+	Database string
+
+	// Sessions are the statistics of the sessions of the client.
+	Sessions SessionPoolStats
+
+	// Channels is the number of gRPC channels of the client. It is
+	// Driver.Config.NumChannels, or the default of the Spanner client,
+	// unless Driver.Options set the size of the connection pool.
+	Channels int
+
+	// Config is the configuration of the client.
+	Config PoolConfig
+}
+
+// PoolConfig is the configuration of the client of a database,
+// with the defaults of the Spanner client and of the driver applied.
+type PoolConfig struct {
+	// MinOpened and MaxOpened bound the size of the session pool.
+	MinOpened uint64
+	MaxOpened uint64
+
+	// Compression is the compression of the gRPC channels,
+	// see the enableCompression connection parameter.
+	Compression string
+	// EndToEndTracing is set by the endToEndTracing
+	// connection parameter.
+	EndToEndTracing bool
+	// MaxAge is the sessionMaxAge after which the
+	// client is replaced, or 0.
+	MaxAge time.Duration
+	// Created is when the client was created.
+	Created time.Time
+}
+
+// GetPoolStats returns the statistics and the configuration of the
+// client that the connections of db share. It uses a connection of
+// db, which opens the client if db has no open connections yet.
+func GetPoolStats(db *sql.DB) (PoolStats, error) {
+	var stats PoolStats
+	err := withConn(context.Background(), db, func(c *conn) error {
+		stats = c.poolStats()
+		return nil
+	})
+	return stats, err
+}
+
+// poolStats returns the PoolStats of the client of c.
+func (c *conn) poolStats() PoolStats {
+	if c.shared == nil {
+		return PoolStats{}
+	}
+	return PoolStats{
+		Database: c.shared.key.name,
+		Sessions: c.SessionPoolStats(),
+		Channels: c.shared.channels,
+		Config:   c.shared.config,
+	}
+}
+
+// newPoolConfig returns the PoolConfig of the client that the
+// connector creates with config, and its number of channels.
+func (c *connector) newPoolConfig(config spanner.ClientConfig) (PoolConfig, int) {
+	channels := config.NumChannels
+	if channels == 0 {
+		channels = defaultNumChannels
+	}
+	pc := PoolConfig{
+		MinOpened:       config.MinOpened,
+		MaxOpened:       config.MaxOpened,
+		Compression:     config.Compression,
+		EndToEndTracing: c.endToEndTracing,
+		MaxAge:          c.sessionMaxAge,
+		Created:         time.Now(),
+	}
+	if pc.MaxOpened == 0 {
+		// The Spanner client allows 100 sessions per channel.
+		pc.MaxOpened = uint64(channels) * 100
+	}
+	return pc, channels
+}
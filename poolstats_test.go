@@ -0,0 +1,44 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"testing"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+)
+
+func TestGetPoolStats(t *testing.T) {
+	d := &Driver{}
+	d.Config.NumChannels = 2
+	db := openFakeSpannerWithDriver(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		return sendRow(stream)
+	}}, d)
+
+	var id int64
+	if err := db.QueryRow("SELECT Id FROM Singers").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := GetPoolStats(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Database != "projects/p/instances/i/databases/d" || stats.Channels != 2 || stats.Config.MaxOpened != 200 {
+		t.Errorf("got %+v", stats)
+	}
+	if stats.Sessions.Open < 1 || stats.Sessions.Acquired != 1 || stats.Config.Created.IsZero() {
+		t.Errorf("got %+v", stats)
+	}
+}
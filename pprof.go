@@ -0,0 +1,40 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"runtime/pprof"
+)
+
+// Labels of the CPU profiles of statements, see withProfilerLabels.
+const (
+	labelStatement       = "spanner.statement"
+	labelTransactionType = "spanner.transaction_type"
+)
+
+// withProfilerLabels calls f with a context whose pprof labels are
+// the digest of query and the type of the transaction, if the
+// pprofLabels connection parameter is set. The goroutines that f
+// starts, such as those that stream the rows of a query, inherit
+// the labels.
+func (c *conn) withProfilerLabels(ctx context.Context, query string, f func(ctx context.Context)) {
+	if !c.pprofLabels {
+		f(ctx)
+		return
+	}
+	labels := pprof.Labels(labelStatement, StatementDigest(query), labelTransactionType, c.transactionType())
+	pprof.Do(ctx, labels, f)
+}
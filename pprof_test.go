@@ -0,0 +1,43 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"runtime/pprof"
+	"testing"
+)
+
+func TestProfilerLabels(t *testing.T) {
+	c := &conn{pprofLabels: true}
+	var statement, txType string
+	c.withProfilerLabels(context.Background(), "SELECT * FROM Singers WHERE Id = 1", func(ctx context.Context) {
+		statement, _ = pprof.Label(ctx, labelStatement)
+		txType, _ = pprof.Label(ctx, labelTransactionType)
+	})
+	if want := StatementDigest("SELECT * FROM Singers WHERE Id = 2"); statement != want {
+		t.Errorf("got statement label %q, want %q", statement, want)
+	}
+	if txType != txTypeSingleUse {
+		t.Errorf("got transaction type label %q, want %q", txType, txTypeSingleUse)
+	}
+
+	c.pprofLabels = false
+	c.withProfilerLabels(context.Background(), "SELECT 1", func(ctx context.Context) {
+		if _, ok := pprof.Label(ctx, labelStatement); ok {
+			t.Error("got a label without pprofLabels")
+		}
+	})
+}
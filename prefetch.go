@@ -0,0 +1,142 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+)
+
+// prefetchBounds are the bounds of the number of rows that
+// are read ahead of the application. Prefetching is off if
+// max is 0.
+type prefetchBounds struct {
+	min, max int
+}
+
+// prefetcher reads the rows of an iterator ahead of the application.
+// Its depth, the number of rows that it reads ahead, adapts to the
+// rate at which the rows are consumed: it doubles, up to max, when
+// the application waits for a row, and halves, down to min, when
+// the read-ahead buffer is full because the application is slower
+// than the stream.
+type prefetcher struct {
+	it     rowIterator
+	bounds prefetchBounds
+	cancel context.CancelFunc // cancels the query of it
+	done   chan struct{}      // closed when fetch returns
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	buf     []*spanner.Row
+	depth   int
+	err     error // iterator.Done at the end of the result
+	stopped bool
+}
+
+// newPrefetcher starts to read the rows of it. cancel
+// cancels the context that the query of it runs with.
+func newPrefetcher(it rowIterator, cancel context.CancelFunc, bounds prefetchBounds) *prefetcher {
+	p := &prefetcher{it: it, bounds: bounds, cancel: cancel, done: make(chan struct{}), depth: bounds.min}
+	p.cond = sync.NewCond(&p.mu)
+	go p.fetch()
+	return p
+}
+
+func (p *prefetcher) fetch() {
+	defer close(p.done)
+	for {
+		row, err := p.it.Next()
+		p.mu.Lock()
+		if err != nil {
+			p.err = err
+			p.cond.Broadcast()
+			p.mu.Unlock()
+			return
+		}
+		p.buf = append(p.buf, row)
+		p.cond.Broadcast()
+		if len(p.buf) >= p.depth && !p.stopped {
+			// The application is slower than the stream.
+			p.depth = max(p.depth/2, p.bounds.min)
+			for len(p.buf) >= p.depth && !p.stopped {
+				p.cond.Wait()
+			}
+		}
+		stopped := p.stopped
+		p.mu.Unlock()
+		if stopped {
+			return
+		}
+	}
+}
+
+// Next returns the next row that was read ahead, or waits for it.
+func (p *prefetcher) Next() (*spanner.Row, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.buf) == 0 && p.err == nil {
+		// The application is faster than the read-ahead.
+		p.depth = min(p.depth*2, p.bounds.max)
+		for len(p.buf) == 0 && p.err == nil {
+			p.cond.Wait()
+		}
+	}
+	if len(p.buf) == 0 {
+		return nil, p.err
+	}
+	row := p.buf[0]
+	p.buf[0] = nil
+	p.buf = p.buf[1:]
+	p.cond.Broadcast()
+	return row, nil
+}
+
+// currentDepth returns the number of rows that are read ahead.
+func (p *prefetcher) currentDepth() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.depth
+}
+
+// Stop cancels the query, waits for the read-ahead
+// to end and stops the underlying iterator.
+func (p *prefetcher) Stop() {
+	p.mu.Lock()
+	p.stopped = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	p.cancel()
+	<-p.done
+	p.it.Stop()
+}
+
+// prefetched starts a query with query and reads its rows ahead
+// if prefetching is enabled for the connection.
+func (c *conn) prefetched(ctx context.Context, query func(context.Context) (rowIterator, error)) (rowIterator, error) {
+	if c.prefetch.max == 0 {
+		return query(ctx)
+	}
+	// The prefetcher cancels the query when it is stopped.
+	ctx, cancel := context.WithCancel(ctx)
+	it, err := query(ctx)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return newPrefetcher(it, cancel, c.prefetch), nil
+}
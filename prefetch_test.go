@@ -0,0 +1,96 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+)
+
+// slowIterator returns n rows, each after delay if slow is set.
+type slowIterator struct {
+	n, next int
+	delay   time.Duration
+	slow    atomic.Bool
+	stopped bool
+}
+
+func (it *slowIterator) Next() (*spanner.Row, error) {
+	if it.next == it.n {
+		return nil, iterator.Done
+	}
+	if it.slow.Load() {
+		time.Sleep(it.delay)
+	}
+	it.next++
+	return spanner.NewRow([]string{"Id"}, []interface{}{int64(it.next - 1)})
+}
+
+func (it *slowIterator) Stop() { it.stopped = true }
+
+func TestPrefetcher(t *testing.T) {
+	it := &slowIterator{n: 200, delay: time.Millisecond}
+	it.slow.Store(true)
+	p := newPrefetcher(it, func() {}, prefetchBounds{min: 2, max: 16})
+
+	next := func(want int64) {
+		t.Helper()
+		row, err := p.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got int64
+		if err := row.Column(0, &got); err != nil || got != want {
+			t.Fatalf("got row %d, %v, want %d", got, err, want)
+		}
+	}
+	// The application waits for the stream, so the depth grows.
+	for i := 0; i < 50; i++ {
+		next(int64(i))
+	}
+	if d := p.currentDepth(); d != 16 {
+		t.Errorf("depth with a fast application is %d, want 16", d)
+	}
+	// The stream is faster than the application, so the depth shrinks.
+	it.slow.Store(false)
+	for i := 50; i < 100; i++ {
+		time.Sleep(time.Millisecond)
+		next(int64(i))
+	}
+	if d := p.currentDepth(); d != 2 {
+		t.Errorf("depth with a slow application is %d, want 2", d)
+	}
+	p.Stop()
+	if !it.stopped {
+		t.Error("the iterator was not stopped")
+	}
+}
+
+func TestPrefetcherEnd(t *testing.T) {
+	p := newPrefetcher(&slowIterator{n: 3}, func() {}, prefetchBounds{min: 1, max: 4})
+	defer p.Stop()
+	for i := 0; i < 3; i++ {
+		if _, err := p.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := p.Next(); err != iterator.Done {
+		t.Errorf("want iterator.Done at the end, got %v", err)
+	}
+}
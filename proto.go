@@ -0,0 +1,69 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"database/sql/driver"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// ProtoDescriptors is a serialized FileDescriptorSet with the
+// descriptors of the proto types of CREATE PROTO BUNDLE and ALTER
+// PROTO BUNDLE statements. It is passed as the argument of the
+// statement:
+//
+//	fds, err := spannerdriver.NewProtoDescriptors(&pb.Singer{})
+//	...
+//	db.ExecContext(ctx, "CREATE PROTO BUNDLE (`examples.Singer`)", fds)
+type ProtoDescriptors []byte
+
+// NewProtoDescriptors returns the descriptors of the files that
+// define the given messages and the files that they import.
+func NewProtoDescriptors(msgs ...proto.Message) (ProtoDescriptors, error) {
+	set := &descriptorpb.FileDescriptorSet{}
+	seen := make(map[string]bool)
+	var add func(fd protoreflect.FileDescriptor)
+	add = func(fd protoreflect.FileDescriptor) {
+		if seen[fd.Path()] {
+			return
+		}
+		seen[fd.Path()] = true
+		// Dependencies are added before the files that import them.
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			add(imports.Get(i).FileDescriptor)
+		}
+		set.File = append(set.File, protodesc.ToFileDescriptorProto(fd))
+	}
+	for _, m := range msgs {
+		add(m.ProtoReflect().Descriptor().ParentFile())
+	}
+	return proto.Marshal(set)
+}
+
+// protoDescriptorsFromArgs returns the proto
+// descriptors of a DDL statement, if any.
+func protoDescriptorsFromArgs(args []driver.NamedValue) ProtoDescriptors {
+	for _, arg := range args {
+		if pd, ok := arg.Value.(ProtoDescriptors); ok {
+			return pd
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestNewProtoDescriptors(t *testing.T) {
+	pd, err := NewProtoDescriptors(&adminpb.Backup{}, &adminpb.Database{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := proto.Unmarshal(pd, set); err != nil {
+		t.Fatal(err)
+	}
+	// The set is complete and ordered if it can be resolved.
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := files.FindDescriptorByName("google.spanner.admin.database.v1.Backup"); err != nil {
+		t.Error(err)
+	}
+	if got, want := len(set.File), files.NumFiles(); got != want {
+		t.Errorf("got %d files, want %d without duplicates", got, want)
+	}
+}
+
+func TestDDLBatchProtoDescriptors(t *testing.T) {
+	ctx := context.Background()
+	c := &conn{}
+	if err := c.StartBatchDDL(); err != nil {
+		t.Fatal(err)
+	}
+	pd := ProtoDescriptors{1, 2, 3}
+	args := []driver.NamedValue{{Ordinal: 1, Value: pd}}
+	if _, err := c.exec(ctx, "CREATE PROTO BUNDLE (`examples.Singer`)", args); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.exec(ctx, "CREATE TABLE A (Id INT64) PRIMARY KEY (Id)", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.ddlBatch.protoDescriptors; string(got) != string(pd) {
+		t.Errorf("got descriptors %v, want %v", got, pd)
+	}
+	if err := c.CheckNamedValue(&args[0]); err != nil {
+		t.Errorf("CheckNamedValue: %v", err)
+	}
+}
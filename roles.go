@@ -0,0 +1,212 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+)
+
+// Privilege is a privilege of fine-grained access control that is
+// granted to database roles.
+type Privilege struct {
+	// Action is SELECT, INSERT, UPDATE, DELETE or EXECUTE.
+	Action string
+	// ObjectType is TABLE, VIEW, CHANGE STREAM or TABLE FUNCTION.
+	// It defaults to TABLE.
+	ObjectType string
+	Object     string
+	// Columns restrict SELECT, INSERT and UPDATE privileges
+	// on tables to the given columns.
+	Columns []string
+}
+
+func (p Privilege) String() string {
+	action := strings.ToUpper(p.Action)
+	if len(p.Columns) > 0 {
+		cols := make([]string, len(p.Columns))
+		for i, col := range p.Columns {
+			cols[i] = quoteIdentifier(col)
+		}
+		action += "(" + strings.Join(cols, ", ") + ")"
+	}
+	objectType := strings.ToUpper(p.ObjectType)
+	if objectType == "" {
+		objectType = "TABLE"
+	}
+	return fmt.Sprintf("%s ON %s %s", action, objectType, quoteIdentifier(p.Object))
+}
+
+// Grant is a privilege that has been granted to a role.
+type Grant struct {
+	Grantee string
+	Privilege
+}
+
+// CreateRole creates the database role with the given name.
+func CreateRole(ctx context.Context, db *sql.DB, name string) error {
+	return ExecDDL(ctx, db, "CREATE ROLE "+quoteIdentifier(name))
+}
+
+// DropRole drops the database role with the given name. Spanner
+// fails to drop roles that still have privileges.
+func DropRole(ctx context.Context, db *sql.DB, name string) error {
+	return ExecDDL(ctx, db, "DROP ROLE "+quoteIdentifier(name))
+}
+
+// GrantStatements returns the GRANT statements that grant
+// the privileges to the roles.
+func GrantStatements(privileges []Privilege, roles ...string) []string {
+	return privilegeStatements("GRANT", "TO", privileges, roles)
+}
+
+// RevokeStatements returns the REVOKE statements that revoke
+// the privileges from the roles.
+func RevokeStatements(privileges []Privilege, roles ...string) []string {
+	return privilegeStatements("REVOKE", "FROM", privileges, roles)
+}
+
+func privilegeStatements(verb, preposition string, privileges []Privilege, roles []string) []string {
+	quoted := make([]string, len(roles))
+	for i, role := range roles {
+		quoted[i] = quoteIdentifier(role)
+	}
+	statements := make([]string, len(privileges))
+	for i, p := range privileges {
+		statements[i] = fmt.Sprintf("%s %s %s ROLE %s", verb, p, preposition, strings.Join(quoted, ", "))
+	}
+	return statements
+}
+
+// GrantPrivileges grants the privileges to the roles
+// in one schema change operation.
+func GrantPrivileges(ctx context.Context, db *sql.DB, privileges []Privilege, roles ...string) error {
+	if len(privileges) == 0 || len(roles) == 0 {
+		return nil
+	}
+	return ExecDDL(ctx, db, GrantStatements(privileges, roles...)...)
+}
+
+// RevokePrivileges revokes the privileges from the roles
+// in one schema change operation.
+func RevokePrivileges(ctx context.Context, db *sql.DB, privileges []Privilege, roles ...string) error {
+	if len(privileges) == 0 || len(roles) == 0 {
+		return nil
+	}
+	return ExecDDL(ctx, db, RevokeStatements(privileges, roles...)...)
+}
+
+// ListRoles returns the names of the roles of the
+// database, except for the system roles.
+func ListRoles(ctx context.Context, db *sql.DB) ([]string, error) {
+	var roles []string
+	err := withConn(ctx, db, func(c *conn) error {
+		stmt := spanner.NewStatement(`SELECT ROLE_NAME FROM INFORMATION_SCHEMA.ROLES
+WHERE NOT IS_SYSTEM ORDER BY ROLE_NAME`)
+		return c.querySchema(ctx, stmt, func(row *spanner.Row) error {
+			var role string
+			if err := row.Columns(&role); err != nil {
+				return err
+			}
+			roles = append(roles, role)
+			return nil
+		})
+	})
+	return roles, err
+}
+
+// ListGrants returns the privileges on tables that have been granted
+// to the roles of the database. Privileges on columns are returned
+// as a Grant with Columns per role, table and action.
+func ListGrants(ctx context.Context, db *sql.DB) ([]Grant, error) {
+	var grants []Grant
+	err := withConn(ctx, db, func(c *conn) error {
+		stmt := spanner.NewStatement(`SELECT GRANTEE, TABLE_SCHEMA, TABLE_NAME, PRIVILEGE_TYPE
+FROM INFORMATION_SCHEMA.TABLE_PRIVILEGES
+ORDER BY GRANTEE, TABLE_SCHEMA, TABLE_NAME, PRIVILEGE_TYPE`)
+		err := c.querySchema(ctx, stmt, func(row *spanner.Row) error {
+			var grantee, schema, table, action string
+			if err := row.Columns(&grantee, &schema, &table, &action); err != nil {
+				return err
+			}
+			grants = append(grants, Grant{Grantee: grantee, Privilege: Privilege{
+				Action:     action,
+				ObjectType: "TABLE",
+				Object:     qualifiedName(schema, table),
+			}})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		stmt = spanner.NewStatement(`SELECT GRANTEE, TABLE_SCHEMA, TABLE_NAME, PRIVILEGE_TYPE, COLUMN_NAME
+FROM INFORMATION_SCHEMA.COLUMN_PRIVILEGES
+ORDER BY GRANTEE, TABLE_SCHEMA, TABLE_NAME, PRIVILEGE_TYPE, COLUMN_NAME`)
+		var columnGrants []Grant
+		err = c.querySchema(ctx, stmt, func(row *spanner.Row) error {
+			var grantee, schema, table, action, column string
+			if err := row.Columns(&grantee, &schema, &table, &action, &column); err != nil {
+				return err
+			}
+			columnGrants = addColumnGrant(columnGrants, grantee, qualifiedName(schema, table), action, column)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		grants = mergeColumnGrants(grants, columnGrants)
+		return nil
+	})
+	return grants, err
+}
+
+// addColumnGrant adds a row of COLUMN_PRIVILEGES to grants,
+// which are ordered by grantee, table and action.
+func addColumnGrant(grants []Grant, grantee, table, action, column string) []Grant {
+	if n := len(grants); n > 0 {
+		last := &grants[n-1]
+		if last.Grantee == grantee && last.Object == table && last.Action == action {
+			last.Columns = append(last.Columns, column)
+			return grants
+		}
+	}
+	return append(grants, Grant{Grantee: grantee, Privilege: Privilege{
+		Action:     action,
+		ObjectType: "TABLE",
+		Object:     table,
+		Columns:    []string{column},
+	}})
+}
+
+// mergeColumnGrants adds the column grants that are
+// not already covered by a grant on the whole table.
+func mergeColumnGrants(grants, columnGrants []Grant) []Grant {
+	type key struct{ grantee, table, action string }
+	tables := make(map[key]bool)
+	for _, g := range grants {
+		tables[key{g.Grantee, g.Object, g.Action}] = true
+	}
+	for _, g := range columnGrants {
+		if !tables[key{g.Grantee, g.Object, g.Action}] {
+			grants = append(grants, g)
+		}
+	}
+	return grants
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGrantStatements(t *testing.T) {
+	privileges := []Privilege{
+		{Action: "select", Object: "Singers"},
+		{Action: "UPDATE", Object: "Singers", Columns: []string{"FirstName", "LastName"}},
+		{Action: "SELECT", ObjectType: "change stream", Object: "SingersStream"},
+	}
+	got := GrantStatements(privileges, "analyst", "auditor")
+	want := []string{
+		"GRANT SELECT ON TABLE `Singers` TO ROLE `analyst`, `auditor`",
+		"GRANT UPDATE(`FirstName`, `LastName`) ON TABLE `Singers` TO ROLE `analyst`, `auditor`",
+		"GRANT SELECT ON CHANGE STREAM `SingersStream` TO ROLE `analyst`, `auditor`",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+	got = RevokeStatements(privileges[:1], "analyst")
+	want = []string{"REVOKE SELECT ON TABLE `Singers` FROM ROLE `analyst`"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+}
+
+func TestColumnGrants(t *testing.T) {
+	var columnGrants []Grant
+	for _, row := range [][4]string{
+		{"analyst", "Singers", "SELECT", "FirstName"},
+		{"analyst", "Singers", "SELECT", "LastName"},
+		{"analyst", "Singers", "UPDATE", "LastName"},
+		{"auditor", "Singers", "SELECT", "FirstName"},
+	} {
+		columnGrants = addColumnGrant(columnGrants, row[0], row[1], row[2], row[3])
+	}
+	tableGrants := []Grant{{Grantee: "auditor", Privilege: Privilege{Action: "SELECT", ObjectType: "TABLE", Object: "Singers"}}}
+
+	got := mergeColumnGrants(tableGrants, columnGrants)
+	want := []Grant{
+		{Grantee: "auditor", Privilege: Privilege{Action: "SELECT", ObjectType: "TABLE", Object: "Singers"}},
+		{Grantee: "analyst", Privilege: Privilege{Action: "SELECT", ObjectType: "TABLE", Object: "Singers", Columns: []string{"FirstName", "LastName"}}},
+		{Grantee: "analyst", Privilege: Privilege{Action: "UPDATE", ObjectType: "TABLE", Object: "Singers", Columns: []string{"LastName"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
@@ -15,24 +15,99 @@
 package spannerdriver
 
 import (
+	"context"
 	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"io"
-	"log"
+	"math"
+	"math/big"
+	"strconv"
 	"sync"
 	"time"
 
+	"cloud.google.com/go/civil"
 	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/api/iterator"
-	sppb "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
+// rowIterator iterates over the rows of a result. It is a
+// *spanner.RowIterator, or a *mergedIterator for partitioned queries.
+type rowIterator interface {
+	Next() (*spanner.Row, error)
+	Stop()
+}
+
 type rows struct {
-	it *spanner.RowIterator
+	it  rowIterator
+	ctx context.Context
 
-	colsOnce sync.Once
-	cols     []string
+	// limiter accounts for the memory of the current row,
+	// which holds reserved bytes until the next row is read.
+	limiter  *MemoryLimiter
+	reserved int64
 
+	cols []string
+	// types are the Spanner types of the columns.
+	types []*sppb.Type
+	// postgreSQL reports the PostgreSQL names of the types
+	// of the columns, see ColumnTypeDatabaseTypeName.
+	postgreSQL bool
+
+	// dirtyRow is the first row, which QueryContext waits for.
 	dirtyRow *spanner.Row
+
+	// done stops tracking the rows for leak detection.
+	done func()
+
+	// shared is the client of the rows, which
+	// reports configuration errors.
+	shared *sharedClient
+
+	// borrowBytes decodes BYTES values into buffers, one per
+	// column, that are reused for the next row.
+	borrowBytes bool
+	buf         *rowBuffers
+
+	// span is the span of the query, which ends when the rows are
+	// closed, and metrics, log and hookEnd record the rows that were
+	// read and err, the error that ended them, if any.
+	span    trace.Span
+	metrics *driverMetrics
+	log     *statementLog
+	hookEnd func(rows int64, err error)
+	count   int64
+	err     error
+
+	// latency measures the time that decoding
+	// takes, if the statement is hooked.
+	latency *statementLatency
+}
+
+// rowBuffers are the buffers that rows decode borrowed BYTES values
+// with. They are pooled, so that each query doesn't allocate them.
+type rowBuffers struct {
+	// columns holds the BYTES values of the current row,
+	// one per column, with borrowBytes.
+	columns [][]byte
+	// scratch holds the base64 encoding of the value that is decoded.
+	scratch []byte
+}
+
+var rowBufferPool = sync.Pool{New: func() interface{} { return new(rowBuffers) }}
+
+// buffers returns the buffers of the rows, which are
+// taken from the pool for the first borrowed value.
+func (r *rows) buffers() *rowBuffers {
+	if r.buf == nil {
+		r.buf = rowBufferPool.Get().(*rowBuffers)
+	}
+	return r.buf
 }
 
 // Columns returns the names of the columns. The number of
@@ -40,26 +115,95 @@ type rows struct {
 // slice. If a particular column name isn't known, an empty
 // string should be returned for that entry.
 func (r *rows) Columns() []string {
-	r.getColumns()
 	return r.cols
 }
 
 // Close closes the rows iterator.
 func (r *rows) Close() error {
+	if r.done != nil {
+		r.done()
+	}
 	r.it.Stop()
+	r.limiter.release(r.reserved)
+	r.reserved = 0
+	r.releaseBuffers()
+	if r.span != nil {
+		r.span.End()
+	}
+	r.metrics.rowsReturned(r.ctx, r.count)
+	r.metrics.failed(r.ctx, StatementKindQuery.String(), r.err)
+	r.log.done(r.ctx, r.count, r.err)
+	if r.hookEnd != nil {
+		r.hookEnd(r.count, r.err)
+		r.hookEnd = nil
+	}
 	return nil
 }
 
-func (r *rows) getColumns() {
-	r.colsOnce.Do(func() {
-		row, err := r.it.Next()
-		if err != nil {
-			log.Println(err)
-			return
+// releaseBuffers returns the buffers of the rows to the pool.
+func (r *rows) releaseBuffers() {
+	if r.buf != nil {
+		rowBufferPool.Put(r.buf)
+		r.buf = nil
+	}
+}
+
+// iteratorMetadata returns the metadata of the result of it,
+// which is known once its first row or its end was read.
+func iteratorMetadata(it rowIterator) *sppb.ResultSetMetadata {
+	switch it := it.(type) {
+	case *spanner.RowIterator:
+		return it.Metadata
+	case *mergedIterator:
+		return it.resultMetadata()
+	case *prefetcher:
+		return iteratorMetadata(it.it)
+	case *bufferedIterator:
+		return it.metadata
+	}
+	return nil
+}
+
+// bufferedIterator iterates over rows that were read before
+// the transaction that returned them committed.
+type bufferedIterator struct {
+	rows     []*spanner.Row
+	metadata *sppb.ResultSetMetadata
+}
+
+func (it *bufferedIterator) Next() (*spanner.Row, error) {
+	if len(it.rows) == 0 {
+		return nil, iterator.Done
+	}
+	row := it.rows[0]
+	it.rows = it.rows[1:]
+	return row, nil
+}
+
+func (it *bufferedIterator) Stop() {}
+
+// readFirst waits for the first row, which is decoded from the first
+// partial result set that Spanner streams. From then on the columns
+// are known, and the rest of the result is streamed as it is read.
+func (r *rows) readFirst() error {
+	row, err := r.it.Next()
+	if err == iterator.Done {
+		// The columns of empty results are only in the metadata.
+		for _, f := range iteratorMetadata(r.it).GetRowType().GetFields() {
+			r.cols = append(r.cols, f.GetName())
+			r.types = append(r.types, f.GetType())
 		}
-		r.dirtyRow = row
-		r.cols = row.ColumnNames()
-	})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.dirtyRow = row
+	r.cols = row.ColumnNames()
+	for i := range r.cols {
+		r.types = append(r.types, row.ColumnType(i))
+	}
+	return nil
 }
 
 // Next is called to populate the next row of data into
@@ -72,7 +216,9 @@ func (r *rows) getColumns() {
 // should be taken when closing Rows not to modify
 // a buffer held in dest.
 func (r *rows) Next(dest []driver.Value) error {
-	r.getColumns()
+	r.limiter.release(r.reserved)
+	r.reserved = 0
+
 	var row *spanner.Row
 	if r.dirtyRow != nil {
 		row = r.dirtyRow
@@ -84,66 +230,262 @@ func (r *rows) Next(dest []driver.Value) error {
 			return io.EOF
 		}
 		if err != nil {
+			err = r.shared.checkConfig(err)
+			setSpanError(r.span, err)
+			r.err = err
 			return err
 		}
 	}
 
-	for i := 0; i < row.Size(); i++ {
-		var col spanner.GenericColumnValue
-		if err := row.Column(i, &col); err != nil {
-			return err
+	// The values are decoded directly from the protobuf values of
+	// the row, without the reflection of spanner.Row.Column.
+	n := row.Size()
+	var size int64
+	for i := 0; i < n; i++ {
+		size += int64(proto.Size(row.ColumnValue(i)))
+	}
+	if err := r.limiter.acquire(r.ctx, size); err != nil {
+		return err
+	}
+	r.reserved = size
+	r.count++
+	if r.latency != nil {
+		defer r.latency.decoded(time.Now())
+	}
+	return r.decodeRow(row, dest)
+}
+
+// decodeRow converts the values of row into dest.
+func (r *rows) decodeRow(row *spanner.Row, dest []driver.Value) error {
+	for i, n := 0, row.Size(); i < n; i++ {
+		var v driver.Value
+		var err error
+		if t := row.ColumnType(i); r.borrowBytes && t.GetCode() == sppb.TypeCode_BYTES {
+			v, err = r.borrowedBytes(i, t, row.ColumnValue(i))
+		} else {
+			v, err = convertValue(t, row.ColumnValue(i))
 		}
-		switch col.Type.Code {
-		case sppb.TypeCode_INT64:
-			var v spanner.NullInt64
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			dest[i] = v.Int64
-		case sppb.TypeCode_FLOAT64:
-			var v spanner.NullFloat64
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			dest[i] = v.Float64
-		case sppb.TypeCode_STRING:
-			var v spanner.NullString
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			dest[i] = v.StringVal
-		case sppb.TypeCode_BYTES:
-			// The column value is a base64 encoded string.
-			var v []byte
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			dest[i] = v
-		case sppb.TypeCode_BOOL:
-			var v spanner.NullBool
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			dest[i] = v.Bool
-		case sppb.TypeCode_DATE:
-			var v spanner.NullDate
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			if v.IsNull() {
-				dest[i] = v.Date // typed nil
-			} else {
-				dest[i] = v.Date.In(time.Local) // TODO(jbd): Add note about this.
-			}
-		case sppb.TypeCode_TIMESTAMP:
-			var v spanner.NullTime
-			if err := col.Decode(&v); err != nil {
-				return err
-			}
-			dest[i] = v.Time
+		if err != nil {
+			return fmt.Errorf("column %d: %w", i, err)
 		}
-		// TODO(jbd): Implement other types.
-		// How to handle array and struct?
+		dest[i] = v
+	}
+	return nil
+}
+
+// borrowedBytes decodes the BYTES value v of column i into the
+// buffer of the column, which is overwritten by the next row.
+func (r *rows) borrowedBytes(i int, t *sppb.Type, v *structpb.Value) (driver.Value, error) {
+	if _, ok := v.GetKind().(*structpb.Value_NullValue); ok {
+		return nil, nil
+	}
+	s, err := stringValueOf(t, v)
+	if err != nil {
+		return nil, err
+	}
+	b := r.buffers()
+	enc := base64.StdEncoding
+	b.scratch = append(b.scratch[:0], s...)
+	if i >= len(b.columns) {
+		b.columns = append(b.columns, make([][]byte, i+1-len(b.columns))...)
+	}
+	buf := b.columns[i]
+	if need := enc.DecodedLen(len(s)); cap(buf) < need {
+		buf = make([]byte, need)
+	}
+	n, err := enc.Decode(buf[:cap(buf)], b.scratch)
+	if err != nil {
+		return nil, err
+	}
+	b.columns[i] = buf[:n]
+	return buf[:n], nil
+}
+
+// convertColumn converts a column value to a driver.Value,
+// see convertValue.
+func convertColumn(col spanner.GenericColumnValue) (driver.Value, error) {
+	return convertValue(col.Type, col.Value)
+}
+
+// convertValue converts a value of type t to a driver.Value. NULL values
+// of any type, including the results of SAFE. functions, are converted
+// to nil so that they can be scanned into pointers and sql.Null types.
+//
+// Scalar values are decoded directly from their protobuf encoding.
+// Arrays are converted to slices of the spanner.Null types of their
+// elements, e.g. []spanner.NullInt64, and arrays of bytes to [][]byte.
+// Values of other types are returned as spanner.GenericColumnValue.
+func convertValue(t *sppb.Type, v *structpb.Value) (driver.Value, error) {
+	if t == nil || v == nil {
+		return nil, errors.New("missing column type or value")
+	}
+	if _, ok := v.GetKind().(*structpb.Value_NullValue); ok {
+		return nil, nil
+	}
+	switch t.Code {
+	case sppb.TypeCode_INT64, sppb.TypeCode_ENUM:
+		// Both types are encoded as decimal strings.
+		s, err := stringValueOf(t, v)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.ParseInt(s, 10, 64)
+	case sppb.TypeCode_FLOAT32:
+		f, err := floatValueOf(t, v)
+		return float64(float32(f)), err
+	case sppb.TypeCode_FLOAT64:
+		return floatValueOf(t, v)
+	case sppb.TypeCode_NUMERIC:
+		s, err := stringValueOf(t, v)
+		if err != nil || t.TypeAnnotation == sppb.TypeAnnotationCode_PG_NUMERIC {
+			// PostgreSQL numerics can be NaN, which big.Rat can't represent.
+			return s, err
+		}
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return nil, fmt.Errorf("invalid NUMERIC value %q", s)
+		}
+		return spanner.NumericString(r), nil
+	case sppb.TypeCode_STRING, sppb.TypeCode_JSON, sppb.TypeCode_UUID, sppb.TypeCode_INTERVAL:
+		// These types are encoded as strings.
+		return stringValueOf(t, v)
+	case sppb.TypeCode_BYTES, sppb.TypeCode_PROTO:
+		// The column value is a base64 encoded string.
+		s, err := stringValueOf(t, v)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(s)
+	case sppb.TypeCode_BOOL:
+		b, ok := v.GetKind().(*structpb.Value_BoolValue)
+		if !ok {
+			return nil, kindMismatch(t, v)
+		}
+		return b.BoolValue, nil
+	case sppb.TypeCode_DATE:
+		s, err := stringValueOf(t, v)
+		if err != nil {
+			return nil, err
+		}
+		d, err := civil.ParseDate(s)
+		if err != nil {
+			return nil, err
+		}
+		return d.In(time.Local), nil // TODO(jbd): Add note about this.
+	case sppb.TypeCode_TIMESTAMP:
+		s, err := stringValueOf(t, v)
+		if err != nil {
+			return nil, err
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	case sppb.TypeCode_ARRAY:
+		return convertArray(spanner.GenericColumnValue{Type: t, Value: v})
+	}
+	// TODO(jbd): How to handle struct?
+	return spanner.GenericColumnValue{Type: t, Value: v}, nil
+}
+
+func stringValueOf(t *sppb.Type, v *structpb.Value) (string, error) {
+	s, ok := v.GetKind().(*structpb.Value_StringValue)
+	if !ok {
+		return "", kindMismatch(t, v)
+	}
+	return s.StringValue, nil
+}
+
+// floatValueOf decodes FLOAT32 and FLOAT64 values, which are encoded
+// as numbers, or as strings if they are not finite.
+func floatValueOf(t *sppb.Type, v *structpb.Value) (float64, error) {
+	switch k := v.GetKind().(type) {
+	case *structpb.Value_NumberValue:
+		return k.NumberValue, nil
+	case *structpb.Value_StringValue:
+		switch k.StringValue {
+		case "NaN":
+			return math.NaN(), nil
+		case "Infinity":
+			return math.Inf(1), nil
+		case "-Infinity":
+			return math.Inf(-1), nil
+		}
+	}
+	return 0, kindMismatch(t, v)
+}
+
+func kindMismatch(t *sppb.Type, v *structpb.Value) error {
+	return fmt.Errorf("unexpected encoding %T of a %v value", v.GetKind(), t.Code)
+}
+
+func convertArray(col spanner.GenericColumnValue) (driver.Value, error) {
+	switch col.Type.ArrayElementType.Code {
+	case sppb.TypeCode_INT64:
+		var v []spanner.NullInt64
+		err := col.Decode(&v)
+		return v, err
+	case sppb.TypeCode_FLOAT32:
+		var v []spanner.NullFloat32
+		err := col.Decode(&v)
+		return v, err
+	case sppb.TypeCode_FLOAT64:
+		var v []spanner.NullFloat64
+		err := col.Decode(&v)
+		return v, err
+	case sppb.TypeCode_NUMERIC:
+		if col.Type.ArrayElementType.TypeAnnotation == sppb.TypeAnnotationCode_PG_NUMERIC {
+			var v []spanner.PGNumeric
+			err := col.Decode(&v)
+			return v, err
+		}
+		var v []spanner.NullNumeric
+		err := col.Decode(&v)
+		return v, err
+	case sppb.TypeCode_STRING:
+		var v []spanner.NullString
+		err := col.Decode(&v)
+		return v, err
+	case sppb.TypeCode_JSON:
+		var v []spanner.NullJSON
+		err := col.Decode(&v)
+		return v, err
+	case sppb.TypeCode_BYTES:
+		var v [][]byte
+		err := col.Decode(&v)
+		return v, err
+	case sppb.TypeCode_BOOL:
+		var v []spanner.NullBool
+		err := col.Decode(&v)
+		return v, err
+	case sppb.TypeCode_DATE:
+		var v []spanner.NullDate
+		err := col.Decode(&v)
+		return v, err
+	case sppb.TypeCode_TIMESTAMP:
+		var v []spanner.NullTime
+		err := col.Decode(&v)
+		return v, err
+	}
+	return col, nil
+}
+
+// staticRows are the rows of client-side statements.
+type staticRows struct {
+	cols   []string
+	values [][]driver.Value
+}
+
+func (r *staticRows) Columns() []string {
+	return r.cols
+}
+
+func (r *staticRows) Close() error {
+	return nil
+}
+
+func (r *staticRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
 	}
+	copy(dest, r.values[0])
+	r.values = r.values[1:]
 	return nil
 }
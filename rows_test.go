@@ -0,0 +1,438 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// valuesConnector returns a single row with the given values for
+// any query, so that they are scanned by database/sql itself.
+type valuesConnector struct {
+	values []driver.Value
+}
+
+func (c *valuesConnector) Connect(context.Context) (driver.Conn, error) { return c, nil }
+func (c *valuesConnector) Driver() driver.Driver                        { return nil }
+func (c *valuesConnector) Prepare(query string) (driver.Stmt, error)    { return c, nil }
+func (c *valuesConnector) Close() error                                 { return nil }
+func (c *valuesConnector) Begin() (driver.Tx, error)                    { panic("not implemented") }
+func (c *valuesConnector) NumInput() int                                { return -1 }
+func (c *valuesConnector) Exec(args []driver.Value) (driver.Result, error) {
+	panic("not implemented")
+}
+func (c *valuesConnector) Query(args []driver.Value) (driver.Rows, error) {
+	return &valuesRows{values: c.values}, nil
+}
+
+type valuesRows struct {
+	values []driver.Value
+	done   bool
+}
+
+func (r *valuesRows) Columns() []string {
+	return make([]string, len(r.values))
+}
+
+func (r *valuesRows) Close() error { return nil }
+
+func (r *valuesRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	copy(dest, r.values)
+	return nil
+}
+
+func scanValue(v driver.Value, dest interface{}) error {
+	db := sql.OpenDB(&valuesConnector{values: []driver.Value{v}})
+	defer db.Close()
+	return db.QueryRow("SELECT").Scan(dest)
+}
+
+func stringValue(s string) *structpb.Value {
+	return structpb.NewStringValue(s)
+}
+
+func arrayType(code sppb.TypeCode) *sppb.Type {
+	return &sppb.Type{Code: sppb.TypeCode_ARRAY, ArrayElementType: &sppb.Type{Code: code}}
+}
+
+func TestConversionMatrix(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	date := time.Date(2020, 1, 2, 0, 0, 0, 0, time.Local)
+	int64Ptr := func(v int64) *int64 { return &v }
+	stringPtr := func(v string) *string { return &v }
+
+	type scan struct {
+		dest interface{} // pointer to scan into
+		want interface{} // value that dest should point to
+	}
+	tests := []struct {
+		typ   *sppb.Type
+		value *structpb.Value
+		scans []scan
+	}{
+		{
+			typ:   &sppb.Type{Code: sppb.TypeCode_BOOL},
+			value: structpb.NewBoolValue(true),
+			scans: []scan{
+				{new(bool), true},
+				{new(sql.NullBool), sql.NullBool{Bool: true, Valid: true}},
+				{new(string), "true"},
+			},
+		},
+		{
+			typ:   &sppb.Type{Code: sppb.TypeCode_INT64},
+			value: stringValue("42"),
+			scans: []scan{
+				{new(int64), int64(42)},
+				{new(int), 42},
+				{new(sql.NullInt64), sql.NullInt64{Int64: 42, Valid: true}},
+				{new(*int64), int64Ptr(42)},
+				{new(string), "42"},
+				{new(float64), float64(42)},
+			},
+		},
+		{
+			typ:   &sppb.Type{Code: sppb.TypeCode_ENUM},
+			value: stringValue("2"),
+			scans: []scan{
+				{new(int32), int32(2)},
+				{new(sql.NullInt32), sql.NullInt32{Int32: 2, Valid: true}},
+			},
+		},
+		{
+			typ:   &sppb.Type{Code: sppb.TypeCode_FLOAT32},
+			value: structpb.NewNumberValue(1.5),
+			scans: []scan{
+				{new(float32), float32(1.5)},
+				{new(float64), 1.5},
+				{new(sql.NullFloat64), sql.NullFloat64{Float64: 1.5, Valid: true}},
+			},
+		},
+		{
+			typ:   &sppb.Type{Code: sppb.TypeCode_FLOAT64},
+			value: structpb.NewNumberValue(3.25),
+			scans: []scan{
+				{new(float64), 3.25},
+				{new(sql.NullFloat64), sql.NullFloat64{Float64: 3.25, Valid: true}},
+				{new(string), "3.25"},
+			},
+		},
+		{
+			typ:   &sppb.Type{Code: sppb.TypeCode_NUMERIC},
+			value: stringValue("3.140000000"),
+			scans: []scan{
+				{new(string), "3.140000000"},
+				{new(float64), 3.14},
+				{new(sql.NullString), sql.NullString{String: "3.140000000", Valid: true}},
+			},
+		},
+		{
+			typ:   &sppb.Type{Code: sppb.TypeCode_STRING},
+			value: stringValue("hello"),
+			scans: []scan{
+				{new(string), "hello"},
+				{new([]byte), []byte("hello")},
+				{new(sql.NullString), sql.NullString{String: "hello", Valid: true}},
+				{new(*string), stringPtr("hello")},
+			},
+		},
+		{
+			typ:   &sppb.Type{Code: sppb.TypeCode_JSON},
+			value: stringValue(`{"a":1}`),
+			scans: []scan{
+				{new(string), `{"a":1}`},
+				{new(sql.NullString), sql.NullString{String: `{"a":1}`, Valid: true}},
+			},
+		},
+		{
+			typ:   &sppb.Type{Code: sppb.TypeCode_BYTES},
+			value: stringValue("aGVsbG8="),
+			scans: []scan{
+				{new([]byte), []byte("hello")},
+				{new(string), "hello"},
+			},
+		},
+		{
+			typ:   &sppb.Type{Code: sppb.TypeCode_DATE},
+			value: stringValue("2020-01-02"),
+			scans: []scan{
+				{new(time.Time), date},
+				{new(sql.NullTime), sql.NullTime{Time: date, Valid: true}},
+			},
+		},
+		{
+			typ:   &sppb.Type{Code: sppb.TypeCode_TIMESTAMP},
+			value: stringValue("2020-01-02T03:04:05.000000006Z"),
+			scans: []scan{
+				{new(time.Time), ts},
+				{new(sql.NullTime), sql.NullTime{Time: ts, Valid: true}},
+			},
+		},
+		{
+			typ: arrayType(sppb.TypeCode_INT64),
+			value: structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{
+				stringValue("1"), structpb.NewNullValue(),
+			}}),
+			scans: []scan{
+				{new([]spanner.NullInt64), []spanner.NullInt64{{Int64: 1, Valid: true}, {}}},
+			},
+		},
+		{
+			typ: arrayType(sppb.TypeCode_STRING),
+			value: structpb.NewListValue(&structpb.ListValue{Values: []*structpb.Value{
+				stringValue("a"),
+			}}),
+			scans: []scan{
+				{new([]spanner.NullString), []spanner.NullString{{StringVal: "a", Valid: true}}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		name := tc.typ.Code.String()
+		if tc.typ.ArrayElementType != nil {
+			name += "<" + tc.typ.ArrayElementType.Code.String() + ">"
+		}
+
+		v, err := convertColumn(spanner.GenericColumnValue{Type: tc.typ, Value: tc.value})
+		if err != nil {
+			t.Errorf("%s: convert failed: %v", name, err)
+			continue
+		}
+		for _, s := range tc.scans {
+			if err := scanValue(v, s.dest); err != nil {
+				t.Errorf("%s into %T: %v", name, s.dest, err)
+				continue
+			}
+			if got := reflect.ValueOf(s.dest).Elem().Interface(); !reflect.DeepEqual(got, s.want) {
+				t.Errorf("%s into %T: want %v, got %v", name, s.dest, s.want, got)
+			}
+		}
+
+		// NULL values of every type, e.g. the results of SAFE.
+		// functions, must scan into pointers and sql.Null types.
+		v, err = convertColumn(spanner.GenericColumnValue{Type: tc.typ, Value: structpb.NewNullValue()})
+		if err != nil {
+			t.Errorf("NULL %s: convert failed: %v", name, err)
+			continue
+		}
+		nullScans := []scan{
+			{new(*int64), (*int64)(nil)},
+			{new(*string), (*string)(nil)},
+			{new(*time.Time), (*time.Time)(nil)},
+			{new([]byte), []byte(nil)},
+			{new(interface{}), nil},
+			{new(sql.NullBool), sql.NullBool{}},
+			{new(sql.NullInt64), sql.NullInt64{}},
+			{new(sql.NullFloat64), sql.NullFloat64{}},
+			{new(sql.NullString), sql.NullString{}},
+			{new(sql.NullTime), sql.NullTime{}},
+		}
+		for _, s := range nullScans {
+			if err := scanValue(v, s.dest); err != nil {
+				t.Errorf("NULL %s into %T: %v", name, s.dest, err)
+				continue
+			}
+			if got := reflect.ValueOf(s.dest).Elem().Interface(); !reflect.DeepEqual(got, s.want) {
+				t.Errorf("NULL %s into %T: want %v, got %v", name, s.dest, s.want, got)
+			}
+		}
+		if err := scanValue(v, new(int64)); err == nil {
+			t.Errorf("NULL %s into *int64: expected error", name)
+		}
+	}
+}
+
+// TestConvertValueMatchesDecode checks that the values that are decoded
+// directly from their protobuf encoding match those of spanner.Row.Column.
+func TestConvertValueMatchesDecode(t *testing.T) {
+	ts := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	row, err := spanner.NewRow(
+		[]string{"b", "i", "f32", "f64", "nan", "s", "bytes", "ts", "date"},
+		[]interface{}{true, int64(-7), float32(0.1), 2.5, math.Inf(-1), "x", []byte{0, 1}, ts, civil.DateOf(ts)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wants := []interface{}{new(bool), new(int64), new(float32), new(float64), new(float64), new(string), new([]byte), new(time.Time), new(civil.Date)}
+	for i, want := range wants {
+		if err := row.Column(i, want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := convertValue(row.ColumnType(i), row.ColumnValue(i))
+		if err != nil {
+			t.Errorf("%s: %v", row.ColumnName(i), err)
+			continue
+		}
+		w := reflect.ValueOf(want).Elem().Interface()
+		switch w := w.(type) {
+		case float32:
+			got = float32(got.(float64))
+		case civil.Date:
+			got = civil.DateOf(got.(time.Time))
+		case time.Time:
+			if !w.Equal(got.(time.Time)) {
+				t.Errorf("%s: got %v, want %v", row.ColumnName(i), got, w)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, w) {
+			t.Errorf("%s: got %#v, want %#v", row.ColumnName(i), got, w)
+		}
+	}
+
+	if _, err := convertValue(&sppb.Type{Code: sppb.TypeCode_INT64}, structpb.NewNumberValue(1)); err == nil {
+		t.Error("INT64 encoded as a number: expected error")
+	}
+	if v, err := convertValue(&sppb.Type{Code: sppb.TypeCode_FLOAT64}, stringValue("NaN")); err != nil || !math.IsNaN(v.(float64)) {
+		t.Errorf("NaN: got %v, %v", v, err)
+	}
+}
+
+func TestBorrowedBytes(t *testing.T) {
+	typ := &sppb.Type{Code: sppb.TypeCode_BYTES}
+	r := &rows{borrowBytes: true}
+	first, err := r.borrowedBytes(0, typ, stringValue("aGVsbG8=")) // hello
+	if err != nil {
+		t.Fatal(err)
+	}
+	b1 := first.([]byte)
+	if string(b1) != "hello" {
+		t.Fatalf("got %q, want hello", b1)
+	}
+	second, err := r.borrowedBytes(0, typ, stringValue("d29ybGQ=")) // world
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2 := second.([]byte)
+	if string(b2) != "world" || &b1[0] != &b2[0] {
+		t.Errorf("got %q, want world in the buffer of the previous row", b2)
+	}
+	v := stringValue("d29ybGQ=")
+	if n := testing.AllocsPerRun(100, func() { r.borrowedBytes(0, typ, v) }); n > 1 {
+		// Boxing the slice into a driver.Value may allocate.
+		t.Errorf("%v allocations per value, want at most 1", n)
+	}
+	if v, err := r.borrowedBytes(0, typ, structpb.NewNullValue()); err != nil || v != nil {
+		t.Errorf("NULL: got %v, %v", v, err)
+	}
+}
+
+// BenchmarkDecodeRows decodes queries of 10 rows. With borrowBytes,
+// the buffers of BYTES values are reused across the rows and, through
+// the pool, across the queries.
+func BenchmarkDecodeRows(b *testing.B) {
+	row, err := spanner.NewRow(
+		[]string{"Id", "Name", "Payload"},
+		[]interface{}{int64(1), "name", bytes.Repeat([]byte("x"), 1024)},
+	)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, borrow := range []bool{false, true} {
+		b.Run(fmt.Sprintf("borrowBytes=%v", borrow), func(b *testing.B) {
+			dest := make([]driver.Value, row.Size())
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				r := &rows{borrowBytes: borrow}
+				for j := 0; j < 10; j++ {
+					if err := r.decodeRow(row, dest); err != nil {
+						b.Fatal(err)
+					}
+				}
+				r.releaseBuffers()
+			}
+		})
+	}
+}
+
+func TestStreamingRows(t *testing.T) {
+	const n = 10000
+	release := make(chan struct{})
+	db := openFakeSpanner(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		for i := 0; i < n; i++ {
+			prs := &sppb.PartialResultSet{Values: []*structpb.Value{stringValue(strconv.Itoa(i))}, ResumeToken: []byte(strconv.Itoa(i))}
+			if i == 0 {
+				prs.Metadata = &sppb.ResultSetMetadata{RowType: &sppb.StructType{Fields: []*sppb.StructType_Field{
+					{Name: "Id", Type: &sppb.Type{Code: sppb.TypeCode_INT64}},
+				}}}
+			}
+			if err := stream.Send(prs); err != nil {
+				return err
+			}
+			if i == 0 {
+				// The rest of the result is sent after the first row was read.
+				select {
+				case <-release:
+				case <-stream.Context().Done():
+					return stream.Context().Err()
+				}
+			}
+		}
+		return nil
+	}})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	rows, err := db.QueryContext(ctx, "SELECT Id FROM Singers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		t.Fatalf("no first row: %v", rows.Err())
+	}
+	t.Logf("time to first row: %v", time.Since(start))
+	close(release)
+	count := 1
+	for rows.Next() {
+		count++
+	}
+	if err := rows.Err(); err != nil || count != n {
+		t.Errorf("got %d rows and %v, want %d rows", count, err, n)
+	}
+}
+
+func TestQueryError(t *testing.T) {
+	db := openFakeSpanner(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		return status.Error(codes.InvalidArgument, "Table not found: Singers")
+	}})
+	// The error is returned by QueryContext rather than rows.Next.
+	if _, err := db.QueryContext(context.Background(), "SELECT Id FROM Singers"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("want InvalidArgument, got %v", err)
+	}
+}
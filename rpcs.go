@@ -0,0 +1,161 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// requestIDHeader is the header with which the Spanner
+// client identifies each attempt of an RPC.
+const requestIDHeader = "x-goog-spanner-request-id"
+
+// serverTimingHeader is the response header in which the Google
+// Front End reports its latency as gfet4t7, e.g. "gfet4t7; dur=12".
+const serverTimingHeader = "server-timing"
+
+// RPC describes an RPC that Spanner has answered.
+type RPC struct {
+	// Method is the full gRPC method name, e.g.
+	// /google.spanner.v1.Spanner/ExecuteStreamingSql.
+	Method string
+
+	// RequestID is the x-goog-spanner-request-id of the RPC, which
+	// Google support can look up in the logs of Spanner.
+	RequestID string
+
+	// GFELatency is the time between the Google Front End receiving
+	// the request and Spanner sending the response headers, or 0 if
+	// it wasn't reported. Latency beyond it is spent on the network
+	// or in the client.
+	GFELatency time.Duration
+
+	// Duration is the time from the start of the RPC
+	// until its response, or the first response of
+	// streaming RPCs, arrived.
+	Duration time.Duration
+}
+
+// RPCRecorder collects the RPCs of the statements that are
+// executed with a context returned by WithRPCRecorder.
+type RPCRecorder struct {
+	mu   sync.Mutex
+	rpcs []RPC
+}
+
+type rpcRecordersKey struct{}
+
+// WithRPCRecorder returns a context that records the RPCs of the
+// statements and transactions that are executed with it in r:
+//
+//	var r spannerdriver.RPCRecorder
+//	rows, err := db.QueryContext(spannerdriver.WithRPCRecorder(ctx, &r), query)
+//	...
+//	for _, rpc := range r.RPCs() {
+//		log.Printf("%s: request ID %s, GFE latency %v", rpc.Method, rpc.RequestID, rpc.GFELatency)
+//	}
+//
+// Streaming RPCs are recorded when their first response arrives.
+func WithRPCRecorder(ctx context.Context, r *RPCRecorder) context.Context {
+	recorders, _ := ctx.Value(rpcRecordersKey{}).([]*RPCRecorder)
+	return context.WithValue(ctx, rpcRecordersKey{}, append(recorders[:len(recorders):len(recorders)], r))
+}
+
+// RPCs returns the RPCs that have been recorded so far.
+func (r *RPCRecorder) RPCs() []RPC {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]RPC(nil), r.rpcs...)
+}
+
+// requestIDs returns the request IDs of the recorded RPCs.
+func (r *RPCRecorder) requestIDs() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]string, len(r.rpcs))
+	for i, rpc := range r.rpcs {
+		ids[i] = rpc.RequestID
+	}
+	return ids
+}
+
+func (r *RPCRecorder) add(rpc RPC) {
+	r.mu.Lock()
+	r.rpcs = append(r.rpcs, rpc)
+	r.mu.Unlock()
+}
+
+// rpcRecorders returns the recorders of the RPCs that are made with ctx.
+func rpcRecorders(ctx context.Context) []*RPCRecorder {
+	recorders, _ := ctx.Value(rpcRecordersKey{}).([]*RPCRecorder)
+	return recorders
+}
+
+// recordRPC records rpc, which started at start, with
+// the GFE latency of the response header.
+func recordRPC(recorders []*RPCRecorder, rpc RPC, start time.Time, header metadata.MD) {
+	rpc.GFELatency = gfeLatency(header)
+	rpc.Duration = time.Since(start)
+	for _, r := range recorders {
+		r.add(rpc)
+	}
+}
+
+// requestID returns the request ID of the RPC that is made with ctx
+// and opts. The Spanner client passes the ID as a header call option
+// to its own interceptor, which adds it to the outgoing metadata.
+func requestID(ctx context.Context, opts []grpc.CallOption) string {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	values := md.Get(requestIDHeader)
+	for _, opt := range opts {
+		if h, ok := opt.(grpc.HeaderCallOption); ok && h.HeaderAddr != nil && len(values) == 0 {
+			values = h.HeaderAddr.Get(requestIDHeader)
+		}
+	}
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// gfeLatency returns the latency that the Google Front End reports
+// in the server-timing header, or 0 if there is none.
+func gfeLatency(header metadata.MD) time.Duration {
+	for _, v := range header.Get(serverTimingHeader) {
+		for _, metric := range strings.Split(v, ",") {
+			params := strings.Split(metric, ";")
+			if strings.TrimSpace(params[0]) != "gfet4t7" {
+				continue
+			}
+			for _, p := range params[1:] {
+				dur, ok := strings.CutPrefix(strings.TrimSpace(p), "dur=")
+				if !ok {
+					continue
+				}
+				if ms, err := strconv.ParseFloat(dur, 64); err == nil {
+					return time.Duration(ms * float64(time.Millisecond))
+				}
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestRPCRecorder(t *testing.T) {
+	db := openFakeSpanner(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		stream.SetHeader(metadata.Pairs(serverTimingHeader, "gfet4t7; dur=12.5"))
+		return sendRow(stream)
+	}})
+
+	var outer, inner RPCRecorder
+	ctx := WithRPCRecorder(WithRPCRecorder(context.Background(), &outer), &inner)
+	var id int64
+	if err := db.QueryRowContext(ctx, "SELECT Id FROM Singers").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []*RPCRecorder{&outer, &inner} {
+		rpcs := r.RPCs()
+		if len(rpcs) != 1 {
+			t.Fatalf("got RPCs %+v, want one", rpcs)
+		}
+		rpc := rpcs[0]
+		if rpc.Method != "/google.spanner.v1.Spanner/ExecuteStreamingSql" || rpc.RequestID == "" || rpc.GFELatency != 12500*time.Microsecond {
+			t.Errorf("got %+v", rpc)
+		}
+	}
+}
+
+func TestGFELatency(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		want   time.Duration
+	}{
+		{"gfet4t7; dur=12", 12 * time.Millisecond},
+		{"cache;desc=miss, gfet4t7;dur=0.5", 500 * time.Microsecond},
+		{"cache;dur=3", 0},
+		{"gfet4t7", 0},
+	} {
+		if got := gfeLatency(metadata.Pairs(serverTimingHeader, tc.header)); got != tc.want {
+			t.Errorf("gfeLatency(%q) = %v, want %v", tc.header, got, tc.want)
+		}
+	}
+}
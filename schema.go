@@ -0,0 +1,377 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+)
+
+var sequenceDefaultRe = regexp.MustCompile(`(?i)\bGET_NEXT_SEQUENCE_VALUE\s*\(`)
+
+// Table describes a table of the database as
+// reported by INFORMATION_SCHEMA.
+type Table struct {
+	// Name is the name of the table, qualified with
+	// its schema if it isn't in the default schema.
+	Name    string
+	Columns []Column
+	// PrimaryKey are the key columns in key order.
+	PrimaryKey []IndexColumn
+	Indexes    []Index
+
+	// ParentTable is the table that the
+	// table is interleaved in, if any.
+	ParentTable string
+	// OnDeleteCascade is set if rows are deleted
+	// along with the parent row.
+	OnDeleteCascade bool
+
+	// RowDeletionPolicy is the TTL of the rows, if any.
+	RowDeletionPolicy *RowDeletionPolicy
+
+	ForeignKeys      []ForeignKey
+	CheckConstraints []CheckConstraint
+}
+
+// Column describes a column of a table.
+type Column struct {
+	Name string
+	// Type is the Spanner type of the column,
+	// e.g. STRING(MAX) or ARRAY<INT64>.
+	Type     string
+	Nullable bool
+	// Default is the default value expression, if any.
+	Default string
+	// Generated is the expression of a generated column.
+	Generated string
+	// Identity is set for identity columns, whose values
+	// are generated by a sequence when rows are inserted.
+	Identity bool
+}
+
+// KeyGenerated reports whether Spanner generates the values of the
+// column, because it is an identity column or defaults to the next
+// value of a sequence.
+func (col Column) KeyGenerated() bool {
+	return col.Identity || sequenceDefaultRe.MatchString(col.Default)
+}
+
+// Index describes a secondary index of a table.
+type Index struct {
+	Name         string
+	Unique       bool
+	NullFiltered bool
+	Columns      []IndexColumn
+	// Storing are the columns that are stored in the index.
+	Storing []string
+	// Interleave is the table that the index is interleaved in, if any.
+	Interleave string
+
+	// State is the state of the index as reported by INFORMATION_SCHEMA:
+	// PREPARE or WRITE_ONLY while it is backfilled, and READ_WRITE once
+	// it can be used. It is ignored by CreateIndex.
+	State string
+}
+
+// IndexColumn is a key column of an index.
+type IndexColumn struct {
+	Name       string
+	Descending bool
+}
+
+// ForeignKey is a foreign key constraint of a table.
+type ForeignKey struct {
+	Name string
+	// Columns are the referencing columns of the table.
+	Columns []string
+	// ReferencedTable and ReferencedColumns are the table and
+	// the columns that Columns refer to, in the same order.
+	ReferencedTable   string
+	ReferencedColumns []string
+	// OnDeleteCascade is set if referencing rows are deleted
+	// along with the referenced row. Otherwise the action is
+	// NO ACTION, and deleting a referenced row fails.
+	OnDeleteCascade bool
+}
+
+// CheckConstraint is a CHECK constraint of a table. The implicit
+// constraints of NOT NULL columns are not included.
+type CheckConstraint struct {
+	Name       string
+	Expression string
+}
+
+// ListTables returns the names of the tables of the database
+// of db, qualified with their schema if it isn't the default one.
+func ListTables(ctx context.Context, db *sql.DB) ([]string, error) {
+	var tables []string
+	err := withConn(ctx, db, func(c *conn) error {
+		stmt := spanner.NewStatement(`SELECT TABLE_SCHEMA, TABLE_NAME FROM INFORMATION_SCHEMA.TABLES
+WHERE TABLE_SCHEMA NOT IN ('INFORMATION_SCHEMA', 'SPANNER_SYS') AND TABLE_TYPE = 'BASE TABLE'
+ORDER BY TABLE_SCHEMA, TABLE_NAME`)
+		return c.querySchema(ctx, stmt, func(row *spanner.Row) error {
+			var schema, name string
+			if err := row.Columns(&schema, &name); err != nil {
+				return err
+			}
+			tables = append(tables, qualifiedName(schema, name))
+			return nil
+		})
+	})
+	return tables, err
+}
+
+// DescribeTable returns the columns, primary key, indexes and
+// interleaving, foreign keys and check constraints of the table
+// with the given name. Tables that aren't in the default schema
+// are named schema.table.
+func DescribeTable(ctx context.Context, db *sql.DB, name string) (Table, error) {
+	var t Table
+	err := withConn(ctx, db, func(c *conn) error {
+		var err error
+		t, err = c.describeTable(ctx, name)
+		return err
+	})
+	return t, err
+}
+
+func (c *conn) describeTable(ctx context.Context, name string) (Table, error) {
+	schema, table := splitQualifiedName(name)
+	params := map[string]interface{}{"schema": schema, "table": table}
+	t := Table{Name: name}
+
+	found := false
+	stmt := spanner.Statement{SQL: `SELECT PARENT_TABLE_NAME, ON_DELETE_ACTION, ROW_DELETION_POLICY_EXPRESSION
+FROM INFORMATION_SCHEMA.TABLES
+WHERE TABLE_SCHEMA = @schema AND TABLE_NAME = @table`, Params: params}
+	err := c.querySchema(ctx, stmt, func(row *spanner.Row) error {
+		var parent, onDelete, policy spanner.NullString
+		if err := row.Columns(&parent, &onDelete, &policy); err != nil {
+			return err
+		}
+		found = true
+		t.ParentTable = parent.StringVal
+		t.OnDeleteCascade = onDelete.StringVal == "CASCADE"
+		if policy.Valid {
+			p, err := ParseRowDeletionPolicy(policy.StringVal)
+			if err != nil {
+				return err
+			}
+			t.RowDeletionPolicy = &p
+		}
+		return nil
+	})
+	if err != nil {
+		return Table{}, err
+	}
+	if !found {
+		return Table{}, fmt.Errorf("table %q not found", name)
+	}
+
+	stmt = spanner.Statement{SQL: `SELECT COLUMN_NAME, SPANNER_TYPE, IS_NULLABLE, COLUMN_DEFAULT, GENERATION_EXPRESSION, IS_IDENTITY
+FROM INFORMATION_SCHEMA.COLUMNS
+WHERE TABLE_SCHEMA = @schema AND TABLE_NAME = @table
+ORDER BY ORDINAL_POSITION`, Params: params}
+	err = c.querySchema(ctx, stmt, func(row *spanner.Row) error {
+		var col Column
+		var nullable string
+		var def, generated, identity spanner.NullString
+		if err := row.Columns(&col.Name, &col.Type, &nullable, &def, &generated, &identity); err != nil {
+			return err
+		}
+		col.Nullable = nullable == "YES"
+		col.Identity = identity.StringVal == "YES"
+		col.Default = def.StringVal
+		col.Generated = generated.StringVal
+		t.Columns = append(t.Columns, col)
+		return nil
+	})
+	if err != nil {
+		return Table{}, err
+	}
+
+	if err := c.describeIndexes(ctx, schema, table, &t); err != nil {
+		return Table{}, err
+	}
+	if err := c.describeConstraints(ctx, schema, table, &t); err != nil {
+		return Table{}, err
+	}
+	return t, nil
+}
+
+// describeConstraints adds the foreign keys and
+// check constraints of the table to t.
+func (c *conn) describeConstraints(ctx context.Context, schema, table string, t *Table) error {
+	params := map[string]interface{}{"schema": schema, "table": table}
+	stmt := spanner.Statement{SQL: `SELECT tc.CONSTRAINT_NAME, rc.DELETE_RULE, kcu.COLUMN_NAME,
+  ukcu.TABLE_SCHEMA, ukcu.TABLE_NAME, ukcu.COLUMN_NAME
+FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS AS tc
+JOIN INFORMATION_SCHEMA.REFERENTIAL_CONSTRAINTS AS rc
+  ON rc.CONSTRAINT_SCHEMA = tc.CONSTRAINT_SCHEMA AND rc.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
+JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE AS kcu
+  ON kcu.CONSTRAINT_SCHEMA = tc.CONSTRAINT_SCHEMA AND kcu.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
+JOIN INFORMATION_SCHEMA.KEY_COLUMN_USAGE AS ukcu
+  ON ukcu.CONSTRAINT_SCHEMA = rc.UNIQUE_CONSTRAINT_SCHEMA AND ukcu.CONSTRAINT_NAME = rc.UNIQUE_CONSTRAINT_NAME
+  AND ukcu.ORDINAL_POSITION = kcu.POSITION_IN_UNIQUE_CONSTRAINT
+WHERE tc.TABLE_SCHEMA = @schema AND tc.TABLE_NAME = @table AND tc.CONSTRAINT_TYPE = 'FOREIGN KEY'
+ORDER BY tc.CONSTRAINT_NAME, kcu.ORDINAL_POSITION`, Params: params}
+	err := c.querySchema(ctx, stmt, func(row *spanner.Row) error {
+		var name, deleteRule, column, refSchema, refTable, refColumn string
+		if err := row.Columns(&name, &deleteRule, &column, &refSchema, &refTable, &refColumn); err != nil {
+			return err
+		}
+		t.addForeignKeyColumn(name, deleteRule, column, qualifiedName(refSchema, refTable), refColumn)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	stmt = spanner.Statement{SQL: `SELECT tc.CONSTRAINT_NAME, cc.CHECK_CLAUSE
+FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS AS tc
+JOIN INFORMATION_SCHEMA.CHECK_CONSTRAINTS AS cc
+  ON cc.CONSTRAINT_SCHEMA = tc.CONSTRAINT_SCHEMA AND cc.CONSTRAINT_NAME = tc.CONSTRAINT_NAME
+WHERE tc.TABLE_SCHEMA = @schema AND tc.TABLE_NAME = @table AND tc.CONSTRAINT_TYPE = 'CHECK'
+  AND NOT STARTS_WITH(tc.CONSTRAINT_NAME, 'CK_IS_NOT_NULL_')
+ORDER BY tc.CONSTRAINT_NAME`, Params: params}
+	return c.querySchema(ctx, stmt, func(row *spanner.Row) error {
+		var check CheckConstraint
+		if err := row.Columns(&check.Name, &check.Expression); err != nil {
+			return err
+		}
+		t.CheckConstraints = append(t.CheckConstraints, check)
+		return nil
+	})
+}
+
+// addForeignKeyColumn adds a referencing column and the column
+// that it refers to to the foreign key with the given name.
+func (t *Table) addForeignKeyColumn(name, deleteRule, column, refTable, refColumn string) {
+	if n := len(t.ForeignKeys); n == 0 || t.ForeignKeys[n-1].Name != name {
+		t.ForeignKeys = append(t.ForeignKeys, ForeignKey{
+			Name:            name,
+			ReferencedTable: refTable,
+			OnDeleteCascade: deleteRule == "CASCADE",
+		})
+	}
+	fk := &t.ForeignKeys[len(t.ForeignKeys)-1]
+	fk.Columns = append(fk.Columns, column)
+	fk.ReferencedColumns = append(fk.ReferencedColumns, refColumn)
+}
+
+// describeIndexes adds the primary key and the indexes of
+// the table to t.
+func (c *conn) describeIndexes(ctx context.Context, schema, table string, t *Table) error {
+	stmt := spanner.Statement{SQL: `SELECT i.INDEX_NAME, i.INDEX_TYPE, i.IS_UNIQUE, i.IS_NULL_FILTERED,
+  i.PARENT_TABLE_NAME, i.INDEX_STATE, c.COLUMN_NAME, c.COLUMN_ORDERING, c.ORDINAL_POSITION
+FROM INFORMATION_SCHEMA.INDEXES AS i
+JOIN INFORMATION_SCHEMA.INDEX_COLUMNS AS c
+  ON c.TABLE_SCHEMA = i.TABLE_SCHEMA AND c.TABLE_NAME = i.TABLE_NAME AND c.INDEX_NAME = i.INDEX_NAME
+WHERE i.TABLE_SCHEMA = @schema AND i.TABLE_NAME = @table
+ORDER BY i.INDEX_NAME, c.ORDINAL_POSITION`, Params: map[string]interface{}{"schema": schema, "table": table}}
+	return c.querySchema(ctx, stmt, func(row *spanner.Row) error {
+		var idx Index
+		var indexType, column string
+		var ordering, parent, state spanner.NullString
+		var pos spanner.NullInt64
+		if err := row.Columns(&idx.Name, &indexType, &idx.Unique, &idx.NullFiltered, &parent, &state, &column, &ordering, &pos); err != nil {
+			return err
+		}
+		idx.Interleave = parent.StringVal
+		idx.State = state.StringVal
+		t.addIndexColumn(idx, indexType, column, ordering.StringVal, pos.Valid)
+		return nil
+	})
+}
+
+// addIndexColumn adds a row of INDEX_COLUMNS to the primary key or
+// to the index idx. Columns without a position are stored columns.
+func (t *Table) addIndexColumn(idx Index, indexType, column, ordering string, key bool) {
+	col := IndexColumn{Name: column, Descending: ordering == "DESC"}
+	if indexType == "PRIMARY_KEY" {
+		t.PrimaryKey = append(t.PrimaryKey, col)
+		return
+	}
+	if n := len(t.Indexes); n == 0 || t.Indexes[n-1].Name != idx.Name {
+		t.Indexes = append(t.Indexes, idx)
+	}
+	last := &t.Indexes[len(t.Indexes)-1]
+	if key {
+		last.Columns = append(last.Columns, col)
+	} else {
+		last.Storing = append(last.Storing, column)
+	}
+}
+
+// querySchema runs stmt in a single use transaction
+// and calls f for each row.
+func (c *conn) querySchema(ctx context.Context, stmt spanner.Statement, f func(row *spanner.Row) error) error {
+	it := c.client.Single().Query(ctx, stmt)
+	defer it.Stop()
+	for {
+		row, err := it.Next()
+		if err == iterator.Done {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := f(row); err != nil {
+			return err
+		}
+	}
+}
+
+func qualifiedName(schema, name string) string {
+	if schema == "" {
+		return name
+	}
+	return schema + "." + name
+}
+
+func splitQualifiedName(name string) (schema, table string) {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+// unquoteIdentifier removes the backticks of a quoted name.
+func unquoteIdentifier(name string) string {
+	return strings.ReplaceAll(name, "`", "")
+}
+
+// equalFoldIdentifiers reports whether a and b name the same
+// object. Spanner names are case insensitive.
+func equalFoldIdentifiers(a, b string) bool {
+	return strings.EqualFold(unquoteIdentifier(a), unquoteIdentifier(b))
+}
+
+// quoteIdentifier quotes a name, and each part of
+// a name that is qualified with a schema.
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = "`" + p + "`"
+	}
+	return strings.Join(parts, ".")
+}
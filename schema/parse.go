@@ -0,0 +1,209 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+	"github.com/rakyll/go-sql-driver-spanner/internal"
+)
+
+var (
+	createTableRe = regexp.MustCompile(`(?is)^CREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?([^\s(]+)\s*\(`)
+	primaryKeyRe  = regexp.MustCompile(`(?is)^\s*PRIMARY\s+KEY\s*\(([^)]*)\)`)
+	interleaveRe  = regexp.MustCompile(`(?is)^INTERLEAVE\s+IN\s+PARENT\s+(\S+)(?:\s+ON\s+DELETE\s+(CASCADE|NO\s+ACTION))?$`)
+	createIndexRe = regexp.MustCompile(`(?is)^CREATE\s+(UNIQUE\s+)?(NULL_FILTERED\s+)?INDEX\s+(?:IF\s+NOT\s+EXISTS\s+)?(\S+)\s+ON\s+([^\s(]+)\s*\(([^)]*)\)\s*(?:STORING\s*\(([^)]*)\))?\s*(?:,\s*INTERLEAVE\s+IN\s+(\S+))?$`)
+	rowDeletionRe = regexp.MustCompile(`(?is)^ROW\s+DELETION\s+POLICY\s*\((.*)\)$`)
+	constraintRe  = regexp.MustCompile(`(?is)^(CONSTRAINT|FOREIGN\s+KEY|CHECK)\b`)
+)
+
+// Parse parses CREATE TABLE and CREATE INDEX statements
+// into the tables that they describe. Constraints are ignored.
+func Parse(ddl string) ([]spannerdriver.Table, error) {
+	var tables []spannerdriver.Table
+	for _, stmt := range internal.SplitStatements(ddl) {
+		stmt = internal.StripComments(stmt)
+		if createTableRe.MatchString(stmt) {
+			t, err := parseCreateTable(stmt)
+			if err != nil {
+				return nil, err
+			}
+			tables = append(tables, t)
+			continue
+		}
+		m := createIndexRe.FindStringSubmatch(stmt)
+		if m == nil {
+			return nil, fmt.Errorf("unsupported statement: %s", stmt)
+		}
+		table := unquote(m[4])
+		i := indexOf(tables, table)
+		if i < 0 {
+			return nil, fmt.Errorf("index %s: table %s is not defined before the index", unquote(m[3]), table)
+		}
+		idx := spannerdriver.Index{
+			Name:         unquote(m[3]),
+			Unique:       m[1] != "",
+			NullFiltered: m[2] != "",
+			Columns:      parseKeys(m[5]),
+			Interleave:   unquote(m[7]),
+		}
+		for _, col := range internal.SplitList(m[6]) {
+			idx.Storing = append(idx.Storing, unquote(col))
+		}
+		tables[i].Indexes = append(tables[i].Indexes, idx)
+	}
+	return tables, nil
+}
+
+func parseCreateTable(stmt string) (spannerdriver.Table, error) {
+	m := createTableRe.FindStringSubmatch(stmt)
+	t := spannerdriver.Table{Name: unquote(m[1])}
+	open := len(m[0]) - 1
+	end := internal.ClosingParen(stmt, open)
+	if end < 0 {
+		return t, fmt.Errorf("table %s: missing closing parenthesis", t.Name)
+	}
+	for _, def := range internal.SplitList(stmt[open+1 : end]) {
+		if def == "" || constraintRe.MatchString(def) {
+			continue
+		}
+		col, err := parseColumn(def)
+		if err != nil {
+			return t, fmt.Errorf("table %s: %v", t.Name, err)
+		}
+		t.Columns = append(t.Columns, col)
+	}
+
+	rest := stmt[end+1:]
+	pk := primaryKeyRe.FindStringSubmatch(rest)
+	if pk == nil {
+		return t, fmt.Errorf("table %s: missing PRIMARY KEY", t.Name)
+	}
+	t.PrimaryKey = parseKeys(pk[1])
+	clauses := internal.SplitList(rest[len(pk[0]):])
+	if len(clauses) > 0 && clauses[0] != "" {
+		return t, fmt.Errorf("table %s: unexpected %q after PRIMARY KEY", t.Name, clauses[0])
+	}
+	for _, clause := range clauses[min(1, len(clauses)):] {
+		if m := interleaveRe.FindStringSubmatch(clause); m != nil {
+			t.ParentTable = unquote(m[1])
+			t.OnDeleteCascade = strings.EqualFold(m[2], "CASCADE")
+		}
+		if m := rowDeletionRe.FindStringSubmatch(clause); m != nil {
+			p, err := spannerdriver.ParseRowDeletionPolicy(m[1])
+			if err != nil {
+				return t, fmt.Errorf("table %s: %v", t.Name, err)
+			}
+			t.RowDeletionPolicy = &p
+		}
+	}
+	return t, nil
+}
+
+// parseColumn parses a column definition of a CREATE TABLE statement.
+func parseColumn(def string) (spannerdriver.Column, error) {
+	fields := strings.Fields(def)
+	col := spannerdriver.Column{Name: unquote(fields[0]), Nullable: true}
+	rest := strings.TrimSpace(def[len(fields[0]):])
+
+	// The type ends at the first space that isn't nested
+	// in angle brackets or parentheses.
+	depth, i := 0, 0
+	for ; i < len(rest); i++ {
+		switch rest[i] {
+		case '<', '(':
+			depth++
+		case '>', ')':
+			depth--
+		}
+		if depth == 0 && (rest[i] == ' ' || rest[i] == '\t' || rest[i] == '\n') {
+			break
+		}
+	}
+	col.Type = rest[:i]
+	if col.Type == "" {
+		return col, fmt.Errorf("column %s: missing type", col.Name)
+	}
+
+	rest = strings.TrimSpace(rest[i:])
+	for rest != "" {
+		upper := strings.ToUpper(rest)
+		var expr *string
+		switch {
+		case strings.HasPrefix(upper, "NOT NULL"):
+			col.Nullable = false
+			rest = strings.TrimSpace(rest[len("NOT NULL"):])
+			continue
+		case strings.HasPrefix(upper, "HIDDEN"):
+			rest = strings.TrimSpace(rest[len("HIDDEN"):])
+			continue
+		case strings.HasPrefix(upper, "STORED"):
+			rest = strings.TrimSpace(rest[len("STORED"):])
+			continue
+		case strings.HasPrefix(upper, "DEFAULT"):
+			expr = &col.Default
+		case strings.HasPrefix(upper, "AS"):
+			expr = &col.Generated
+		case strings.HasPrefix(upper, "OPTIONS"):
+			expr = new(string)
+		default:
+			return col, fmt.Errorf("column %s: unexpected %q", col.Name, rest)
+		}
+		open := strings.IndexByte(rest, '(')
+		end := -1
+		if open >= 0 {
+			end = internal.ClosingParen(rest, open)
+		}
+		if end < 0 {
+			return col, fmt.Errorf("column %s: missing expression in %q", col.Name, rest)
+		}
+		*expr = strings.TrimSpace(rest[open+1 : end])
+		rest = strings.TrimSpace(rest[end+1:])
+	}
+	return col, nil
+}
+
+// parseKeys parses a list of key columns, such as "a, b DESC".
+func parseKeys(list string) []spannerdriver.IndexColumn {
+	var keys []spannerdriver.IndexColumn
+	for _, part := range internal.SplitList(list) {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		keys = append(keys, spannerdriver.IndexColumn{
+			Name:       unquote(fields[0]),
+			Descending: len(fields) > 1 && strings.EqualFold(fields[1], "DESC"),
+		})
+	}
+	return keys
+}
+
+func indexOf(tables []spannerdriver.Table, name string) int {
+	for i, t := range tables {
+		if strings.EqualFold(t.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// unquote removes the backticks of a quoted identifier.
+func unquote(name string) string {
+	return strings.ReplaceAll(name, "`", "")
+}
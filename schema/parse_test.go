@@ -0,0 +1,100 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"reflect"
+	"testing"
+
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+)
+
+const singersDDL = `
+-- Singers and their albums.
+CREATE TABLE Singers (
+  SingerId   INT64 NOT NULL,
+  Name       STRING(1024),
+  Tags       ARRAY<STRING(MAX)>,
+  CreatedAt  TIMESTAMP NOT NULL DEFAULT (CURRENT_TIMESTAMP()),
+  NameLength INT64 AS (IF(Name IS NULL, 0, CHAR_LENGTH(Name))) STORED,
+  CONSTRAINT positive CHECK (SingerId > 0),
+) PRIMARY KEY (SingerId),
+  ROW DELETION POLICY (OLDER_THAN(CreatedAt, INTERVAL 30 DAY));
+
+CREATE TABLE Albums (
+  SingerId INT64 NOT NULL,
+  AlbumId  INT64 NOT NULL,
+  Title    STRING(MAX) OPTIONS (allow_commit_timestamp = false),
+) PRIMARY KEY (SingerId, AlbumId DESC),
+  INTERLEAVE IN PARENT Singers ON DELETE CASCADE;
+
+CREATE UNIQUE NULL_FILTERED INDEX AlbumsByTitle ON Albums (Title DESC) STORING (AlbumId);
+`
+
+func TestParse(t *testing.T) {
+	tables, err := Parse(singersDDL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []spannerdriver.Table{
+		{
+			Name: "Singers",
+			Columns: []spannerdriver.Column{
+				{Name: "SingerId", Type: "INT64"},
+				{Name: "Name", Type: "STRING(1024)", Nullable: true},
+				{Name: "Tags", Type: "ARRAY<STRING(MAX)>", Nullable: true},
+				{Name: "CreatedAt", Type: "TIMESTAMP", Default: "CURRENT_TIMESTAMP()"},
+				{Name: "NameLength", Type: "INT64", Nullable: true, Generated: "IF(Name IS NULL, 0, CHAR_LENGTH(Name))"},
+			},
+			PrimaryKey:        []spannerdriver.IndexColumn{{Name: "SingerId"}},
+			RowDeletionPolicy: &spannerdriver.RowDeletionPolicy{Column: "CreatedAt", Days: 30},
+		},
+		{
+			Name: "Albums",
+			Columns: []spannerdriver.Column{
+				{Name: "SingerId", Type: "INT64"},
+				{Name: "AlbumId", Type: "INT64"},
+				{Name: "Title", Type: "STRING(MAX)", Nullable: true},
+			},
+			PrimaryKey:      []spannerdriver.IndexColumn{{Name: "SingerId"}, {Name: "AlbumId", Descending: true}},
+			ParentTable:     "Singers",
+			OnDeleteCascade: true,
+			Indexes: []spannerdriver.Index{{
+				Name:         "AlbumsByTitle",
+				Unique:       true,
+				NullFiltered: true,
+				Columns:      []spannerdriver.IndexColumn{{Name: "Title", Descending: true}},
+				Storing:      []string{"AlbumId"},
+			}},
+		},
+	}
+	if !reflect.DeepEqual(tables, want) {
+		t.Errorf("got  %+v\nwant %+v", tables, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, ddl := range []string{
+		"CREATE TABLE T (Id INT64)",
+		"CREATE TABLE T (Id INT64 PRIMARY KEY (Id)",
+		"CREATE TABLE T (Id INT64 UNIQUE) PRIMARY KEY (Id)",
+		"CREATE INDEX I ON T (Id)",
+		"DROP TABLE T",
+	} {
+		if _, err := Parse(ddl); err == nil {
+			t.Errorf("Parse(%q): expected error", ddl)
+		}
+	}
+}
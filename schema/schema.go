@@ -0,0 +1,310 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package schema compares a desired schema with the schema of a
+// Spanner database and generates the DDL statements that migrate
+// the database to the desired schema.
+//
+// The desired schema is described by DDL statements, see Parse,
+// or by Go structs, see FromStruct:
+//
+//	desired, err := schema.Parse(ddl)
+//	...
+//	statements, err := schema.Apply(ctx, db, desired, schema.Options{})
+//
+// Tables, columns, indexes and row deletion policies that are not
+// part of the desired schema are only dropped if Options.Drop is set.
+// Changes that Spanner can't apply to an existing table, such as
+// changes of the primary key, are reported as errors.
+package schema
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+)
+
+// Options configure how a schema is migrated.
+type Options struct {
+	// Drop enables dropping tables, columns, indexes and row
+	// deletion policies that aren't part of the desired schema.
+	Drop bool
+}
+
+// Apply migrates the database of db to the desired schema in one
+// DDL batch, and returns the statements that were executed.
+func Apply(ctx context.Context, db *sql.DB, desired []spannerdriver.Table, opts Options) ([]string, error) {
+	current, err := Current(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	statements, err := Diff(current, desired, opts)
+	if err != nil || len(statements) == 0 {
+		return nil, err
+	}
+	if err := spannerdriver.ExecDDL(ctx, db, statements...); err != nil {
+		return nil, err
+	}
+	return statements, nil
+}
+
+// Current returns the tables of the database of db.
+func Current(ctx context.Context, db *sql.DB) ([]spannerdriver.Table, error) {
+	names, err := spannerdriver.ListTables(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]spannerdriver.Table, 0, len(names))
+	for _, name := range names {
+		t, err := spannerdriver.DescribeTable(ctx, db, name)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, t)
+	}
+	return tables, nil
+}
+
+// Diff returns the DDL statements that change the current
+// schema into the desired schema.
+func Diff(current, desired []spannerdriver.Table, opts Options) ([]string, error) {
+	byName := make(map[string]*spannerdriver.Table)
+	for i := range current {
+		byName[strings.ToUpper(current[i].Name)] = &current[i]
+	}
+	var statements []string
+	wanted := make(map[string]bool)
+	for _, t := range desired {
+		wanted[strings.ToUpper(t.Name)] = true
+		cur, ok := byName[strings.ToUpper(t.Name)]
+		if !ok {
+			statements = append(statements, CreateTable(t))
+			for _, idx := range t.Indexes {
+				statements = append(statements, CreateIndex(t.Name, idx))
+			}
+			continue
+		}
+		s, err := diffTable(*cur, t, opts)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, s...)
+	}
+	if opts.Drop {
+		// Drop child tables before their parents.
+		for i := len(current) - 1; i >= 0; i-- {
+			t := current[i]
+			if wanted[strings.ToUpper(t.Name)] {
+				continue
+			}
+			for _, idx := range t.Indexes {
+				statements = append(statements, "DROP INDEX "+quote(idx.Name))
+			}
+			statements = append(statements, "DROP TABLE "+quote(t.Name))
+		}
+	}
+	return statements, nil
+}
+
+func diffTable(cur, t spannerdriver.Table, opts Options) ([]string, error) {
+	if !equalKeys(cur.PrimaryKey, t.PrimaryKey) {
+		return nil, fmt.Errorf("table %s: the primary key can't be changed", t.Name)
+	}
+	if !strings.EqualFold(cur.ParentTable, t.ParentTable) || cur.OnDeleteCascade != t.OnDeleteCascade && t.ParentTable != "" {
+		return nil, fmt.Errorf("table %s: the interleaving can't be changed", t.Name)
+	}
+
+	var statements []string
+	columns := make(map[string]spannerdriver.Column)
+	for _, col := range cur.Columns {
+		columns[strings.ToUpper(col.Name)] = col
+	}
+	wanted := make(map[string]bool)
+	for _, col := range t.Columns {
+		wanted[strings.ToUpper(col.Name)] = true
+		c, ok := columns[strings.ToUpper(col.Name)]
+		switch {
+		case !ok:
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", quote(t.Name), ColumnDefinition(col)))
+		case col.Generated != "" || c.Generated != "":
+			// Generated columns can't be altered.
+		case normalizeType(c.Type) != normalizeType(col.Type) || c.Nullable != col.Nullable:
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s", quote(t.Name), ColumnDefinition(col)))
+		}
+	}
+
+	if t.RowDeletionPolicy != nil || opts.Drop {
+		if s := spannerdriver.AlterRowDeletionPolicy(t.Name, cur.RowDeletionPolicy, t.RowDeletionPolicy); s != "" {
+			statements = append(statements, s)
+		}
+	}
+
+	indexes := make(map[string]spannerdriver.Index)
+	for _, idx := range cur.Indexes {
+		indexes[strings.ToUpper(idx.Name)] = idx
+	}
+	wantedIndexes := make(map[string]bool)
+	var create []string
+	for _, idx := range t.Indexes {
+		wantedIndexes[strings.ToUpper(idx.Name)] = true
+		c, ok := indexes[strings.ToUpper(idx.Name)]
+		if ok && equalIndexes(c, idx) {
+			continue
+		}
+		if ok {
+			statements = append(statements, "DROP INDEX "+quote(idx.Name))
+		}
+		create = append(create, CreateIndex(t.Name, idx))
+	}
+	if opts.Drop {
+		for _, idx := range cur.Indexes {
+			if !wantedIndexes[strings.ToUpper(idx.Name)] {
+				statements = append(statements, "DROP INDEX "+quote(idx.Name))
+			}
+		}
+		for _, col := range cur.Columns {
+			if !wanted[strings.ToUpper(col.Name)] {
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", quote(t.Name), quote(col.Name)))
+			}
+		}
+	}
+	// Indexes are created after the columns that they refer to.
+	return append(statements, create...), nil
+}
+
+// CreateTable returns the CREATE TABLE statement of t.
+func CreateTable(t spannerdriver.Table) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE TABLE %s (\n", quote(t.Name))
+	for _, col := range t.Columns {
+		fmt.Fprintf(&b, "  %s,\n", ColumnDefinition(col))
+	}
+	fmt.Fprintf(&b, ") PRIMARY KEY (%s)", keyList(t.PrimaryKey))
+	if t.ParentTable != "" {
+		fmt.Fprintf(&b, ",\n  INTERLEAVE IN PARENT %s", quote(t.ParentTable))
+		if t.OnDeleteCascade {
+			b.WriteString(" ON DELETE CASCADE")
+		}
+	}
+	if t.RowDeletionPolicy != nil {
+		fmt.Fprintf(&b, ",\n  ROW DELETION POLICY (%s)", t.RowDeletionPolicy)
+	}
+	return b.String()
+}
+
+// CreateIndex returns the CREATE INDEX statement of
+// the index idx of the given table.
+func CreateIndex(table string, idx spannerdriver.Index) string {
+	return spannerdriver.CreateIndexStatement(table, idx)
+}
+
+// AddForeignKey returns the ALTER TABLE statement that
+// adds the foreign key fk to the given table.
+func AddForeignKey(table string, fk spannerdriver.ForeignKey) string {
+	columns := make([]string, len(fk.Columns))
+	for i, col := range fk.Columns {
+		columns[i] = quote(col)
+	}
+	references := make([]string, len(fk.ReferencedColumns))
+	for i, col := range fk.ReferencedColumns {
+		references[i] = quote(col)
+	}
+	s := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+		quote(table), quote(fk.Name), strings.Join(columns, ", "), quote(fk.ReferencedTable), strings.Join(references, ", "))
+	if fk.OnDeleteCascade {
+		s += " ON DELETE CASCADE"
+	}
+	return s
+}
+
+// ColumnDefinition returns the definition of col
+// in CREATE TABLE and ALTER TABLE statements.
+func ColumnDefinition(col spannerdriver.Column) string {
+	def := quote(col.Name) + " " + col.Type
+	if !col.Nullable {
+		def += " NOT NULL"
+	}
+	if col.Default != "" {
+		def += " DEFAULT (" + col.Default + ")"
+	}
+	if col.Generated != "" {
+		def += " AS (" + col.Generated + ") STORED"
+	}
+	if col.Identity {
+		def += " GENERATED BY DEFAULT AS IDENTITY (BIT_REVERSED_POSITIVE)"
+	}
+	return def
+}
+
+func keyList(cols []spannerdriver.IndexColumn) string {
+	parts := make([]string, len(cols))
+	for i, col := range cols {
+		parts[i] = quote(col.Name)
+		if col.Descending {
+			parts[i] += " DESC"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func equalKeys(a, b []spannerdriver.IndexColumn) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i].Name, b[i].Name) || a[i].Descending != b[i].Descending {
+			return false
+		}
+	}
+	return true
+}
+
+func equalIndexes(a, b spannerdriver.Index) bool {
+	if a.Unique != b.Unique || a.NullFiltered != b.NullFiltered || !equalKeys(a.Columns, b.Columns) ||
+		!strings.EqualFold(a.Interleave, b.Interleave) {
+		return false
+	}
+	if len(a.Storing) != len(b.Storing) {
+		return false
+	}
+	stored := make(map[string]bool)
+	for _, col := range a.Storing {
+		stored[strings.ToUpper(col)] = true
+	}
+	for _, col := range b.Storing {
+		if !stored[strings.ToUpper(col)] {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeType returns the form of a Spanner type
+// that INFORMATION_SCHEMA reports, e.g. ARRAY<STRING(MAX)>.
+func normalizeType(t string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(t), ""))
+}
+
+// quote quotes an identifier, and each part
+// of a name that is qualified with a schema.
+func quote(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = "`" + p + "`"
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,148 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+)
+
+func TestDiff(t *testing.T) {
+	desired, err := Parse(singersDDL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := Parse(`
+CREATE TABLE Singers (
+  SingerId INT64 NOT NULL,
+  Name     STRING(MAX),
+  Obsolete BOOL,
+) PRIMARY KEY (SingerId);
+CREATE TABLE Old (Id INT64) PRIMARY KEY (Id);
+CREATE INDEX OldById ON Old (Id);
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := Diff(current, desired, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"ALTER TABLE `Singers` ALTER COLUMN `Name` STRING(1024)",
+		"ALTER TABLE `Singers` ADD COLUMN `Tags` ARRAY<STRING(MAX)>",
+		"ALTER TABLE `Singers` ADD COLUMN `CreatedAt` TIMESTAMP NOT NULL DEFAULT (CURRENT_TIMESTAMP())",
+		"ALTER TABLE `Singers` ADD COLUMN `NameLength` INT64 AS (IF(Name IS NULL, 0, CHAR_LENGTH(Name))) STORED",
+		"ALTER TABLE `Singers` ADD ROW DELETION POLICY (OLDER_THAN(`CreatedAt`, INTERVAL 30 DAY))",
+		"CREATE TABLE `Albums` (\n" +
+			"  `SingerId` INT64 NOT NULL,\n" +
+			"  `AlbumId` INT64 NOT NULL,\n" +
+			"  `Title` STRING(MAX),\n" +
+			") PRIMARY KEY (`SingerId`, `AlbumId` DESC),\n" +
+			"  INTERLEAVE IN PARENT `Singers` ON DELETE CASCADE",
+		"CREATE UNIQUE NULL_FILTERED INDEX `AlbumsByTitle` ON `Albums` (`Title` DESC) STORING (`AlbumId`)",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+
+	got, err = Diff(current, desired, Options{Drop: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = append(want[:5:5], "ALTER TABLE `Singers` DROP COLUMN `Obsolete`")
+	want = append(want, "CREATE TABLE", "CREATE UNIQUE", "DROP INDEX `OldById`", "DROP TABLE `Old`")
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %d statements", got, len(want))
+	}
+	for i := range want {
+		if !strings.HasPrefix(got[i], want[i]) {
+			t.Errorf("statement %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	if got, err := Diff(desired, desired, Options{Drop: true}); err != nil || len(got) != 0 {
+		t.Errorf("Diff of equal schemas: got %q, %v", got, err)
+	}
+}
+
+func TestDiffIndexes(t *testing.T) {
+	table := spannerdriver.Table{
+		Name:       "T",
+		Columns:    []spannerdriver.Column{{Name: "Id", Type: "INT64"}, {Name: "V", Type: "STRING(MAX)", Nullable: true}},
+		PrimaryKey: []spannerdriver.IndexColumn{{Name: "Id"}},
+		Indexes:    []spannerdriver.Index{{Name: "TByV", Columns: []spannerdriver.IndexColumn{{Name: "V"}}}},
+	}
+	changed := table
+	changed.Indexes = []spannerdriver.Index{{Name: "TByV", Columns: []spannerdriver.IndexColumn{{Name: "V", Descending: true}}}}
+	got, err := Diff([]spannerdriver.Table{table}, []spannerdriver.Table{changed}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"DROP INDEX `TByV`", "CREATE INDEX `TByV` ON `T` (`V` DESC)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	changed = table
+	changed.RowDeletionPolicy = &spannerdriver.RowDeletionPolicy{Column: "CreatedAt", Days: 7}
+	got, err = Diff([]spannerdriver.Table{table}, []spannerdriver.Table{changed}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"ALTER TABLE `T` ADD ROW DELETION POLICY (OLDER_THAN(`CreatedAt`, INTERVAL 7 DAY))"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	changed = table
+	changed.PrimaryKey = []spannerdriver.IndexColumn{{Name: "V"}}
+	if _, err := Diff([]spannerdriver.Table{table}, []spannerdriver.Table{changed}, Options{}); err == nil {
+		t.Error("changed primary key: expected error")
+	}
+}
+
+func TestColumnDefinition(t *testing.T) {
+	for _, tc := range []struct {
+		col  spannerdriver.Column
+		want string
+	}{
+		{spannerdriver.Column{Name: "Name", Type: "STRING(MAX)", Nullable: true}, "`Name` STRING(MAX)"},
+		{spannerdriver.Column{Name: "CreatedAt", Type: "TIMESTAMP", Default: "CURRENT_TIMESTAMP()"}, "`CreatedAt` TIMESTAMP NOT NULL DEFAULT (CURRENT_TIMESTAMP())"},
+		{spannerdriver.Column{Name: "Id", Type: "INT64", Identity: true}, "`Id` INT64 NOT NULL GENERATED BY DEFAULT AS IDENTITY (BIT_REVERSED_POSITIVE)"},
+	} {
+		if got := ColumnDefinition(tc.col); got != tc.want {
+			t.Errorf("got %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestAddForeignKey(t *testing.T) {
+	fk := spannerdriver.ForeignKey{
+		Name:              "FK_Albums_Singers",
+		Columns:           []string{"SingerId"},
+		ReferencedTable:   "Singers",
+		ReferencedColumns: []string{"Id"},
+		OnDeleteCascade:   true,
+	}
+	want := "ALTER TABLE `Albums` ADD CONSTRAINT `FK_Albums_Singers` FOREIGN KEY (`SingerId`) REFERENCES `Singers` (`Id`) ON DELETE CASCADE"
+	if got := AddForeignKey("Albums", fk); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
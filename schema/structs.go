@@ -0,0 +1,143 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+)
+
+var nullTypes = map[reflect.Type]string{
+	reflect.TypeOf(spanner.NullString{}):  "STRING(MAX)",
+	reflect.TypeOf(spanner.NullInt64{}):   "INT64",
+	reflect.TypeOf(spanner.NullFloat64{}): "FLOAT64",
+	reflect.TypeOf(spanner.NullFloat32{}): "FLOAT32",
+	reflect.TypeOf(spanner.NullBool{}):    "BOOL",
+	reflect.TypeOf(spanner.NullTime{}):    "TIMESTAMP",
+	reflect.TypeOf(spanner.NullDate{}):    "DATE",
+	reflect.TypeOf(spanner.NullNumeric{}): "NUMERIC",
+	reflect.TypeOf(spanner.NullJSON{}):    "JSON",
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	dateType    = reflect.TypeOf(civil.Date{})
+	numericType = reflect.TypeOf(big.Rat{})
+)
+
+// FromStruct returns the table with the given name and primary key
+// that stores values of the struct type of v. Columns are named
+// like the spanner client names them: after the spanner tag of a
+// field, or the field itself. Fields tagged spanner:"-" are skipped.
+//
+// Fields of pointer and spanner.Null types are nullable, all other
+// fields are NOT NULL. Strings and byte slices are mapped to
+// STRING(MAX) and BYTES(MAX).
+func FromStruct(name string, v interface{}, primaryKey ...string) (spannerdriver.Table, error) {
+	t := spannerdriver.Table{Name: name}
+	typ := reflect.TypeOf(v)
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return t, fmt.Errorf("%T is not a struct", v)
+	}
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		colName := f.Name
+		if tag, ok := f.Tag.Lookup("spanner"); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				colName = tag
+			}
+		}
+		colType, nullable, err := spannerType(f.Type)
+		if err != nil {
+			return t, fmt.Errorf("field %s: %v", f.Name, err)
+		}
+		t.Columns = append(t.Columns, spannerdriver.Column{Name: colName, Type: colType, Nullable: nullable})
+	}
+	for _, key := range primaryKey {
+		if indexOfColumn(t.Columns, key) < 0 {
+			return t, fmt.Errorf("primary key column %s is not a field of %T", key, v)
+		}
+		t.PrimaryKey = append(t.PrimaryKey, spannerdriver.IndexColumn{Name: key})
+	}
+	return t, nil
+}
+
+// spannerType returns the Spanner type of columns
+// that store values of type t.
+func spannerType(t reflect.Type) (string, bool, error) {
+	if s, ok := nullTypes[t]; ok {
+		return s, true, nil
+	}
+	if t.Kind() == reflect.Ptr {
+		s, _, err := spannerType(t.Elem())
+		return s, true, err
+	}
+	switch t {
+	case timeType:
+		return "TIMESTAMP", false, nil
+	case dateType:
+		return "DATE", false, nil
+	case numericType:
+		return "NUMERIC", false, nil
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "STRING(MAX)", false, nil
+	case reflect.Bool:
+		return "BOOL", false, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return "INT64", false, nil
+	case reflect.Float32:
+		return "FLOAT32", false, nil
+	case reflect.Float64:
+		return "FLOAT64", false, nil
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "BYTES(MAX)", false, nil
+		}
+		elem, _, err := spannerType(t.Elem())
+		if err != nil {
+			return "", false, err
+		}
+		// Arrays are nullable like nil slices.
+		return "ARRAY<" + elem + ">", true, nil
+	}
+	return "", false, fmt.Errorf("unsupported type %s", t)
+}
+
+func indexOfColumn(cols []spannerdriver.Column, name string) int {
+	for i, col := range cols {
+		if col.Name == name {
+			return i
+		}
+	}
+	return -1
+}
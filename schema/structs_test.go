@@ -0,0 +1,67 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package schema
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+)
+
+type singer struct {
+	ID         int64 `spanner:"SingerId"`
+	Name       spanner.NullString
+	Tags       []string
+	Photo      []byte
+	Rating     *float64
+	CreatedAt  time.Time
+	Internal   string `spanner:"-"`
+	unexported int
+}
+
+func TestFromStruct(t *testing.T) {
+	got, err := FromStruct("Singers", &singer{}, "SingerId")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := spannerdriver.Table{
+		Name: "Singers",
+		Columns: []spannerdriver.Column{
+			{Name: "SingerId", Type: "INT64"},
+			{Name: "Name", Type: "STRING(MAX)", Nullable: true},
+			{Name: "Tags", Type: "ARRAY<STRING(MAX)>", Nullable: true},
+			{Name: "Photo", Type: "BYTES(MAX)"},
+			{Name: "Rating", Type: "FLOAT64", Nullable: true},
+			{Name: "CreatedAt", Type: "TIMESTAMP"},
+		},
+		PrimaryKey: []spannerdriver.IndexColumn{{Name: "SingerId"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	if _, err := FromStruct("Singers", singer{}, "Id"); err == nil {
+		t.Error("unknown primary key column: expected error")
+	}
+	if _, err := FromStruct("T", 1); err == nil {
+		t.Error("not a struct: expected error")
+	}
+	if _, err := FromStruct("T", struct{ C chan int }{}); err == nil {
+		t.Error("unsupported field type: expected error")
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAddIndexColumn(t *testing.T) {
+	var table Table
+	table.addIndexColumn(Index{Name: "PRIMARY_KEY", Unique: true}, "PRIMARY_KEY", "SingerId", "ASC", true)
+	table.addIndexColumn(Index{Name: "PRIMARY_KEY", Unique: true}, "PRIMARY_KEY", "AlbumId", "DESC", true)
+	byTitle := Index{Name: "AlbumsByTitle", NullFiltered: true, Interleave: "Singers", State: "READ_WRITE"}
+	table.addIndexColumn(byTitle, "INDEX", "Title", "ASC", true)
+	table.addIndexColumn(byTitle, "INDEX", "Budget", "", false)
+	table.addIndexColumn(Index{Name: "AlbumsByYear", Unique: true, State: "WRITE_ONLY"}, "INDEX", "Year", "DESC", true)
+
+	want := Table{
+		PrimaryKey: []IndexColumn{{Name: "SingerId"}, {Name: "AlbumId", Descending: true}},
+		Indexes: []Index{
+			{
+				Name:         "AlbumsByTitle",
+				NullFiltered: true,
+				Columns:      []IndexColumn{{Name: "Title"}},
+				Storing:      []string{"Budget"},
+				Interleave:   "Singers",
+				State:        "READ_WRITE",
+			},
+			{
+				Name:    "AlbumsByYear",
+				Unique:  true,
+				Columns: []IndexColumn{{Name: "Year", Descending: true}},
+				State:   "WRITE_ONLY",
+			},
+		},
+	}
+	if !reflect.DeepEqual(table, want) {
+		t.Errorf("got %+v, want %+v", table, want)
+	}
+}
+
+func TestQualifiedName(t *testing.T) {
+	for _, name := range []string{"Singers", "sales.Orders"} {
+		schema, table := splitQualifiedName(name)
+		if got := qualifiedName(schema, table); got != name {
+			t.Errorf("qualifiedName(splitQualifiedName(%q)) = %q", name, got)
+		}
+	}
+}
+
+func TestAddForeignKeyColumn(t *testing.T) {
+	var table Table
+	table.addForeignKeyColumn("FK_Albums_Singers", "NO ACTION", "SingerId", "Singers", "Id")
+	table.addForeignKeyColumn("FK_Albums_Labels", "CASCADE", "LabelCountry", "music.Labels", "Country")
+	table.addForeignKeyColumn("FK_Albums_Labels", "CASCADE", "LabelName", "music.Labels", "Name")
+
+	want := []ForeignKey{
+		{
+			Name:              "FK_Albums_Singers",
+			Columns:           []string{"SingerId"},
+			ReferencedTable:   "Singers",
+			ReferencedColumns: []string{"Id"},
+		},
+		{
+			Name:              "FK_Albums_Labels",
+			Columns:           []string{"LabelCountry", "LabelName"},
+			ReferencedTable:   "music.Labels",
+			ReferencedColumns: []string{"Country", "Name"},
+			OnDeleteCascade:   true,
+		},
+	}
+	if !reflect.DeepEqual(table.ForeignKeys, want) {
+		t.Errorf("got %+v, want %+v", table.ForeignKeys, want)
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"cloud.google.com/go/spanner"
+)
+
+// Sequence describes a sequence of the database, as created with
+// CREATE SEQUENCE.
+type Sequence struct {
+	// Name is the name of the sequence, qualified with
+	// its schema if it isn't in the default schema.
+	Name string
+	// Kind is the kind of the sequence, e.g. bit_reversed_positive.
+	Kind string
+	// StartWithCounter is the first value of the internal counter.
+	StartWithCounter int64
+	// SkipRangeMin and SkipRangeMax are the range of values
+	// that the sequence skips, or 0 if it doesn't skip values.
+	SkipRangeMin int64
+	SkipRangeMax int64
+}
+
+// NextSequenceValue returns the next value of the sequence with the
+// given name. Spanner only allows GET_NEXT_SEQUENCE_VALUE in read-write
+// transactions, so the value is fetched in a transaction of its own.
+func NextSequenceValue(ctx context.Context, db *sql.DB, name string) (int64, error) {
+	values, err := NextSequenceValues(ctx, db, name, 1)
+	if err != nil {
+		return 0, err
+	}
+	return values[0], nil
+}
+
+// NextSequenceValues returns the next n values of the
+// sequence with the given name in one round trip.
+func NextSequenceValues(ctx context.Context, db *sql.DB, name string, n int) ([]int64, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("invalid number of sequence values %d", n)
+	}
+	var values []int64
+	err := withConn(ctx, db, func(c *conn) error {
+		stmt := spanner.Statement{
+			SQL:    fmt.Sprintf("SELECT GET_NEXT_SEQUENCE_VALUE(SEQUENCE %s) FROM UNNEST(GENERATE_ARRAY(1, @n))", quoteIdentifier(name)),
+			Params: map[string]interface{}{"n": int64(n)},
+		}
+		_, err := c.client.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+			values = values[:0]
+			return tx.Query(ctx, stmt).Do(func(row *spanner.Row) error {
+				var v int64
+				if err := row.Columns(&v); err != nil {
+					return err
+				}
+				values = append(values, v)
+				return nil
+			})
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Sequences returns the sequences of the database of db.
+func Sequences(ctx context.Context, db *sql.DB) ([]Sequence, error) {
+	var seqs []Sequence
+	err := withConn(ctx, db, func(c *conn) error {
+		stmt := spanner.NewStatement(`SELECT s.SCHEMA, s.NAME, o.OPTION_NAME, o.OPTION_VALUE
+FROM INFORMATION_SCHEMA.SEQUENCES AS s
+LEFT JOIN INFORMATION_SCHEMA.SEQUENCE_OPTIONS AS o
+  ON o.SCHEMA = s.SCHEMA AND o.NAME = s.NAME
+ORDER BY s.SCHEMA, s.NAME`)
+		return c.querySchema(ctx, stmt, func(row *spanner.Row) error {
+			var schema, name string
+			var option, value spanner.NullString
+			if err := row.Columns(&schema, &name, &option, &value); err != nil {
+				return err
+			}
+			name = qualifiedName(schema, name)
+			if n := len(seqs); n == 0 || seqs[n-1].Name != name {
+				seqs = append(seqs, Sequence{Name: name})
+			}
+			return seqs[len(seqs)-1].setOption(option.StringVal, value.StringVal)
+		})
+	})
+	return seqs, err
+}
+
+// setOption sets an option of INFORMATION_SCHEMA.SEQUENCE_OPTIONS.
+func (s *Sequence) setOption(name, value string) error {
+	var dst *int64
+	switch name {
+	case "sequence_kind":
+		s.Kind = value
+		return nil
+	case "start_with_counter":
+		dst = &s.StartWithCounter
+	case "skip_range_min":
+		dst = &s.SkipRangeMin
+	case "skip_range_max":
+		dst = &s.SkipRangeMax
+	default:
+		return nil
+	}
+	v, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("sequence %s: invalid %s %q", s.Name, name, value)
+	}
+	*dst = v
+	return nil
+}
@@ -0,0 +1,44 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"testing"
+)
+
+func TestSequenceOptions(t *testing.T) {
+	s := Sequence{Name: "Orders"}
+	for _, o := range [][2]string{
+		{"sequence_kind", "bit_reversed_positive"},
+		{"start_with_counter", "1000"},
+		{"skip_range_min", "1"},
+		{"skip_range_max", "99"},
+		{"unknown", "x"},
+	} {
+		if err := s.setOption(o[0], o[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := Sequence{Name: "Orders", Kind: "bit_reversed_positive", StartWithCounter: 1000, SkipRangeMin: 1, SkipRangeMax: 99}
+	if s != want {
+		t.Errorf("got %+v, want %+v", s, want)
+	}
+	if err := s.setOption("skip_range_min", "x"); err == nil {
+		t.Error("invalid option value: expected error")
+	}
+	if got, want := quoteIdentifier("sales.Orders"), "`sales`.`Orders`"; got != want {
+		t.Errorf("quoteIdentifier: got %q, want %q", got, want)
+	}
+}
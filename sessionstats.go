@@ -0,0 +1,183 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+)
+
+// SessionPoolStats contains the statistics of the sessions of the
+// client that the connections to a database share. They are counted
+// by the driver from the RPCs of the client and the transactions and
+// queries of the connections.
+type SessionPoolStats struct {
+	// Open is the number of sessions that were created
+	// and not deleted, including multiplexed sessions.
+	Open int64
+
+	// InUse is the number of transactions, open rows of queries
+	// and executing DML statements outside of transactions. Each
+	// holds a session, unless multiplexed sessions are used.
+	InUse int64
+
+	// Idle is the number of open sessions that are not in use.
+	Idle int64
+
+	// CreationFailures is the number of
+	// session creation RPCs that failed.
+	CreationFailures int64
+
+	// Acquired is the number of single-use queries, DML statements
+	// outside of transactions and read-write transactions that
+	// started, and AcquireWait is the total time that they waited
+	// for a session before their first RPC.
+	Acquired    int64
+	AcquireWait time.Duration
+}
+
+// sessionStats records SessionPoolStats
+// through the interceptors of transportStats.
+type sessionStats struct {
+	open             atomic.Int64
+	inUse            atomic.Int64
+	creationFailures atomic.Int64
+	acquired         atomic.Int64
+	acquireWait      atomic.Int64 // nanoseconds
+
+	// pooled is the number of sessions that were created for the
+	// session pool, and creationErr the error of the last session
+	// creation that failed. They are used to warm up the pool.
+	pooled      atomic.Int64
+	creationErr atomic.Pointer[error]
+}
+
+func (s *sessionStats) snapshot() SessionPoolStats {
+	stats := SessionPoolStats{
+		Open:             s.open.Load(),
+		InUse:            s.inUse.Load(),
+		CreationFailures: s.creationFailures.Load(),
+		Acquired:         s.acquired.Load(),
+		AcquireWait:      time.Duration(s.acquireWait.Load()),
+	}
+	stats.Idle = max(stats.Open-stats.InUse, 0)
+	return stats
+}
+
+// observe records the sessions that the RPC method created or deleted.
+func (s *sessionStats) observe(method string, reply interface{}, err error) {
+	switch method {
+	case "/google.spanner.v1.Spanner/CreateSession", "/google.spanner.v1.Spanner/BatchCreateSessions":
+		if err != nil {
+			s.creationFailures.Add(1)
+			s.creationErr.Store(&err)
+			return
+		}
+		if r, ok := reply.(*sppb.BatchCreateSessionsResponse); ok {
+			s.open.Add(int64(len(r.GetSession())))
+			s.pooled.Add(int64(len(r.GetSession())))
+		} else {
+			s.open.Add(1)
+		}
+	case "/google.spanner.v1.Spanner/DeleteSession":
+		if err == nil {
+			s.open.Add(-1)
+		}
+	}
+}
+
+// hold records a session that is in use until
+// the returned function is called.
+func (s *sessionStats) hold() (release func()) {
+	if s == nil {
+		return func() {}
+	}
+	s.inUse.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() { s.inUse.Add(-1) })
+	}
+}
+
+type sessionWaitKey struct{}
+
+// sessionWait measures the time from the start of an
+// operation that needs a session until its first RPC.
+type sessionWait struct {
+	stats *sessionStats
+	start time.Time
+	once  sync.Once
+}
+
+// withSessionWait returns a context whose first RPC records
+// the time that it waited for a session in s.
+func (s *sessionStats) withSessionWait(ctx context.Context) context.Context {
+	if s == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, sessionWaitKey{}, &sessionWait{stats: s, start: time.Now()})
+}
+
+// recordSessionWait records the session wait of the
+// operation of ctx when method is its first RPC.
+func recordSessionWait(ctx context.Context, method string) {
+	w, ok := ctx.Value(sessionWaitKey{}).(*sessionWait)
+	if !ok {
+		return
+	}
+	switch method {
+	case "/google.spanner.v1.Spanner/CreateSession", "/google.spanner.v1.Spanner/BatchCreateSessions":
+		return
+	}
+	w.once.Do(func() {
+		w.stats.acquired.Add(1)
+		w.stats.acquireWait.Add(int64(time.Since(w.start)))
+	})
+}
+
+// sessionStatsByDatabase returns the session statistics of
+// all clients, summed up by database.
+func sessionStatsByDatabase() map[string]SessionPoolStats {
+	clients.Lock()
+	defer clients.Unlock()
+	stats := make(map[string]SessionPoolStats)
+	for key, sc := range clients.m {
+		s := sc.stats.sessions.snapshot()
+		sum := stats[key.name]
+		sum.Open += s.Open
+		sum.InUse += s.InUse
+		sum.Idle += s.Idle
+		sum.CreationFailures += s.CreationFailures
+		sum.Acquired += s.Acquired
+		sum.AcquireWait += s.AcquireWait
+		stats[key.name] = sum
+	}
+	return stats
+}
+
+// PublishSessionPoolStats publishes the SessionPoolStats of all
+// databases that the process is connected to as an expvar variable
+// with the given name, keyed by database. Like expvar.Publish,
+// it panics if the name is already in use.
+func PublishSessionPoolStats(name string) {
+	expvar.Publish(name, expvar.Func(func() any {
+		return sessionStatsByDatabase()
+	}))
+}
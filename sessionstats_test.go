@@ -0,0 +1,78 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"strings"
+	"testing"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+)
+
+func TestSessionStatsObserve(t *testing.T) {
+	var s sessionStats
+	s.observe("/google.spanner.v1.Spanner/BatchCreateSessions", &sppb.BatchCreateSessionsResponse{Session: make([]*sppb.Session, 3)}, nil)
+	s.observe("/google.spanner.v1.Spanner/CreateSession", &sppb.Session{}, nil)
+	s.observe("/google.spanner.v1.Spanner/BatchCreateSessions", nil, errors.New("unavailable"))
+	s.observe("/google.spanner.v1.Spanner/DeleteSession", nil, nil)
+	release := s.hold()
+	release()
+	release()
+	defer s.hold()()
+
+	want := SessionPoolStats{Open: 3, InUse: 1, Idle: 2, CreationFailures: 1}
+	if got := s.snapshot(); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSessionPoolStats(t *testing.T) {
+	db := openFakeSpanner(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		return sendRow(stream)
+	}})
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	stats := func() (s SessionPoolStats) {
+		c.Raw(func(driverConn any) error {
+			s = driverConn.(SpannerConn).SessionPoolStats()
+			return nil
+		})
+		return s
+	}
+
+	rows, err := c.QueryContext(ctx, "SELECT Id FROM Singers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := stats(); s.InUse != 1 || s.Open < 1 || s.Acquired != 1 {
+		t.Errorf("with open rows: got %+v", s)
+	}
+	rows.Close()
+	if s := stats(); s.InUse != 0 || s.Idle != s.Open {
+		t.Errorf("after the rows were closed: got %+v", s)
+	}
+
+	PublishSessionPoolStats("spannerdriver_test_sessions")
+	if got := expvar.Get("spannerdriver_test_sessions").String(); !strings.Contains(got, `"projects/p/instances/i/databases/d":{"Open":`) {
+		t.Errorf("got expvar %s", got)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"log"
+	"log/slog"
+	"time"
+
+	"github.com/rakyll/go-sql-driver-spanner/internal"
+)
+
+// SlowQuery is a statement that took longer than the
+// slowQueryThreshold connection parameter, see Driver.OnSlowQuery.
+type SlowQuery struct {
+	// SQL is the statement with its literals replaced by ?.
+	SQL string
+	// Digest is the StatementDigest of the statement.
+	Digest string
+
+	Kind     StatementKind
+	Duration time.Duration
+
+	// TransactionType is single_use, read_only or read_write.
+	TransactionType string
+	// RequestTag is the tag of the statement, see WithRequestTag.
+	RequestTag string
+
+	// Err is the error of the statement, if it failed.
+	Err error
+}
+
+// reportSlowQuery passes q to the OnSlowQuery callback of the driver.
+// Without a callback, q is logged as a warning to the Logger of the
+// driver or, if it isn't set either, with the log package.
+func (c *conn) reportSlowQuery(ctx context.Context, q SlowQuery) {
+	switch {
+	case c.onSlowQuery != nil:
+		c.onSlowQuery(q)
+	case c.logger != nil:
+		attrs := []slog.Attr{
+			slog.String("sql", q.SQL),
+			slog.String("kind", q.Kind.String()),
+			slog.Duration("duration", q.Duration),
+			slog.String("transaction_type", q.TransactionType),
+		}
+		if q.Digest != "" {
+			attrs = append(attrs, slog.String("digest", q.Digest))
+		}
+		if q.RequestTag != "" {
+			attrs = append(attrs, slog.String("request_tag", q.RequestTag))
+		}
+		if q.Err != nil {
+			attrs = append(attrs, slog.String("error", q.Err.Error()))
+		}
+		c.logger.LogAttrs(ctx, slog.LevelWarn, "spanner slow statement", attrs...)
+	default:
+		log.Printf("spannerdriver: %s in %s transaction took %v: %s", q.Kind, q.TransactionType, q.Duration.Round(time.Millisecond), q.SQL)
+	}
+}
+
+// slowQuery returns the SlowQuery of a statement
+// that was logged with l and took d.
+func (l *statementLog) slowQuery(d time.Duration, err error) SlowQuery {
+	return SlowQuery{
+		SQL:             internal.RedactLiterals(l.query),
+		Digest:          StatementDigest(l.query),
+		Kind:            l.kind,
+		Duration:        d,
+		TransactionType: l.txType,
+		RequestTag:      l.tag,
+		Err:             err,
+	}
+}
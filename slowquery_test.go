@@ -0,0 +1,70 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+)
+
+func TestSlowQuery(t *testing.T) {
+	var slow []SlowQuery
+	db := openFakeSpannerWithDriver(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		if strings.Contains(req.Sql, "Slow") {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return sendRow(stream)
+	}}, &Driver{OnSlowQuery: func(q SlowQuery) { slow = append(slow, q) }})
+
+	ctx := WithRequestTag(context.Background(), "app=test")
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Raw(func(driverConn any) error {
+		driverConn.(*conn).slowQueryThreshold = 10 * time.Millisecond
+		return nil
+	})
+	var id int64
+	for _, q := range []string{"SELECT Id FROM Fast WHERE Name = 'Alice'", "SELECT Id FROM Slow WHERE Name = 'Alice'"} {
+		if err := c.QueryRowContext(ctx, q).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(slow) != 1 {
+		t.Fatalf("got %d slow queries, want 1", len(slow))
+	}
+	q := slow[0]
+	if q.SQL != "SELECT Id FROM Slow WHERE Name = ?" || q.Digest != StatementDigest(q.SQL) || q.Kind != StatementKindQuery || q.Duration < 10*time.Millisecond ||
+		q.TransactionType != txTypeSingleUse || q.RequestTag != "app=test" || q.Err != nil {
+		t.Errorf("got %+v", q)
+	}
+}
+
+func TestLogSlowQuery(t *testing.T) {
+	var out syncBuffer
+	c := &conn{logger: slog.New(slog.NewTextHandler(&out, nil))}
+	c.reportSlowQuery(context.Background(), SlowQuery{SQL: "SELECT ?", Kind: StatementKindQuery, Duration: time.Second, TransactionType: txTypeReadOnly})
+	if got, want := out.String(), `level=WARN msg="spanner slow statement" sql="SELECT ?" kind=Query duration=1s transaction_type=read_only`; !strings.Contains(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
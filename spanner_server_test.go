@@ -0,0 +1,211 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/longrunning/autogen/longrunningpb"
+	"cloud.google.com/go/spanner"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeSpanner is a Spanner server that creates sessions and streams
+// the results of queries with a function of the test, so that the
+// driver can be tested without an emulator.
+type fakeSpanner struct {
+	sppb.UnimplementedSpannerServer
+
+	query func(*sppb.ExecuteSqlRequest, sppb.Spanner_ExecuteStreamingSqlServer) error
+
+	// update, if set, executes the DML statements of
+	// read-write transactions.
+	update func(*sppb.ExecuteSqlRequest) (*sppb.ResultSet, error)
+
+	// batchUpdate, if set, executes batches of DML statements.
+	batchUpdate func(*sppb.ExecuteBatchDmlRequest) (*sppb.ExecuteBatchDmlResponse, error)
+
+	// commit, if set, commits read-write transactions.
+	commit func(*sppb.CommitRequest) (*sppb.CommitResponse, error)
+
+	// partitions is the number of partitions of partitioned
+	// queries. The partition tokens are "0", "1" and so on.
+	partitions int
+
+	// dialect, if set, is the database dialect that the server
+	// returns to the driver, e.g. POSTGRESQL. Otherwise the
+	// database is opened with dialect=googlesql.
+	dialect string
+
+	// createSessions, if set, is called before the sessions
+	// of a BatchCreateSessions request are created.
+	createSessions func(*sppb.BatchCreateSessionsRequest) error
+
+	// admin, if set, serves the database admin API.
+	admin *fakeDatabaseAdmin
+
+	mu       sync.Mutex
+	sessions int
+}
+
+// openFakeSpanner starts the server s and opens a database on it.
+func openFakeSpanner(t *testing.T, s *fakeSpanner) *sql.DB {
+	return openFakeSpannerWithDriver(t, s, &Driver{})
+}
+
+// openFakeSpannerWithDriver starts the server s and opens
+// a database on it with the driver d.
+func openFakeSpannerWithDriver(t *testing.T, s *fakeSpanner, d *Driver) *sql.DB {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	sppb.RegisterSpannerServer(srv, s)
+	if s.admin != nil {
+		adminpb.RegisterDatabaseAdminServer(srv, s.admin)
+	}
+	go srv.Serve(lis)
+	t.Setenv("SPANNER_EMULATOR_HOST", lis.Addr().String())
+
+	d.Config.SessionPoolConfig = spanner.SessionPoolConfig{MinOpened: 0}
+	dsn := "projects/p/instances/i/databases/d"
+	if s.dialect == "" {
+		dsn += ";dialect=googlesql"
+	}
+	connector, err := d.OpenConnector(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(connector)
+	t.Cleanup(func() {
+		db.Close()
+		srv.Stop()
+	})
+	return db
+}
+
+// fakeDatabaseAdmin is a database admin server that records the
+// databases that are created and dropped.
+type fakeDatabaseAdmin struct {
+	adminpb.UnimplementedDatabaseAdminServer
+
+	mu      sync.Mutex
+	created []*adminpb.CreateDatabaseRequest
+	dropped []string
+}
+
+func (a *fakeDatabaseAdmin) CreateDatabase(ctx context.Context, req *adminpb.CreateDatabaseRequest) (*longrunningpb.Operation, error) {
+	a.mu.Lock()
+	a.created = append(a.created, req)
+	a.mu.Unlock()
+	resp, err := anypb.New(&adminpb.Database{State: adminpb.Database_READY, DatabaseDialect: req.DatabaseDialect})
+	if err != nil {
+		return nil, err
+	}
+	return &longrunningpb.Operation{Name: "operations/create", Done: true, Result: &longrunningpb.Operation_Response{Response: resp}}, nil
+}
+
+func (a *fakeDatabaseAdmin) DropDatabase(ctx context.Context, req *adminpb.DropDatabaseRequest) (*emptypb.Empty, error) {
+	a.mu.Lock()
+	a.dropped = append(a.dropped, req.Database)
+	a.mu.Unlock()
+	return &emptypb.Empty{}, nil
+}
+
+func (s *fakeSpanner) newSession(database string, multiplexed bool) *sppb.Session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions++
+	return &sppb.Session{Name: fmt.Sprintf("%s/sessions/%d", database, s.sessions), Multiplexed: multiplexed}
+}
+
+func (s *fakeSpanner) CreateSession(ctx context.Context, req *sppb.CreateSessionRequest) (*sppb.Session, error) {
+	return s.newSession(req.Database, req.GetSession().GetMultiplexed()), nil
+}
+
+func (s *fakeSpanner) BatchCreateSessions(ctx context.Context, req *sppb.BatchCreateSessionsRequest) (*sppb.BatchCreateSessionsResponse, error) {
+	if s.createSessions != nil {
+		if err := s.createSessions(req); err != nil {
+			return nil, err
+		}
+	}
+	resp := &sppb.BatchCreateSessionsResponse{}
+	for i := int32(0); i < req.SessionCount; i++ {
+		resp.Session = append(resp.Session, s.newSession(req.Database, false))
+	}
+	return resp, nil
+}
+
+func (s *fakeSpanner) DeleteSession(ctx context.Context, req *sppb.DeleteSessionRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, nil
+}
+
+func (s *fakeSpanner) BeginTransaction(ctx context.Context, req *sppb.BeginTransactionRequest) (*sppb.Transaction, error) {
+	return &sppb.Transaction{Id: []byte("tx"), ReadTimestamp: timestamppb.Now()}, nil
+}
+
+func (s *fakeSpanner) Commit(ctx context.Context, req *sppb.CommitRequest) (*sppb.CommitResponse, error) {
+	if s.commit != nil {
+		return s.commit(req)
+	}
+	return &sppb.CommitResponse{CommitTimestamp: timestamppb.Now()}, nil
+}
+
+func (s *fakeSpanner) PartitionQuery(ctx context.Context, req *sppb.PartitionQueryRequest) (*sppb.PartitionResponse, error) {
+	resp := &sppb.PartitionResponse{Transaction: &sppb.Transaction{Id: req.GetTransaction().GetId()}}
+	for i := 0; i < s.partitions; i++ {
+		resp.Partitions = append(resp.Partitions, &sppb.Partition{PartitionToken: []byte(strconv.Itoa(i))})
+	}
+	return resp, nil
+}
+
+func (s *fakeSpanner) ExecuteSql(ctx context.Context, req *sppb.ExecuteSqlRequest) (*sppb.ResultSet, error) {
+	if s.update == nil {
+		return s.UnimplementedSpannerServer.ExecuteSql(ctx, req)
+	}
+	return s.update(req)
+}
+
+func (s *fakeSpanner) ExecuteBatchDml(ctx context.Context, req *sppb.ExecuteBatchDmlRequest) (*sppb.ExecuteBatchDmlResponse, error) {
+	if s.batchUpdate == nil {
+		return s.UnimplementedSpannerServer.ExecuteBatchDml(ctx, req)
+	}
+	return s.batchUpdate(req)
+}
+
+func (s *fakeSpanner) ExecuteStreamingSql(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+	if s.dialect != "" && req.GetSql() == dialectQuery {
+		return stream.Send(&sppb.PartialResultSet{
+			Metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{Fields: []*sppb.StructType_Field{
+				{Name: "option_value", Type: &sppb.Type{Code: sppb.TypeCode_STRING}},
+			}}},
+			Values: []*structpb.Value{structpb.NewStringValue(s.dialect)},
+		})
+	}
+	return s.query(req, stream)
+}
@@ -0,0 +1,280 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spanneratlas
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"ariga.io/atlas/sql/migrate"
+	"ariga.io/atlas/sql/schema"
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+	spannerschema "github.com/rakyll/go-sql-driver-spanner/schema"
+)
+
+var _ migrate.PlanApplier = (*Driver)(nil)
+
+// PlanChanges returns the DDL statements of changes. Spanner can't
+// apply DDL transactionally, so the plan isn't transactional.
+func (d *Driver) PlanChanges(ctx context.Context, name string, changes []schema.Change, opts ...migrate.PlanOption) (*migrate.Plan, error) {
+	plan := &migrate.Plan{Name: name, Delimiter: ";"}
+	for _, c := range changes {
+		statements, err := statementsOf(c)
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range statements {
+			plan.Changes = append(plan.Changes, &migrate.Change{Cmd: s, Source: c})
+		}
+	}
+	return plan, nil
+}
+
+// ApplyChanges applies changes in one DDL batch.
+func (d *Driver) ApplyChanges(ctx context.Context, changes []schema.Change, opts ...migrate.PlanOption) error {
+	plan, err := d.PlanChanges(ctx, "apply", changes, opts...)
+	if err != nil || len(plan.Changes) == 0 {
+		return err
+	}
+	statements := make([]string, len(plan.Changes))
+	for i, c := range plan.Changes {
+		statements[i] = c.Cmd
+	}
+	return spannerdriver.ExecDDL(ctx, d.db, statements...)
+}
+
+// statementsOf returns the DDL statements of the change c.
+func statementsOf(c schema.Change) ([]string, error) {
+	switch c := c.(type) {
+	case *schema.AddSchema:
+		return []string{"CREATE SCHEMA " + quote(c.S.Name)}, nil
+	case *schema.DropSchema:
+		return []string{"DROP SCHEMA " + quote(c.S.Name)}, nil
+	case *schema.AddTable:
+		t := Table(c.T)
+		statements := []string{spannerschema.CreateTable(t)}
+		for _, idx := range t.Indexes {
+			statements = append(statements, spannerschema.CreateIndex(t.Name, idx))
+		}
+		for _, chk := range t.CheckConstraints {
+			statements = append(statements, addCheck(t.Name, chk))
+		}
+		for _, fk := range t.ForeignKeys {
+			statements = append(statements, spannerschema.AddForeignKey(t.Name, fk))
+		}
+		return statements, nil
+	case *schema.DropTable:
+		var statements []string
+		for _, idx := range c.T.Indexes {
+			statements = append(statements, "DROP INDEX "+quote(idx.Name))
+		}
+		return append(statements, "DROP TABLE "+quote(tableName(c.T))), nil
+	case *schema.ModifyTable:
+		var statements []string
+		for _, tc := range c.Changes {
+			s, err := tableStatementsOf(c.T, tc)
+			if err != nil {
+				return nil, err
+			}
+			statements = append(statements, s...)
+		}
+		return statements, nil
+	}
+	return nil, fmt.Errorf("spanner: unsupported change %T", c)
+}
+
+// tableStatementsOf returns the DDL statements
+// of the change c of the table t.
+func tableStatementsOf(t *schema.Table, c schema.Change) ([]string, error) {
+	name := tableName(t)
+	switch c := c.(type) {
+	case *schema.AddColumn:
+		return []string{fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", quote(name), spannerschema.ColumnDefinition(Column(c.C)))}, nil
+	case *schema.DropColumn:
+		return []string{fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", quote(name), quote(c.C.Name))}, nil
+	case *schema.ModifyColumn:
+		col := Column(c.To)
+		if col.Generated != "" {
+			return nil, fmt.Errorf("spanner: generated column %s.%s can't be altered", name, col.Name)
+		}
+		// The type and the nullability are altered without
+		// the default, which is set separately.
+		def := col.Default
+		col.Default, col.Identity = "", false
+		statements := []string{fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s", quote(name), spannerschema.ColumnDefinition(col))}
+		switch {
+		case c.Change.Is(schema.ChangeDefault) && def != "":
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT (%s)", quote(name), quote(col.Name), def))
+		case c.Change.Is(schema.ChangeDefault):
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT", quote(name), quote(col.Name)))
+		}
+		return statements, nil
+	case *schema.AddIndex:
+		return []string{spannerschema.CreateIndex(name, index(c.I))}, nil
+	case *schema.DropIndex:
+		return []string{"DROP INDEX " + quote(c.I.Name)}, nil
+	case *schema.ModifyIndex:
+		return []string{"DROP INDEX " + quote(c.From.Name), spannerschema.CreateIndex(name, index(c.To))}, nil
+	case *schema.AddForeignKey:
+		return []string{spannerschema.AddForeignKey(name, foreignKey(c.F))}, nil
+	case *schema.DropForeignKey:
+		return []string{fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", quote(name), quote(c.F.Symbol))}, nil
+	case *schema.AddCheck:
+		return []string{addCheck(name, spannerdriver.CheckConstraint{Name: c.C.Name, Expression: c.C.Expr})}, nil
+	case *schema.DropCheck:
+		return []string{fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", quote(name), quote(c.C.Name))}, nil
+	}
+	return nil, fmt.Errorf("spanner: unsupported change %T of table %s", c, name)
+}
+
+// Table returns the Spanner table of the Atlas table t.
+func Table(t *schema.Table) spannerdriver.Table {
+	table := spannerdriver.Table{Name: tableName(t)}
+	for _, col := range t.Columns {
+		table.Columns = append(table.Columns, Column(col))
+	}
+	if t.PrimaryKey != nil {
+		table.PrimaryKey = keyColumns(t.PrimaryKey)
+	}
+	for _, idx := range t.Indexes {
+		table.Indexes = append(table.Indexes, index(idx))
+	}
+	for _, fk := range t.ForeignKeys {
+		table.ForeignKeys = append(table.ForeignKeys, foreignKey(fk))
+	}
+	for _, attr := range t.Attrs {
+		switch a := attr.(type) {
+		case *Interleave:
+			table.ParentTable, table.OnDeleteCascade = a.Parent, a.OnDeleteCascade
+		case *schema.Check:
+			table.CheckConstraints = append(table.CheckConstraints, spannerdriver.CheckConstraint{Name: a.Name, Expression: a.Expr})
+		}
+	}
+	return table
+}
+
+// Column returns the Spanner column of the Atlas column c.
+func Column(c *schema.Column) spannerdriver.Column {
+	col := spannerdriver.Column{Name: c.Name}
+	if c.Type != nil {
+		col.Type = spannerType(c.Type)
+		col.Nullable = c.Type.Null
+	}
+	switch x := c.Default.(type) {
+	case *schema.RawExpr:
+		col.Default = x.X
+	case *schema.Literal:
+		col.Default = x.V
+	}
+	for _, attr := range c.Attrs {
+		switch a := attr.(type) {
+		case *schema.GeneratedExpr:
+			col.Generated = a.Expr
+		case *Identity:
+			col.Identity = true
+		}
+	}
+	return col
+}
+
+// spannerType returns the Spanner type of the column type ct.
+func spannerType(ct *schema.ColumnType) string {
+	switch t := ct.Type.(type) {
+	case *schema.BoolType:
+		return "BOOL"
+	case *schema.IntegerType:
+		return "INT64"
+	case *schema.FloatType:
+		if strings.EqualFold(t.T, "FLOAT32") {
+			return "FLOAT32"
+		}
+		return "FLOAT64"
+	case *schema.DecimalType:
+		return "NUMERIC"
+	case *schema.StringType:
+		if t.Size > 0 {
+			return fmt.Sprintf("STRING(%d)", t.Size)
+		}
+		return "STRING(MAX)"
+	case *schema.BinaryType:
+		if t.Size != nil && *t.Size > 0 {
+			return fmt.Sprintf("BYTES(%d)", *t.Size)
+		}
+		return "BYTES(MAX)"
+	case *schema.TimeType:
+		if strings.EqualFold(t.T, "DATE") {
+			return "DATE"
+		}
+		return "TIMESTAMP"
+	case *schema.JSONType:
+		return "JSON"
+	case *schema.UnsupportedType:
+		return t.T
+	}
+	return ct.Raw
+}
+
+func index(idx *schema.Index) spannerdriver.Index {
+	return spannerdriver.Index{Name: idx.Name, Unique: idx.Unique, Columns: keyColumns(idx)}
+}
+
+func keyColumns(idx *schema.Index) []spannerdriver.IndexColumn {
+	var cols []spannerdriver.IndexColumn
+	for _, part := range idx.Parts {
+		if part.C != nil {
+			cols = append(cols, spannerdriver.IndexColumn{Name: part.C.Name, Descending: part.Desc})
+		}
+	}
+	return cols
+}
+
+func foreignKey(fk *schema.ForeignKey) spannerdriver.ForeignKey {
+	f := spannerdriver.ForeignKey{
+		Name:            fk.Symbol,
+		ReferencedTable: tableName(fk.RefTable),
+		OnDeleteCascade: fk.OnDelete == schema.Cascade,
+	}
+	for _, col := range fk.Columns {
+		f.Columns = append(f.Columns, col.Name)
+	}
+	for _, col := range fk.RefColumns {
+		f.ReferencedColumns = append(f.ReferencedColumns, col.Name)
+	}
+	return f
+}
+
+func addCheck(table string, chk spannerdriver.CheckConstraint) string {
+	return fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s)", quote(table), quote(chk.Name), chk.Expression)
+}
+
+// tableName returns the name of t, qualified with its
+// schema if it isn't in the default schema.
+func tableName(t *schema.Table) string {
+	if t.Schema != nil && t.Schema.Name != "" {
+		return t.Schema.Name + "." + t.Name
+	}
+	return t.Name
+}
+
+// quote quotes an identifier, and each part
+// of a name that is qualified with a schema.
+func quote(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = "`" + p + "`"
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,259 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package spanneratlas inspects and changes the schema of Spanner
+// databases for Atlas (ariga.io/atlas), so that declarative schema
+// management tools can drive Spanner through the database/sql driver:
+//
+//	drv := spanneratlas.Open(db)
+//	current, err := drv.InspectSchema(ctx, "", nil)
+//	...
+//	changes, err := differ.SchemaDiff(current, desired)
+//	...
+//	err = drv.ApplyChanges(ctx, changes)
+//
+// Columns are described with the Atlas types that match their Spanner
+// types, and the Raw type of each column is the Spanner type, such as
+// STRING(MAX) or ARRAY<INT64>. Interleaved tables have an Interleave
+// attribute, and identity columns an Identity attribute. The changes
+// are applied in one DDL batch.
+package spanneratlas
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"ariga.io/atlas/sql/schema"
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+)
+
+// Interleave is the attribute of tables that are interleaved
+// in a parent table.
+type Interleave struct {
+	schema.Attr
+	Parent string
+	// OnDeleteCascade is set if rows are deleted
+	// along with the parent row.
+	OnDeleteCascade bool
+}
+
+// Identity is the attribute of identity columns, whose values
+// Spanner generates with a bit-reversed sequence.
+type Identity struct {
+	schema.Attr
+}
+
+// Driver inspects and changes the schema of a Spanner database.
+type Driver struct {
+	schema.ExecQuerier
+	db *sql.DB
+}
+
+var _ schema.Inspector = (*Driver)(nil)
+
+// Open returns a driver of the database of db.
+func Open(db *sql.DB) *Driver {
+	return &Driver{ExecQuerier: db, db: db}
+}
+
+// InspectSchema returns the schema with the given name,
+// or the default schema if name is empty.
+func (d *Driver) InspectSchema(ctx context.Context, name string, opts *schema.InspectOptions) (*schema.Schema, error) {
+	realm, err := d.inspect(ctx, []string{name}, opts)
+	if err != nil {
+		return nil, err
+	}
+	if len(realm.Schemas) == 0 {
+		return nil, &schema.NotExistError{Err: fmt.Errorf("spanner: schema %q was not found", name)}
+	}
+	return realm.Schemas[0], nil
+}
+
+// InspectRealm returns the schemas of the database.
+func (d *Driver) InspectRealm(ctx context.Context, opts *schema.InspectRealmOption) (*schema.Realm, error) {
+	if opts == nil {
+		opts = &schema.InspectRealmOption{}
+	}
+	return d.inspect(ctx, opts.Schemas, nil)
+}
+
+// inspect returns the realm of the schemas with the given names,
+// or of all schemas if names is empty.
+func (d *Driver) inspect(ctx context.Context, names []string, opts *schema.InspectOptions) (*schema.Realm, error) {
+	tableNames, err := spannerdriver.ListTables(ctx, d.db)
+	if err != nil {
+		return nil, err
+	}
+	var tables []spannerdriver.Table
+	for _, name := range tableNames {
+		s, t := splitQualifiedName(name)
+		if len(names) > 0 && !contains(names, s) || opts != nil && len(opts.Tables) > 0 && !contains(opts.Tables, t) {
+			continue
+		}
+		table, err := spannerdriver.DescribeTable(ctx, d.db, name)
+		if err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	realm := Realm(tables)
+	// The default schema exists even if it has no tables.
+	if len(realm.Schemas) == 0 && (len(names) == 0 || contains(names, "")) {
+		realm.AddSchemas(schema.New(""))
+	}
+	return realm, nil
+}
+
+// Realm returns the Atlas realm of tables, with one schema per
+// schema of the tables. Tables of the default schema are in the
+// schema with the empty name.
+func Realm(tables []spannerdriver.Table) *schema.Realm {
+	realm := schema.NewRealm()
+	byName := make(map[string]*schema.Table)
+	for _, t := range tables {
+		name, table := splitQualifiedName(t.Name)
+		s, ok := realm.Schema(name)
+		if !ok {
+			s = schema.New(name)
+			realm.AddSchemas(s)
+		}
+		at := schema.NewTable(table)
+		s.AddTables(at)
+		byName[strings.ToUpper(t.Name)] = at
+		for _, col := range t.Columns {
+			at.AddColumns(column(col))
+		}
+		var pk []*schema.Column
+		for _, key := range t.PrimaryKey {
+			if col, ok := at.Column(key.Name); ok {
+				pk = append(pk, col)
+			}
+		}
+		at.SetPrimaryKey(schema.NewPrimaryKey(pk...))
+		for i, key := range t.PrimaryKey {
+			at.PrimaryKey.Parts[i].Desc = key.Descending
+		}
+		for _, idx := range t.Indexes {
+			ai := schema.NewIndex(idx.Name).SetUnique(idx.Unique)
+			for _, key := range idx.Columns {
+				if col, ok := at.Column(key.Name); ok {
+					ai.AddParts(&schema.IndexPart{C: col, Desc: key.Descending})
+				}
+			}
+			at.AddIndexes(ai)
+		}
+		for _, chk := range t.CheckConstraints {
+			at.AddChecks(&schema.Check{Name: chk.Name, Expr: chk.Expression})
+		}
+		if t.ParentTable != "" {
+			at.AddAttrs(&Interleave{Parent: t.ParentTable, OnDeleteCascade: t.OnDeleteCascade})
+		}
+	}
+	// Foreign keys are added once all tables exist.
+	for _, t := range tables {
+		at := byName[strings.ToUpper(t.Name)]
+		for _, fk := range t.ForeignKeys {
+			ref, ok := byName[strings.ToUpper(fk.ReferencedTable)]
+			if !ok {
+				continue
+			}
+			afk := schema.NewForeignKey(fk.Name).SetRefTable(ref).SetOnDelete(schema.NoAction)
+			if fk.OnDeleteCascade {
+				afk.SetOnDelete(schema.Cascade)
+			}
+			for _, name := range fk.Columns {
+				if col, ok := at.Column(name); ok {
+					afk.AddColumns(col)
+				}
+			}
+			for _, name := range fk.ReferencedColumns {
+				if col, ok := ref.Column(name); ok {
+					afk.AddRefColumns(col)
+				}
+			}
+			at.AddForeignKeys(afk)
+		}
+	}
+	return realm
+}
+
+// column returns the Atlas column of col.
+func column(col spannerdriver.Column) *schema.Column {
+	c := schema.NewColumn(col.Name)
+	c.Type = &schema.ColumnType{Type: atlasType(col.Type), Raw: col.Type, Null: col.Nullable}
+	if col.Default != "" {
+		c.Default = &schema.RawExpr{X: col.Default}
+	}
+	if col.Generated != "" {
+		c.AddAttrs(&schema.GeneratedExpr{Expr: col.Generated, Type: "STORED"})
+	}
+	if col.Identity {
+		c.AddAttrs(&Identity{})
+	}
+	return c
+}
+
+var sizedTypeRe = regexp.MustCompile(`^(STRING|BYTES)\((\d+|MAX)\)$`)
+
+// atlasType returns the Atlas type of the Spanner type t.
+func atlasType(t string) schema.Type {
+	upper := strings.ToUpper(strings.Join(strings.Fields(t), ""))
+	if m := sizedTypeRe.FindStringSubmatch(upper); m != nil {
+		size, _ := strconv.Atoi(m[2]) // MAX is size 0.
+		if m[1] == "STRING" {
+			return &schema.StringType{T: "STRING", Size: size}
+		}
+		if size == 0 {
+			return &schema.BinaryType{T: "BYTES"}
+		}
+		return &schema.BinaryType{T: "BYTES", Size: &size}
+	}
+	switch upper {
+	case "BOOL":
+		return &schema.BoolType{T: upper}
+	case "INT64":
+		return &schema.IntegerType{T: upper}
+	case "FLOAT32", "FLOAT64":
+		return &schema.FloatType{T: upper}
+	case "NUMERIC":
+		return &schema.DecimalType{T: upper}
+	case "DATE", "TIMESTAMP":
+		return &schema.TimeType{T: upper}
+	case "JSON":
+		return &schema.JSONType{T: upper}
+	}
+	return &schema.UnsupportedType{T: t}
+}
+
+// splitQualifiedName splits a table name into
+// its schema, which may be empty, and its name.
+func splitQualifiedName(name string) (string, string) {
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
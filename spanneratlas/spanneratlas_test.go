@@ -0,0 +1,118 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spanneratlas
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"ariga.io/atlas/sql/schema"
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+)
+
+var testTables = []spannerdriver.Table{
+	{
+		Name: "Singers",
+		Columns: []spannerdriver.Column{
+			{Name: "Id", Type: "INT64", Identity: true},
+			{Name: "Name", Type: "STRING(100)", Nullable: true},
+			{Name: "Tags", Type: "ARRAY<STRING(MAX)>", Nullable: true},
+		},
+		PrimaryKey: []spannerdriver.IndexColumn{{Name: "Id"}},
+		Indexes: []spannerdriver.Index{
+			{Name: "SingersByName", Unique: true, Columns: []spannerdriver.IndexColumn{{Name: "Name", Descending: true}}},
+		},
+	},
+	{
+		Name: "music.Albums",
+		Columns: []spannerdriver.Column{
+			{Name: "SingerId", Type: "INT64"},
+			{Name: "Id", Type: "INT64"},
+			{Name: "Cover", Type: "BYTES(1024)", Nullable: true},
+			{Name: "ReleasedAt", Type: "TIMESTAMP", Default: "CURRENT_TIMESTAMP()"},
+		},
+		PrimaryKey:  []spannerdriver.IndexColumn{{Name: "SingerId"}, {Name: "Id"}},
+		ForeignKeys: []spannerdriver.ForeignKey{{Name: "FK_Albums_Singers", Columns: []string{"SingerId"}, ReferencedTable: "Singers", ReferencedColumns: []string{"Id"}}},
+	},
+}
+
+func TestRealm(t *testing.T) {
+	realm := Realm(testTables)
+	if len(realm.Schemas) != 2 {
+		t.Fatalf("got %d schemas, want 2", len(realm.Schemas))
+	}
+	singers, ok := realm.Schemas[0].Table("Singers")
+	if !ok {
+		t.Fatal("missing table Singers")
+	}
+	name, _ := singers.Column("Name")
+	if st, ok := name.Type.Type.(*schema.StringType); !ok || st.Size != 100 || name.Type.Raw != "STRING(100)" || !name.Type.Null {
+		t.Errorf("got column type %+v", name.Type)
+	}
+
+	var got []spannerdriver.Table
+	for _, s := range realm.Schemas {
+		for _, at := range s.Tables {
+			got = append(got, Table(at))
+		}
+	}
+	if !reflect.DeepEqual(got, testTables) {
+		t.Errorf("got  %+v\nwant %+v", got, testTables)
+	}
+}
+
+func TestPlanChanges(t *testing.T) {
+	realm := Realm(testTables)
+	singers, _ := realm.Schemas[0].Table("Singers")
+	albums, _ := realm.Schemas[1].Table("Albums")
+	name, _ := singers.Column("Name")
+	longName := schema.NewNullStringColumn("Name", "STRING", schema.StringSize(200))
+	changes := []schema.Change{
+		&schema.AddTable{T: albums},
+		&schema.ModifyTable{T: singers, Changes: []schema.Change{
+			&schema.AddColumn{C: schema.NewNullBoolColumn("Active", "BOOL")},
+			&schema.ModifyColumn{From: name, To: longName, Change: schema.ChangeType},
+			&schema.DropIndex{I: singers.Indexes[0]},
+		}},
+	}
+	plan, err := (&Driver{}).PlanChanges(context.Background(), "test", changes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range plan.Changes {
+		got = append(got, c.Cmd)
+	}
+	want := []string{
+		"CREATE TABLE `music`.`Albums` (\n" +
+			"  `SingerId` INT64 NOT NULL,\n" +
+			"  `Id` INT64 NOT NULL,\n" +
+			"  `Cover` BYTES(1024),\n" +
+			"  `ReleasedAt` TIMESTAMP NOT NULL DEFAULT (CURRENT_TIMESTAMP()),\n" +
+			") PRIMARY KEY (`SingerId`, `Id`)",
+		"ALTER TABLE `music`.`Albums` ADD CONSTRAINT `FK_Albums_Singers` FOREIGN KEY (`SingerId`) REFERENCES `Singers` (`Id`)",
+		"ALTER TABLE `Singers` ADD COLUMN `Active` BOOL",
+		"ALTER TABLE `Singers` ALTER COLUMN `Name` STRING(200)",
+		"DROP INDEX `SingersByName`",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %q\nwant %q", got, want)
+	}
+
+	if _, err := (&Driver{}).PlanChanges(context.Background(), "test", []schema.Change{&schema.RenameTable{From: singers, To: singers}}); err == nil {
+		t.Error("RenameTable: expected error")
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package spannercontainer starts the Spanner emulator in a container
+// with testcontainers, so that integration tests are hermetic:
+//
+//	func TestSingers(t *testing.T) {
+//		db := spannercontainer.OpenDB(t, spannercontainer.Config{
+//			DDL: []string{"CREATE TABLE Singers (Id INT64, Name STRING(MAX)) PRIMARY KEY (Id)"},
+//		})
+//		...
+//	}
+//
+// Docker, or another container runtime that testcontainers supports,
+// must be available.
+package spannercontainer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	adminpb "cloud.google.com/go/spanner/admin/database/apiv1/databasepb"
+	instance "cloud.google.com/go/spanner/admin/instance/apiv1"
+	instancepb "cloud.google.com/go/spanner/admin/instance/apiv1/instancepb"
+	_ "github.com/rakyll/go-sql-driver-spanner"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/wait"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// DefaultImage is the emulator image that is started
+// if Config.Image is empty.
+const DefaultImage = "gcr.io/cloud-spanner-emulator/emulator:latest"
+
+const grpcPort = "9010/tcp"
+
+// Config configures the emulator and the database that is created in it.
+type Config struct {
+	// Image is the emulator image, DefaultImage if empty.
+	Image string
+
+	// Project, Instance and Database name the database, test-project,
+	// test-instance and test-database if empty.
+	Project  string
+	Instance string
+	Database string
+
+	// DDL are the statements that the database is created with.
+	DDL []string
+}
+
+func (c Config) withDefaults() Config {
+	if c.Image == "" {
+		c.Image = DefaultImage
+	}
+	if c.Project == "" {
+		c.Project = "test-project"
+	}
+	if c.Instance == "" {
+		c.Instance = "test-instance"
+	}
+	if c.Database == "" {
+		c.Database = "test-database"
+	}
+	return c
+}
+
+// Emulator is an emulator that runs in a container.
+type Emulator struct {
+	// Host is the address of the gRPC endpoint of the emulator,
+	// which SPANNER_EMULATOR_HOST must be set to for the driver
+	// to connect to it.
+	Host string
+
+	// DSN is the data source name of the database.
+	DSN string
+
+	container testcontainers.Container
+}
+
+// Run starts the emulator, and creates the instance and the database
+// of config in it. The emulator must be terminated when it is no
+// longer needed.
+func Run(ctx context.Context, config Config) (*Emulator, error) {
+	config = config.withDefaults()
+	c, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
+		ContainerRequest: testcontainers.ContainerRequest{
+			Image:        config.Image,
+			ExposedPorts: []string{grpcPort},
+			WaitingFor:   wait.ForListeningPort(grpcPort),
+		},
+		Started: true,
+	})
+	if err != nil {
+		if c != nil {
+			c.Terminate(ctx)
+		}
+		return nil, fmt.Errorf("start emulator: %v", err)
+	}
+	e := &Emulator{container: c}
+	e.Host, err = c.PortEndpoint(ctx, grpcPort, "")
+	if err == nil {
+		e.DSN, err = e.createDatabase(ctx, config)
+	}
+	if err != nil {
+		c.Terminate(ctx)
+		return nil, err
+	}
+	return e, nil
+}
+
+// Terminate stops and removes the container of the emulator.
+func (e *Emulator) Terminate(ctx context.Context) error {
+	return e.container.Terminate(ctx)
+}
+
+// createDatabase creates the instance and the database
+// of config, and returns the name of the database.
+func (e *Emulator) createDatabase(ctx context.Context, config Config) (string, error) {
+	opts := []option.ClientOption{
+		option.WithEndpoint(e.Host),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}
+	project := "projects/" + config.Project
+	ic, err := instance.NewInstanceAdminClient(ctx, opts...)
+	if err != nil {
+		return "", err
+	}
+	defer ic.Close()
+	iop, err := ic.CreateInstance(ctx, &instancepb.CreateInstanceRequest{
+		Parent:     project,
+		InstanceId: config.Instance,
+		Instance: &instancepb.Instance{
+			Config:      project + "/instanceConfigs/emulator-config",
+			DisplayName: config.Instance,
+			NodeCount:   1,
+		},
+	})
+	if err == nil {
+		_, err = iop.Wait(ctx)
+	}
+	if err != nil {
+		return "", fmt.Errorf("create instance: %v", err)
+	}
+
+	dc, err := database.NewDatabaseAdminClient(ctx, opts...)
+	if err != nil {
+		return "", err
+	}
+	defer dc.Close()
+	dop, err := dc.CreateDatabase(ctx, &adminpb.CreateDatabaseRequest{
+		Parent:          project + "/instances/" + config.Instance,
+		CreateStatement: "CREATE DATABASE `" + config.Database + "`",
+		ExtraStatements: config.DDL,
+	})
+	if err != nil {
+		return "", fmt.Errorf("create database: %v", err)
+	}
+	db, err := dop.Wait(ctx)
+	if err != nil {
+		return "", fmt.Errorf("create database: %v", err)
+	}
+	return db.GetName(), nil
+}
+
+// OpenDB starts an emulator for the test, and returns the database
+// of config in it. It sets SPANNER_EMULATOR_HOST for the duration
+// of the test, so it can't be used in parallel tests. The database
+// is closed and the emulator terminated when the test ends.
+func OpenDB(t testing.TB, config Config) *sql.DB {
+	t.Helper()
+	ctx := context.Background()
+	e, err := Run(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := e.Terminate(ctx); err != nil {
+			t.Errorf("terminate emulator: %v", err)
+		}
+	})
+	t.Setenv("SPANNER_EMULATOR_HOST", e.Host)
+	db, err := sql.Open("spanner", e.DSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannercontainer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/testcontainers/testcontainers-go"
+)
+
+func TestConfigDefaults(t *testing.T) {
+	got := Config{Database: "orders"}.withDefaults()
+	want := Config{Image: DefaultImage, Project: "test-project", Instance: "test-instance", Database: "orders"}
+	if got.Image != want.Image || got.Project != want.Project || got.Instance != want.Instance || got.Database != want.Database {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestOpenDB(t *testing.T) {
+	if testing.Short() {
+		t.Skip("starts a container")
+	}
+	testcontainers.SkipIfProviderIsNotHealthy(t)
+
+	db := OpenDB(t, Config{
+		DDL: []string{"CREATE TABLE Singers (Id INT64, Name STRING(MAX)) PRIMARY KEY (Id)"},
+	})
+	ctx := context.Background()
+	if _, err := db.ExecContext(ctx, "INSERT INTO Singers (Id, Name) VALUES (1, 'Alice')"); err != nil {
+		t.Fatal(err)
+	}
+	var name string
+	if err := db.QueryRowContext(ctx, "SELECT Name FROM Singers WHERE Id = 1").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != "Alice" {
+		t.Errorf("got %q, want Alice", name)
+	}
+}
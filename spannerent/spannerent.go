@@ -0,0 +1,114 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package spannerent is an ent dialect driver for Spanner, built on
+// the database/sql driver:
+//
+//	drv, err := spannerent.Open("projects/PROJECT/instances/INSTANCE/databases/DATABASE")
+//	...
+//	client := ent.NewClient(ent.Driver(drv))
+//
+// The driver reports the SQLite dialect, whose statements ent builds
+// with backtick quoted identifiers, ? placeholders and RETURNING
+// clauses. The driver converts the placeholders into the query
+// parameters @p1, @p2 and so on, and RETURNING into THEN RETURN,
+// before the statements are executed.
+//
+// Spanner has no auto-increment columns, so the IDs of entities are
+// either set by the application, e.g. with a UUID default, or are
+// identity columns whose values are returned with THEN RETURN.
+// The schema is migrated with Spanner DDL, see the schema and
+// migrate packages, and not with the migrations of ent.
+package spannerent
+
+import (
+	"context"
+	"database/sql"
+
+	"entgo.io/ent/dialect"
+	entsql "entgo.io/ent/dialect/sql"
+	_ "github.com/rakyll/go-sql-driver-spanner"
+	"github.com/rakyll/go-sql-driver-spanner/internal"
+)
+
+// Driver is an ent dialect driver for Spanner.
+type Driver struct {
+	*entsql.Driver
+}
+
+var _ dialect.Driver = (*Driver)(nil)
+
+// Open opens the database dsn, which may
+// have the connection parameters of the driver.
+func Open(dsn string) (*Driver, error) {
+	db, err := sql.Open("spanner", dsn)
+	if err != nil {
+		return nil, err
+	}
+	return OpenDB(db), nil
+}
+
+// OpenDB returns a driver that uses db.
+func OpenDB(db *sql.DB) *Driver {
+	return &Driver{entsql.OpenDB(dialect.SQLite, db)}
+}
+
+// Exec executes a statement that ent built.
+func (d *Driver) Exec(ctx context.Context, query string, args, v any) error {
+	return d.Driver.Exec(ctx, convert(query), args, v)
+}
+
+// Query executes a query that ent built.
+func (d *Driver) Query(ctx context.Context, query string, args, v any) error {
+	return d.Driver.Query(ctx, convert(query), args, v)
+}
+
+// Tx begins a read-write transaction.
+func (d *Driver) Tx(ctx context.Context) (dialect.Tx, error) {
+	return d.BeginTx(ctx, nil)
+}
+
+// BeginTx begins a transaction with the given options.
+func (d *Driver) BeginTx(ctx context.Context, opts *sql.TxOptions) (dialect.Tx, error) {
+	tx, err := d.Driver.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{tx}, nil
+}
+
+// Tx is a transaction of a Driver.
+type Tx struct {
+	dialect.Tx
+}
+
+// Exec executes a statement that ent built in the transaction.
+func (tx *Tx) Exec(ctx context.Context, query string, args, v any) error {
+	return tx.Tx.Exec(ctx, convert(query), args, v)
+}
+
+// Query executes a query that ent built in the transaction.
+func (tx *Tx) Query(ctx context.Context, query string, args, v any) error {
+	return tx.Tx.Query(ctx, convert(query), args, v)
+}
+
+// keywords are the keywords of the SQLite dialect
+// that have other names in Spanner.
+var keywords = map[string]string{"RETURNING": "THEN RETURN"}
+
+// convert converts a statement of the SQLite dialect of ent
+// into a Spanner statement.
+func convert(query string) string {
+	return internal.ConvertPositionalParams(query, keywords)
+}
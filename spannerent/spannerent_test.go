@@ -0,0 +1,67 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerent
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"entgo.io/ent/dialect"
+	entsql "entgo.io/ent/dialect/sql"
+)
+
+// recorder records the statements that are executed.
+type recorder struct {
+	queries []string
+}
+
+func (r *recorder) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	r.queries = append(r.queries, query)
+	return nil, nil
+}
+
+func (r *recorder) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	r.queries = append(r.queries, query)
+	return nil, nil
+}
+
+func TestExec(t *testing.T) {
+	r := &recorder{}
+	d := &Driver{entsql.NewDriver(dialect.SQLite, entsql.Conn{ExecQuerier: r})}
+	insert, args := entsql.Dialect(d.Dialect()).
+		Insert("users").Columns("name", "age").Values("Alice", 30).Returning("id").Query()
+	if err := d.Exec(context.Background(), insert, args, nil); err != nil {
+		t.Fatal(err)
+	}
+	update, args := entsql.Dialect(d.Dialect()).
+		Update("users").Set("age", 31).Where(entsql.EQ("name", "Alice")).Query()
+	if err := d.Exec(context.Background(), update, args, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"INSERT INTO `users` (`name`, `age`) VALUES (@p1, @p2) THEN RETURN `id`",
+		"UPDATE `users` SET `age` = @p1 WHERE `name` = @p2",
+	}
+	if len(r.queries) != len(want) {
+		t.Fatalf("got %q, want %q", r.queries, want)
+	}
+	for i, q := range r.queries {
+		if q != want[i] {
+			t.Errorf("got %q, want %q", q, want[i])
+		}
+	}
+}
@@ -0,0 +1,311 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannergorm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	spannerdriver "github.com/rakyll/go-sql-driver-spanner"
+	spannerschema "github.com/rakyll/go-sql-driver-spanner/schema"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/migrator"
+	gormschema "gorm.io/gorm/schema"
+)
+
+// Interleaved is implemented by models whose table is interleaved
+// in the table of a parent model. The primary key of the model must
+// start with the primary key columns of the parent, and the parent
+// must be migrated before the model.
+type Interleaved interface {
+	// InterleaveIn returns the name of the parent table, and
+	// whether rows are deleted along with their parent row.
+	InterleaveIn() (parent string, onDeleteCascade bool)
+}
+
+// Migrator is the GORM migrator of Spanner.
+type Migrator struct {
+	migrator.Migrator
+}
+
+// CurrentDatabase returns the empty name of the default schema.
+func (m Migrator) CurrentDatabase() string {
+	return ""
+}
+
+// CreateTable creates the tables of values, each in one DDL batch
+// with its indexes and constraints.
+func (m Migrator) CreateTable(values ...interface{}) error {
+	for _, value := range m.ReorderModels(values, false) {
+		if err := m.RunWithValue(value, func(stmt *gorm.Statement) error {
+			statements, err := m.createTableStatements(stmt)
+			if err != nil {
+				return err
+			}
+			return m.DB.Exec(strings.Join(statements, ";\n")).Error
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createTableStatements returns the DDL statements
+// that create the table of stmt.
+func (m Migrator) createTableStatements(stmt *gorm.Statement) ([]string, error) {
+	if stmt.Schema == nil {
+		return nil, errors.New("failed to get schema")
+	}
+	t := spannerdriver.Table{Name: stmt.Table}
+	for _, dbName := range stmt.Schema.DBNames {
+		field := stmt.Schema.FieldsByDBName[dbName]
+		if field.IgnoreMigration {
+			continue
+		}
+		t.Columns = append(t.Columns, m.column(field))
+	}
+	if len(stmt.Schema.PrimaryFields) == 0 {
+		return nil, fmt.Errorf("table %s: Spanner tables need a primary key", stmt.Table)
+	}
+	for _, field := range stmt.Schema.PrimaryFields {
+		t.PrimaryKey = append(t.PrimaryKey, spannerdriver.IndexColumn{Name: field.DBName})
+	}
+	if v, ok := reflect.New(stmt.Schema.ModelType).Interface().(Interleaved); ok {
+		t.ParentTable, t.OnDeleteCascade = v.InterleaveIn()
+	}
+
+	statements := []string{spannerschema.CreateTable(t)}
+	for _, idx := range stmt.Schema.ParseIndexes() {
+		statements = append(statements, spannerschema.CreateIndex(t.Name, index(idx)))
+	}
+	// Spanner has no unique constraints, only unique indexes.
+	for _, uni := range stmt.Schema.ParseUniqueConstraints() {
+		statements = append(statements, spannerschema.CreateIndex(t.Name, spannerdriver.Index{
+			Name:    uni.Name,
+			Unique:  true,
+			Columns: []spannerdriver.IndexColumn{{Name: uni.Field.DBName}},
+		}))
+	}
+	for _, chk := range stmt.Schema.ParseCheckConstraints() {
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s)",
+			m.quote(t.Name), m.quote(chk.Name), chk.Constraint))
+	}
+	if !m.DB.DisableForeignKeyConstraintWhenMigrating && !m.DB.IgnoreRelationshipsWhenMigrating {
+		for _, rel := range stmt.Schema.Relationships.Relations {
+			if rel.Field.IgnoreMigration {
+				continue
+			}
+			if c := rel.ParseConstraint(); c != nil && c.Schema == stmt.Schema {
+				statements = append(statements, m.addForeignKey(c))
+			}
+		}
+	}
+	return statements, nil
+}
+
+// column returns the column of field. Auto-increment
+// fields are identity columns.
+func (m Migrator) column(field *gormschema.Field) spannerdriver.Column {
+	col := spannerdriver.Column{
+		Name:     field.DBName,
+		Type:     m.DataTypeOf(field),
+		Nullable: !field.NotNull && !field.PrimaryKey,
+		Identity: field.AutoIncrement,
+	}
+	switch {
+	case field.AutoIncrement:
+	case field.DefaultValueInterface != nil:
+		col.Default = m.Dialector.Explain("@p1", field.DefaultValueInterface)
+	case field.DefaultValue != "" && field.DefaultValue != "(-)":
+		col.Default = field.DefaultValue
+	}
+	return col
+}
+
+// index returns the Spanner index of a GORM index.
+func index(idx *gormschema.Index) spannerdriver.Index {
+	i := spannerdriver.Index{Name: idx.Name, Unique: strings.EqualFold(idx.Class, "UNIQUE")}
+	for _, opt := range idx.Fields {
+		i.Columns = append(i.Columns, spannerdriver.IndexColumn{
+			Name:       opt.DBName,
+			Descending: strings.EqualFold(opt.Sort, "DESC"),
+		})
+	}
+	return i
+}
+
+// addForeignKey returns the statement that adds the foreign key c.
+func (m Migrator) addForeignKey(c *gormschema.Constraint) string {
+	fk := spannerdriver.ForeignKey{
+		Name:            c.Name,
+		ReferencedTable: c.ReferenceSchema.Table,
+		// Spanner only supports the CASCADE and NO ACTION delete actions.
+		OnDeleteCascade: strings.EqualFold(c.OnDelete, "CASCADE"),
+	}
+	for _, f := range c.ForeignKeys {
+		fk.Columns = append(fk.Columns, f.DBName)
+	}
+	for _, f := range c.References {
+		fk.ReferencedColumns = append(fk.ReferencedColumns, f.DBName)
+	}
+	return spannerschema.AddForeignKey(c.Schema.Table, fk)
+}
+
+func (m Migrator) quote(name string) string {
+	return m.DB.Statement.Quote(name)
+}
+
+// DropTable drops the tables of values, after their indexes.
+// Child tables are dropped before their parents.
+func (m Migrator) DropTable(values ...interface{}) error {
+	values = m.ReorderModels(values, false)
+	for i := len(values) - 1; i >= 0; i-- {
+		if err := m.RunWithValue(values[i], func(stmt *gorm.Statement) error {
+			if !m.HasTable(stmt.Table) {
+				return nil
+			}
+			var indexes []string
+			if err := m.DB.Raw(`SELECT INDEX_NAME FROM INFORMATION_SCHEMA.INDEXES
+WHERE TABLE_SCHEMA = '' AND TABLE_NAME = ? AND INDEX_TYPE = 'INDEX'`, stmt.Table).Scan(&indexes).Error; err != nil {
+				return err
+			}
+			var statements []string
+			for _, idx := range indexes {
+				statements = append(statements, "DROP INDEX "+m.quote(idx))
+			}
+			statements = append(statements, "DROP TABLE "+m.quote(stmt.Table))
+			return m.DB.Exec(strings.Join(statements, ";\n")).Error
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetTables returns the tables of the default schema.
+func (m Migrator) GetTables() (tables []string, err error) {
+	err = m.DB.Raw(`SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES
+WHERE TABLE_SCHEMA = '' AND TABLE_TYPE = 'BASE TABLE'`).Scan(&tables).Error
+	return tables, err
+}
+
+// HasTable reports whether the table of value exists.
+func (m Migrator) HasTable(value interface{}) bool {
+	var count int64
+	m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		return m.DB.Raw(`SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES
+WHERE TABLE_SCHEMA = '' AND TABLE_NAME = ? AND TABLE_TYPE = 'BASE TABLE'`, stmt.Table).Row().Scan(&count)
+	})
+	return count > 0
+}
+
+// HasColumn reports whether the table of value has the column of field.
+func (m Migrator) HasColumn(value interface{}, field string) bool {
+	var count int64
+	m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		name := field
+		if stmt.Schema != nil {
+			if f := stmt.Schema.LookUpField(field); f != nil {
+				name = f.DBName
+			}
+		}
+		return m.DB.Raw(`SELECT COUNT(*) FROM INFORMATION_SCHEMA.COLUMNS
+WHERE TABLE_SCHEMA = '' AND TABLE_NAME = ? AND COLUMN_NAME = ?`, stmt.Table, name).Row().Scan(&count)
+	})
+	return count > 0
+}
+
+// AlterColumn changes the type and nullability of the column of field.
+func (m Migrator) AlterColumn(value interface{}, field string) error {
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		if stmt.Schema == nil {
+			return errors.New("failed to get schema")
+		}
+		f := stmt.Schema.LookUpField(field)
+		if f == nil {
+			return fmt.Errorf("failed to look up field with name: %s", field)
+		}
+		col := m.column(f)
+		// Defaults and identities can't be changed along with the type.
+		col.Default, col.Identity = "", false
+		return m.DB.Exec(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s",
+			m.quote(stmt.Table), spannerschema.ColumnDefinition(col))).Error
+	})
+}
+
+// RenameColumn returns an error, because Spanner
+// can't rename columns.
+func (m Migrator) RenameColumn(value interface{}, oldName, newName string) error {
+	return fmt.Errorf("spanner can't rename column %s to %s", oldName, newName)
+}
+
+// HasIndex reports whether the table of value has the index name.
+func (m Migrator) HasIndex(value interface{}, name string) bool {
+	var count int64
+	m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		if stmt.Schema != nil {
+			if idx := stmt.Schema.LookIndex(name); idx != nil {
+				name = idx.Name
+			}
+		}
+		return m.DB.Raw(`SELECT COUNT(*) FROM INFORMATION_SCHEMA.INDEXES
+WHERE TABLE_SCHEMA = '' AND TABLE_NAME = ? AND INDEX_NAME = ?`, stmt.Table, name).Row().Scan(&count)
+	})
+	return count > 0
+}
+
+// CreateIndex creates the index name of the table of value.
+func (m Migrator) CreateIndex(value interface{}, name string) error {
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		if stmt.Schema == nil {
+			return errors.New("failed to get schema")
+		}
+		idx := stmt.Schema.LookIndex(name)
+		if idx == nil {
+			return fmt.Errorf("failed to create index with name %s", name)
+		}
+		return m.DB.Exec(spannerschema.CreateIndex(stmt.Table, index(idx))).Error
+	})
+}
+
+// DropIndex drops the index name of the table of value.
+func (m Migrator) DropIndex(value interface{}, name string) error {
+	return m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		if stmt.Schema != nil {
+			if idx := stmt.Schema.LookIndex(name); idx != nil {
+				name = idx.Name
+			}
+		}
+		return m.DB.Exec("DROP INDEX ?", clause.Column{Name: name}).Error
+	})
+}
+
+// HasConstraint reports whether the table of
+// value has the constraint name.
+func (m Migrator) HasConstraint(value interface{}, name string) bool {
+	var count int64
+	m.RunWithValue(value, func(stmt *gorm.Statement) error {
+		constraint, table := m.GuessConstraintInterfaceAndTable(stmt, name)
+		if constraint != nil {
+			name = constraint.GetName()
+		}
+		return m.DB.Raw(`SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLE_CONSTRAINTS
+WHERE TABLE_SCHEMA = '' AND TABLE_NAME = ? AND CONSTRAINT_NAME = ?`, table, name).Row().Scan(&count)
+	})
+	return count > 0
+}
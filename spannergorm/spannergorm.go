@@ -0,0 +1,181 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package spannergorm is a GORM dialector for Spanner, built on the
+// database/sql driver:
+//
+//	db, err := gorm.Open(spannergorm.Open("projects/PROJECT/instances/INSTANCE/databases/DATABASE"), &gorm.Config{})
+//
+// AutoMigrate creates tables with Spanner DDL, in one DDL batch per
+// table together with its indexes and constraints. Spanner has no
+// auto-increment columns, so auto-increment primary keys, such as
+// the ID of gorm.Model, are identity columns with bit-reversed
+// values, and their values are read back with THEN RETURN when rows
+// are created. Models that implement Interleaved are interleaved in
+// the table of their parent.
+package spannergorm
+
+import (
+	"database/sql"
+	"regexp"
+	"strconv"
+	"strings"
+
+	_ "github.com/rakyll/go-sql-driver-spanner"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/migrator"
+	"gorm.io/gorm/schema"
+)
+
+// Config configures a Dialector.
+type Config struct {
+	// DriverName is the name of the database/sql driver,
+	// spanner by default.
+	DriverName string
+	// DSN is the data source name of the database,
+	// with the connection parameters of the driver.
+	DSN string
+	// Conn is used instead of opening DSN, e.g. a *sql.DB that
+	// was opened with a connector of a spannerdriver.Driver.
+	Conn gorm.ConnPool
+}
+
+// Dialector is the GORM dialector of Spanner.
+type Dialector struct {
+	Config
+}
+
+var _ gorm.Dialector = Dialector{}
+
+// Open returns a dialector of the database dsn.
+func Open(dsn string) gorm.Dialector {
+	return Dialector{Config{DSN: dsn}}
+}
+
+// New returns a dialector with the given configuration.
+func New(config Config) gorm.Dialector {
+	return Dialector{config}
+}
+
+// Name returns spanner.
+func (Dialector) Name() string {
+	return "spanner"
+}
+
+// Initialize registers the callbacks of Spanner with db
+// and opens the database, unless Config.Conn is set.
+func (d Dialector) Initialize(db *gorm.DB) error {
+	// Inserts, updates and deletes return the values
+	// that Spanner generated with THEN RETURN.
+	callbacks.RegisterDefaultCallbacks(db, &callbacks.Config{
+		CreateClauses: []string{"INSERT", "VALUES", "RETURNING"},
+		UpdateClauses: []string{"UPDATE", "SET", "WHERE", "RETURNING"},
+		DeleteClauses: []string{"DELETE", "FROM", "WHERE", "RETURNING"},
+	})
+	db.ClauseBuilders["RETURNING"] = func(c clause.Clause, builder clause.Builder) {
+		builder.WriteString("THEN RETURN ")
+		c.Expression.Build(builder)
+	}
+
+	if d.Conn != nil {
+		db.ConnPool = d.Conn
+		return nil
+	}
+	driverName := d.DriverName
+	if driverName == "" {
+		driverName = "spanner"
+	}
+	conn, err := sql.Open(driverName, d.DSN)
+	if err != nil {
+		return err
+	}
+	db.ConnPool = conn
+	return nil
+}
+
+// Migrator returns the migrator of Spanner.
+func (d Dialector) Migrator(db *gorm.DB) gorm.Migrator {
+	return Migrator{migrator.Migrator{Config: migrator.Config{
+		DB:        db,
+		Dialector: d,
+	}}}
+}
+
+// DataTypeOf returns the Spanner type of the column of field.
+func (d Dialector) DataTypeOf(field *schema.Field) string {
+	switch field.DataType {
+	case schema.Bool:
+		return "BOOL"
+	case schema.Int, schema.Uint:
+		return "INT64"
+	case schema.Float:
+		if field.Size == 32 {
+			return "FLOAT32"
+		}
+		return "FLOAT64"
+	case schema.String:
+		return sized("STRING", field.Size)
+	case schema.Bytes:
+		return sized("BYTES", field.Size)
+	case schema.Time:
+		return "TIMESTAMP"
+	}
+	// Types such as DATE, NUMERIC and JSON are
+	// named by the type tags of fields.
+	return string(field.DataType)
+}
+
+// sized returns the Spanner type with the given
+// length, or with MAX if the length is not set.
+func sized(typ string, size int) string {
+	if size <= 0 {
+		return typ + "(MAX)"
+	}
+	return typ + "(" + strconv.Itoa(size) + ")"
+}
+
+// DefaultValueOf returns the DEFAULT keyword.
+func (Dialector) DefaultValueOf(*schema.Field) clause.Expression {
+	return clause.Expr{SQL: "DEFAULT"}
+}
+
+// BindVarTo writes the positional query parameter
+// of v, e.g. @p1 for the first value of stmt.
+func (Dialector) BindVarTo(writer clause.Writer, stmt *gorm.Statement, v interface{}) {
+	writer.WriteString("@p")
+	writer.WriteString(strconv.Itoa(len(stmt.Vars)))
+}
+
+// QuoteTo writes str quoted with backticks. Each part of
+// a name that is qualified with a schema is quoted.
+func (Dialector) QuoteTo(writer clause.Writer, str string) {
+	writer.WriteByte('`')
+	for i, part := range strings.Split(strings.Trim(str, "`"), ".") {
+		if i > 0 {
+			writer.WriteString("`.`")
+		}
+		writer.WriteString(strings.Trim(part, "`"))
+	}
+	writer.WriteByte('`')
+}
+
+var positionalParam = regexp.MustCompile(`@p(\d+)`)
+
+// Explain returns sql with its query parameters replaced by vars.
+func (Dialector) Explain(sql string, vars ...interface{}) string {
+	return logger.ExplainSQL(sql, positionalParam, `'`, vars...)
+}
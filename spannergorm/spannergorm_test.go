@@ -0,0 +1,132 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannergorm
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Singer struct {
+	ID        int64
+	Name      string `gorm:"size:100;not null;index:idx_singers_name,sort:desc"`
+	Email     string `gorm:"unique"`
+	Rating    float32
+	Active    bool `gorm:"default:true"`
+	CreatedAt time.Time
+}
+
+type Album struct {
+	SingerID int64 `gorm:"primaryKey;autoIncrement:false"`
+	ID       int64 `gorm:"primaryKey;autoIncrement:false"`
+	Title    string
+	Cover    []byte `gorm:"size:1024"`
+}
+
+func (Album) InterleaveIn() (string, bool) {
+	return "singers", true
+}
+
+func openDryRun(t *testing.T) *gorm.DB {
+	t.Helper()
+	conn, err := sql.Open("spanner", "projects/p/instances/i/databases/d")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	db, err := gorm.Open(New(Config{Conn: conn}), &gorm.Config{DisableAutomaticPing: true, DryRun: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func createTableStatements(t *testing.T, db *gorm.DB, model interface{}) []string {
+	t.Helper()
+	m := db.Migrator().(Migrator)
+	var statements []string
+	if err := m.RunWithValue(model, func(stmt *gorm.Statement) (err error) {
+		statements, err = m.createTableStatements(stmt)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return statements
+}
+
+func TestCreateTableStatements(t *testing.T) {
+	db := openDryRun(t)
+	for _, tc := range []struct {
+		model interface{}
+		want  []string
+	}{
+		{
+			&Singer{},
+			[]string{
+				"CREATE TABLE `singers` (\n" +
+					"  `id` INT64 NOT NULL GENERATED BY DEFAULT AS IDENTITY (BIT_REVERSED_POSITIVE),\n" +
+					"  `name` STRING(100) NOT NULL,\n" +
+					"  `email` STRING(MAX),\n" +
+					"  `rating` FLOAT32,\n" +
+					"  `active` BOOL DEFAULT (true),\n" +
+					"  `created_at` TIMESTAMP,\n" +
+					") PRIMARY KEY (`id`)",
+				"CREATE INDEX `idx_singers_name` ON `singers` (`name` DESC)",
+				"CREATE UNIQUE INDEX `uni_singers_email` ON `singers` (`email`)",
+			},
+		},
+		{
+			&Album{},
+			[]string{
+				"CREATE TABLE `albums` (\n" +
+					"  `singer_id` INT64 NOT NULL,\n" +
+					"  `id` INT64 NOT NULL,\n" +
+					"  `title` STRING(MAX),\n" +
+					"  `cover` BYTES(1024),\n" +
+					") PRIMARY KEY (`singer_id`, `id`),\n" +
+					"  INTERLEAVE IN PARENT `singers` ON DELETE CASCADE",
+			},
+		},
+	} {
+		if got := createTableStatements(t, db, tc.model); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%T: got %q, want %q", tc.model, got, tc.want)
+		}
+	}
+}
+
+func TestCreateReturning(t *testing.T) {
+	db := openDryRun(t)
+	tx := db.Create(&Singer{Name: "Marc", Email: "marc@example.com"})
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	stmt := tx.Statement
+	want := "INSERT INTO `singers` (`name`,`email`,`rating`,`active`,`created_at`) VALUES (@p1,@p2,@p3,@p4,@p5) THEN RETURN `id`"
+	if got := stmt.SQL.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestExplain(t *testing.T) {
+	got := Dialector{}.Explain("SELECT * FROM `singers` WHERE `id` = @p1 AND `name` = @p2", 1, "Marc")
+	want := "SELECT * FROM `singers` WHERE `id` = 1 AND `name` = 'Marc'"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/rakyll/go-sql-driver-spanner/internal"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// sqlCommentDriver is the db_driver tag of sqlcommenter comments.
+const sqlCommentDriver = "go-sql-driver-spanner"
+
+type sqlCommentTagsKey struct{}
+
+// WithSQLCommentTags returns a context that adds tags to the
+// sqlcommenter comments of the queries and DML statements that are
+// executed with it, if the sqlCommenter connection parameter is set.
+// The tags of ctx, if any, are kept unless tags replaces them.
+// sqlcommenter defines the tags application, framework, route,
+// controller and action:
+//
+//	ctx = spannerdriver.WithSQLCommentTags(ctx, map[string]string{
+//		"framework": "net/http",
+//		"route":     "/singers/{id}",
+//	})
+func WithSQLCommentTags(ctx context.Context, tags map[string]string) context.Context {
+	merged := make(map[string]string)
+	for k, v := range sqlCommentTags(ctx) {
+		merged[k] = v
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, sqlCommentTagsKey{}, merged)
+}
+
+// sqlCommentTags returns the sqlcommenter tags of ctx, if any.
+func sqlCommentTags(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(sqlCommentTagsKey{}).(map[string]string)
+	return tags
+}
+
+// withSQLComment returns query with a sqlcommenter comment of the
+// driver, the trace context and the tags of ctx, if the sqlCommenter
+// connection parameter is set. Statements that have comments are
+// left as they are, as sqlcommenter requires.
+func (c *conn) withSQLComment(ctx context.Context, query string) string {
+	if !c.sqlCommenter {
+		return query
+	}
+	trimmed := strings.TrimRight(query, " \t\r\n;")
+	if internal.StripComments(trimmed) != strings.TrimSpace(trimmed) {
+		return query
+	}
+	tags := map[string]string{"db_driver": sqlCommentDriver}
+	for k, v := range sqlCommentTags(ctx) {
+		tags[k] = v
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	for k, v := range carrier {
+		tags[k] = v
+	}
+	return trimmed + " " + sqlComment(tags)
+}
+
+// sqlComment formats tags as a sqlcommenter comment: the keys and
+// values are URL-encoded, which escapes quotes and the end of the
+// comment, the values are quoted, and the pairs are sorted by key.
+func sqlComment(tags map[string]string) string {
+	pairs := make([]string, 0, len(tags))
+	for k, v := range tags {
+		pairs = append(pairs, url.PathEscape(k)+"='"+url.PathEscape(v)+"'")
+	}
+	sort.Strings(pairs)
+	return "/*" + strings.Join(pairs, ",") + "*/"
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"testing"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestWithSQLComment(t *testing.T) {
+	c := &conn{sqlCommenter: true}
+	sc := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	})
+	ctx := trace.ContextWithSpanContext(context.Background(), sc)
+	ctx = WithSQLCommentTags(ctx, map[string]string{"framework": "net/http", "route": "/singers/{id}"})
+	ctx = WithSQLCommentTags(ctx, map[string]string{"action": "it's"})
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{
+			query: "SELECT * FROM Singers;\n",
+			want:  "SELECT * FROM Singers /*action='it%27s',db_driver='go-sql-driver-spanner',framework='net%2Fhttp',route='%2Fsingers%2F%7Bid%7D',traceparent='00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01'*/",
+		},
+		{query: "SELECT * FROM Singers /* hand-written */", want: "SELECT * FROM Singers /* hand-written */"},
+		{query: "SELECT '/* not a comment */'", want: "SELECT '/* not a comment */' /*action="},
+	}
+	for _, tc := range tests {
+		got := c.withSQLComment(ctx, tc.query)
+		if len(got) < len(tc.want) || got[:len(tc.want)] != tc.want {
+			t.Errorf("withSQLComment(%q): got %q, want %q", tc.query, got, tc.want)
+		}
+	}
+
+	c.sqlCommenter = false
+	if got := c.withSQLComment(ctx, "SELECT 1"); got != "SELECT 1" {
+		t.Errorf("got %q without sqlCommenter", got)
+	}
+}
+
+func TestSQLCommentOfQueries(t *testing.T) {
+	var sql string
+	db := openFakeSpanner(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		sql = req.Sql
+		return sendRow(stream)
+	}})
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	c.Raw(func(driverConn any) error {
+		driverConn.(*conn).sqlCommenter = true
+		return nil
+	})
+
+	var id int64
+	ctx = WithSQLCommentTags(ctx, map[string]string{"route": "/singers"})
+	if err := c.QueryRowContext(ctx, "SELECT Id FROM Singers WHERE Id = @id", 1).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if want := "SELECT Id FROM Singers WHERE Id = @id /*db_driver='go-sql-driver-spanner',route='%2Fsingers'*/"; sql != want {
+		t.Errorf("got %q, want %q", sql, want)
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/jmoiron/sqlx"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type sqlxSinger struct {
+	ID   int64  `db:"Id"`
+	Name string `db:"Name"`
+}
+
+// openSqlx opens a sqlx database on a fake server that records the
+// SQL and the parameters of the requests and returns two singers.
+func openSqlx(t *testing.T) (*sqlx.DB, func() (string, map[string]*structpb.Value)) {
+	var (
+		mu     sync.Mutex
+		sql    string
+		params map[string]*structpb.Value
+	)
+	db := openFakeSpanner(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		mu.Lock()
+		sql, params = req.GetSql(), req.GetParams().GetFields()
+		mu.Unlock()
+		return stream.Send(&sppb.PartialResultSet{
+			Metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{Fields: []*sppb.StructType_Field{
+				{Name: "Id", Type: &sppb.Type{Code: sppb.TypeCode_INT64}},
+				{Name: "Name", Type: &sppb.Type{Code: sppb.TypeCode_STRING}},
+			}}},
+			Values: []*structpb.Value{stringValue("1"), stringValue("Alice"), stringValue("2"), stringValue("Bob")},
+		})
+	}})
+	return sqlx.NewDb(db, "spanner"), func() (string, map[string]*structpb.Value) {
+		mu.Lock()
+		defer mu.Unlock()
+		return sql, params
+	}
+}
+
+func paramStrings(params map[string]*structpb.Value) map[string]string {
+	m := make(map[string]string)
+	for name, v := range params {
+		m[name] = v.GetStringValue()
+	}
+	return m
+}
+
+func TestSqlxSelect(t *testing.T) {
+	db, last := openSqlx(t)
+	var singers []sqlxSinger
+	if err := db.SelectContext(context.Background(), &singers, "SELECT Id, Name FROM Singers WHERE Id > ?", 0); err != nil {
+		t.Fatal(err)
+	}
+	want := []sqlxSinger{{1, "Alice"}, {2, "Bob"}}
+	if !reflect.DeepEqual(singers, want) {
+		t.Errorf("got %+v, want %+v", singers, want)
+	}
+	sql, params := last()
+	if sql != "SELECT Id, Name FROM Singers WHERE Id > @p1" {
+		t.Errorf("got SQL %q", sql)
+	}
+	if got := paramStrings(params); !reflect.DeepEqual(got, map[string]string{"p1": "0"}) {
+		t.Errorf("got params %v", got)
+	}
+}
+
+func TestSqlxNamedQuery(t *testing.T) {
+	db, last := openSqlx(t)
+	rows, err := db.NamedQueryContext(context.Background(),
+		"SELECT Id, Name FROM Singers WHERE Name = :name OR Name = :other", map[string]interface{}{"name": "Alice", "other": "Bob"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var singers []sqlxSinger
+	for rows.Next() {
+		var s sqlxSinger
+		if err := rows.StructScan(&s); err != nil {
+			t.Fatal(err)
+		}
+		singers = append(singers, s)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(singers) != 2 {
+		t.Errorf("got %d singers, want 2", len(singers))
+	}
+	sql, params := last()
+	if sql != "SELECT Id, Name FROM Singers WHERE Name = @p1 OR Name = @p2" {
+		t.Errorf("got SQL %q", sql)
+	}
+	if got := paramStrings(params); !reflect.DeepEqual(got, map[string]string{"p1": "Alice", "p2": "Bob"}) {
+		t.Errorf("got params %v", got)
+	}
+}
+
+func TestSqlxIn(t *testing.T) {
+	db, last := openSqlx(t)
+	query, args, err := sqlx.In("SELECT Id, Name FROM Singers WHERE Id IN (?)", []int64{1, 2, 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var singer sqlxSinger
+	if err := db.GetContext(context.Background(), &singer, db.Rebind(query), args...); err != nil {
+		t.Fatal(err)
+	}
+	if singer != (sqlxSinger{1, "Alice"}) {
+		t.Errorf("got %+v", singer)
+	}
+	sql, params := last()
+	if sql != "SELECT Id, Name FROM Singers WHERE Id IN (@p1, @p2, @p3)" {
+		t.Errorf("got SQL %q", sql)
+	}
+	if got := paramStrings(params); !reflect.DeepEqual(got, map[string]string{"p1": "1", "p2": "2", "p3": "3"}) {
+		t.Errorf("got params %v", got)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+// staleness is a timestamp bound together with the textual
+// form that is used in SET and SHOW statements, e.g.
+// 'STRONG', 'MAX_STALENESS 10s' or 'READ_TIMESTAMP 2020-01-01T00:00:00Z'.
+type staleness struct {
+	bound spanner.TimestampBound
+	spec  string
+}
+
+var strongStaleness = staleness{bound: spanner.StrongRead(), spec: "STRONG"}
+
+func parseStaleness(spec string) (staleness, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return staleness{}, fmt.Errorf("invalid read-only staleness %q", spec)
+	}
+	mode := strings.ToUpper(fields[0])
+	if mode == "STRONG" && len(fields) == 1 {
+		return strongStaleness, nil
+	}
+	if len(fields) != 2 {
+		return staleness{}, fmt.Errorf("invalid read-only staleness %q", spec)
+	}
+
+	var bound spanner.TimestampBound
+	switch mode {
+	case "MIN_READ_TIMESTAMP", "READ_TIMESTAMP":
+		ts, err := time.Parse(time.RFC3339Nano, fields[1])
+		if err != nil {
+			return staleness{}, fmt.Errorf("invalid read-only staleness %q: %v", spec, err)
+		}
+		if mode == "MIN_READ_TIMESTAMP" {
+			bound = spanner.MinReadTimestamp(ts)
+		} else {
+			bound = spanner.ReadTimestamp(ts)
+		}
+	case "MAX_STALENESS", "EXACT_STALENESS":
+		d, err := time.ParseDuration(fields[1])
+		if err != nil {
+			return staleness{}, fmt.Errorf("invalid read-only staleness %q: %v", spec, err)
+		}
+		if mode == "MAX_STALENESS" {
+			bound = spanner.MaxStaleness(d)
+		} else {
+			bound = spanner.ExactStaleness(d)
+		}
+	default:
+		return staleness{}, fmt.Errorf("invalid read-only staleness %q", spec)
+	}
+	return staleness{bound: bound, spec: mode + " " + fields[1]}, nil
+}
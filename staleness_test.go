@@ -0,0 +1,59 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+func TestParseStaleness(t *testing.T) {
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		input     string
+		want      spanner.TimestampBound
+		wantSpec  string
+		wantError bool
+	}{
+		{input: "strong", want: spanner.StrongRead(), wantSpec: "STRONG"},
+		{input: "MIN_READ_TIMESTAMP 2020-01-01T00:00:00Z", want: spanner.MinReadTimestamp(ts), wantSpec: "MIN_READ_TIMESTAMP 2020-01-01T00:00:00Z"},
+		{input: "read_timestamp  2020-01-01T00:00:00Z", want: spanner.ReadTimestamp(ts), wantSpec: "READ_TIMESTAMP 2020-01-01T00:00:00Z"},
+		{input: "MAX_STALENESS 10s", want: spanner.MaxStaleness(10 * time.Second), wantSpec: "MAX_STALENESS 10s"},
+		{input: "EXACT_STALENESS 1m", want: spanner.ExactStaleness(time.Minute), wantSpec: "EXACT_STALENESS 1m"},
+		{input: "", wantError: true},
+		{input: "STRONG 10s", wantError: true},
+		{input: "MAX_STALENESS", wantError: true},
+		{input: "MAX_STALENESS ten", wantError: true},
+		{input: "READ_TIMESTAMP yesterday", wantError: true},
+		{input: "EVENTUAL 10s", wantError: true},
+	}
+
+	for _, tc := range tests {
+		got, err := parseStaleness(tc.input)
+		if (err != nil) != tc.wantError {
+			t.Errorf("%q: wanted error %t, got %v", tc.input, tc.wantError, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if got.bound.String() != tc.want.String() || got.spec != tc.wantSpec {
+			t.Errorf("%q: want %v %q, got %v %q", tc.input, tc.want, tc.wantSpec, got.bound, got.spec)
+		}
+	}
+}
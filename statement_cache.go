@@ -0,0 +1,112 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rakyll/go-sql-driver-spanner/internal"
+)
+
+const (
+	// statementCacheSize is the number of parsed
+	// statements that are cached by their SQL text.
+	statementCacheSize = 1000
+
+	// maxCachedStatementLength is the length of the longest statement
+	// that is cached. Longer statements usually contain literals and
+	// are rarely executed again.
+	maxCachedStatementLength = 16 << 10
+)
+
+var (
+	statementCache   = internal.NewLRU[string, *parsedStatement](statementCacheSize)
+	pgStatementCache = internal.NewLRU[string, *parsedStatement](statementCacheSize)
+)
+
+// parsedStatement is the result of parsing the SQL text of a
+// statement. It is shared by all executions of the statement
+// and must not be modified.
+type parsedStatement struct {
+	// clientSide is the client-side statement, if any,
+	// and clientSideParams its parameters.
+	clientSide       *clientSideStatement
+	clientSideParams []string
+
+	typ internal.StatementType
+
+	// sql is the SQL text that is sent to Spanner. It is the query
+	// with ? placeholders replaced by @p1, @p2 and so on.
+	sql string
+
+	// statements are the semicolon-separated statements.
+	statements []string
+
+	// postgreSQL is set for statements of PostgreSQL-dialect
+	// databases, see parsePGStatement.
+	postgreSQL bool
+
+	// params are the names of the parameters in the order of
+	// their first occurrence, see internal.ParamNames.
+	params []string
+}
+
+// parseStatement parses query, or returns the cached result.
+func parseStatement(query string) *parsedStatement {
+	if p, ok := statementCache.Get(query); ok {
+		return p
+	}
+	p := &parsedStatement{typ: internal.ParseStatementType(query), sql: query}
+	p.clientSide, p.clientSideParams = matchClientSideStatement(query)
+	if p.typ != internal.StatementTypeDDL && strings.IndexByte(query, '?') >= 0 {
+		p.sql = internal.ConvertPositionalParams(query, nil)
+	}
+	p.statements = internal.SplitStatements(p.sql)
+	p.params = internal.ParamNames(p.sql)
+	if len(query) <= maxCachedStatementLength {
+		statementCache.Add(query, p)
+	}
+	return p
+}
+
+// parsePGStatement parses query of a PostgreSQL-dialect database,
+// or returns the cached result. The parameters $1, $2 and so on of
+// the query are named p1, p2 and so on.
+func parsePGStatement(query string) *parsedStatement {
+	if p, ok := pgStatementCache.Get(query); ok {
+		return p
+	}
+	p := &parsedStatement{typ: internal.ParseStatementType(query), sql: query, postgreSQL: true}
+	p.clientSide, p.clientSideParams = matchClientSideStatement(query)
+	p.statements = internal.SplitStatements(query)
+	p.params = internal.PGParamNames(query)
+	if len(query) <= maxCachedStatementLength {
+		pgStatementCache.Add(query, p)
+	}
+	return p
+}
+
+// paramNames returns the names of the first n parameters, which
+// positional arguments are bound to.
+func (p *parsedStatement) paramNames(n int) ([]string, error) {
+	if n == -1 {
+		return p.params, nil
+	}
+	if len(p.params) < n {
+		return nil, fmt.Errorf("query has %d placeholders but %d arguments are provided", len(p.params), n)
+	}
+	return p.params[:n], nil
+}
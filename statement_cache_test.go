@@ -0,0 +1,84 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rakyll/go-sql-driver-spanner/internal"
+)
+
+func TestParseStatement(t *testing.T) {
+	q := "/* hot */ UPDATE Singers SET Name = @name WHERE SingerId = @id"
+	p := parseStatement(q)
+	if p.typ != internal.StatementTypeDML || p.clientSide != nil {
+		t.Errorf("got type %v and client-side statement %v, want DML", p.typ, p.clientSide)
+	}
+	if want := []string{"name", "id"}; !reflect.DeepEqual(p.params, want) {
+		t.Errorf("params = %v, want %v", p.params, want)
+	}
+	if parseStatement(q) != p {
+		t.Error("the statement was parsed again")
+	}
+	if names, err := p.paramNames(1); err != nil || !reflect.DeepEqual(names, []string{"name"}) {
+		t.Errorf("paramNames(1) = %v, %v", names, err)
+	}
+	if _, err := p.paramNames(3); err == nil {
+		t.Error("paramNames(3): expected error")
+	}
+
+	cs := parseStatement("SAVEPOINT sp1")
+	if cs.clientSide == nil || !reflect.DeepEqual(cs.clientSideParams, []string{"sp1"}) {
+		t.Errorf("SAVEPOINT: got %v %v", cs.clientSide, cs.clientSideParams)
+	}
+
+	pos := parseStatement("SELECT Name FROM Singers WHERE SingerId = ? AND Name != '?'")
+	if want := "SELECT Name FROM Singers WHERE SingerId = @p1 AND Name != '?'"; pos.sql != want {
+		t.Errorf("got SQL %q, want %q", pos.sql, want)
+	}
+	if want := []string{"p1"}; !reflect.DeepEqual(pos.params, want) {
+		t.Errorf("params = %v, want %v", pos.params, want)
+	}
+
+	pg := parsePGStatement("UPDATE singers SET name = $2 WHERE id = $1 AND note != '$3'")
+	if want := []string{"p1", "p2"}; !pg.postgreSQL || !reflect.DeepEqual(pg.params, want) {
+		t.Errorf("PostgreSQL params = %v, want %v", pg.params, want)
+	}
+
+	long := "SELECT '" + strings.Repeat("x", maxCachedStatementLength) + "'"
+	if parseStatement(long) == parseStatement(long) {
+		t.Error("a statement that is too long was cached")
+	}
+}
+
+func TestSpannerStatement(t *testing.T) {
+	q := "UPDATE Singers SET Name = @name WHERE SingerId = @id"
+	p := parseStatement(q)
+	args := []driver.NamedValue{{Ordinal: 1, Value: "Alice"}, {Ordinal: 2, Name: "id", Value: int64(1)}}
+	ss, err := p.spannerStatement(q, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]interface{}{"name": "Alice", "id": int64(1)}; ss.SQL != q || !reflect.DeepEqual(ss.Params, want) {
+		t.Errorf("got %q with %v, want %v", ss.SQL, ss.Params, want)
+	}
+	// Only the parameter map is allocated per execution.
+	if n := testing.AllocsPerRun(100, func() { p.spannerStatement(q, args) }); n > 2 {
+		t.Errorf("%v allocations per execution, want at most 2", n)
+	}
+}
@@ -24,17 +24,27 @@ import (
 )
 
 type stmt struct {
-	conn    *conn
-	numArgs int
-	query   string
+	conn   *conn
+	query  string
+	parsed *parsedStatement
 }
 
 func (s *stmt) Close() error {
 	return nil
 }
 
+// NumInput returns the number of distinct query parameters of the
+// statement, so that database/sql checks the number of arguments. It
+// returns -1 for DDL statements, which take proto descriptors as
+// arguments, and 0 for client-side statements.
 func (s *stmt) NumInput() int {
-	return s.numArgs
+	switch {
+	case s.parsed.clientSide != nil:
+		return 0
+	case s.parsed.typ == internal.StatementTypeDDL:
+		return -1
+	}
+	return len(s.parsed.params)
 }
 
 func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
@@ -50,24 +60,22 @@ func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
 }
 
 func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-	ss, err := prepareSpannerStmt(s.query, args)
-	if err != nil {
-		return nil, err
-	}
+	return s.conn.queryContext(ctx, s.query, args)
+}
 
-	var it *spanner.RowIterator
-	if s.conn.roTx != nil {
-		it = s.conn.roTx.Query(ctx, ss)
-	} else if s.conn.rwTx != nil {
-		it = s.conn.rwTx.Query(ctx, ss)
-	} else {
-		it = s.conn.client.Single().Query(ctx, ss)
+func (c *conn) prepareSpannerStmt(ctx context.Context, q string, args []driver.NamedValue) (spanner.Statement, error) {
+	p, err := c.parse(ctx, q)
+	if err != nil {
+		return spanner.Statement{}, err
 	}
-	return &rows{it: it}, nil
+	return p.spannerStatement(p.sql, args)
 }
 
-func prepareSpannerStmt(q string, args []driver.NamedValue) (spanner.Statement, error) {
-	names, err := internal.NamedValueParamNames(q, len(args))
+// spannerStatement binds args to the parsed statement q. Positional
+// arguments get the names of the parameters that were parsed with
+// the statement, so no parsing happens per execution.
+func (p *parsedStatement) spannerStatement(q string, args []driver.NamedValue) (spanner.Statement, error) {
+	names, err := p.paramNames(len(args))
 	if err != nil {
 		return spanner.Statement{}, err
 	}
@@ -0,0 +1,76 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+
+	"cloud.google.com/go/spanner"
+)
+
+type requestTagKey struct{}
+
+// WithRequestTag returns a context that tags the queries and DML
+// statements that are executed with it. Spanner reports the tag in
+// its query statistics, and the driver adds it to the spans of the
+// statements:
+//
+//	ctx = spannerdriver.WithRequestTag(ctx, "app=shop,action=checkout")
+//	rows, err := db.QueryContext(ctx, "SELECT * FROM Orders")
+func WithRequestTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, requestTagKey{}, tag)
+}
+
+// requestTag returns the request tag of ctx, if any.
+func requestTag(ctx context.Context) string {
+	tag, _ := ctx.Value(requestTagKey{}).(string)
+	return tag
+}
+
+// withDefaultRequestTag returns ctx tagged with the request tag
+// that the RequestTag function of the driver returns for query,
+// if ctx has no request tag.
+func (c *conn) withDefaultRequestTag(ctx context.Context, query string) context.Context {
+	if c.requestTag == nil || requestTag(ctx) != "" {
+		return ctx
+	}
+	if tag := c.requestTag(ctx, query); tag != "" {
+		return WithRequestTag(ctx, tag)
+	}
+	return ctx
+}
+
+// querier is implemented by the single-use, read-only
+// and read-write transactions of the spanner client.
+type querier interface {
+	Query(ctx context.Context, stmt spanner.Statement) *spanner.RowIterator
+	QueryWithOptions(ctx context.Context, stmt spanner.Statement, opts spanner.QueryOptions) *spanner.RowIterator
+}
+
+// taggedQuery runs stmt in tx with the request tag of ctx.
+func taggedQuery(ctx context.Context, tx querier, stmt spanner.Statement) *spanner.RowIterator {
+	if tag := requestTag(ctx); tag != "" {
+		return tx.QueryWithOptions(ctx, stmt, spanner.QueryOptions{RequestTag: tag})
+	}
+	return tx.Query(ctx, stmt)
+}
+
+// taggedUpdate executes stmt in tx with the request tag of ctx.
+func taggedUpdate(ctx context.Context, tx *spanner.ReadWriteTransaction, stmt spanner.Statement) (int64, error) {
+	if tag := requestTag(ctx); tag != "" {
+		return tx.UpdateWithOptions(ctx, stmt, spanner.QueryOptions{RequestTag: tag})
+	}
+	return tx.Update(ctx, stmt)
+}
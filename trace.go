@@ -0,0 +1,202 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc/metadata"
+)
+
+// tracerName is the instrumentation scope of the spans of the driver.
+const tracerName = "github.com/rakyll/go-sql-driver-spanner"
+
+// Values of the spanner.transaction_type attribute.
+const (
+	txTypeSingleUse = "single_use"
+	txTypeReadOnly  = "read_only"
+	txTypeReadWrite = "read_write"
+)
+
+// Attributes of the spans of the driver, in addition to the
+// OpenTelemetry database attributes.
+const (
+	attrStatementType   = attribute.Key("spanner.statement_type")
+	attrRequestTag      = attribute.Key("spanner.request_tag")
+	attrTransactionType = attribute.Key("spanner.transaction_type")
+	attrRetryCount      = attribute.Key("spanner.retry_count")
+)
+
+var noopTracer = noop.NewTracerProvider().Tracer(tracerName)
+
+// newTracer returns the tracer of tp, or of the global
+// tracer provider if tp is nil.
+func newTracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// startSpan starts a span of the connection. The RPCs that are made
+// with the returned context are traced as children of the span.
+func (c *conn) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := c.tracer
+	if tracer == nil {
+		tracer = noopTracer
+	}
+	attrs = append(attrs,
+		attribute.String("db.system.name", "gcp.spanner"),
+		attribute.String("db.namespace", c.name),
+	)
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// startStatementSpan starts the span of a query or an executed statement.
+func (c *conn) startStatementSpan(ctx context.Context, kind StatementKind, query string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.operation.name", kind.String()),
+		attribute.String("db.query.text", query),
+		attrStatementType.String(statementType(query)),
+		attrTransactionType.String(c.transactionType()),
+	}
+	if tag := requestTag(ctx); tag != "" {
+		attrs = append(attrs, attrRequestTag.String(tag))
+	}
+	return c.startSpan(ctx, "spanner."+kind.String(), attrs...)
+}
+
+// txTelemetry traces and measures the Commit
+// and Rollback of a transaction.
+type txTelemetry struct {
+	ctx    context.Context
+	conn   *conn
+	txType string
+	begin  time.Time
+}
+
+func (t *txTelemetry) commit() func(attempts int, err error) {
+	return t.start("Commit", false)
+}
+
+func (t *txTelemetry) rollback() func(attempts int, err error) {
+	return t.start("Rollback", true)
+}
+
+// start starts the span of the Commit or Rollback of the transaction.
+// The returned function ends it with the number of attempts of the
+// transaction, if known, and records the outcome.
+func (t *txTelemetry) start(operation string, rollback bool) func(attempts int, err error) {
+	if t == nil {
+		return func(int, error) {}
+	}
+	_, span := t.conn.startSpan(t.ctx, "spanner."+operation, attrTransactionType.String(t.txType))
+	return func(attempts int, err error) {
+		if attempts > 0 {
+			span.SetAttributes(retryCount(attempts))
+		}
+		endSpan(span, err)
+		t.conn.metrics.transactionEnded(t.ctx, t.txType, transactionOutcome(rollback, err))
+		t.conn.metrics.failed(t.ctx, operation, err)
+		t.hook(rollback, attempts, err)
+	}
+}
+
+// hook calls OnTxCommit or OnTxRollback, and OnError
+// if the transaction failed to commit or roll back.
+func (t *txTelemetry) hook(rollback bool, attempts int, err error) {
+	hooks := t.conn.hooks
+	if hooks == nil {
+		return
+	}
+	e := TxEvent{ReadOnly: t.txType == txTypeReadOnly, Duration: time.Since(t.begin), Attempts: attempts, Err: err}
+	if rollback {
+		hooks.OnTxRollback(t.ctx, e)
+	} else {
+		hooks.OnTxCommit(t.ctx, e)
+	}
+	t.conn.hookError(t.ctx, err)
+}
+
+// propagateTraceContext returns ctx with the W3C trace context of its
+// span in the outgoing gRPC metadata, so that Spanner can join its
+// server-side traces and statistics with the trace of the statement.
+// A traceparent header that is already set is kept.
+func propagateTraceContext(ctx context.Context) context.Context {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get("traceparent")) > 0 {
+		return ctx
+	}
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	kv := make([]string, 0, 2*len(carrier))
+	for k, v := range carrier {
+		kv = append(kv, k, v)
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// statementType returns the value of the spanner.statement_type
+// attribute of query: query, dml, ddl, client_side or unknown.
+func statementType(query string) string {
+	p := parseStatement(query)
+	if p.clientSide != nil {
+		return "client_side"
+	}
+	return strings.ToLower(p.typ.String())
+}
+
+// transactionType returns the type of the transaction that
+// statements of the connection are executed in.
+func (c *conn) transactionType() string {
+	switch {
+	case c.roTx != nil:
+		return txTypeReadOnly
+	case c.rwTx != nil:
+		return txTypeReadWrite
+	}
+	return txTypeSingleUse
+}
+
+// retryCount returns the spanner.retry_count attribute of a
+// read-write transaction that ran attempts times.
+func retryCount(attempts int) attribute.KeyValue {
+	return attrRetryCount.Int(max(attempts-1, 0))
+}
+
+// setSpanError records err on span, if err is not nil.
+func setSpanError(span trace.Span, err error) {
+	if err == nil || span == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// endSpan records err on span and ends it.
+func endSpan(span trace.Span, err error) {
+	setSpanError(span, err)
+	span.End()
+}
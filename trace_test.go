@@ -0,0 +1,180 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	grpccodes "google.golang.org/grpc/codes"
+)
+
+// sendRow streams a result with a single INT64 column and row.
+func sendRow(stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+	return stream.Send(&sppb.PartialResultSet{
+		Metadata: &sppb.ResultSetMetadata{RowType: &sppb.StructType{Fields: []*sppb.StructType_Field{
+			{Name: "Id", Type: &sppb.Type{Code: sppb.TypeCode_INT64}},
+		}}},
+		Values: []*structpb.Value{stringValue("1")},
+	})
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestQuerySpan(t *testing.T) {
+	var tag string
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	db := openFakeSpannerWithDriver(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		tag = req.GetRequestOptions().GetRequestTag()
+		return sendRow(stream)
+	}}, &Driver{TracerProvider: tp})
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "parent")
+	rows, err := db.QueryContext(WithRequestTag(ctx, "app=test"), "SELECT Id FROM Singers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rows.Next() {
+		t.Fatalf("no row: %v", rows.Err())
+	}
+	if len(recorder.Ended()) != 0 {
+		t.Errorf("the span ended before the rows were closed")
+	}
+	rows.Close()
+	parent.End()
+
+	if tag != "app=test" {
+		t.Errorf("got request tag %q, want app=test", tag)
+	}
+	spans := recorder.Ended()
+	if len(spans) != 2 || spans[0].Name() != "spanner.Query" {
+		t.Fatalf("got spans %v, want spanner.Query and parent", spans)
+	}
+	span := spans[0]
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("the query span is not a child of the span of the context")
+	}
+	attrs := spanAttributes(span)
+	for k, want := range map[attribute.Key]string{
+		attrStatementType:   "query",
+		attrRequestTag:      "app=test",
+		attrTransactionType: txTypeSingleUse,
+		"db.query.text":     "SELECT Id FROM Singers",
+	} {
+		if got := attrs[k].AsString(); got != want {
+			t.Errorf("%s = %q, want %q", k, got, want)
+		}
+	}
+}
+
+func TestTransactionSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	db := openFakeSpannerWithDriver(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		return sendRow(stream)
+	}}, &Driver{TracerProvider: tp})
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int64
+	if err := tx.QueryRowContext(ctx, "SELECT Id FROM Singers").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, span := range recorder.Ended() {
+		names = append(names, span.Name())
+		if got := spanAttributes(span)[attrTransactionType].AsString(); got != txTypeReadOnly {
+			t.Errorf("%s: got transaction type %q, want %q", span.Name(), got, txTypeReadOnly)
+		}
+	}
+	want := []string{"spanner.Begin", "spanner.Query", "spanner.Commit"}
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] || names[2] != want[2] {
+		t.Errorf("got spans %v, want %v", names, want)
+	}
+}
+
+func TestQuerySpanError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	db := openFakeSpannerWithDriver(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		return status.Error(grpccodes.InvalidArgument, "Table not found: Singers")
+	}}, &Driver{TracerProvider: tp})
+
+	if _, err := db.QueryContext(context.Background(), "SELECT Id FROM Singers"); err == nil {
+		t.Fatal("want an error")
+	}
+	spans := recorder.Ended()
+	if len(spans) != 1 || spans[0].Status().Code != codes.Error {
+		t.Errorf("got spans %v, want a spanner.Query span with an error", spans)
+	}
+}
+
+func TestPropagateTraceContext(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	var traceparent, tag string
+	db := openFakeSpannerWithDriver(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		traceparent = strings.Join(md.Get("traceparent"), ",")
+		tag = req.GetRequestOptions().GetRequestTag()
+		return sendRow(stream)
+	}}, &Driver{TracerProvider: tp, RequestTag: func(ctx context.Context, query string) string {
+		return "action=" + strings.Fields(query)[0]
+	}})
+
+	ctx, span := tp.Tracer("test").Start(context.Background(), "handler")
+	defer span.End()
+	var id int64
+	if err := db.QueryRowContext(ctx, "SELECT Id FROM Singers").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if traceID := span.SpanContext().TraceID().String(); !strings.Contains(traceparent, traceID) {
+		t.Errorf("got traceparent %q, want trace ID %s", traceparent, traceID)
+	}
+	if tag != "action=SELECT" {
+		t.Errorf("got request tag %q, want action=SELECT", tag)
+	}
+
+	if err := db.QueryRowContext(WithRequestTag(ctx, "app=test"), "SELECT Id FROM Singers").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if tag != "app=test" {
+		t.Errorf("got request tag %q, want the tag of the context", tag)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// TransportStats contains transport-level counters of a connection.
+// They help to tell network issues apart from problems on the
+// Spanner side.
+type TransportStats struct {
+	// Retries is the number of RPC attempts with which the Spanner
+	// client retried an RPC that failed, e.g. with UNAVAILABLE.
+	Retries int64
+
+	// StreamRestarts is the number of streaming queries and reads
+	// that were resumed from a resume token after a failure. They
+	// are included in Retries.
+	StreamRestarts int64
+
+	// GoAways is the number of RPCs that failed because the
+	// server was draining the connection (GOAWAY).
+	GoAways int64
+}
+
+// transportStats records TransportStats through gRPC interceptors.
+type transportStats struct {
+	retries        int64
+	streamRestarts int64
+	goAways        int64
+
+	// succeeded is set once an RPC succeeded, which proves that
+	// the database exists and the credentials are accepted.
+	succeeded atomic.Bool
+
+	sessions sessionStats
+
+	// metrics records the commit statistics of transactions.
+	metrics *driverMetrics
+}
+
+func (s *transportStats) snapshot() TransportStats {
+	return TransportStats{
+		Retries:        atomic.LoadInt64(&s.retries),
+		StreamRestarts: atomic.LoadInt64(&s.streamRestarts),
+		GoAways:        atomic.LoadInt64(&s.goAways),
+	}
+}
+
+// clientOptions returns the client options that install
+// the interceptors on the gRPC channels.
+func (s *transportStats) clientOptions() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(s.unaryInterceptor)),
+		option.WithGRPCDialOption(grpc.WithChainStreamInterceptor(s.streamInterceptor)),
+	}
+}
+
+// recordAttempt counts the RPC with the given request ID
+// as a retry if it isn't the first attempt of the RPC.
+func (s *transportStats) recordAttempt(id string) {
+	if requestAttempt(id) > 1 {
+		atomic.AddInt64(&s.retries, 1)
+	}
+}
+
+func (s *transportStats) recordError(err error) {
+	if isGoAway(err) {
+		atomic.AddInt64(&s.goAways, 1)
+	}
+}
+
+func (s *transportStats) unaryInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	ctx = propagateTraceContext(ctx)
+	recordSessionWait(ctx, method)
+	recorders := rpcRecorders(ctx)
+	start := time.Now()
+	id := requestID(ctx, opts)
+	s.recordAttempt(id)
+	if len(recorders) > 0 {
+		rpc := RPC{Method: method, RequestID: id}
+		var header metadata.MD
+		opts = append(opts, grpc.Header(&header))
+		defer func() { recordRPC(recorders, rpc, start, header) }()
+	}
+	err := invoker(ctx, method, req, reply, cc, opts...)
+	if method == commitMethod && err == nil {
+		s.metrics.committed(ctx, req, reply, time.Since(start))
+	}
+	s.sessions.observe(method, reply, err)
+	if err == nil {
+		s.succeeded.Store(true)
+	}
+	s.recordError(err)
+	return err
+}
+
+func (s *transportStats) streamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	ctx = propagateTraceContext(ctx)
+	recordSessionWait(ctx, method)
+	recorders := rpcRecorders(ctx)
+	rpc := RPC{Method: method, RequestID: requestID(ctx, opts)}
+	s.recordAttempt(rpc.RequestID)
+	start := time.Now()
+	stream, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		recordRPC(recorders, rpc, start, nil)
+		s.recordError(err)
+		return nil, err
+	}
+	return &statsClientStream{ClientStream: stream, stats: s, recorders: recorders, rpc: rpc, start: start}, nil
+}
+
+type statsClientStream struct {
+	grpc.ClientStream
+	stats *transportStats
+
+	// recorders record rpc, which started at start, with its
+	// response headers when the first response arrives.
+	recorders []*RPCRecorder
+	rpc       RPC
+	start     time.Time
+}
+
+func (cs *statsClientStream) SendMsg(m interface{}) error {
+	// ExecuteSqlRequest and ReadRequest carry a resume token
+	// only if the client library restarts a broken stream.
+	if r, ok := m.(interface{ GetResumeToken() []byte }); ok && len(r.GetResumeToken()) > 0 {
+		atomic.AddInt64(&cs.stats.streamRestarts, 1)
+	}
+	return cs.ClientStream.SendMsg(m)
+}
+
+func (cs *statsClientStream) RecvMsg(m interface{}) error {
+	err := cs.ClientStream.RecvMsg(m)
+	if len(cs.recorders) > 0 {
+		header, _ := cs.ClientStream.Header()
+		recordRPC(cs.recorders, cs.rpc, cs.start, header)
+		cs.recorders = nil
+	}
+	if err != nil {
+		cs.stats.recordError(err)
+	} else {
+		cs.stats.succeeded.Store(true)
+	}
+	return err
+}
+
+// goAwayStatuses are the statuses with which gRPC fails RPCs because
+// the server sent a GOAWAY: streams that the server rejected, and
+// streams that were started on a connection that is draining.
+var goAwayStatuses = []*status.Status{
+	status.New(codes.Unavailable, "the stream is rejected because server is draining the connection"),
+	status.New(codes.Unavailable, "the connection is draining"),
+}
+
+// isGoAway reports whether err is one of the statuses
+// that gRPC returns for RPCs that a GOAWAY cut off.
+func isGoAway(err error) bool {
+	s, ok := status.FromError(err)
+	if !ok || s.Code() != codes.Unavailable {
+		return false
+	}
+	for _, g := range goAwayStatuses {
+		if proto.Equal(s.Proto(), g.Proto()) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestAttempt returns the attempt of a Spanner request ID, which
+// is its last part, e.g. 2 for 1.6b7f3c1a2d4e5f60.1.1.7.2. It returns
+// 0 if the ID has no attempt.
+func requestAttempt(id string) int {
+	i := strings.LastIndexByte(id, '.')
+	if i < 0 {
+		return 0
+	}
+	n, _ := strconv.Atoi(id[i+1:])
+	return n
+}
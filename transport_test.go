@@ -0,0 +1,80 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type fakeClientStream struct {
+	grpc.ClientStream
+	recvErr error
+}
+
+func (s *fakeClientStream) SendMsg(m interface{}) error { return nil }
+func (s *fakeClientStream) RecvMsg(m interface{}) error { return s.recvErr }
+
+func TestTransportStats(t *testing.T) {
+	ctx := context.Background()
+	stats := &transportStats{}
+
+	// The Spanner client numbers the attempts of an RPC in
+	// the last part of its request ID.
+	attempt := func(id string) context.Context {
+		return metadata.AppendToOutgoingContext(ctx, requestIDHeader, id)
+	}
+	for _, call := range []struct {
+		id  string
+		err error
+	}{
+		{"1.abc.1.1.1.1", nil},
+		{"1.abc.1.1.2.1", status.Error(codes.NotFound, "not found")},
+		{"1.abc.1.1.3.1", status.Error(codes.Unavailable, "transport is closing")},
+		{"1.abc.1.1.3.2", status.Error(codes.Unavailable, "the connection is draining")},
+		{"1.abc.1.1.3.3", nil},
+		{"1.abc.1.1.4.1", status.Error(codes.Unavailable, "Spanner is draining the instance")},
+	} {
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return call.err
+		}
+		stats.unaryInterceptor(attempt(call.id), "/google.spanner.v1.Spanner/Commit", nil, nil, nil, invoker)
+	}
+
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return &fakeClientStream{recvErr: status.Error(codes.Unavailable, "the stream is rejected because server is draining the connection")}, nil
+	}
+	for i, token := range [][]byte{nil, []byte("token")} {
+		id := fmt.Sprintf("1.abc.1.1.5.%d", i+1)
+		cs, err := stats.streamInterceptor(attempt(id), &grpc.StreamDesc{}, nil, "/google.spanner.v1.Spanner/ExecuteStreamingSql", streamer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs.SendMsg(&sppb.ExecuteSqlRequest{ResumeToken: token})
+		cs.RecvMsg(&sppb.PartialResultSet{})
+	}
+
+	want := TransportStats{Retries: 3, StreamRestarts: 1, GoAways: 3}
+	if got := stats.snapshot(); got != want {
+		t.Errorf("TransportStats test failed, want: %+v, got: %+v", want, got)
+	}
+}
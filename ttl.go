@@ -0,0 +1,84 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var rowDeletionPolicyRe = regexp.MustCompile(`(?is)^\s*OLDER_THAN\s*\(\s*([^\s,]+)\s*,\s*INTERVAL\s+(\d+)\s+DAY\s*\)\s*$`)
+
+// RowDeletionPolicy is the row deletion policy of a table, with which
+// Spanner deletes rows once the timestamp in Column is older than the
+// given number of days.
+type RowDeletionPolicy struct {
+	Column string
+	Days   int64
+}
+
+// ParseRowDeletionPolicy parses a policy expression such as
+// OLDER_THAN(CreatedAt, INTERVAL 30 DAY).
+func ParseRowDeletionPolicy(expr string) (RowDeletionPolicy, error) {
+	m := rowDeletionPolicyRe.FindStringSubmatch(expr)
+	if m == nil {
+		return RowDeletionPolicy{}, fmt.Errorf("invalid row deletion policy %q", expr)
+	}
+	days, err := strconv.ParseInt(m[2], 10, 64)
+	if err != nil {
+		return RowDeletionPolicy{}, fmt.Errorf("invalid row deletion policy %q: %v", expr, err)
+	}
+	return RowDeletionPolicy{Column: unquoteIdentifier(m[1]), Days: days}, nil
+}
+
+// String returns the policy expression.
+func (p RowDeletionPolicy) String() string {
+	return fmt.Sprintf("OLDER_THAN(%s, INTERVAL %d DAY)", quoteIdentifier(p.Column), p.Days)
+}
+
+// AlterRowDeletionPolicy returns the ALTER TABLE statement that
+// changes the row deletion policy of table from current to desired,
+// where nil is no policy, or "" if they are the same.
+func AlterRowDeletionPolicy(table string, current, desired *RowDeletionPolicy) string {
+	switch {
+	case current == nil && desired == nil:
+		return ""
+	case desired == nil:
+		return fmt.Sprintf("ALTER TABLE %s DROP ROW DELETION POLICY", quoteIdentifier(table))
+	case current == nil:
+		return fmt.Sprintf("ALTER TABLE %s ADD ROW DELETION POLICY (%s)", quoteIdentifier(table), desired)
+	case current.Days == desired.Days && equalFoldIdentifiers(current.Column, desired.Column):
+		return ""
+	default:
+		return fmt.Sprintf("ALTER TABLE %s REPLACE ROW DELETION POLICY (%s)", quoteIdentifier(table), desired)
+	}
+}
+
+// SetRowDeletionPolicy sets the row deletion policy of the table,
+// or drops it if policy is nil.
+func SetRowDeletionPolicy(ctx context.Context, db *sql.DB, table string, policy *RowDeletionPolicy) error {
+	t, err := DescribeTable(ctx, db, table)
+	if err != nil {
+		return err
+	}
+	stmt := AlterRowDeletionPolicy(table, t.RowDeletionPolicy, policy)
+	if stmt == "" {
+		return nil
+	}
+	return ExecDDL(ctx, db, stmt)
+}
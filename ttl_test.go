@@ -0,0 +1,57 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"testing"
+)
+
+func TestParseRowDeletionPolicy(t *testing.T) {
+	p, err := ParseRowDeletionPolicy("OLDER_THAN(CreatedAt, INTERVAL 30 DAY)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (RowDeletionPolicy{Column: "CreatedAt", Days: 30}); p != want {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+	if got, want := p.String(), "OLDER_THAN(`CreatedAt`, INTERVAL 30 DAY)"; got != want {
+		t.Errorf("String: got %q, want %q", got, want)
+	}
+	for _, expr := range []string{"", "OLDER_THAN(CreatedAt, INTERVAL 30 HOUR)", "OLDER_THAN(CreatedAt)"} {
+		if _, err := ParseRowDeletionPolicy(expr); err == nil {
+			t.Errorf("ParseRowDeletionPolicy(%q): expected error", expr)
+		}
+	}
+}
+
+func TestAlterRowDeletionPolicy(t *testing.T) {
+	week := &RowDeletionPolicy{Column: "CreatedAt", Days: 7}
+	month := &RowDeletionPolicy{Column: "createdat", Days: 30}
+	tests := []struct {
+		current, desired *RowDeletionPolicy
+		want             string
+	}{
+		{},
+		{current: week, desired: &RowDeletionPolicy{Column: "`createdAt`", Days: 7}},
+		{desired: week, want: "ALTER TABLE `Events` ADD ROW DELETION POLICY (OLDER_THAN(`CreatedAt`, INTERVAL 7 DAY))"},
+		{current: week, desired: month, want: "ALTER TABLE `Events` REPLACE ROW DELETION POLICY (OLDER_THAN(`createdat`, INTERVAL 30 DAY))"},
+		{current: week, want: "ALTER TABLE `Events` DROP ROW DELETION POLICY"},
+	}
+	for _, tc := range tests {
+		if got := AlterRowDeletionPolicy("Events", tc.current, tc.desired); got != tc.want {
+			t.Errorf("AlterRowDeletionPolicy(%v, %v): got %q, want %q", tc.current, tc.desired, got, tc.want)
+		}
+	}
+}
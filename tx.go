@@ -16,63 +16,482 @@ package spannerdriver
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
 	"github.com/rakyll/go-sql-driver-spanner/internal"
+	"google.golang.org/grpc/codes"
 )
 
+// ReadWriteTransactionOptions contains options for read-write
+// transactions that override the defaults of the connection.
+type ReadWriteTransactionOptions struct {
+	// MaxCommitDelay is the amount of latency the transaction is willing
+	// to accept for Spanner to batch its commit with other commits.
+	// If nil, the maxCommitDelay connection parameter is used.
+	MaxCommitDelay *time.Duration
+
+	// ExcludeTxnFromChangeStreams excludes the changes of the transaction
+	// from change streams that were created with allow_txn_exclusion=true.
+	ExcludeTxnFromChangeStreams bool
+
+	// ReadLockMode chooses between pessimistic locking, where reads
+	// acquire locks, and optimistic locking, where reads are validated
+	// at commit. If unspecified, the readLockMode connection parameter
+	// is used.
+	ReadLockMode sppb.TransactionOptions_ReadWrite_ReadLockMode
+
+	// Timeout is the time between beginning and committing the
+	// transaction after which it is rolled back. If 0, the
+	// transactionTimeout connection parameter is used.
+	Timeout time.Duration
+
+	// ReturnCommitStats requests the commit statistics of the
+	// transaction, see SpannerConn.CommitResponse. It is also
+	// enabled by the returnCommitStats connection parameter.
+	ReturnCommitStats bool
+
+	// TransactionTag tags the transaction in the transaction
+	// statistics of Spanner and the commit metrics of the driver.
+	TransactionTag string
+}
+
+type rwTxOptionsKey struct{}
+
+// WithReadWriteTransactionOptions returns a context that applies the
+// given options to the read-write transactions that are started with it,
+// including the implicit transactions of DML statements that are
+// executed outside of a transaction:
+//
+//	ctx = spannerdriver.WithReadWriteTransactionOptions(ctx, spannerdriver.ReadWriteTransactionOptions{
+//		MaxCommitDelay: &delay,
+//	})
+//	tx, err := db.BeginTx(ctx, &sql.TxOptions{})
+func WithReadWriteTransactionOptions(ctx context.Context, opts ReadWriteTransactionOptions) context.Context {
+	return context.WithValue(ctx, rwTxOptionsKey{}, opts)
+}
+
+// mergeTransactionOptions applies the options in ctx, if any, to defaults.
+func mergeTransactionOptions(ctx context.Context, defaults spanner.TransactionOptions) spanner.TransactionOptions {
+	opts, ok := ctx.Value(rwTxOptionsKey{}).(ReadWriteTransactionOptions)
+	if !ok {
+		return defaults
+	}
+	if opts.MaxCommitDelay != nil {
+		defaults.CommitOptions.MaxCommitDelay = opts.MaxCommitDelay
+	}
+	if opts.ExcludeTxnFromChangeStreams {
+		defaults.ExcludeTxnFromChangeStreams = true
+	}
+	if opts.ReadLockMode != sppb.TransactionOptions_ReadWrite_READ_LOCK_MODE_UNSPECIFIED {
+		defaults.ReadLockMode = opts.ReadLockMode
+	}
+	if opts.ReturnCommitStats {
+		defaults.CommitOptions.ReturnCommitStats = true
+	}
+	if opts.TransactionTag != "" {
+		defaults.TransactionTag = opts.TransactionTag
+	}
+	return defaults
+}
+
+// transactionTimeout returns the timeout in ctx, if any, or defaultTimeout.
+func transactionTimeout(ctx context.Context, defaultTimeout time.Duration) time.Duration {
+	if opts, ok := ctx.Value(rwTxOptionsKey{}).(ReadWriteTransactionOptions); ok && opts.Timeout > 0 {
+		return opts.Timeout
+	}
+	return defaultTimeout
+}
+
+// TransactionRetry describes a read-write transaction
+// that was retried because Spanner aborted it.
+type TransactionRetry struct {
+	// Attempts is the number of times the transaction
+	// ran, including the first attempt.
+	Attempts int
+
+	// Err is nil if the transaction committed in the
+	// last attempt. Transactions started with BeginTx
+	// are not retried: they fail after the first attempt
+	// without a TransactionRetry.
+	Err error
+}
+
+// transactionFinished records the outcome of a read-write
+// transaction that ran attempts times.
+func (c *conn) transactionFinished(attempts int, err error) {
+	c.metrics.transactionRetried(attempts)
+	c.retried = attempts > 1
+	if c.retried {
+		attrs := []slog.Attr{slog.Int("attempts", attempts)}
+		if err != nil {
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+		c.logEvent(context.Background(), slog.LevelInfo, "spanner transaction retried", attrs...)
+	}
+	if c.retried && c.onRetry != nil {
+		c.onRetry(TransactionRetry{Attempts: attempts, Err: err})
+	}
+}
+
+// ErrDDLInTransaction is returned for DDL statements in a transaction
+// unless the ddlInTransactionMode connection parameter is autocommit.
+// Spanner cannot execute DDL in a transaction.
+var ErrDDLInTransaction = errors.New("DDL statements cannot be executed in a transaction, commit it first or set ddlInTransactionMode=autocommit")
+
+// errRolledBack is the outcome of read-write transactions
+// that were rolled back, which TransactionRetry reports.
+var errRolledBack = errors.New("transaction was rolled back")
+
+// ErrAbortedDueToConcurrentModification is returned when a statement
+// that the driver replayed in a new transaction, after a rollback to a
+// savepoint, had a different result than before because other
+// transactions modified the data in the meantime. The transaction
+// can't continue and has to be run again. It matches ErrAborted.
+var ErrAbortedDueToConcurrentModification error = &Error{
+	Code: codes.Aborted,
+	Err:  errors.New("transaction was aborted due to a concurrent modification"),
+}
+
+// endTransactionForDDL ends the current transaction, if any, before
+// a DDL statement. Later statements in the database/sql transaction
+// run outside of a transaction, and its Commit and Rollback do nothing.
+func (c *conn) endTransactionForDDL() error {
+	if !c.InTransaction() {
+		return nil
+	}
+	if !c.autocommitDDL {
+		return ErrDDLInTransaction
+	}
+	if c.stmtTx != nil {
+		tx := c.stmtTx
+		c.stmtTx = nil
+		return tx.Commit()
+	}
+	if c.roTx != nil {
+		c.roTx.Close()
+		c.roTx = nil
+		return nil
+	}
+	tx := c.rwTx
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	tx.done = true
+	return nil
+}
+
 type roTx struct {
-	close func()
+	close     func()
+	telemetry *txTelemetry
 }
 
 func (tx *roTx) Commit() error {
+	tx.telemetry.commit()(0, nil)
 	tx.close()
 	return nil
 }
 
 func (tx *roTx) Rollback() error {
+	tx.telemetry.rollback()(0, nil)
 	tx.close()
 	return nil
 }
 
 type rwTx struct {
 	connector *internal.RWConnector
-	close     func()
+	begin     func() (*internal.RWConnector, error)
+	close     func(commitResp *spanner.CommitResponse, err error)
+	telemetry *txTelemetry
+
+	// err is set if the transaction can no longer be used
+	// because it timed out or rolling back to a savepoint failed.
+	err error
+
+	// statements are the DML statements that were executed
+	// successfully in this transaction and counts are their
+	// update counts. They are replayed after a rollback to
+	// a savepoint.
+	statements []spanner.Statement
+	counts     []int64
+	savepoints []savepoint
+
+	// batch is the active DML batch of the transaction.
+	batch *dmlBatch
+
+	// done is set if the transaction was committed before
+	// a DDL statement. Commit and Rollback then do nothing.
+	done bool
+
+	// audit are the audit entries of the DML statements of the
+	// transaction, which are recorded when it ends.
+	audit []AuditEntry
+
+	// mutations are buffered by the driver until commit, so
+	// that a rollback to a savepoint can discard the mutations
+	// that were buffered after it.
+	mutations []*spanner.Mutation
+}
+
+type savepoint struct {
+	name      string
+	pos       int // number of statements executed before the savepoint
+	mutations int // number of mutations buffered before the savepoint
+	audit     int // number of audit entries before the savepoint
+}
+
+// startRWConnector starts a read-write transaction and
+// waits until it is ready to execute statements.
+func startRWConnector(ctx context.Context, client *spanner.Client, opts spanner.TransactionOptions) (*internal.RWConnector, error) {
+	connector := internal.NewRWConnector(ctx, client, opts)
+
+	// TODO(jbd): Make sure we are not leaking
+	// a goroutine in connector if timeout happens.
+	select {
+	case <-connector.Ready:
+		return connector, nil
+	case err := <-connector.Errors: // If received before Ready, transaction failed to start.
+		return nil, err
+	case <-time.Tick(10 * time.Second):
+		return nil, errors.New("cannot begin transaction, timeout after 10 seconds")
+	}
 }
 
-func (tx *rwTx) Query(ctx context.Context, stmt spanner.Statement) *spanner.RowIterator {
-	tx.connector.QueryIn <- &internal.RWQueryMessage{
+// exchange sends msg to the transaction on in and returns the reply
+// from out. It fails if the transaction has ended in the meantime,
+// which happens if its context expired, e.g. because of a timeout.
+func exchange[T any](tx *rwTx, in chan<- T, out <-chan T, msg T) (T, error) {
+	select {
+	case in <- msg:
+		return <-out, nil
+	case err := <-tx.connector.Errors:
+		tx.err = fmt.Errorf("transaction is no longer usable: %w", err)
+		var zero T
+		return zero, tx.err
+	}
+}
+
+func (tx *rwTx) Query(ctx context.Context, stmt spanner.Statement) (*spanner.RowIterator, error) {
+	if tx.err != nil {
+		return nil, tx.err
+	}
+	msg, err := exchange(tx, tx.connector.QueryIn, tx.connector.QueryOut, &internal.RWQueryMessage{
 		Ctx:  ctx,
 		Stmt: stmt,
+		Tag:  requestTag(ctx),
+	})
+	if err != nil {
+		return nil, err
 	}
-	msg := <-tx.connector.QueryOut
-	return msg.It
+	return msg.It, nil
 }
 
 func (tx *rwTx) ExecContext(ctx context.Context, stmt spanner.Statement) (int64, error) {
-	tx.connector.ExecIn <- &internal.RWExecMessage{
+	if tx.err != nil {
+		return 0, tx.err
+	}
+	msg, err := exchange(tx, tx.connector.ExecIn, tx.connector.ExecOut, &internal.RWExecMessage{
 		Ctx:  ctx,
 		Stmt: stmt,
+		Tag:  requestTag(ctx),
+	})
+	if err != nil {
+		return 0, err
+	}
+	if msg.Error == nil {
+		tx.statements = append(tx.statements, stmt)
+		tx.counts = append(tx.counts, msg.Rows)
 	}
-	msg := <-tx.connector.ExecOut
 	return msg.Rows, msg.Error
 }
 
 func (tx *rwTx) Commit() error {
-	tx.connector.CommitIn <- struct{}{}
-	err := <-tx.connector.Errors
-	if err == nil {
-		tx.close()
+	if tx.done {
+		return nil
 	}
-	return err
+	end := tx.telemetry.commit()
+	err := tx.commit()
+	end(tx.attempts(), err)
+	return newError(err)
+}
+
+// attempts returns the number of times the transaction ran.
+func (tx *rwTx) attempts() int {
+	if tx.connector == nil {
+		return 0
+	}
+	return tx.connector.Attempts()
+}
+
+func (tx *rwTx) commit() error {
+	if tx.err != nil {
+		// The underlying transaction has already been rolled back.
+		tx.close(nil, tx.err)
+		return tx.err
+	}
+	if tx.batch != nil {
+		// database/sql releases the connection after a failed
+		// commit too, so the transaction must not stay open.
+		tx.batch = nil
+		tx.rollback()
+		return errors.New("cannot commit while a DML batch is active, the transaction was rolled back; run or abort the batch first")
+	}
+	if len(tx.mutations) > 0 {
+		msg, err := exchange(tx, tx.connector.BufferIn, tx.connector.BufferOut, &internal.RWBufferMessage{Mutations: tx.mutations})
+		if err != nil {
+			tx.close(nil, err)
+			return err
+		}
+		if msg.Error != nil {
+			tx.rollback()
+			return msg.Error
+		}
+	}
+	var err error
+	select {
+	case tx.connector.CommitIn <- struct{}{}:
+		err = <-tx.connector.Errors
+	case err = <-tx.connector.Errors:
+		// The transaction ended before it was committed.
+		if err == nil {
+			err = errors.New("transaction ended before commit")
+		}
+	}
+	if err != nil {
+		tx.err = err
+		tx.close(nil, err)
+		return err
+	}
+	tx.close(&tx.connector.CommitResponse, nil)
+	return nil
 }
 
 func (tx *rwTx) Rollback() error {
-	tx.connector.RollbackIn <- struct{}{}
-	err := <-tx.connector.Errors
-	if err == internal.ErrAborted {
-		tx.close()
+	if tx.done {
+		return nil
+	}
+	end := tx.telemetry.rollback()
+	err := tx.rollback()
+	end(tx.attempts(), err)
+	return newError(err)
+}
+
+func (tx *rwTx) rollback() error {
+	if tx.err != nil {
+		// The underlying transaction has already been rolled back.
+		tx.close(nil, tx.err)
+		return nil
+	}
+	var err error
+	ended := false
+	select {
+	case tx.connector.RollbackIn <- struct{}{}:
+		err = <-tx.connector.Errors
+	case err = <-tx.connector.Errors:
+		// The transaction has already ended, e.g. because it timed out.
+		ended = true
+	}
+	// The transaction has ended, whether or not the rollback succeeded.
+	if err == nil || err == internal.ErrAborted {
+		tx.close(nil, errRolledBack)
+	} else {
+		tx.close(nil, err)
+	}
+	if ended || err == internal.ErrAborted {
 		return nil
 	}
 	return err
 }
+
+// abort rolls back the underlying transaction and returns
+// internal.ErrAborted, or returns the error with which the
+// transaction has already ended.
+func (tx *rwTx) abort() error {
+	select {
+	case tx.connector.RollbackIn <- struct{}{}:
+		return <-tx.connector.Errors
+	case err := <-tx.connector.Errors:
+		return err
+	}
+}
+
+func (tx *rwTx) savepoint(name string) {
+	tx.savepoints = append(tx.savepoints, savepoint{name: name, pos: len(tx.statements), mutations: len(tx.mutations), audit: len(tx.audit)})
+}
+
+// findSavepoint returns the index of the last savepoint
+// with the given name, or -1 if there is none.
+func (tx *rwTx) findSavepoint(name string) int {
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if strings.EqualFold(tx.savepoints[i].name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (tx *rwTx) releaseSavepoint(name string) error {
+	i := tx.findSavepoint(name)
+	if i < 0 {
+		return fmt.Errorf("savepoint %q does not exist", name)
+	}
+	tx.savepoints = tx.savepoints[:i]
+	return nil
+}
+
+// rollbackToSavepoint undoes the statements that were executed after
+// the savepoint. Spanner does not support partial rollbacks, so the
+// transaction is rolled back and the statements that were executed
+// before the savepoint are replayed in a new transaction. The replay
+// fails if a statement returns a different update count than before,
+// as the transaction would then see different data.
+//
+// Only DML statements are replayed. Queries are not replayed and do
+// not hold locks in the new transaction until they are executed again.
+func (tx *rwTx) rollbackToSavepoint(ctx context.Context, name string) error {
+	if tx.err != nil {
+		return tx.err
+	}
+	i := tx.findSavepoint(name)
+	if i < 0 {
+		return fmt.Errorf("savepoint %q does not exist", name)
+	}
+	sp := tx.savepoints[i]
+	tx.savepoints = tx.savepoints[:i+1]
+	tx.mutations = tx.mutations[:sp.mutations]
+	tx.audit = tx.audit[:sp.audit]
+	if sp.pos == len(tx.statements) {
+		return nil // Nothing to undo.
+	}
+
+	if err := tx.abort(); err != internal.ErrAborted {
+		tx.err = fmt.Errorf("transaction is no longer usable, rollback to savepoint %q failed: %v", name, err)
+		return tx.err
+	}
+	connector, err := tx.begin()
+	if err != nil {
+		tx.err = fmt.Errorf("transaction is no longer usable, rollback to savepoint %q failed: %v", name, err)
+		return tx.err
+	}
+	tx.connector = connector
+
+	statements, counts := tx.statements[:sp.pos], tx.counts[:sp.pos]
+	tx.statements, tx.counts = nil, nil
+	for i, stmt := range statements {
+		n, err := tx.ExecContext(ctx, stmt)
+		if err == nil && n != counts[i] {
+			err = fmt.Errorf("%w: update count changed from %d to %d", ErrAbortedDueToConcurrentModification, counts[i], n)
+		}
+		if err != nil {
+			tx.abort()
+			tx.err = fmt.Errorf("transaction is no longer usable, replay after rollback to savepoint %q failed: %w", name, err)
+			return tx.err
+		}
+	}
+	return nil
+}
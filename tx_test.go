@@ -0,0 +1,503 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	sppb "cloud.google.com/go/spanner/apiv1/spannerpb"
+	"github.com/rakyll/go-sql-driver-spanner/internal"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestMergeTransactionOptions(t *testing.T) {
+	connDelay := 10 * time.Millisecond
+	txDelay := 200 * time.Millisecond
+	defaults := spanner.TransactionOptions{CommitOptions: spanner.CommitOptions{MaxCommitDelay: &connDelay}}
+
+	got := mergeTransactionOptions(context.Background(), defaults)
+	if *got.CommitOptions.MaxCommitDelay != connDelay {
+		t.Errorf("without context options: want %v, got %v", connDelay, *got.CommitOptions.MaxCommitDelay)
+	}
+
+	ctx := WithReadWriteTransactionOptions(context.Background(), ReadWriteTransactionOptions{MaxCommitDelay: &txDelay})
+	got = mergeTransactionOptions(ctx, defaults)
+	if *got.CommitOptions.MaxCommitDelay != txDelay {
+		t.Errorf("with context options: want %v, got %v", txDelay, *got.CommitOptions.MaxCommitDelay)
+	}
+	if got.ExcludeTxnFromChangeStreams {
+		t.Errorf("with context options: transaction unexpectedly excluded from change streams")
+	}
+
+	ctx = WithReadWriteTransactionOptions(context.Background(), ReadWriteTransactionOptions{
+		ExcludeTxnFromChangeStreams: true,
+		ReadLockMode:                sppb.TransactionOptions_ReadWrite_OPTIMISTIC,
+	})
+	got = mergeTransactionOptions(ctx, defaults)
+	if !got.ExcludeTxnFromChangeStreams || *got.CommitOptions.MaxCommitDelay != connDelay {
+		t.Errorf("with exclusion: want excluded transaction with delay %v, got %+v", connDelay, got)
+	}
+	if got.ReadLockMode != sppb.TransactionOptions_ReadWrite_OPTIMISTIC {
+		t.Errorf("with read lock mode: want %v, got %v", sppb.TransactionOptions_ReadWrite_OPTIMISTIC, got.ReadLockMode)
+	}
+
+	ctx = WithReadWriteTransactionOptions(context.Background(), ReadWriteTransactionOptions{
+		ReturnCommitStats: true,
+		TransactionTag:    "app=shop,action=checkout",
+	})
+	got = mergeTransactionOptions(ctx, defaults)
+	if !got.CommitOptions.ReturnCommitStats || got.TransactionTag != "app=shop,action=checkout" {
+		t.Errorf("with commit stats and tag: got %+v", got)
+	}
+	if defaults.CommitOptions.ReturnCommitStats {
+		t.Errorf("defaults were modified: %+v", defaults)
+	}
+	if *defaults.CommitOptions.MaxCommitDelay != connDelay {
+		t.Errorf("defaults were modified: %v", *defaults.CommitOptions.MaxCommitDelay)
+	}
+}
+
+func TestSavepoints(t *testing.T) {
+	ctx := context.Background()
+	tx := &rwTx{}
+
+	tx.savepoint("a")
+	tx.statements = append(tx.statements, spanner.NewStatement("UPDATE T SET V = 1 WHERE TRUE"))
+	tx.counts = append(tx.counts, 1)
+	tx.savepoint("b")
+	tx.savepoint("c")
+
+	if err := tx.releaseSavepoint("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.releaseSavepoint("c"); err == nil {
+		t.Error("released savepoint c twice")
+	}
+	// No statements were executed after b, so nothing is rolled back.
+	if err := tx.rollbackToSavepoint(ctx, "B"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.rollbackToSavepoint(ctx, "unknown"); err == nil {
+		t.Error("rolled back to unknown savepoint")
+	}
+	if got := len(tx.savepoints); got != 2 {
+		t.Errorf("want 2 savepoints, got %d", got)
+	}
+	if i := tx.findSavepoint("a"); i != 0 {
+		t.Errorf("want savepoint a at 0, got %d", i)
+	}
+}
+
+func TestCommitResponse(t *testing.T) {
+	c := &conn{}
+	if _, err := c.CommitTimestamp(); err == nil {
+		t.Error("CommitTimestamp without commit: expected error")
+	}
+	if _, err := c.CommitResponse(); err == nil {
+		t.Error("CommitResponse without commit: expected error")
+	}
+
+	ts := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tx := &rwTx{close: func(resp *spanner.CommitResponse, err error) { c.commitResp = resp }}
+	tx.close(&spanner.CommitResponse{CommitTs: ts}, nil)
+	if got, err := c.CommitTimestamp(); err != nil || !got.Equal(ts) {
+		t.Errorf("want %v, got %v, %v", ts, got, err)
+	}
+}
+
+func TestTransactionTimeout(t *testing.T) {
+	ctx := WithReadWriteTransactionOptions(context.Background(), ReadWriteTransactionOptions{Timeout: time.Second})
+	if got := transactionTimeout(ctx, time.Minute); got != time.Second {
+		t.Errorf("with context options: want %v, got %v", time.Second, got)
+	}
+	if got := transactionTimeout(context.Background(), time.Minute); got != time.Minute {
+		t.Errorf("without context options: want %v, got %v", time.Minute, got)
+	}
+
+	// The transaction ends on its own when its context expires.
+	connector := &internal.RWConnector{
+		ExecIn:  make(chan *internal.RWExecMessage),
+		ExecOut: make(chan *internal.RWExecMessage),
+		Errors:  make(chan error, 1),
+	}
+	connector.Errors <- context.DeadlineExceeded
+	closed := false
+	tx := &rwTx{connector: connector, close: func(*spanner.CommitResponse, error) { closed = true }}
+	if _, err := tx.ExecContext(ctx, spanner.NewStatement("UPDATE T SET V = 1 WHERE TRUE")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want deadline exceeded, got %v", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("commit: want deadline exceeded, got %v", err)
+	}
+	if !closed {
+		t.Error("timed out transaction was not closed")
+	}
+}
+
+func TestTransactionState(t *testing.T) {
+	c := &conn{}
+	if c.InTransaction() || c.InReadOnlyTransaction() {
+		t.Error("new connection: unexpectedly in transaction")
+	}
+	if _, err := c.ReadTimestamp(); err == nil {
+		t.Error("ReadTimestamp outside of transaction: expected error")
+	}
+	if c.TransactionRetried() {
+		t.Error("new connection: unexpectedly retried")
+	}
+
+	c.rwTx = &rwTx{}
+	if !c.InTransaction() || c.InReadOnlyTransaction() {
+		t.Error("read-write transaction: want in read-write transaction")
+	}
+	if _, err := c.ReadTimestamp(); err == nil {
+		t.Error("ReadTimestamp in read-write transaction: expected error")
+	}
+}
+
+func TestRawTransaction(t *testing.T) {
+	db := openFakeSpanner(t, &fakeSpanner{query: func(req *sppb.ExecuteSqlRequest, stream sppb.Spanner_ExecuteStreamingSqlServer) error {
+		var tx *sppb.Transaction
+		if req.GetTransaction().GetBegin() != nil {
+			tx = &sppb.Transaction{Id: []byte("tx")}
+		}
+		return stream.Send(&sppb.PartialResultSet{
+			Metadata: &sppb.ResultSetMetadata{
+				RowType: &sppb.StructType{Fields: []*sppb.StructType_Field{
+					{Name: "Id", Type: &sppb.Type{Code: sppb.TypeCode_INT64}},
+				}},
+				Transaction: tx,
+			},
+			Values: []*structpb.Value{stringValue("1")},
+		})
+	}})
+	ctx := context.Background()
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	raw := func(f func(SpannerConn) error) error {
+		return c.Raw(func(driverConn any) error { return f(driverConn.(SpannerConn)) })
+	}
+
+	raw(func(sc SpannerConn) error {
+		if sc.Client() == nil || sc.ReadWriteTransaction() != nil || sc.ReadOnlyTransaction() != nil {
+			t.Error("outside of a transaction: want a client and no transactions")
+		}
+		return nil
+	})
+	tx, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = raw(func(sc SpannerConn) error {
+		rwTx := sc.ReadWriteTransaction()
+		if rwTx == nil {
+			return errors.New("no read-write transaction")
+		}
+		var id int64
+		return rwTx.Query(ctx, spanner.NewStatement("SELECT Id FROM Singers")).Do(func(r *spanner.Row) error {
+			return r.Column(0, &id)
+		})
+	})
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err = c.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	raw(func(sc SpannerConn) error {
+		if sc.ReadOnlyTransaction() == nil || sc.ReadWriteTransaction() != nil {
+			t.Error("in a read-only transaction: want only a read-only transaction")
+		}
+		return nil
+	})
+}
+
+func TestTransactionRetryHook(t *testing.T) {
+	var got []TransactionRetry
+	c := &conn{onRetry: func(r TransactionRetry) { got = append(got, r) }}
+
+	c.transactionFinished(1, nil)
+	if c.TransactionRetried() || len(got) != 0 {
+		t.Errorf("first attempt: want no retry, got %v", got)
+	}
+	c.transactionFinished(3, nil)
+	if !c.TransactionRetried() {
+		t.Error("third attempt: want retried")
+	}
+	if want := []TransactionRetry{{Attempts: 3}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+type fakeTx struct {
+	committed  bool
+	rolledBack bool
+	err        error // returned by Commit and Rollback
+}
+
+func (tx *fakeTx) Commit() error   { tx.committed = true; return tx.err }
+func (tx *fakeTx) Rollback() error { tx.rolledBack = true; return tx.err }
+
+func TestDDLInTransaction(t *testing.T) {
+	ctx := context.Background()
+	c := &conn{rwTx: &rwTx{}}
+	if _, err := c.exec(ctx, "CREATE TABLE T (Id INT64) PRIMARY KEY (Id)", nil); err != ErrDDLInTransaction {
+		t.Errorf("want ErrDDLInTransaction, got %v", err)
+	}
+
+	// A transaction started with BEGIN is committed before the DDL.
+	stmtTx := &fakeTx{}
+	c = &conn{rwTx: &rwTx{}, stmtTx: stmtTx, autocommitDDL: true}
+	if err := c.endTransactionForDDL(); err != nil {
+		t.Fatal(err)
+	}
+	if !stmtTx.committed || c.stmtTx != nil {
+		t.Error("transaction started with BEGIN was not committed")
+	}
+
+	// Transactions committed before DDL are no longer ended by database/sql.
+	tx := &rwTx{done: true}
+	if err := tx.Commit(); err != nil {
+		t.Errorf("commit after DDL: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Errorf("rollback after DDL: %v", err)
+	}
+}
+
+func TestResetSession(t *testing.T) {
+	stmtTx := &fakeTx{}
+	c := &conn{
+		stmtTx:                   stmtTx,
+		ddlBatch:                 &ddlBatch{},
+		readOnlyStaleness:        staleness{spec: "EXACT_STALENESS 10s"},
+		defaultReadOnlyStaleness: strongStaleness,
+	}
+	if err := c.ResetSession(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !stmtTx.rolledBack || c.stmtTx != nil {
+		t.Error("transaction started with BEGIN was not rolled back")
+	}
+	if c.ddlBatch != nil {
+		t.Error("DDL batch was not discarded")
+	}
+	if c.readOnlyStaleness.spec != "STRONG" {
+		t.Errorf("read-only staleness is %q, want %q", c.readOnlyStaleness.spec, "STRONG")
+	}
+
+	// A read-write transaction that was left open is rolled back.
+	closed := false
+	tx := &rwTx{err: internal.ErrAborted}
+	tx.close = func(*spanner.CommitResponse, error) {
+		closed = true
+		c.rwTx = nil
+	}
+	c.rwTx = tx
+	if err := c.ResetSession(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !closed || c.rwTx != nil {
+		t.Error("dangling read-write transaction was not rolled back")
+	}
+
+	// The connection is discarded if the transaction can't be ended.
+	c.rwTx = &rwTx{err: internal.ErrAborted, close: func(*spanner.CommitResponse, error) {}}
+	if err := c.ResetSession(context.Background()); err != driver.ErrBadConn {
+		t.Errorf("ResetSession with a transaction that doesn't end: got %v, want %v", err, driver.ErrBadConn)
+	}
+}
+
+func TestReplayConcurrentModification(t *testing.T) {
+	var updates int64
+	db := openFakeSpanner(t, &fakeSpanner{update: func(req *sppb.ExecuteSqlRequest) (*sppb.ResultSet, error) {
+		var tx *sppb.Transaction
+		if req.GetTransaction().GetBegin() != nil {
+			tx = &sppb.Transaction{Id: []byte("tx")}
+		}
+		// The replay of the first statement updates another row.
+		updates++
+		n := int64(1)
+		if updates > 2 {
+			n = 2
+		}
+		return &sppb.ResultSet{
+			Metadata: &sppb.ResultSetMetadata{Transaction: tx},
+			Stats:    &sppb.ResultSetStats{RowCount: &sppb.ResultSetStats_RowCountExact{RowCountExact: n}},
+		}, nil
+	}})
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for _, stmt := range []string{
+		"UPDATE Singers SET Active = TRUE WHERE LastName = 'Smith'",
+		"SAVEPOINT s",
+		"UPDATE Singers SET Active = FALSE WHERE LastName = 'Jones'",
+	} {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("%s: %v", stmt, err)
+		}
+	}
+	_, err = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT s")
+	if !errors.Is(err, ErrAbortedDueToConcurrentModification) || !errors.Is(err, ErrAborted) {
+		t.Errorf("want ErrAbortedDueToConcurrentModification, got %v", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, ErrAbortedDueToConcurrentModification) {
+		t.Errorf("commit: want ErrAbortedDueToConcurrentModification, got %v", err)
+	}
+}
+
+func TestCommitWithActiveBatch(t *testing.T) {
+	db := openFakeSpanner(t, &fakeSpanner{})
+	db.SetMaxOpenConns(1)
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ExecContext(ctx, "START BATCH DML"); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err == nil {
+		t.Error("committed a transaction with an active DML batch")
+	}
+
+	// The connection is reused after the failed commit.
+	tx, err = db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin after failed commit: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTransactionRetryOutcome(t *testing.T) {
+	// Every other commit is aborted, starting with the first.
+	var mu sync.Mutex
+	commits := 0
+	s := &fakeSpanner{
+		update: func(req *sppb.ExecuteSqlRequest) (*sppb.ResultSet, error) {
+			var tx *sppb.Transaction
+			if req.GetTransaction().GetBegin() != nil {
+				tx = &sppb.Transaction{Id: []byte("tx")}
+			}
+			return &sppb.ResultSet{
+				Metadata: &sppb.ResultSetMetadata{Transaction: tx},
+				Stats:    &sppb.ResultSetStats{RowCount: &sppb.ResultSetStats_RowCountExact{RowCountExact: 1}},
+			}, nil
+		},
+		commit: func(req *sppb.CommitRequest) (*sppb.CommitResponse, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if commits++; commits%2 == 1 {
+				return nil, status.Error(codes.Aborted, "Transaction was aborted")
+			}
+			return &sppb.CommitResponse{CommitTimestamp: timestamppb.Now()}, nil
+		},
+	}
+	ctx := context.Background()
+	var got []TransactionRetry
+	db := openFakeSpannerWithDriver(t, s, &Driver{OnTransactionRetry: func(r TransactionRetry) { got = append(got, r) }})
+
+	// The implicit transaction of a DML statement is retried and commits.
+	if _, err := db.ExecContext(ctx, "UPDATE Singers SET Active = TRUE WHERE SingerId = 1"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []TransactionRetry{{Attempts: 2}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("retry that committed: want %v, got %v", want, got)
+	}
+
+	// So is the implicit transaction of several DML statements.
+	s.batchUpdate = func(req *sppb.ExecuteBatchDmlRequest) (*sppb.ExecuteBatchDmlResponse, error) {
+		resp := &sppb.ExecuteBatchDmlResponse{Status: &spb.Status{}}
+		for i := range req.Statements {
+			rs := &sppb.ResultSet{
+				Metadata: &sppb.ResultSetMetadata{},
+				Stats:    &sppb.ResultSetStats{RowCount: &sppb.ResultSetStats_RowCountExact{RowCountExact: 1}},
+			}
+			if i == 0 && req.GetTransaction().GetBegin() != nil {
+				rs.Metadata.Transaction = &sppb.Transaction{Id: []byte("tx")}
+			}
+			resp.ResultSets = append(resp.ResultSets, rs)
+		}
+		return resp, nil
+	}
+	got = nil
+	if _, err := db.ExecContext(ctx, "UPDATE Singers SET Active = TRUE WHERE SingerId = 1; UPDATE Singers SET Active = TRUE WHERE SingerId = 2"); err != nil {
+		t.Fatal(err)
+	}
+	if want := []TransactionRetry{{Attempts: 2}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("batch retry that committed: want %v, got %v", want, got)
+	}
+
+	// Transactions started with BeginTx fail instead, without a retry.
+	got = nil
+	c, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	tx, err := c.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE Singers SET Active = TRUE WHERE SingerId = 1"); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	commitErr := tx.Commit()
+	if commitErr == nil {
+		t.Fatal("commit of an aborted transaction succeeded")
+	}
+	if len(got) != 0 {
+		t.Errorf("transaction that failed with %v was reported as retried: %v", commitErr, got)
+	}
+	c.Raw(func(driverConn any) error {
+		if driverConn.(SpannerConn).TransactionRetried() {
+			t.Error("transaction started with BeginTx was reported as retried")
+		}
+		return nil
+	})
+	if !errors.Is(commitErr, ErrAborted) || Code(commitErr) != codes.Aborted {
+		t.Errorf("commit of an aborted transaction: got %v with code %v, want an Aborted error", commitErr, Code(commitErr))
+	}
+}
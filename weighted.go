@@ -0,0 +1,163 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync/atomic"
+)
+
+// WeightedTarget is a database that receives a share of the
+// new connections of a WeightedConnector.
+type WeightedTarget struct {
+	// DSN is the data source name of the database,
+	// see Driver.Open for the format.
+	DSN string
+
+	// Weight is the relative share of new connections
+	// that are routed to this database.
+	Weight int
+}
+
+// TargetStats contains the connection counters of a WeightedTarget.
+type TargetStats struct {
+	DSN    string
+	Weight int
+
+	// ConnectionsOpened is the number of connections that were
+	// opened to the target.
+	ConnectionsOpened int64
+
+	// ConnectErrors is the number of connection attempts that failed.
+	ConnectErrors int64
+
+	// OpenConnections is the number of connections to the target
+	// that are currently open.
+	OpenConnections int64
+}
+
+// WeightedConnector is a driver.Connector that routes new connections
+// to one of several databases at random, proportionally to their weights.
+// It can be used to send a small percentage of traffic to a canary
+// database during schema or data migrations:
+//
+//	c, err := spannerdriver.NewWeightedConnector(&spannerdriver.Driver{},
+//		spannerdriver.WeightedTarget{DSN: primary, Weight: 95},
+//		spannerdriver.WeightedTarget{DSN: canary, Weight: 5},
+//	)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	db := sql.OpenDB(c)
+//
+// As transactions are bound to a connection, all statements of a
+// transaction are executed on the same database. Use db.SetConnMaxLifetime
+// to make sure long-lived connections are rebalanced over time.
+type WeightedConnector struct {
+	driver  *Driver
+	targets []*weightedTarget
+	total   int
+
+	// intn returns a random number in [0, n).
+	intn func(n int) int
+}
+
+type weightedTarget struct {
+	WeightedTarget
+	connector *connector
+
+	opened  int64
+	errors  int64
+	current int64
+}
+
+// NewWeightedConnector returns a connector that distributes new connections
+// over the given targets. At least one target must have a positive weight.
+func NewWeightedConnector(d *Driver, targets ...WeightedTarget) (*WeightedConnector, error) {
+	wc := &WeightedConnector{driver: d, intn: rand.Intn}
+	for _, t := range targets {
+		if t.Weight < 0 {
+			return nil, fmt.Errorf("negative weight %d for %q", t.Weight, t.DSN)
+		}
+		c, err := d.OpenConnector(t.DSN)
+		if err != nil {
+			return nil, err
+		}
+		wc.targets = append(wc.targets, &weightedTarget{WeightedTarget: t, connector: c.(*connector)})
+		wc.total += t.Weight
+	}
+	if wc.total == 0 {
+		return nil, errors.New("at least one target must have a positive weight")
+	}
+	return wc, nil
+}
+
+func (wc *WeightedConnector) pick() *weightedTarget {
+	n := wc.intn(wc.total)
+	for _, t := range wc.targets {
+		if n < t.Weight {
+			return t
+		}
+		n -= t.Weight
+	}
+	panic("unreachable")
+}
+
+func (wc *WeightedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	t := wc.pick()
+	c, err := t.connector.Connect(ctx)
+	if err != nil {
+		atomic.AddInt64(&t.errors, 1)
+		return nil, err
+	}
+	atomic.AddInt64(&t.opened, 1)
+	atomic.AddInt64(&t.current, 1)
+	return &weightedConn{conn: c.(*conn), target: t}, nil
+}
+
+func (wc *WeightedConnector) Driver() driver.Driver {
+	return wc.driver
+}
+
+// Stats returns the connection counters of each target
+// in the order they were passed to NewWeightedConnector.
+func (wc *WeightedConnector) Stats() []TargetStats {
+	stats := make([]TargetStats, len(wc.targets))
+	for i, t := range wc.targets {
+		stats[i] = TargetStats{
+			DSN:               t.DSN,
+			Weight:            t.Weight,
+			ConnectionsOpened: atomic.LoadInt64(&t.opened),
+			ConnectErrors:     atomic.LoadInt64(&t.errors),
+			OpenConnections:   atomic.LoadInt64(&t.current),
+		}
+	}
+	return stats
+}
+
+// weightedConn keeps track of the open connections of a target.
+type weightedConn struct {
+	*conn
+	target *weightedTarget
+}
+
+func (c *weightedConn) Close() error {
+	atomic.AddInt64(&c.target.current, -1)
+	return c.conn.Close()
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spannerdriver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+)
+
+func TestWeightedConnectorPick(t *testing.T) {
+	wc, err := NewWeightedConnector(&Driver{},
+		WeightedTarget{DSN: "projects/p/instances/i/databases/primary", Weight: 3},
+		WeightedTarget{DSN: "projects/p/instances/i/databases/unused", Weight: 0},
+		WeightedTarget{DSN: "projects/p/instances/i/databases/canary", Weight: 1},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"primary", "primary", "primary", "canary"}
+	for n, name := range want {
+		wc.intn = func(int) int { return n }
+		if got := wc.pick().DSN; got != "projects/p/instances/i/databases/"+name {
+			t.Errorf("pick(%d): want %s, got %s", n, name, got)
+		}
+	}
+}
+
+func TestNewWeightedConnectorErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		targets []WeightedTarget
+	}{
+		{
+			name: "no targets",
+		},
+		{
+			name:    "zero weights",
+			targets: []WeightedTarget{{DSN: "projects/p/instances/i/databases/d"}},
+		},
+		{
+			name:    "negative weight",
+			targets: []WeightedTarget{{DSN: "projects/p/instances/i/databases/d", Weight: -1}},
+		},
+		{
+			name:    "invalid dsn",
+			targets: []WeightedTarget{{DSN: "d", Weight: 1}},
+		},
+	}
+
+	for _, tc := range tests {
+		if _, err := NewWeightedConnector(&Driver{}, tc.targets...); err == nil {
+			t.Errorf("%s: expected error", tc.name)
+		}
+	}
+}
+
+func TestWeightedConnectorHelpers(t *testing.T) {
+	// The fake server serves the connections of the weighted connector.
+	openFakeSpanner(t, &fakeSpanner{})
+	wc, err := NewWeightedConnector(&Driver{},
+		WeightedTarget{DSN: "projects/p/instances/i/databases/d;dialect=googlesql", Weight: 1},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := sql.OpenDB(wc)
+	defer db.Close()
+
+	err = withConn(context.Background(), db, func(c *conn) error {
+		if c.client == nil {
+			return errors.New("connection without client")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("helpers on a weighted connector: %v", err)
+	}
+}